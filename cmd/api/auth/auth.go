@@ -0,0 +1,43 @@
+// Package auth authenticates the services calling the PaymentService gRPC API
+// and checks they may make the RPC they call. Callers identify themselves with
+// a JWT bearer token signed by a key of a local JWKS file or, on TLS
+// connections, with a verified client certificate.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+const (
+	MethodJWT  = "jwt"
+	MethodMTLS = "mtls"
+)
+
+var (
+	ErrUnauthenticated  = errors.New("caller is not authenticated")
+	ErrPermissionDenied = errors.New("caller may not call this RPC")
+)
+
+// Identity is the authenticated caller of an RPC
+type Identity struct {
+	Subject string // Service name of the caller, the token subject or the certificate name
+	Method  string // How the caller authenticated, MethodJWT or MethodMTLS
+}
+
+func (i Identity) String() string {
+	return i.Subject + " (" + i.Method + ")"
+}
+
+type identityKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity of the caller
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, identity)
+}
+
+// FromContext returns the identity of the caller the interceptors stored in ctx
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(identityKey{}).(Identity)
+	return identity, ok
+}
@@ -0,0 +1,321 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// ClockSkew is the leeway given to the time claims of a token
+var ClockSkew = 30 * time.Second
+
+var signingMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// Authenticator authenticates and authorizes every RPC of a gRPC server
+type Authenticator struct {
+	// Keys verify bearer tokens, bearer tokens are rejected when nil
+	Keys *KeySet
+	// Required iss and aud claims of bearer tokens, not checked when empty
+	Issuer   string
+	Audience string
+	// Accept verified client certificates of TLS connections as identity
+	AllowMTLS bool
+	Policy    Policy
+	// Public lists gRPC services, such as grpc.health.v1.Health, that take
+	// calls without credentials
+	Public []string
+	// Clock and logger, time.Now and the standard logger when nil
+	Now    func() time.Time
+	Logger *log.Logger
+}
+
+// NewAuthenticator builds the authenticator described by cfg. It is nil when
+// authentication is disabled or, outside production, no JWKS file is set and
+// client certificates are not verified. Verified client certificates are
+// accepted as identity whenever tls_client_auth is not none.
+func NewAuthenticator(cfg *config.Config) (*Authenticator, error) {
+
+	if cfg.AuthDisabled {
+		return nil, nil
+	}
+
+	mtls := cfg.TLSClientAuth != "" && cfg.TLSClientAuth != config.ClientAuthNone
+
+	if cfg.AuthJWKSFile == "" && !mtls {
+		if cfg.Env == config.EnvProduction {
+			return nil, errors.New("auth_jwks_file or tls_client_auth is required in production, set AUTH_JWKS_FILE, TLS_CLIENT_AUTH or auth_disabled")
+		}
+
+		return nil, nil
+	}
+
+	a := &Authenticator{
+		Issuer:    cfg.AuthIssuer,
+		Audience:  cfg.AuthAudience,
+		AllowMTLS: mtls,
+		Policy:    DefaultPolicy(),
+		Public:    []string{healthpb.Health_ServiceDesc.ServiceName},
+	}
+
+	if cfg.AuthJWKSFile != "" {
+		keys, err := LoadKeySet(cfg.AuthJWKSFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		a.Keys = keys
+	}
+
+	if cfg.AuthPolicyFile != "" {
+		policy, err := LoadPolicy(cfg.AuthPolicyFile)
+
+		if err != nil {
+			return nil, err
+		}
+
+		a.Policy = policy
+	}
+
+	return a, nil
+}
+
+// UnaryServerInterceptor rejects unauthenticated and unauthorized calls, the
+// identity of the caller is passed to the handler in its context and added to
+// its logger. It goes after the logging interceptor.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		ctx, err := a.authorize(ctx, info.FullMethod)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context {
+	return s.ctx
+}
+
+func (a *Authenticator) authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+
+	if a.isPublic(fullMethod) {
+		return ctx, nil
+	}
+
+	logger := logging.FromContextOr(ctx, a.logger()).WithField("rpc", fullMethod)
+
+	identity, err := a.Authenticate(ctx)
+
+	if err != nil {
+		logger.Warn("Rejected unauthenticated call: ", err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	fields := log.Fields{"caller": identity.Subject, "auth_method": identity.Method}
+
+	logger = logger.WithFields(fields)
+
+	if !a.Policy.Allowed(fullMethod, identity.Subject) {
+		logger.Warn("Rejected unauthorized call")
+		return nil, status.Errorf(codes.PermissionDenied, "%v: %s may not call %s", ErrPermissionDenied, identity.Subject, fullMethod)
+	}
+
+	logger.Info("Authorized call")
+
+	// Every entry of the call names the caller, not only the one above
+
+	return NewContext(logging.WithFields(ctx, fields), identity), nil
+}
+
+// isPublic reports whether the service of fullMethod, such as
+// /grpc.health.v1.Health/Check, is public
+func (a *Authenticator) isPublic(fullMethod string) bool {
+
+	service := strings.TrimPrefix(fullMethod[:max(strings.LastIndex(fullMethod, "/"), 0)], "/")
+
+	return slices.Contains(a.Public, service)
+}
+
+// Authenticate returns the identity of the caller. A bearer token, when sent,
+// has to be valid, otherwise a verified client certificate is used if allowed.
+func (a *Authenticator) Authenticate(ctx context.Context) (Identity, error) {
+
+	token, err := bearerToken(ctx)
+
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if token != "" {
+		return a.verifyToken(token)
+	}
+
+	if a.AllowMTLS {
+		if identity, ok := certificateIdentity(ctx); ok {
+			return identity, nil
+		}
+	}
+
+	return Identity{}, fmt.Errorf("%w: no bearer token or client certificate", ErrUnauthenticated)
+}
+
+func bearerToken(ctx context.Context) (string, error) {
+
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	values := md.Get("authorization")
+
+	if len(values) == 0 {
+		return "", nil
+	}
+
+	if len(values) > 1 {
+		return "", fmt.Errorf("%w: more than one authorization header", ErrUnauthenticated)
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+
+	if !ok || !strings.EqualFold(scheme, "Bearer") || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("%w: authorization header is not a bearer token", ErrUnauthenticated)
+	}
+
+	return strings.TrimSpace(token), nil
+}
+
+func (a *Authenticator) verifyToken(raw string) (Identity, error) {
+
+	if a.Keys == nil {
+		return Identity{}, fmt.Errorf("%w: bearer tokens are not accepted", ErrUnauthenticated)
+	}
+
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(signingMethods),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(ClockSkew),
+		jwt.WithTimeFunc(a.now),
+	}
+
+	if a.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(a.Issuer))
+	}
+
+	if a.Audience != "" {
+		opts = append(opts, jwt.WithAudience(a.Audience))
+	}
+
+	var claims jwt.RegisteredClaims
+
+	_, err := jwt.ParseWithClaims(raw, &claims, func(token *jwt.Token) (interface{}, error) {
+
+		kid, _ := token.Header["kid"].(string)
+
+		key, ok := a.Keys.Key(kid)
+
+		if !ok {
+			return nil, fmt.Errorf("unknown key %q", kid)
+		}
+
+		return key, nil
+	}, opts...)
+
+	if err != nil {
+		return Identity{}, fmt.Errorf("%w: invalid bearer token: %w", ErrUnauthenticated, err)
+	}
+
+	if claims.Subject == "" {
+		return Identity{}, fmt.Errorf("%w: bearer token has no subject", ErrUnauthenticated)
+	}
+
+	return Identity{Subject: claims.Subject, Method: MethodJWT}, nil
+}
+
+// certificateIdentity names the caller after the verified client certificate,
+// the first URI SAN such as a SPIFFE ID or else the common name
+func certificateIdentity(ctx context.Context) (Identity, bool) {
+
+	p, ok := peer.FromContext(ctx)
+
+	if !ok {
+		return Identity{}, false
+	}
+
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+
+	if !ok || len(info.State.VerifiedChains) == 0 || len(info.State.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+
+	subject := certificateSubject(info.State.VerifiedChains[0][0])
+
+	if subject == "" {
+		return Identity{}, false
+	}
+
+	return Identity{Subject: subject, Method: MethodMTLS}, true
+}
+
+func certificateSubject(cert *x509.Certificate) string {
+
+	if len(cert.URIs) > 0 {
+		return cert.URIs[0].String()
+	}
+
+	return cert.Subject.CommonName
+}
+
+func (a *Authenticator) now() time.Time {
+
+	if a.Now == nil {
+		return time.Now()
+	}
+
+	return a.Now()
+}
+
+func (a *Authenticator) logger() *log.Logger {
+
+	if a.Logger == nil {
+		return log.StandardLogger()
+	}
+
+	return a.Logger
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// BookingGateway is the subject of the booking gateway service
+const BookingGateway = "booking-gateway"
+
+// AnyCaller in the callers of a rule allows every authenticated caller
+const AnyCaller = "*"
+
+// Policy lists, by RPC name such as CommitOrderIds, the callers allowed to
+// make the RPC. RPCs without a rule are open to every authenticated caller.
+type Policy map[string][]string
+
+// DefaultPolicy limits the RPCs that change a booking session after the fact
+// to the booking gateway
+func DefaultPolicy() Policy {
+	return Policy{
+		"CommitIdempotentKey": {BookingGateway},
+		"CommitCustomerID":    {BookingGateway},
+		"CommitOrderIds":      {BookingGateway},
+		"RefundPayment":       {BookingGateway},
+	}
+}
+
+// LoadPolicy reads a YAML file mapping RPC names to the callers allowed to make
+// them, the rules replace the default policy
+func LoadPolicy(path string) (Policy, error) {
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read auth policy file: %w", err)
+	}
+
+	var policy Policy
+
+	if err := yaml.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("failed to parse auth policy file %s: %w", path, err)
+	}
+
+	for method, callers := range policy {
+		if strings.Contains(method, "/") {
+			return nil, fmt.Errorf("auth policy file %s: %q must be an RPC name without the service", path, method)
+		}
+
+		if len(callers) == 0 {
+			return nil, fmt.Errorf("auth policy file %s: %s allows no caller", path, method)
+		}
+	}
+
+	return policy, nil
+}
+
+// Allowed reports whether the caller may make the RPC, fullMethod is the gRPC
+// method such as /payment_service.PaymentService/CommitOrderIds
+func (p Policy) Allowed(fullMethod string, subject string) bool {
+
+	name := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+
+	callers, ok := p[name]
+
+	if !ok {
+		return true
+	}
+
+	return slices.Contains(callers, AnyCaller) || slices.Contains(callers, subject)
+}
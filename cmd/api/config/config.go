@@ -0,0 +1,572 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	EnvDevelopment = "development"
+	EnvTest        = "test"
+	EnvProduction  = "production"
+)
+
+// Client certificate verification of the gRPC server, see tls_client_auth
+const (
+	ClientAuthNone     = "none"
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// Log output formats, see log_format
+const (
+	LogFormatJSON = "json"
+	LogFormatText = "text"
+)
+
+// Where spans are exported, see tracing_exporter
+const (
+	TracingNone   = "none"
+	TracingOTLP   = "otlp"
+	TracingStdout = "stdout"
+)
+
+// Config is the configuration of the payment service. Every field is read from,
+// lowest precedence first, its default, the YAML file given with -config or
+// CONFIG_FILE, the environment and the command line.
+//
+// The key tag is the YAML key, the flag is the key with dashes instead of
+// underscores. The env tag lists environment variables, the first one set wins.
+// Secrets cannot be given as flags, they would show up in the process list.
+type Config struct {
+	Env         string `key:"env" env:"ENV" usage:"Environment: development, test or production, payments go to the Dodo test API outside production"`
+	GRPCAddr    string `key:"grpc_addr" env:"GRPC_ADDR" usage:"Address the gRPC server listens on"`
+	HTTPAddr    string `key:"http_addr" env:"HTTP_ADDR" usage:"Address the webhook and payment return HTTP server listens on"`
+	MovieDBAddr string `key:"moviedb_addr" env:"MOVIEDB_ADDR" usage:"Address of the movie DB service"`
+	MetricsAddr string `key:"metrics_addr" env:"METRICS_ADDR" usage:"Address the Prometheus metrics endpoint listens on, disabled when empty"`
+
+	LogFormat string `key:"log_format" env:"LOG_FORMAT" usage:"Log output format: json or text"`
+	LogLevel  string `key:"log_level" env:"LOG_LEVEL" usage:"Least severe level logged: debug, info, warn or error"`
+
+	DatabaseURL       Secret `key:"database_url" env:"DB_URL,DB_URL_TEST" usage:"Postgres connection URL"`
+	DodoToken         Secret `key:"dodo_token" env:"DODOPAYMENT_TOKEN" usage:"Dodo Payments API key"`
+	DodoWebhookSecret Secret `key:"dodo_webhook_secret" env:"DODOPAYMENT_WEBHOOK_SECRET" usage:"Dodo Payments webhook signing secret"`
+
+	PlatformFeeBasisPoints int64  `key:"platform_fee_bps" env:"PLATFORM_FEE_BPS" usage:"Share of every payment net of tax kept as platform fee, in basis points"`
+	PriceCurrency          string `key:"price_currency" env:"PRICE_CURRENCY" usage:"ISO 4217 currency the movie DB service quotes seat prices in"`
+	FXRatesFile            string `key:"fx_rates_file" env:"FX_RATES_FILE" usage:"JSON file with static exchange rates"`
+
+	PaymentSuccessURL string `key:"payment_success_url" env:"PAYMENT_SUCCESS_URL" usage:"Default URL customers are sent to after paying"`
+	PaymentCancelURL  string `key:"payment_cancel_url" env:"PAYMENT_CANCEL_URL" usage:"Default URL customers are sent to when a payment is not completed"`
+	PublicBaseURL     string `key:"public_base_url" env:"PUBLIC_BASE_URL" usage:"Public address of the HTTP server"`
+	RedirectHosts     string `key:"redirect_hosts" env:"REDIRECT_HOSTS" usage:"Comma separated hosts customers may be sent to after checkout, the hosts of payment_success_url and payment_cancel_url are always allowed"`
+
+	MovieDBTimeout         time.Duration `key:"moviedb_timeout" env:"MOVIEDB_TIMEOUT" usage:"How long a single call to the movie DB service may take, retries included"`
+	MovieDBRetryAttempts   int           `key:"moviedb_retry_attempts" env:"MOVIEDB_RETRY_ATTEMPTS" usage:"How often a movie DB call that changes nothing, such as the seat check, is tried"`
+	MovieDBAttemptTimeout  time.Duration `key:"moviedb_attempt_timeout" env:"MOVIEDB_ATTEMPT_TIMEOUT" usage:"How long one attempt of a retried movie DB call may take"`
+	MovieDBRetryBudget     time.Duration `key:"moviedb_retry_budget" env:"MOVIEDB_RETRY_BUDGET" usage:"How long all attempts of a retried movie DB call and the waits between them may take"`
+	MovieDBRetryBackoff    time.Duration `key:"moviedb_retry_backoff" env:"MOVIEDB_RETRY_BACKOFF" usage:"Wait after the first failed attempt of a retried movie DB call, doubled after every further one"`
+	MovieDBRetryMaxBackoff time.Duration `key:"moviedb_retry_max_backoff" env:"MOVIEDB_RETRY_MAX_BACKOFF" usage:"Longest wait between attempts of a retried movie DB call"`
+	PaymentProviderTimeout time.Duration `key:"payment_provider_timeout" env:"PAYMENT_PROVIDER_TIMEOUT" usage:"How long a single call to Dodo Payments may take"`
+
+	MovieDBBreakerFailures int           `key:"moviedb_breaker_failures" env:"MOVIEDB_BREAKER_FAILURES" usage:"Failed movie DB calls in a row after which calls fail fast"`
+	MovieDBBreakerCooldown time.Duration `key:"moviedb_breaker_cooldown" env:"MOVIEDB_BREAKER_COOLDOWN" usage:"How long movie DB calls fail fast before one is tried again"`
+
+	SessionSweepInterval  time.Duration `key:"session_sweep_interval" env:"SESSION_SWEEP_INTERVAL" usage:"How often expired payment sessions are swept"`
+	SessionSweepBatchSize int           `key:"session_sweep_batch_size" env:"SESSION_SWEEP_BATCH_SIZE" usage:"How many expired payment sessions are swept per batch"`
+
+	AuthJWKSFile   string `key:"auth_jwks_file" env:"AUTH_JWKS_FILE" usage:"JWKS file with the keys that sign the bearer tokens of calling services"`
+	AuthIssuer     string `key:"auth_issuer" env:"AUTH_ISSUER" usage:"Required issuer of bearer tokens"`
+	AuthAudience   string `key:"auth_audience" env:"AUTH_AUDIENCE" usage:"Required audience of bearer tokens"`
+	AuthPolicyFile string `key:"auth_policy_file" env:"AUTH_POLICY_FILE" usage:"YAML file mapping RPC names to the services allowed to call them"`
+	AuthDisabled   bool   `key:"auth_disabled" env:"AUTH_DISABLED" usage:"Accept calls from unauthenticated callers, never use in production"`
+
+	TLSCertFile       string        `key:"tls_cert_file" env:"TLS_CERT_FILE" usage:"PEM certificate of the gRPC server, the server runs in plaintext when empty"`
+	TLSKeyFile        string        `key:"tls_key_file" env:"TLS_KEY_FILE" usage:"PEM private key of the gRPC server certificate"`
+	TLSClientCAFile   string        `key:"tls_client_ca_file" env:"TLS_CLIENT_CA_FILE" usage:"PEM CA bundle client certificates are verified against"`
+	TLSClientAuth     string        `key:"tls_client_auth" env:"TLS_CLIENT_AUTH" usage:"Client certificate verification: none, optional or require"`
+	TLSReloadInterval time.Duration `key:"tls_reload_interval" env:"TLS_RELOAD_INTERVAL" usage:"How often certificate, key and CA files are checked for changes"`
+
+	GRPCReflection      bool          `key:"grpc_reflection" env:"GRPC_REFLECTION" usage:"Register gRPC server reflection, lets tools such as grpcurl list the API"`
+	HealthCheckInterval time.Duration `key:"health_check_interval" env:"HEALTH_CHECK_INTERVAL" usage:"How often the database, the movie DB service and the payment gateway are checked for readiness"`
+	DrainDelay          time.Duration `key:"drain_delay" env:"DRAIN_DELAY" usage:"How long health reports NOT_SERVING on shutdown before the server stops taking calls"`
+
+	MovieDBTLS        bool   `key:"moviedb_tls" env:"MOVIEDB_TLS" usage:"Connect to the movie DB service over TLS"`
+	MovieDBCAFile     string `key:"moviedb_ca_file" env:"MOVIEDB_CA_FILE" usage:"PEM CA bundle the movie DB certificate is verified against, the system roots when empty"`
+	MovieDBCertFile   string `key:"moviedb_cert_file" env:"MOVIEDB_CERT_FILE" usage:"PEM client certificate presented to the movie DB service"`
+	MovieDBKeyFile    string `key:"moviedb_key_file" env:"MOVIEDB_KEY_FILE" usage:"PEM private key of the movie DB client certificate"`
+	MovieDBServerName string `key:"moviedb_server_name" env:"MOVIEDB_SERVER_NAME" usage:"Name the movie DB certificate is verified for, the host of moviedb_addr when empty"`
+
+	TracingExporter  string  `key:"tracing_exporter" env:"TRACING_EXPORTER" usage:"Where spans are exported: none, otlp or stdout"`
+	OTLPEndpoint     string  `key:"otlp_endpoint" env:"OTLP_ENDPOINT" usage:"host:port of the OTLP gRPC collector spans are exported to"`
+	OTLPInsecure     bool    `key:"otlp_insecure" env:"OTLP_INSECURE" usage:"Export spans to the OTLP collector in plaintext"`
+	TraceSampleRatio float64 `key:"trace_sample_ratio" env:"TRACE_SAMPLE_RATIO" usage:"Share of new traces that are recorded, calls that arrive sampled are always recorded"`
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Env:                    EnvProduction,
+		GRPCAddr:               ":1104",
+		HTTPAddr:               ":1105",
+		MovieDBAddr:            ":1102",
+		MetricsAddr:            ":1106",
+		LogFormat:              LogFormatJSON,
+		LogLevel:               "info",
+		PriceCurrency:          money.INR,
+		MovieDBTimeout:         10 * time.Second,
+		MovieDBRetryAttempts:   3,
+		MovieDBAttemptTimeout:  2 * time.Second,
+		MovieDBRetryBudget:     5 * time.Second,
+		MovieDBRetryBackoff:    100 * time.Millisecond,
+		MovieDBRetryMaxBackoff: time.Second,
+		PaymentProviderTimeout: 10 * time.Second,
+		MovieDBBreakerFailures: 5,
+		MovieDBBreakerCooldown: 30 * time.Second,
+		SessionSweepInterval:   time.Minute,
+		SessionSweepBatchSize:  100,
+		TLSClientAuth:          ClientAuthNone,
+		TLSReloadInterval:      30 * time.Second,
+		HealthCheckInterval:    10 * time.Second,
+		DrainDelay:             5 * time.Second,
+		TracingExporter:        TracingNone,
+		OTLPEndpoint:           "localhost:4317",
+		TraceSampleRatio:       1,
+	}
+}
+
+// DodoTestMode reports whether payments go to the Dodo Payments test API
+func (c *Config) DodoTestMode() bool {
+	return c.Env != EnvProduction
+}
+
+// AllowedRedirectHosts lists the hosts customers may be sent to after checkout,
+// redirect_hosts and the hosts of the default success and cancel URLs
+func (c *Config) AllowedRedirectHosts() []string {
+
+	var hosts []string
+
+	for _, host := range strings.Split(c.RedirectHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" {
+			hosts = append(hosts, host)
+		}
+	}
+
+	for _, raw := range []string{c.PaymentSuccessURL, c.PaymentCancelURL} {
+		if u, err := url.Parse(raw); err == nil && u.Hostname() != "" {
+			hosts = append(hosts, strings.ToLower(u.Hostname()))
+		}
+	}
+
+	return hosts
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the command line arguments, args excludes the program name
+func Load(args []string) (*Config, error) {
+
+	c := Default()
+
+	fs := flag.NewFlagSet("payment_service", flag.ContinueOnError)
+
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "YAML config file")
+
+	// Bool settings are bool flags so that a bare -grpc-reflection turns them on
+
+	for _, f := range fields() {
+		switch {
+		case f.secret:
+		case f.isBool():
+			fs.Bool(f.flag(), false, f.usage)
+		default:
+			fs.String(f.flag(), "", f.usage)
+		}
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := c.loadFile(*configFile); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.loadEnv(); err != nil {
+		return nil, err
+	}
+
+	var flagErr error
+
+	fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == "config" || flagErr != nil {
+			return
+		}
+
+		for _, f := range fields() {
+			if f.flag() == fl.Name {
+				flagErr = f.set(c, fl.Value.String(), "flag -"+fl.Name)
+			}
+		}
+	})
+
+	if flagErr != nil {
+		return nil, flagErr
+	}
+
+	c.Env = strings.ToLower(c.Env)
+	c.PriceCurrency = strings.ToUpper(c.PriceCurrency)
+	c.TLSClientAuth = strings.ToLower(c.TLSClientAuth)
+	c.TracingExporter = strings.ToLower(c.TracingExporter)
+	c.LogFormat = strings.ToLower(c.LogFormat)
+	c.LogLevel = strings.ToLower(c.LogLevel)
+	c.RedirectHosts = strings.ToLower(c.RedirectHosts)
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Config) loadFile(path string) error {
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]interface{}
+
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	for key, value := range values {
+
+		f, ok := fieldByKey(key)
+
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key %q", path, key)
+		}
+
+		if value == nil {
+			continue
+		}
+
+		if err := f.set(c, fmt.Sprint(value), "config file key "+key); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (c *Config) loadEnv() error {
+
+	for _, f := range fields() {
+		for _, name := range f.env {
+			value := os.Getenv(name)
+
+			if value == "" {
+				continue
+			}
+
+			if err := f.set(c, value, "environment variable "+name); err != nil {
+				return err
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
+
+// Validate reports every invalid setting at once
+func (c *Config) Validate() error {
+
+	var errs []error
+
+	switch c.Env {
+	case EnvDevelopment, EnvTest, EnvProduction:
+	default:
+		errs = append(errs, fmt.Errorf("env must be %s, %s or %s, got %q", EnvDevelopment, EnvTest, EnvProduction, c.Env))
+	}
+
+	for name, addr := range map[string]string{"grpc_addr": c.GRPCAddr, "http_addr": c.HTTPAddr, "moviedb_addr": c.MovieDBAddr} {
+		if addr == "" {
+			errs = append(errs, fmt.Errorf("%s is required", name))
+		}
+	}
+
+	if c.DatabaseURL.IsZero() {
+		errs = append(errs, errors.New("database_url is required, set DB_URL"))
+	}
+
+	if c.LogFormat != LogFormatJSON && c.LogFormat != LogFormatText {
+		errs = append(errs, fmt.Errorf("log_format must be %s or %s, got %q", LogFormatJSON, LogFormatText, c.LogFormat))
+	}
+
+	if _, err := log.ParseLevel(c.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("log_level: %w", err))
+	}
+
+	if c.PlatformFeeBasisPoints < 0 || c.PlatformFeeBasisPoints > 10000 {
+		errs = append(errs, fmt.Errorf("platform_fee_bps must be between 0 and 10000, got %d", c.PlatformFeeBasisPoints))
+	}
+
+	if _, err := money.Exponent(c.PriceCurrency); err != nil {
+		errs = append(errs, fmt.Errorf("price_currency: %w", err))
+	}
+
+	for name, raw := range map[string]string{"payment_success_url": c.PaymentSuccessURL, "payment_cancel_url": c.PaymentCancelURL, "public_base_url": c.PublicBaseURL} {
+		if raw == "" {
+			continue
+		}
+
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("%s must be an absolute http or https URL, got %q", name, raw))
+		}
+	}
+
+	for _, host := range strings.Split(c.RedirectHosts, ",") {
+		if host = strings.TrimSpace(host); host != "" && strings.ContainsAny(host, "/:@") {
+			errs = append(errs, fmt.Errorf("redirect_hosts must list host names without scheme, port or path, got %q", host))
+		}
+	}
+
+	if c.SessionSweepInterval <= 0 {
+		errs = append(errs, fmt.Errorf("session_sweep_interval must be positive, got %s", c.SessionSweepInterval))
+	}
+
+	if c.SessionSweepBatchSize <= 0 {
+		errs = append(errs, fmt.Errorf("session_sweep_batch_size must be positive, got %d", c.SessionSweepBatchSize))
+	}
+
+	if c.MovieDBTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_timeout must be positive, got %s", c.MovieDBTimeout))
+	}
+
+	if c.MovieDBRetryAttempts <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_retry_attempts must be positive, got %d", c.MovieDBRetryAttempts))
+	}
+
+	if c.MovieDBAttemptTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_attempt_timeout must be positive, got %s", c.MovieDBAttemptTimeout))
+	}
+
+	if c.MovieDBRetryBudget <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_retry_budget must be positive, got %s", c.MovieDBRetryBudget))
+	}
+
+	if c.MovieDBRetryBackoff <= 0 || c.MovieDBRetryMaxBackoff < c.MovieDBRetryBackoff {
+		errs = append(errs, fmt.Errorf("moviedb_retry_backoff must be positive and at most moviedb_retry_max_backoff, got %s and %s", c.MovieDBRetryBackoff, c.MovieDBRetryMaxBackoff))
+	}
+
+	if c.PaymentProviderTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("payment_provider_timeout must be positive, got %s", c.PaymentProviderTimeout))
+	}
+
+	if c.MovieDBBreakerFailures <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_breaker_failures must be positive, got %d", c.MovieDBBreakerFailures))
+	}
+
+	if c.MovieDBBreakerCooldown <= 0 {
+		errs = append(errs, fmt.Errorf("moviedb_breaker_cooldown must be positive, got %s", c.MovieDBBreakerCooldown))
+	}
+
+	if c.HealthCheckInterval <= 0 {
+		errs = append(errs, fmt.Errorf("health_check_interval must be positive, got %s", c.HealthCheckInterval))
+	}
+
+	if c.DrainDelay < 0 {
+		errs = append(errs, fmt.Errorf("drain_delay must not be negative, got %s", c.DrainDelay))
+	}
+
+	switch c.TracingExporter {
+	case TracingNone, TracingStdout:
+	case TracingOTLP:
+		if c.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("tracing_exporter otlp needs otlp_endpoint"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing_exporter must be %s, %s or %s, got %q", TracingNone, TracingOTLP, TracingStdout, c.TracingExporter))
+	}
+
+	if c.TraceSampleRatio < 0 || c.TraceSampleRatio > 1 {
+		errs = append(errs, fmt.Errorf("trace_sample_ratio must be between 0 and 1, got %v", c.TraceSampleRatio))
+	}
+
+	errs = append(errs, c.validateTLS()...)
+
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateTLS() []error {
+
+	var errs []error
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls_cert_file and tls_key_file must be set together"))
+	}
+
+	switch c.TLSClientAuth {
+	case ClientAuthNone:
+	case ClientAuthOptional, ClientAuthRequire:
+		if c.TLSClientCAFile == "" {
+			errs = append(errs, fmt.Errorf("tls_client_auth %s needs tls_client_ca_file", c.TLSClientAuth))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tls_client_auth must be %s, %s or %s, got %q", ClientAuthNone, ClientAuthOptional, ClientAuthRequire, c.TLSClientAuth))
+	}
+
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		errs = append(errs, errors.New("tls_client_ca_file needs tls_cert_file, client certificates are only verified over TLS"))
+	}
+
+	if c.TLSReloadInterval <= 0 {
+		errs = append(errs, fmt.Errorf("tls_reload_interval must be positive, got %s", c.TLSReloadInterval))
+	}
+
+	if (c.MovieDBCertFile == "") != (c.MovieDBKeyFile == "") {
+		errs = append(errs, errors.New("moviedb_cert_file and moviedb_key_file must be set together"))
+	}
+
+	if !c.MovieDBTLS && (c.MovieDBCAFile != "" || c.MovieDBCertFile != "" || c.MovieDBServerName != "") {
+		errs = append(errs, errors.New("moviedb_ca_file, moviedb_cert_file and moviedb_server_name need moviedb_tls"))
+	}
+
+	return errs
+}
+
+// String lists every setting with secrets redacted, safe to log
+func (c *Config) String() string {
+
+	var b strings.Builder
+
+	v := reflect.ValueOf(c).Elem()
+
+	for i, f := range fields() {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+
+		fmt.Fprintf(&b, "%s=%v", f.key, v.Field(f.index).Interface())
+	}
+
+	return b.String()
+}
+
+type field struct {
+	index  int
+	key    string
+	env    []string
+	usage  string
+	secret bool
+}
+
+func (f field) flag() string {
+	return strings.ReplaceAll(f.key, "_", "-")
+}
+
+func (f field) isBool() bool {
+	return reflect.TypeOf(Config{}).Field(f.index).Type.Kind() == reflect.Bool
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func (f field) set(c *Config, raw string, source string) error {
+
+	v := reflect.ValueOf(c).Elem().Field(f.index)
+
+	raw = strings.TrimSpace(raw)
+
+	switch {
+	case v.Type() == durationType:
+		d, err := time.ParseDuration(raw)
+
+		if err != nil {
+			return fmt.Errorf("%s: invalid duration %q", source, raw)
+		}
+
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Int || v.Kind() == reflect.Int64:
+		n, err := strconv.ParseInt(raw, 10, 64)
+
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", source, raw)
+		}
+
+		v.SetInt(n)
+	case v.Kind() == reflect.Float64:
+		n, err := strconv.ParseFloat(raw, 64)
+
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", source, raw)
+		}
+
+		v.SetFloat(n)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", source, raw)
+		}
+
+		v.SetBool(b)
+	default:
+		return fmt.Errorf("%s: unsupported setting type %s", source, v.Type())
+	}
+
+	return nil
+}
+
+var secretType = reflect.TypeOf(Secret(""))
+
+func fields() []field {
+
+	t := reflect.TypeOf(Config{})
+
+	fs := make([]field, 0, t.NumField())
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+
+		fs = append(fs, field{
+			index:  i,
+			key:    sf.Tag.Get("key"),
+			env:    strings.Split(sf.Tag.Get("env"), ","),
+			usage:  sf.Tag.Get("usage"),
+			secret: sf.Type == secretType,
+		})
+	}
+
+	return fs
+}
+
+func fieldByKey(key string) (field, bool) {
+
+	for _, f := range fields() {
+		if f.key == key {
+			return f, true
+		}
+	}
+
+	return field{}, false
+}
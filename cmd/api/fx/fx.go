@@ -0,0 +1,124 @@
+package fx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strings"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+)
+
+var ErrRateNotFound = errors.New("exchange rate not found")
+
+// RateProvider returns how many major units of to one major unit of from is worth
+type RateProvider interface {
+	Rate(ctx context.Context, from string, to string) (*big.Rat, error)
+}
+
+// Convert exchanges m into the currency to. Amounts already in that currency are
+// returned as is, so a nil provider is fine as long as no conversion is needed.
+func Convert(ctx context.Context, provider RateProvider, m money.Money, to string) (money.Money, error) {
+
+	to = strings.ToUpper(to)
+
+	if m.Currency == to {
+		return m, nil
+	}
+
+	if provider == nil {
+		return money.Money{}, fmt.Errorf("%w: %s -> %s, no rate provider configured", ErrRateNotFound, m.Currency, to)
+	}
+
+	rate, err := provider.Rate(ctx, m.Currency, to)
+
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	return m.Exchange(rate, to, money.RoundHalfEven)
+}
+
+// StaticRates serves fixed rates loaded from a JSON file such as
+//
+//	{"base": "INR", "rates": {"USD": "0.012", "EUR": "0.011"}}
+//
+// where every rate is the value of one unit of base in that currency. Rates are
+// decimal strings so they are never rounded through a float.
+type StaticRates struct {
+	Base  string
+	rates map[string]*big.Rat
+}
+
+// LoadStaticRates reads the rates file at path
+func LoadStaticRates(path string) (*StaticRates, error) {
+
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read exchange rates: %w", err)
+	}
+
+	return ParseStaticRates(data)
+}
+
+func ParseStaticRates(data []byte) (*StaticRates, error) {
+
+	var file struct {
+		Base  string            `json:"base"`
+		Rates map[string]string `json:"rates"`
+	}
+
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+
+	base := strings.ToUpper(file.Base)
+
+	if _, err := money.Exponent(base); err != nil {
+		return nil, fmt.Errorf("invalid base currency: %w", err)
+	}
+
+	s := &StaticRates{
+		Base:  base,
+		rates: map[string]*big.Rat{base: big.NewRat(1, 1)},
+	}
+
+	for currency, value := range file.Rates {
+		currency = strings.ToUpper(currency)
+
+		if _, err := money.Exponent(currency); err != nil {
+			return nil, fmt.Errorf("invalid exchange rate currency: %w", err)
+		}
+
+		rate, ok := new(big.Rat).SetString(value)
+
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate %q for %s", value, currency)
+		}
+
+		s.rates[currency] = rate
+	}
+
+	return s, nil
+}
+
+func (s *StaticRates) Rate(ctx context.Context, from string, to string) (*big.Rat, error) {
+
+	fromRate, ok := s.rates[strings.ToUpper(from)]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrRateNotFound, from, to)
+	}
+
+	toRate, ok := s.rates[strings.ToUpper(to)]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s -> %s", ErrRateNotFound, from, to)
+	}
+
+	return new(big.Rat).Quo(toRate, fromRate), nil
+}
@@ -0,0 +1,294 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/dodopayments/dodopayments-go"
+	"github.com/dodopayments/dodopayments-go/option"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tracing"
+)
+
+const DodoTestBaseURL = "https://test.dodopayments.com"
+
+// DodoGateway implements PaymentGateway on top of the Dodo Payments SDK
+type DodoGateway struct {
+	Client *dodopayments.Client
+
+	hasToken bool
+}
+
+func NewDodoGateway(token string, testMode bool) *DodoGateway {
+
+	opts := []option.RequestOption{
+		option.WithBearerToken(token),
+		option.WithHTTPClient(&http.Client{Transport: tracing.Transport(metrics.ServiceDodo, nil)}),
+	}
+
+	if testMode {
+		opts = append(opts, option.WithBaseURL(DodoTestBaseURL))
+	}
+
+	return &DodoGateway{
+		Client:   dodopayments.NewClient(opts...),
+		hasToken: token != "",
+	}
+}
+
+// Check reports whether the gateway has a client and an API key, it does not
+// call Dodo Payments
+func (d *DodoGateway) Check(ctx context.Context) error {
+
+	if d.Client == nil {
+		return errors.New("dodo payments client is not set up")
+	}
+
+	if !d.hasToken {
+		return errors.New("dodo payments API key is not set")
+	}
+
+	return nil
+}
+
+func (d *DodoGateway) CreateCustomer(ctx context.Context, params CustomerParams) (*Customer, error) {
+
+	customer, err := d.Client.Customers.New(ctx, dodopayments.CustomerNewParams{
+		Email:       dodopayments.F(params.Email),
+		PhoneNumber: dodopayments.F(params.PhoneNumber),
+		Name:        dodopayments.F(params.Name),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create customer: %w", dodoError(err))
+	}
+
+	return dodoCustomer(customer), nil
+}
+
+func (d *DodoGateway) GetCustomer(ctx context.Context, customerID string) (*Customer, error) {
+
+	customer, err := d.Client.Customers.Get(ctx, customerID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch customer %s: %w", customerID, dodoError(err))
+	}
+
+	return dodoCustomer(customer), nil
+}
+
+func (d *DodoGateway) CreateProduct(ctx context.Context, params ProductParams) (*Product, error) {
+
+	product, err := d.Client.Products.New(ctx, dodopayments.ProductNewParams{
+		Price: dodopayments.F[dodopayments.PriceUnionParam](dodopayments.PriceOneTimePriceParam{
+			Currency:              dodopayments.F(dodopayments.Currency(params.Price.Currency)),
+			Price:                 dodopayments.F(params.Price.Amount),
+			Type:                  dodopayments.F(dodopayments.PriceOneTimePriceTypeOneTimePrice),
+			Discount:              dodopayments.Float(0),
+			PurchasingPowerParity: dodopayments.F(false),
+		}),
+		Name:        dodopayments.F(params.Name),
+		Description: dodopayments.F(params.Description),
+		TaxCategory: dodopayments.F(dodopayments.TaxCategoryDigitalProducts),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create product: %w", dodoError(err))
+	}
+
+	return dodoProduct(product), nil
+}
+
+func (d *DodoGateway) GetProduct(ctx context.Context, productID string) (*Product, error) {
+
+	product, err := d.Client.Products.Get(ctx, productID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch product %s: %w", productID, dodoError(err))
+	}
+
+	return dodoProduct(product), nil
+}
+
+func (d *DodoGateway) CreatePayment(ctx context.Context, params PaymentParams) (*Payment, error) {
+
+	cart := make([]dodopayments.OneTimeProductCartItemParam, len(params.ProductCart))
+
+	for i, item := range params.ProductCart {
+		cart[i] = dodopayments.OneTimeProductCartItemParam{
+			ProductID: dodopayments.F(item.ProductID),
+			Quantity:  dodopayments.F(item.Quantity),
+		}
+	}
+
+	payment, err := d.Client.Payments.New(ctx, dodopayments.PaymentNewParams{
+		PaymentLink: dodopayments.F(true),
+		ProductCart: dodopayments.F(cart),
+		Billing: dodopayments.F(dodopayments.BillingAddressParam{
+			Country: dodopayments.F(dodopayments.CountryCode(params.Billing.Country)),
+			State:   dodopayments.F(params.Billing.State),
+			City:    dodopayments.F(params.Billing.City),
+			Street:  dodopayments.F(params.Billing.Street),
+			Zipcode: dodopayments.F(params.Billing.Zipcode),
+		}),
+		Customer: dodopayments.F[dodopayments.CustomerRequestUnionParam](dodopayments.AttachExistingCustomerParam{
+			CustomerID: dodopayments.F(params.CustomerID),
+		}),
+		ReturnURL:       dodopayments.F(params.ReturnURL),
+		BillingCurrency: dodopayments.F(dodopayments.Currency(params.Currency)),
+		Metadata:        dodopayments.F(params.Metadata),
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create payment: %w", dodoError(err))
+	}
+
+	return &Payment{
+		PaymentID:   payment.PaymentID,
+		PaymentLink: payment.PaymentLink,
+		TotalAmount: money.New(payment.TotalAmount, params.Currency),
+		Customer: Customer{
+			CustomerID: payment.Customer.CustomerID,
+			Email:      payment.Customer.Email,
+			Name:       payment.Customer.Name,
+		},
+		Billing:     params.Billing,
+		ProductCart: params.ProductCart,
+		Metadata:    payment.Metadata,
+	}, nil
+}
+
+func (d *DodoGateway) GetPayment(ctx context.Context, paymentID string) (*Payment, error) {
+
+	payment, err := d.Client.Payments.Get(ctx, paymentID)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch payment %s: %w", paymentID, dodoError(err))
+	}
+
+	cart := make([]CartItem, len(payment.ProductCart))
+
+	for i, item := range payment.ProductCart {
+		cart[i] = CartItem{
+			ProductID: item.ProductID,
+			Quantity:  item.Quantity,
+		}
+	}
+
+	refunds := make([]Refund, len(payment.Refunds))
+
+	for i := range payment.Refunds {
+		refunds[i] = *dodoRefund(&payment.Refunds[i])
+
+		// the currency of a refund is optional, it is always the one of the payment
+		if refunds[i].Amount.Currency == "" {
+			refunds[i].Amount.Currency = string(payment.Currency)
+		}
+	}
+
+	return &Payment{
+		PaymentID:   payment.PaymentID,
+		PaymentLink: payment.PaymentLink,
+		Status:      string(payment.Status),
+		TotalAmount: money.New(payment.TotalAmount, string(payment.Currency)),
+		Tax:         money.New(payment.Tax, string(payment.Currency)),
+		Customer: Customer{
+			CustomerID: payment.Customer.CustomerID,
+			Email:      payment.Customer.Email,
+			Name:       payment.Customer.Name,
+		},
+		Billing: BillingAddress{
+			Country: string(payment.Billing.Country),
+			State:   payment.Billing.State,
+			City:    payment.Billing.City,
+			Street:  payment.Billing.Street,
+			Zipcode: payment.Billing.Zipcode,
+		},
+		ProductCart: cart,
+		Metadata:    payment.Metadata,
+		Refunds:     refunds,
+		CreatedAt:   payment.CreatedAt,
+	}, nil
+}
+
+func (d *DodoGateway) CreateRefund(ctx context.Context, params RefundParams) (*Refund, error) {
+
+	body := dodopayments.RefundNewParams{
+		PaymentID: dodopayments.F(params.PaymentID),
+		Reason:    dodopayments.F(params.Reason),
+	}
+
+	if len(params.Items) > 0 {
+		items := make([]dodopayments.RefundNewParamsItem, len(params.Items))
+
+		for i, item := range params.Items {
+			items[i] = dodopayments.RefundNewParamsItem{
+				ItemID: dodopayments.F(item.ItemID),
+			}
+
+			if item.Amount.IsPositive() {
+				items[i].Amount = dodopayments.F(item.Amount.Amount)
+			}
+		}
+
+		body.Items = dodopayments.F(items)
+	}
+
+	refund, err := d.Client.Refunds.New(ctx, body)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create refund: %w", dodoError(err))
+	}
+
+	return dodoRefund(refund), nil
+}
+
+func dodoCustomer(customer *dodopayments.Customer) *Customer {
+	return &Customer{
+		CustomerID:  customer.CustomerID,
+		Email:       customer.Email,
+		Name:        customer.Name,
+		PhoneNumber: customer.PhoneNumber,
+	}
+}
+
+func dodoProduct(product *dodopayments.Product) *Product {
+	return &Product{
+		ProductID:   product.ProductID,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       money.New(product.Price.Price, string(product.Price.Currency)),
+	}
+}
+
+func dodoRefund(refund *dodopayments.Refund) *Refund {
+	return &Refund{
+		RefundID:  refund.RefundID,
+		PaymentID: refund.PaymentID,
+		Amount:    money.New(refund.Amount, string(refund.Currency)),
+		IsPartial: refund.IsPartial,
+		Status:    string(refund.Status),
+		Reason:    refund.Reason,
+		CreatedAt: refund.CreatedAt,
+	}
+}
+
+// dodoError marks errors the caller may retry later, network failures, rate
+// limits and server errors of Dodo Payments, as ErrUnavailable
+func dodoError(err error) error {
+
+	if errors.Is(err, context.Canceled) {
+		return err
+	}
+
+	var apiErr *dodopayments.Error
+
+	if errors.As(err, &apiErr) && apiErr.StatusCode < http.StatusInternalServerError && apiErr.StatusCode != http.StatusTooManyRequests {
+		return err
+	}
+
+	return fmt.Errorf("%w: %w", ErrUnavailable, err)
+}
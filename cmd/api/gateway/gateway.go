@@ -0,0 +1,115 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+)
+
+// ErrUnavailable is wrapped by errors of a provider that could not be reached
+// or failed on its side, the call may succeed when retried later
+var ErrUnavailable = errors.New("payment provider is unavailable")
+
+// PaymentGateway is everything the payment service needs from a payment
+// provider. DodoGateway talks to Dodo Payments, gatewaytest.FakeGateway keeps
+// everything in memory so the whole booking flow can run without network access.
+type PaymentGateway interface {
+	CreateCustomer(ctx context.Context, params CustomerParams) (*Customer, error)
+	GetCustomer(ctx context.Context, customerID string) (*Customer, error)
+	CreateProduct(ctx context.Context, params ProductParams) (*Product, error)
+	GetProduct(ctx context.Context, productID string) (*Product, error)
+	CreatePayment(ctx context.Context, params PaymentParams) (*Payment, error)
+	GetPayment(ctx context.Context, paymentID string) (*Payment, error)
+	CreateRefund(ctx context.Context, params RefundParams) (*Refund, error)
+}
+
+// Checker is implemented by gateways that can tell whether they are set up to
+// take payments, e.g. whether their credentials are configured
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+type CustomerParams struct {
+	Email       string
+	Name        string
+	PhoneNumber string
+}
+
+type Customer struct {
+	CustomerID  string `json:"customer_id"`
+	Email       string `json:"email"`
+	Name        string `json:"name"`
+	PhoneNumber string `json:"phone_number"`
+}
+
+type ProductParams struct {
+	Name        string
+	Description string
+	Price       money.Money
+}
+
+type Product struct {
+	ProductID   string      `json:"product_id"`
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Price       money.Money `json:"price"`
+}
+
+type BillingAddress struct {
+	Country string `json:"country"` // ISO 3166 alpha-2 code
+	State   string `json:"state"`
+	City    string `json:"city"`
+	Street  string `json:"street"`
+	Zipcode string `json:"zipcode"`
+}
+
+type CartItem struct {
+	ProductID string `json:"product_id"`
+	Quantity  int64  `json:"quantity"`
+}
+
+type PaymentParams struct {
+	CustomerID  string
+	ProductCart []CartItem
+	Billing     BillingAddress
+	ReturnURL   string
+	Currency    string // ISO 4217 code the customer is billed in
+	Metadata    map[string]string
+}
+
+type Payment struct {
+	PaymentID   string            `json:"payment_id"`
+	PaymentLink string            `json:"payment_link"`
+	Status      string            `json:"status"`
+	TotalAmount money.Money       `json:"total_amount"`
+	Tax         money.Money       `json:"tax"`
+	Customer    Customer          `json:"customer"`
+	Billing     BillingAddress    `json:"billing"`
+	ProductCart []CartItem        `json:"product_cart"`
+	Metadata    map[string]string `json:"metadata"`
+	Refunds     []Refund          `json:"refunds"`
+	CreatedAt   time.Time         `json:"created_at"`
+}
+
+type RefundItem struct {
+	ItemID string      // product ID in the cart of the payment
+	Amount money.Money // optional, the whole item is refunded when zero
+}
+
+type RefundParams struct {
+	PaymentID string
+	Reason    string
+	Items     []RefundItem // refunds the whole payment when empty
+}
+
+type Refund struct {
+	RefundID  string      `json:"refund_id"`
+	PaymentID string      `json:"payment_id"`
+	Amount    money.Money `json:"amount"`
+	IsPartial bool        `json:"is_partial"`
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason"`
+	CreatedAt time.Time   `json:"created_at"`
+}
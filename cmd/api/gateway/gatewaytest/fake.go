@@ -0,0 +1,456 @@
+// Package gatewaytest provides an in-memory payment gateway for tests. It is
+// kept out of package gateway so the service binary does not link httptest.
+package gatewaytest
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+)
+
+var ErrFakeNotFound = errors.New("not found")
+
+// FakeEvent is a webhook the fake gateway delivered
+type FakeEvent struct {
+	Type       string
+	StatusCode int
+}
+
+// FakeGateway is an in-memory gateway.PaymentGateway. Payments stay in the
+// requires_payment_method state until SucceedPayment or FailPayment is called,
+// which, like a real provider, emits a signed Standard Webhooks event to the
+// configured handler.
+type FakeGateway struct {
+	// Webhooks receives every emitted event, events are dropped when nil
+	Webhooks http.Handler
+	// Secret signs the emitted events
+	Secret []byte
+
+	mu        sync.Mutex
+	seq       int
+	customers map[string]*gateway.Customer
+	products  map[string]*gateway.Product
+	payments  map[string]*gateway.Payment
+	failures  map[string]error
+	events    []FakeEvent
+}
+
+func NewFakeGateway(secret []byte) *FakeGateway {
+	return &FakeGateway{
+		Secret:    secret,
+		customers: map[string]*gateway.Customer{},
+		products:  map[string]*gateway.Product{},
+		payments:  map[string]*gateway.Payment{},
+		failures:  map[string]error{},
+	}
+}
+
+// FailWith makes every following call of the named method, e.g. "CreatePayment", return err.
+// Passing a nil error clears the failure.
+func (f *FakeGateway) FailWith(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err == nil {
+		delete(f.failures, method)
+		return
+	}
+
+	f.failures[method] = err
+}
+
+func (f *FakeGateway) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake_%d", prefix, f.seq)
+}
+
+func (f *FakeGateway) CreateCustomer(ctx context.Context, params gateway.CustomerParams) (*gateway.Customer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["CreateCustomer"]; err != nil {
+		return nil, err
+	}
+
+	customer := &gateway.Customer{
+		CustomerID:  f.nextID("cus"),
+		Email:       params.Email,
+		Name:        params.Name,
+		PhoneNumber: params.PhoneNumber,
+	}
+
+	f.customers[customer.CustomerID] = customer
+
+	copied := *customer
+	return &copied, nil
+}
+
+func (f *FakeGateway) GetCustomer(ctx context.Context, customerID string) (*gateway.Customer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["GetCustomer"]; err != nil {
+		return nil, err
+	}
+
+	customer, ok := f.customers[customerID]
+
+	if !ok {
+		return nil, fmt.Errorf("customer %s: %w", customerID, ErrFakeNotFound)
+	}
+
+	copied := *customer
+	return &copied, nil
+}
+
+func (f *FakeGateway) CreateProduct(ctx context.Context, params gateway.ProductParams) (*gateway.Product, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["CreateProduct"]; err != nil {
+		return nil, err
+	}
+
+	product := &gateway.Product{
+		ProductID:   f.nextID("pdt"),
+		Name:        params.Name,
+		Description: params.Description,
+		Price:       params.Price,
+	}
+
+	f.products[product.ProductID] = product
+
+	copied := *product
+	return &copied, nil
+}
+
+func (f *FakeGateway) GetProduct(ctx context.Context, productID string) (*gateway.Product, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["GetProduct"]; err != nil {
+		return nil, err
+	}
+
+	product, ok := f.products[productID]
+
+	if !ok {
+		return nil, fmt.Errorf("product %s: %w", productID, ErrFakeNotFound)
+	}
+
+	copied := *product
+	return &copied, nil
+}
+
+func (f *FakeGateway) CreatePayment(ctx context.Context, params gateway.PaymentParams) (*gateway.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["CreatePayment"]; err != nil {
+		return nil, err
+	}
+
+	customer, ok := f.customers[params.CustomerID]
+
+	if !ok {
+		return nil, fmt.Errorf("customer %s: %w", params.CustomerID, ErrFakeNotFound)
+	}
+
+	total := money.Zero(params.Currency)
+
+	for _, item := range params.ProductCart {
+		product, ok := f.products[item.ProductID]
+
+		if !ok {
+			return nil, fmt.Errorf("product %s: %w", item.ProductID, ErrFakeNotFound)
+		}
+
+		line, err := product.Price.Mul(item.Quantity)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if total, err = total.Add(line); err != nil {
+			return nil, fmt.Errorf("product %s: %w", item.ProductID, err)
+		}
+	}
+
+	metadata := map[string]string{}
+
+	for k, v := range params.Metadata {
+		metadata[k] = v
+	}
+
+	payment := &gateway.Payment{
+		PaymentID:   f.nextID("pay"),
+		Status:      "requires_payment_method",
+		TotalAmount: total,
+		Tax:         money.Zero(params.Currency),
+		Customer:    *customer,
+		Billing:     params.Billing,
+		ProductCart: append([]gateway.CartItem(nil), params.ProductCart...),
+		Metadata:    metadata,
+		CreatedAt:   time.Now(),
+	}
+
+	payment.PaymentLink = "https://checkout.fake.gateway/" + payment.PaymentID
+
+	f.payments[payment.PaymentID] = payment
+
+	return copyPayment(payment), nil
+}
+
+func (f *FakeGateway) GetPayment(ctx context.Context, paymentID string) (*gateway.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err := f.failures["GetPayment"]; err != nil {
+		return nil, err
+	}
+
+	payment, ok := f.payments[paymentID]
+
+	if !ok {
+		return nil, fmt.Errorf("payment %s: %w", paymentID, ErrFakeNotFound)
+	}
+
+	return copyPayment(payment), nil
+}
+
+func (f *FakeGateway) CreateRefund(ctx context.Context, params gateway.RefundParams) (*gateway.Refund, error) {
+	f.mu.Lock()
+
+	if err := f.failures["CreateRefund"]; err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+
+	payment, ok := f.payments[params.PaymentID]
+
+	if !ok {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("payment %s: %w", params.PaymentID, ErrFakeNotFound)
+	}
+
+	if payment.Status != "succeeded" {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("payment %s is %s and cannot be refunded", payment.PaymentID, payment.Status)
+	}
+
+	amount := payment.TotalAmount
+
+	if len(params.Items) > 0 {
+		amount = money.Zero(payment.TotalAmount.Currency)
+
+		for _, item := range params.Items {
+			itemAmount := item.Amount
+
+			if !itemAmount.IsPositive() {
+				if product, ok := f.products[item.ItemID]; ok {
+					itemAmount = product.Price
+				}
+			}
+
+			if itemAmount.IsZero() {
+				continue
+			}
+
+			var err error
+
+			if amount, err = amount.Add(itemAmount); err != nil {
+				f.mu.Unlock()
+				return nil, fmt.Errorf("refund item %s: %w", item.ItemID, err)
+			}
+		}
+	}
+
+	refunded := money.Zero(payment.TotalAmount.Currency)
+
+	for _, r := range payment.Refunds {
+		refunded, _ = refunded.Add(r.Amount)
+	}
+
+	after, err := refunded.Add(amount)
+
+	if err != nil {
+		f.mu.Unlock()
+		return nil, err
+	}
+
+	if after.Amount > payment.TotalAmount.Amount {
+		f.mu.Unlock()
+		return nil, fmt.Errorf("refund of %s exceeds the refundable amount of payment %s", amount, payment.PaymentID)
+	}
+
+	refund := gateway.Refund{
+		RefundID:  f.nextID("rfd"),
+		PaymentID: payment.PaymentID,
+		Amount:    amount,
+		IsPartial: after.Amount < payment.TotalAmount.Amount,
+		Status:    "succeeded",
+		Reason:    params.Reason,
+		CreatedAt: time.Now(),
+	}
+
+	payment.Refunds = append(payment.Refunds, refund)
+
+	f.mu.Unlock()
+
+	if err := f.emit("refund.succeeded", wireRefund(refund)); err != nil {
+		return nil, err
+	}
+
+	return &refund, nil
+}
+
+// Emitted returns the webhook events delivered so far
+func (f *FakeGateway) Emitted() []FakeEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeEvent(nil), f.events...)
+}
+
+// SucceedPayment simulates the customer paying through the payment link
+func (f *FakeGateway) SucceedPayment(paymentID string) error {
+	return f.settlePayment(paymentID, "succeeded", "payment.succeeded")
+}
+
+// FailPayment simulates a declined payment
+func (f *FakeGateway) FailPayment(paymentID string) error {
+	return f.settlePayment(paymentID, "failed", "payment.failed")
+}
+
+func (f *FakeGateway) settlePayment(paymentID string, status string, eventType string) error {
+	f.mu.Lock()
+
+	payment, ok := f.payments[paymentID]
+
+	if !ok {
+		f.mu.Unlock()
+		return fmt.Errorf("payment %s: %w", paymentID, ErrFakeNotFound)
+	}
+
+	payment.Status = status
+	data := wirePayment(payment)
+
+	f.mu.Unlock()
+
+	return f.emit(eventType, data)
+}
+
+// wirePayment encodes a payment the way Dodo Payments sends it in webhooks,
+// with amounts as plain minor units next to a single currency field
+func wirePayment(payment *gateway.Payment) map[string]interface{} {
+
+	refunds := make([]map[string]interface{}, len(payment.Refunds))
+
+	for i, r := range payment.Refunds {
+		refunds[i] = wireRefund(r)
+	}
+
+	return map[string]interface{}{
+		"payment_id":   payment.PaymentID,
+		"payment_link": payment.PaymentLink,
+		"status":       payment.Status,
+		"total_amount": payment.TotalAmount.Amount,
+		"tax":          payment.Tax.Amount,
+		"currency":     payment.TotalAmount.Currency,
+		"customer":     payment.Customer,
+		"billing":      payment.Billing,
+		"product_cart": payment.ProductCart,
+		"metadata":     payment.Metadata,
+		"refunds":      refunds,
+		"created_at":   payment.CreatedAt,
+	}
+}
+
+func wireRefund(refund gateway.Refund) map[string]interface{} {
+	return map[string]interface{}{
+		"refund_id":  refund.RefundID,
+		"payment_id": refund.PaymentID,
+		"amount":     refund.Amount.Amount,
+		"currency":   refund.Amount.Currency,
+		"is_partial": refund.IsPartial,
+		"status":     refund.Status,
+		"reason":     refund.Reason,
+		"created_at": refund.CreatedAt,
+	}
+}
+
+// emit delivers a signed webhook event to the configured handler
+func (f *FakeGateway) emit(eventType string, data interface{}) error {
+
+	if f.Webhooks == nil {
+		return nil
+	}
+
+	now := time.Now()
+
+	body, err := json.Marshal(map[string]interface{}{
+		"business_id": "bus_fake",
+		"type":        eventType,
+		"timestamp":   now.UTC().Format(time.RFC3339),
+		"data":        data,
+	})
+
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	f.mu.Lock()
+	msgID := f.nextID("msg")
+	f.mu.Unlock()
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+
+	mac := hmac.New(sha256.New, f.Secret)
+	mac.Write([]byte(msgID + "." + timestamp + "."))
+	mac.Write(body)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dodopayments", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("webhook-id", msgID)
+	req.Header.Set("webhook-timestamp", timestamp)
+	req.Header.Set("webhook-signature", "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	rec := httptest.NewRecorder()
+	f.Webhooks.ServeHTTP(rec, req)
+
+	f.mu.Lock()
+	f.events = append(f.events, FakeEvent{Type: eventType, StatusCode: rec.Code})
+	f.mu.Unlock()
+
+	if rec.Code < 200 || rec.Code > 299 {
+		return fmt.Errorf("webhook %s was rejected with status %d: %s", eventType, rec.Code, rec.Body.String())
+	}
+
+	return nil
+}
+
+func copyPayment(payment *gateway.Payment) *gateway.Payment {
+	copied := *payment
+	copied.ProductCart = append([]gateway.CartItem(nil), payment.ProductCart...)
+	copied.Refunds = append([]gateway.Refund(nil), payment.Refunds...)
+	copied.Metadata = map[string]string{}
+
+	for k, v := range payment.Metadata {
+		copied.Metadata[k] = v
+	}
+
+	return &copied
+}
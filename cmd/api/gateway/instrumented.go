@@ -0,0 +1,81 @@
+package gateway
+
+import (
+	"context"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+)
+
+// InstrumentedGateway records the latency of every call to the gateway it wraps
+// in the outbound request metrics
+type InstrumentedGateway struct {
+	Next PaymentGateway
+	// Service names the provider in the metrics, e.g. metrics.ServiceDodo
+	Service string
+}
+
+// NewInstrumentedGateway wraps next, service names the provider in the metrics
+func NewInstrumentedGateway(next PaymentGateway, service string) *InstrumentedGateway {
+	return &InstrumentedGateway{Next: next, Service: service}
+}
+
+func (g *InstrumentedGateway) CreateCustomer(ctx context.Context, params CustomerParams) (*Customer, error) {
+	start := time.Now()
+	customer, err := g.Next.CreateCustomer(ctx, params)
+	metrics.ObserveOutbound(g.Service, "CreateCustomer", start, err)
+	return customer, err
+}
+
+func (g *InstrumentedGateway) GetCustomer(ctx context.Context, customerID string) (*Customer, error) {
+	start := time.Now()
+	customer, err := g.Next.GetCustomer(ctx, customerID)
+	metrics.ObserveOutbound(g.Service, "GetCustomer", start, err)
+	return customer, err
+}
+
+func (g *InstrumentedGateway) CreateProduct(ctx context.Context, params ProductParams) (*Product, error) {
+	start := time.Now()
+	product, err := g.Next.CreateProduct(ctx, params)
+	metrics.ObserveOutbound(g.Service, "CreateProduct", start, err)
+	return product, err
+}
+
+func (g *InstrumentedGateway) GetProduct(ctx context.Context, productID string) (*Product, error) {
+	start := time.Now()
+	product, err := g.Next.GetProduct(ctx, productID)
+	metrics.ObserveOutbound(g.Service, "GetProduct", start, err)
+	return product, err
+}
+
+func (g *InstrumentedGateway) CreatePayment(ctx context.Context, params PaymentParams) (*Payment, error) {
+	start := time.Now()
+	payment, err := g.Next.CreatePayment(ctx, params)
+	metrics.ObserveOutbound(g.Service, "CreatePayment", start, err)
+	return payment, err
+}
+
+func (g *InstrumentedGateway) GetPayment(ctx context.Context, paymentID string) (*Payment, error) {
+	start := time.Now()
+	payment, err := g.Next.GetPayment(ctx, paymentID)
+	metrics.ObserveOutbound(g.Service, "GetPayment", start, err)
+	return payment, err
+}
+
+func (g *InstrumentedGateway) CreateRefund(ctx context.Context, params RefundParams) (*Refund, error) {
+	start := time.Now()
+	refund, err := g.Next.CreateRefund(ctx, params)
+	metrics.ObserveOutbound(g.Service, "CreateRefund", start, err)
+	return refund, err
+}
+
+// Check passes the check of the wrapped gateway through, it is not timed as it
+// does not call the provider
+func (g *InstrumentedGateway) Check(ctx context.Context) error {
+
+	if checker, ok := g.Next.(Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
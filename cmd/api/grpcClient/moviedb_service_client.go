@@ -5,7 +5,9 @@ import (
 	"google.golang.org/grpc/credentials/insecure"
 )
 
-func NewMovieDBClient() (MovieDBServiceClient, error) {
+// NewMovieDBClient connects to the movie DB service in plaintext unless opts
+// give other transport credentials
+func NewMovieDBClient(addr string, opts ...grpc.DialOption) (MovieDBServiceClient, error) {
 	// Initialize the MovieDB client here
 	// This function should create a new instance of the MovieDB client
 	// and return it for use in other parts of the application.
@@ -14,10 +16,7 @@ func NewMovieDBClient() (MovieDBServiceClient, error) {
 	// client := moviedb.NewClient(moviedb.WithAPIKey(os.Getenv("MOVIEDB_API_KEY")))
 	// return client
 
-	var opts []grpc.DialOption
-	opts = append(opts, grpc.WithTransportCredentials(insecure.NewCredentials()))
-
-	conn, err := grpc.NewClient(":1102", opts...)
+	conn, err := DialMovieDB(addr, opts...)
 
 	if err != nil {
 		return nil, err
@@ -27,3 +26,12 @@ func NewMovieDBClient() (MovieDBServiceClient, error) {
 
 	return client, nil
 }
+
+// DialMovieDB returns the connection NewMovieDBClient uses, for callers that
+// also need the connection itself, e.g. to check its health
+func DialMovieDB(addr string, opts ...grpc.DialOption) (*grpc.ClientConn, error) {
+
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+
+	return grpc.NewClient(addr, opts...)
+}
@@ -223,20 +223,73 @@ func (PaymentType) EnumDescriptor() ([]byte, []int) {
 	return file_payment_service_proto_rawDescGZIP(), []int{2}
 }
 
+// Amount in the minor unit of the currency, e.g. 25050 INR is 250.50 rupees
+type Money struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Amount        int64                  `protobuf:"varint,1,opt,name=amount,proto3" json:"amount,omitempty"`
+	Currency      string                 `protobuf:"bytes,2,opt,name=currency,proto3" json:"currency,omitempty"` // ISO 4217 code
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Money) Reset() {
+	*x = Money{}
+	mi := &file_payment_service_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Money) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Money) ProtoMessage() {}
+
+func (x *Money) ProtoReflect() protoreflect.Message {
+	mi := &file_payment_service_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Money.ProtoReflect.Descriptor instead.
+func (*Money) Descriptor() ([]byte, []int) {
+	return file_payment_service_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Money) GetAmount() int64 {
+	if x != nil {
+		return x.Amount
+	}
+	return 0
+}
+
+func (x *Money) GetCurrency() string {
+	if x != nil {
+		return x.Currency
+	}
+	return ""
+}
+
 type CheckoutSessionLineItemParam struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Price         int32                  `protobuf:"varint,1,opt,name=price,proto3" json:"price,omitempty"`
 	Quantity      int32                  `protobuf:"varint,2,opt,name=quantity,proto3" json:"quantity,omitempty"`
 	PaymentType   PaymentType            `protobuf:"varint,3,opt,name=paymentType,proto3,enum=moviedb_service.PaymentType" json:"paymentType,omitempty"`
 	SuccessUrl    string                 `protobuf:"bytes,4,opt,name=success_url,json=successUrl,proto3" json:"success_url,omitempty"`
 	CancelUrl     string                 `protobuf:"bytes,5,opt,name=cancel_url,json=cancelUrl,proto3" json:"cancel_url,omitempty"`
+	Price         *Money                 `protobuf:"bytes,6,opt,name=price,proto3" json:"price,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CheckoutSessionLineItemParam) Reset() {
 	*x = CheckoutSessionLineItemParam{}
-	mi := &file_payment_service_proto_msgTypes[0]
+	mi := &file_payment_service_proto_msgTypes[1]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -248,7 +301,7 @@ func (x *CheckoutSessionLineItemParam) String() string {
 func (*CheckoutSessionLineItemParam) ProtoMessage() {}
 
 func (x *CheckoutSessionLineItemParam) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[0]
+	mi := &file_payment_service_proto_msgTypes[1]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -261,14 +314,7 @@ func (x *CheckoutSessionLineItemParam) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CheckoutSessionLineItemParam.ProtoReflect.Descriptor instead.
 func (*CheckoutSessionLineItemParam) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{0}
-}
-
-func (x *CheckoutSessionLineItemParam) GetPrice() int32 {
-	if x != nil {
-		return x.Price
-	}
-	return 0
+	return file_payment_service_proto_rawDescGZIP(), []int{1}
 }
 
 func (x *CheckoutSessionLineItemParam) GetQuantity() int32 {
@@ -299,22 +345,28 @@ func (x *CheckoutSessionLineItemParam) GetCancelUrl() string {
 	return ""
 }
 
+func (x *CheckoutSessionLineItemParam) GetPrice() *Money {
+	if x != nil {
+		return x.Price
+	}
+	return nil
+}
+
 type PaymentIntent struct {
 	state              protoimpl.MessageState `protogen:"open.v1"`
 	Id                 string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Amount             int64                  `protobuf:"varint,2,opt,name=amount,proto3" json:"amount,omitempty"`
-	Currency           string                 `protobuf:"bytes,3,opt,name=currency,proto3" json:"currency,omitempty"`
 	Status             string                 `protobuf:"bytes,4,opt,name=status,proto3" json:"status,omitempty"`
 	ClientSecret       string                 `protobuf:"bytes,5,opt,name=client_secret,json=clientSecret,proto3" json:"client_secret,omitempty"`
 	PaymentMethodTypes []string               `protobuf:"bytes,6,rep,name=payment_method_types,json=paymentMethodTypes,proto3" json:"payment_method_types,omitempty"`
 	Created            *timestamp.Timestamp   `protobuf:"bytes,7,opt,name=created,proto3" json:"created,omitempty"`
+	Amount             *Money                 `protobuf:"bytes,8,opt,name=amount,proto3" json:"amount,omitempty"`
 	unknownFields      protoimpl.UnknownFields
 	sizeCache          protoimpl.SizeCache
 }
 
 func (x *PaymentIntent) Reset() {
 	*x = PaymentIntent{}
-	mi := &file_payment_service_proto_msgTypes[1]
+	mi := &file_payment_service_proto_msgTypes[2]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -326,7 +378,7 @@ func (x *PaymentIntent) String() string {
 func (*PaymentIntent) ProtoMessage() {}
 
 func (x *PaymentIntent) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[1]
+	mi := &file_payment_service_proto_msgTypes[2]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -339,7 +391,7 @@ func (x *PaymentIntent) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use PaymentIntent.ProtoReflect.Descriptor instead.
 func (*PaymentIntent) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{1}
+	return file_payment_service_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *PaymentIntent) GetId() string {
@@ -349,20 +401,6 @@ func (x *PaymentIntent) GetId() string {
 	return ""
 }
 
-func (x *PaymentIntent) GetAmount() int64 {
-	if x != nil {
-		return x.Amount
-	}
-	return 0
-}
-
-func (x *PaymentIntent) GetCurrency() string {
-	if x != nil {
-		return x.Currency
-	}
-	return ""
-}
-
 func (x *PaymentIntent) GetStatus() string {
 	if x != nil {
 		return x.Status
@@ -391,6 +429,13 @@ func (x *PaymentIntent) GetCreated() *timestamp.Timestamp {
 	return nil
 }
 
+func (x *PaymentIntent) GetAmount() *Money {
+	if x != nil {
+		return x.Amount
+	}
+	return nil
+}
+
 type CreateCheckoutSessionRequest struct {
 	state         protoimpl.MessageState          `protogen:"open.v1"`
 	MovieID       int32                           `protobuf:"varint,1,opt,name=movieID,proto3" json:"movieID,omitempty"`
@@ -401,7 +446,7 @@ type CreateCheckoutSessionRequest struct {
 
 func (x *CreateCheckoutSessionRequest) Reset() {
 	*x = CreateCheckoutSessionRequest{}
-	mi := &file_payment_service_proto_msgTypes[2]
+	mi := &file_payment_service_proto_msgTypes[3]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -413,7 +458,7 @@ func (x *CreateCheckoutSessionRequest) String() string {
 func (*CreateCheckoutSessionRequest) ProtoMessage() {}
 
 func (x *CreateCheckoutSessionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[2]
+	mi := &file_payment_service_proto_msgTypes[3]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -426,7 +471,7 @@ func (x *CreateCheckoutSessionRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateCheckoutSessionRequest.ProtoReflect.Descriptor instead.
 func (*CreateCheckoutSessionRequest) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{2}
+	return file_payment_service_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *CreateCheckoutSessionRequest) GetMovieID() int32 {
@@ -454,7 +499,7 @@ type CreateCheckoutSessionResponse struct {
 
 func (x *CreateCheckoutSessionResponse) Reset() {
 	*x = CreateCheckoutSessionResponse{}
-	mi := &file_payment_service_proto_msgTypes[3]
+	mi := &file_payment_service_proto_msgTypes[4]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -466,7 +511,7 @@ func (x *CreateCheckoutSessionResponse) String() string {
 func (*CreateCheckoutSessionResponse) ProtoMessage() {}
 
 func (x *CreateCheckoutSessionResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[3]
+	mi := &file_payment_service_proto_msgTypes[4]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -479,7 +524,7 @@ func (x *CreateCheckoutSessionResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateCheckoutSessionResponse.ProtoReflect.Descriptor instead.
 func (*CreateCheckoutSessionResponse) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{3}
+	return file_payment_service_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *CreateCheckoutSessionResponse) GetStatus() int32 {
@@ -512,7 +557,7 @@ type ProductBookedSeats struct {
 
 func (x *ProductBookedSeats) Reset() {
 	*x = ProductBookedSeats{}
-	mi := &file_payment_service_proto_msgTypes[4]
+	mi := &file_payment_service_proto_msgTypes[5]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -524,7 +569,7 @@ func (x *ProductBookedSeats) String() string {
 func (*ProductBookedSeats) ProtoMessage() {}
 
 func (x *ProductBookedSeats) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[4]
+	mi := &file_payment_service_proto_msgTypes[5]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -537,7 +582,7 @@ func (x *ProductBookedSeats) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ProductBookedSeats.ProtoReflect.Descriptor instead.
 func (*ProductBookedSeats) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{4}
+	return file_payment_service_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *ProductBookedSeats) GetBookedSeatID() int32 {
@@ -563,13 +608,14 @@ type Create_Payment_Intent_INR_Request struct {
 	VenueId         int32                  `protobuf:"varint,19,opt,name=venue_id,json=venueId,proto3" json:"venue_id,omitempty"`
 	MovieTimeSlotId int32                  `protobuf:"varint,20,opt,name=movie_time_slot_id,json=movieTimeSlotId,proto3" json:"movie_time_slot_id,omitempty"`
 	CustomerName    string                 `protobuf:"bytes,21,opt,name=customer_name,json=customerName,proto3" json:"customer_name,omitempty"`
+	IdempotentKey   string                 `protobuf:"bytes,22,opt,name=idempotent_key,json=idempotentKey,proto3" json:"idempotent_key,omitempty"`
 	unknownFields   protoimpl.UnknownFields
 	sizeCache       protoimpl.SizeCache
 }
 
 func (x *Create_Payment_Intent_INR_Request) Reset() {
 	*x = Create_Payment_Intent_INR_Request{}
-	mi := &file_payment_service_proto_msgTypes[5]
+	mi := &file_payment_service_proto_msgTypes[6]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -581,7 +627,7 @@ func (x *Create_Payment_Intent_INR_Request) String() string {
 func (*Create_Payment_Intent_INR_Request) ProtoMessage() {}
 
 func (x *Create_Payment_Intent_INR_Request) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[5]
+	mi := &file_payment_service_proto_msgTypes[6]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -594,7 +640,7 @@ func (x *Create_Payment_Intent_INR_Request) ProtoReflect() protoreflect.Message
 
 // Deprecated: Use Create_Payment_Intent_INR_Request.ProtoReflect.Descriptor instead.
 func (*Create_Payment_Intent_INR_Request) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{5}
+	return file_payment_service_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *Create_Payment_Intent_INR_Request) GetSuccessUrl() string {
@@ -695,6 +741,13 @@ func (x *Create_Payment_Intent_INR_Request) GetCustomerName() string {
 	return ""
 }
 
+func (x *Create_Payment_Intent_INR_Request) GetIdempotentKey() string {
+	if x != nil {
+		return x.IdempotentKey
+	}
+	return ""
+}
+
 type IsValidIdempotentKeyRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	IdempotentKey string                 `protobuf:"bytes,1,opt,name=idempotent_key,json=idempotentKey,proto3" json:"idempotent_key,omitempty"`
@@ -704,7 +757,7 @@ type IsValidIdempotentKeyRequest struct {
 
 func (x *IsValidIdempotentKeyRequest) Reset() {
 	*x = IsValidIdempotentKeyRequest{}
-	mi := &file_payment_service_proto_msgTypes[6]
+	mi := &file_payment_service_proto_msgTypes[7]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -716,7 +769,7 @@ func (x *IsValidIdempotentKeyRequest) String() string {
 func (*IsValidIdempotentKeyRequest) ProtoMessage() {}
 
 func (x *IsValidIdempotentKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[6]
+	mi := &file_payment_service_proto_msgTypes[7]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -729,7 +782,7 @@ func (x *IsValidIdempotentKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IsValidIdempotentKeyRequest.ProtoReflect.Descriptor instead.
 func (*IsValidIdempotentKeyRequest) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{6}
+	return file_payment_service_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *IsValidIdempotentKeyRequest) GetIdempotentKey() string {
@@ -750,7 +803,7 @@ type IsValidIdempotentKeyResponse struct {
 
 func (x *IsValidIdempotentKeyResponse) Reset() {
 	*x = IsValidIdempotentKeyResponse{}
-	mi := &file_payment_service_proto_msgTypes[7]
+	mi := &file_payment_service_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -762,7 +815,7 @@ func (x *IsValidIdempotentKeyResponse) String() string {
 func (*IsValidIdempotentKeyResponse) ProtoMessage() {}
 
 func (x *IsValidIdempotentKeyResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[7]
+	mi := &file_payment_service_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -775,7 +828,7 @@ func (x *IsValidIdempotentKeyResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use IsValidIdempotentKeyResponse.ProtoReflect.Descriptor instead.
 func (*IsValidIdempotentKeyResponse) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{7}
+	return file_payment_service_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *IsValidIdempotentKeyResponse) GetIsValid() bool {
@@ -812,7 +865,7 @@ type CommitIdempotentKeyRequest struct {
 
 func (x *CommitIdempotentKeyRequest) Reset() {
 	*x = CommitIdempotentKeyRequest{}
-	mi := &file_payment_service_proto_msgTypes[8]
+	mi := &file_payment_service_proto_msgTypes[9]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -824,7 +877,7 @@ func (x *CommitIdempotentKeyRequest) String() string {
 func (*CommitIdempotentKeyRequest) ProtoMessage() {}
 
 func (x *CommitIdempotentKeyRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[8]
+	mi := &file_payment_service_proto_msgTypes[9]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -837,7 +890,7 @@ func (x *CommitIdempotentKeyRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CommitIdempotentKeyRequest.ProtoReflect.Descriptor instead.
 func (*CommitIdempotentKeyRequest) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{8}
+	return file_payment_service_proto_rawDescGZIP(), []int{9}
 }
 
 func (x *CommitIdempotentKeyRequest) GetIdempotentKey() string {
@@ -887,7 +940,7 @@ type Create_Payment_Intent_INR_Response struct {
 
 func (x *Create_Payment_Intent_INR_Response) Reset() {
 	*x = Create_Payment_Intent_INR_Response{}
-	mi := &file_payment_service_proto_msgTypes[9]
+	mi := &file_payment_service_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -899,7 +952,7 @@ func (x *Create_Payment_Intent_INR_Response) String() string {
 func (*Create_Payment_Intent_INR_Response) ProtoMessage() {}
 
 func (x *Create_Payment_Intent_INR_Response) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[9]
+	mi := &file_payment_service_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -912,7 +965,7 @@ func (x *Create_Payment_Intent_INR_Response) ProtoReflect() protoreflect.Message
 
 // Deprecated: Use Create_Payment_Intent_INR_Response.ProtoReflect.Descriptor instead.
 func (*Create_Payment_Intent_INR_Response) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{9}
+	return file_payment_service_proto_rawDescGZIP(), []int{10}
 }
 
 func (x *Create_Payment_Intent_INR_Response) GetStatus() int32 {
@@ -946,15 +999,15 @@ func (x *Create_Payment_Intent_INR_Response) GetPaymentLink() string {
 type Order struct {
 	state              protoimpl.MessageState `protogen:"open.v1"`
 	ProductName        string                 `protobuf:"bytes,1,opt,name=product_name,json=productName,proto3" json:"product_name,omitempty"`
-	ProductPrice       int32                  `protobuf:"varint,2,opt,name=product_price,json=productPrice,proto3" json:"product_price,omitempty"`
 	ProductDescription string                 `protobuf:"bytes,3,opt,name=product_description,json=productDescription,proto3" json:"product_description,omitempty"`
+	ProductPrice       *Money                 `protobuf:"bytes,4,opt,name=product_price,json=productPrice,proto3" json:"product_price,omitempty"`
 	unknownFields      protoimpl.UnknownFields
 	sizeCache          protoimpl.SizeCache
 }
 
 func (x *Order) Reset() {
 	*x = Order{}
-	mi := &file_payment_service_proto_msgTypes[10]
+	mi := &file_payment_service_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -966,7 +1019,7 @@ func (x *Order) String() string {
 func (*Order) ProtoMessage() {}
 
 func (x *Order) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[10]
+	mi := &file_payment_service_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -979,7 +1032,7 @@ func (x *Order) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Order.ProtoReflect.Descriptor instead.
 func (*Order) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{10}
+	return file_payment_service_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *Order) GetProductName() string {
@@ -989,18 +1042,18 @@ func (x *Order) GetProductName() string {
 	return ""
 }
 
-func (x *Order) GetProductPrice() int32 {
+func (x *Order) GetProductDescription() string {
 	if x != nil {
-		return x.ProductPrice
+		return x.ProductDescription
 	}
-	return 0
+	return ""
 }
 
-func (x *Order) GetProductDescription() string {
+func (x *Order) GetProductPrice() *Money {
 	if x != nil {
-		return x.ProductDescription
+		return x.ProductPrice
 	}
-	return ""
+	return nil
 }
 
 type Create_Order_Request struct {
@@ -1009,13 +1062,15 @@ type Create_Order_Request struct {
 	SeatMatrixIDs   []int32                `protobuf:"varint,6,rep,packed,name=seatMatrixIDs,proto3" json:"seatMatrixIDs,omitempty"`
 	VenueId         int32                  `protobuf:"varint,7,opt,name=venue_id,json=venueId,proto3" json:"venue_id,omitempty"`
 	MovieTimeSlotId int32                  `protobuf:"varint,8,opt,name=movie_time_slot_id,json=movieTimeSlotId,proto3" json:"movie_time_slot_id,omitempty"`
-	unknownFields   protoimpl.UnknownFields
-	sizeCache       protoimpl.SizeCache
+	// Currency the customer pays in, seat prices are converted into it
+	Currency      Currency `protobuf:"varint,9,opt,name=currency,proto3,enum=moviedb_service.Currency" json:"currency,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Create_Order_Request) Reset() {
 	*x = Create_Order_Request{}
-	mi := &file_payment_service_proto_msgTypes[11]
+	mi := &file_payment_service_proto_msgTypes[12]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1027,7 +1082,7 @@ func (x *Create_Order_Request) String() string {
 func (*Create_Order_Request) ProtoMessage() {}
 
 func (x *Create_Order_Request) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[11]
+	mi := &file_payment_service_proto_msgTypes[12]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1040,7 +1095,7 @@ func (x *Create_Order_Request) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Create_Order_Request.ProtoReflect.Descriptor instead.
 func (*Create_Order_Request) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{11}
+	return file_payment_service_proto_rawDescGZIP(), []int{12}
 }
 
 func (x *Create_Order_Request) GetIdempotentKey() string {
@@ -1071,19 +1126,28 @@ func (x *Create_Order_Request) GetMovieTimeSlotId() int32 {
 	return 0
 }
 
+func (x *Create_Order_Request) GetCurrency() Currency {
+	if x != nil {
+		return x.Currency
+	}
+	return Currency_INR
+}
+
 type Create_Order_Response struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
-	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
-	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
-	OrderId       []string               `protobuf:"bytes,4,rep,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Status  int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Error   string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Message string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	OrderId []string               `protobuf:"bytes,4,rep,name=order_id,json=orderId,proto3" json:"order_id,omitempty"`
+	// The seats are held for this booking until then
+	HoldExpiresAt *timestamp.Timestamp `protobuf:"bytes,5,opt,name=hold_expires_at,json=holdExpiresAt,proto3" json:"hold_expires_at,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *Create_Order_Response) Reset() {
 	*x = Create_Order_Response{}
-	mi := &file_payment_service_proto_msgTypes[12]
+	mi := &file_payment_service_proto_msgTypes[13]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1095,7 +1159,7 @@ func (x *Create_Order_Response) String() string {
 func (*Create_Order_Response) ProtoMessage() {}
 
 func (x *Create_Order_Response) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[12]
+	mi := &file_payment_service_proto_msgTypes[13]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1108,7 +1172,7 @@ func (x *Create_Order_Response) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Create_Order_Response.ProtoReflect.Descriptor instead.
 func (*Create_Order_Response) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{12}
+	return file_payment_service_proto_rawDescGZIP(), []int{13}
 }
 
 func (x *Create_Order_Response) GetStatus() int32 {
@@ -1139,6 +1203,13 @@ func (x *Create_Order_Response) GetOrderId() []string {
 	return nil
 }
 
+func (x *Create_Order_Response) GetHoldExpiresAt() *timestamp.Timestamp {
+	if x != nil {
+		return x.HoldExpiresAt
+	}
+	return nil
+}
+
 type CreateCustomerRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	CustomerName  string                 `protobuf:"bytes,1,opt,name=customer_name,json=customerName,proto3" json:"customer_name,omitempty"`
@@ -1156,7 +1227,7 @@ type CreateCustomerRequest struct {
 
 func (x *CreateCustomerRequest) Reset() {
 	*x = CreateCustomerRequest{}
-	mi := &file_payment_service_proto_msgTypes[13]
+	mi := &file_payment_service_proto_msgTypes[14]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1168,7 +1239,7 @@ func (x *CreateCustomerRequest) String() string {
 func (*CreateCustomerRequest) ProtoMessage() {}
 
 func (x *CreateCustomerRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[13]
+	mi := &file_payment_service_proto_msgTypes[14]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1181,7 +1252,7 @@ func (x *CreateCustomerRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateCustomerRequest.ProtoReflect.Descriptor instead.
 func (*CreateCustomerRequest) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{13}
+	return file_payment_service_proto_rawDescGZIP(), []int{14}
 }
 
 func (x *CreateCustomerRequest) GetCustomerName() string {
@@ -1259,7 +1330,7 @@ type CreateCustomerResponse struct {
 
 func (x *CreateCustomerResponse) Reset() {
 	*x = CreateCustomerResponse{}
-	mi := &file_payment_service_proto_msgTypes[14]
+	mi := &file_payment_service_proto_msgTypes[15]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1271,7 +1342,7 @@ func (x *CreateCustomerResponse) String() string {
 func (*CreateCustomerResponse) ProtoMessage() {}
 
 func (x *CreateCustomerResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[14]
+	mi := &file_payment_service_proto_msgTypes[15]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1284,7 +1355,7 @@ func (x *CreateCustomerResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreateCustomerResponse.ProtoReflect.Descriptor instead.
 func (*CreateCustomerResponse) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{14}
+	return file_payment_service_proto_rawDescGZIP(), []int{15}
 }
 
 func (x *CreateCustomerResponse) GetStatus() int32 {
@@ -1318,13 +1389,17 @@ func (x *CreateCustomerResponse) GetCustomerId() string {
 type CreatePaymentLinkRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	IdempotentKey string                 `protobuf:"bytes,1,opt,name=idempotent_key,json=idempotentKey,proto3" json:"idempotent_key,omitempty"`
+	// Where the customer is sent after checkout, the ones given when the booking
+	// was created or the service defaults are used when empty
+	SuccessUrl    string `protobuf:"bytes,2,opt,name=success_url,json=successUrl,proto3" json:"success_url,omitempty"`
+	CancelUrl     string `protobuf:"bytes,3,opt,name=cancel_url,json=cancelUrl,proto3" json:"cancel_url,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *CreatePaymentLinkRequest) Reset() {
 	*x = CreatePaymentLinkRequest{}
-	mi := &file_payment_service_proto_msgTypes[15]
+	mi := &file_payment_service_proto_msgTypes[16]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1336,7 +1411,7 @@ func (x *CreatePaymentLinkRequest) String() string {
 func (*CreatePaymentLinkRequest) ProtoMessage() {}
 
 func (x *CreatePaymentLinkRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[15]
+	mi := &file_payment_service_proto_msgTypes[16]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1349,7 +1424,7 @@ func (x *CreatePaymentLinkRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreatePaymentLinkRequest.ProtoReflect.Descriptor instead.
 func (*CreatePaymentLinkRequest) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{15}
+	return file_payment_service_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *CreatePaymentLinkRequest) GetIdempotentKey() string {
@@ -1359,6 +1434,20 @@ func (x *CreatePaymentLinkRequest) GetIdempotentKey() string {
 	return ""
 }
 
+func (x *CreatePaymentLinkRequest) GetSuccessUrl() string {
+	if x != nil {
+		return x.SuccessUrl
+	}
+	return ""
+}
+
+func (x *CreatePaymentLinkRequest) GetCancelUrl() string {
+	if x != nil {
+		return x.CancelUrl
+	}
+	return ""
+}
+
 type CreatePaymentLinkResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
@@ -1371,7 +1460,7 @@ type CreatePaymentLinkResponse struct {
 
 func (x *CreatePaymentLinkResponse) Reset() {
 	*x = CreatePaymentLinkResponse{}
-	mi := &file_payment_service_proto_msgTypes[16]
+	mi := &file_payment_service_proto_msgTypes[17]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -1383,7 +1472,7 @@ func (x *CreatePaymentLinkResponse) String() string {
 func (*CreatePaymentLinkResponse) ProtoMessage() {}
 
 func (x *CreatePaymentLinkResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_payment_service_proto_msgTypes[16]
+	mi := &file_payment_service_proto_msgTypes[17]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -1396,7 +1485,7 @@ func (x *CreatePaymentLinkResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use CreatePaymentLinkResponse.ProtoReflect.Descriptor instead.
 func (*CreatePaymentLinkResponse) Descriptor() ([]byte, []int) {
-	return file_payment_service_proto_rawDescGZIP(), []int{16}
+	return file_payment_service_proto_rawDescGZIP(), []int{17}
 }
 
 func (x *CreatePaymentLinkResponse) GetStatus() int32 {
@@ -1427,27 +1516,182 @@ func (x *CreatePaymentLinkResponse) GetPaymentLink() string {
 	return ""
 }
 
+type RefundPaymentRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IdempotentKey string                 `protobuf:"bytes,1,opt,name=idempotent_key,json=idempotentKey,proto3" json:"idempotent_key,omitempty"`
+	PaymentId     string                 `protobuf:"bytes,2,opt,name=payment_id,json=paymentId,proto3" json:"payment_id,omitempty"`
+	// Seats to refund, every seat not refunded yet is refunded when empty
+	BookedSeatsIds []int32 `protobuf:"varint,3,rep,packed,name=booked_seats_ids,json=bookedSeatsIds,proto3" json:"booked_seats_ids,omitempty"`
+	Reason         string  `protobuf:"bytes,4,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *RefundPaymentRequest) Reset() {
+	*x = RefundPaymentRequest{}
+	mi := &file_payment_service_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefundPaymentRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefundPaymentRequest) ProtoMessage() {}
+
+func (x *RefundPaymentRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_payment_service_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefundPaymentRequest.ProtoReflect.Descriptor instead.
+func (*RefundPaymentRequest) Descriptor() ([]byte, []int) {
+	return file_payment_service_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *RefundPaymentRequest) GetIdempotentKey() string {
+	if x != nil {
+		return x.IdempotentKey
+	}
+	return ""
+}
+
+func (x *RefundPaymentRequest) GetPaymentId() string {
+	if x != nil {
+		return x.PaymentId
+	}
+	return ""
+}
+
+func (x *RefundPaymentRequest) GetBookedSeatsIds() []int32 {
+	if x != nil {
+		return x.BookedSeatsIds
+	}
+	return nil
+}
+
+func (x *RefundPaymentRequest) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type RefundPaymentResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Status        int32                  `protobuf:"varint,1,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string                 `protobuf:"bytes,2,opt,name=error,proto3" json:"error,omitempty"`
+	Message       string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	RefundId      string                 `protobuf:"bytes,4,opt,name=refund_id,json=refundId,proto3" json:"refund_id,omitempty"`
+	IsPartial     bool                   `protobuf:"varint,5,opt,name=is_partial,json=isPartial,proto3" json:"is_partial,omitempty"`
+	Amount        *Money                 `protobuf:"bytes,6,opt,name=amount,proto3" json:"amount,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RefundPaymentResponse) Reset() {
+	*x = RefundPaymentResponse{}
+	mi := &file_payment_service_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RefundPaymentResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RefundPaymentResponse) ProtoMessage() {}
+
+func (x *RefundPaymentResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_payment_service_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RefundPaymentResponse.ProtoReflect.Descriptor instead.
+func (*RefundPaymentResponse) Descriptor() ([]byte, []int) {
+	return file_payment_service_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *RefundPaymentResponse) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *RefundPaymentResponse) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *RefundPaymentResponse) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *RefundPaymentResponse) GetRefundId() string {
+	if x != nil {
+		return x.RefundId
+	}
+	return ""
+}
+
+func (x *RefundPaymentResponse) GetIsPartial() bool {
+	if x != nil {
+		return x.IsPartial
+	}
+	return false
+}
+
+func (x *RefundPaymentResponse) GetAmount() *Money {
+	if x != nil {
+		return x.Amount
+	}
+	return nil
+}
+
 var File_payment_service_proto protoreflect.FileDescriptor
 
 const file_payment_service_proto_rawDesc = "" +
 	"\n" +
-	"\x15payment_service.proto\x12\x0fmoviedb_service\x1a\x1fgoogle/protobuf/timestamp.proto\"\xd0\x01\n" +
-	"\x1cCheckoutSessionLineItemParam\x12\x14\n" +
-	"\x05price\x18\x01 \x01(\x05R\x05price\x12\x1a\n" +
+	"\x15payment_service.proto\x12\x0fmoviedb_service\x1a\x1fgoogle/protobuf/timestamp.proto\";\n" +
+	"\x05Money\x12\x16\n" +
+	"\x06amount\x18\x01 \x01(\x03R\x06amount\x12\x1a\n" +
+	"\bcurrency\x18\x02 \x01(\tR\bcurrency\"\xee\x01\n" +
+	"\x1cCheckoutSessionLineItemParam\x12\x1a\n" +
 	"\bquantity\x18\x02 \x01(\x05R\bquantity\x12>\n" +
 	"\vpaymentType\x18\x03 \x01(\x0e2\x1c.moviedb_service.PaymentTypeR\vpaymentType\x12\x1f\n" +
 	"\vsuccess_url\x18\x04 \x01(\tR\n" +
 	"successUrl\x12\x1d\n" +
 	"\n" +
-	"cancel_url\x18\x05 \x01(\tR\tcancelUrl\"\xf8\x01\n" +
+	"cancel_url\x18\x05 \x01(\tR\tcancelUrl\x12,\n" +
+	"\x05price\x18\x06 \x01(\v2\x16.moviedb_service.MoneyR\x05priceJ\x04\b\x01\x10\x02\"\x80\x02\n" +
 	"\rPaymentIntent\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
-	"\x06amount\x18\x02 \x01(\x03R\x06amount\x12\x1a\n" +
-	"\bcurrency\x18\x03 \x01(\tR\bcurrency\x12\x16\n" +
 	"\x06status\x18\x04 \x01(\tR\x06status\x12#\n" +
 	"\rclient_secret\x18\x05 \x01(\tR\fclientSecret\x120\n" +
 	"\x14payment_method_types\x18\x06 \x03(\tR\x12paymentMethodTypes\x124\n" +
-	"\acreated\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\acreated\"\x8c\x01\n" +
+	"\acreated\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\acreated\x12.\n" +
+	"\x06amount\x18\b \x01(\v2\x16.moviedb_service.MoneyR\x06amountJ\x04\b\x02\x10\x03J\x04\b\x03\x10\x04\"\x8c\x01\n" +
 	"\x1cCreateCheckoutSessionRequest\x12\x18\n" +
 	"\amovieID\x18\x01 \x01(\x05R\amovieID\x12R\n" +
 	"\rpayment_items\x18\x02 \x03(\v2-.moviedb_service.CheckoutSessionLineItemParamR\fpaymentItems\"g\n" +
@@ -1456,7 +1700,7 @@ const file_payment_service_proto_rawDesc = "" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
 	"\amessage\x18\x03 \x01(\tR\amessage\"8\n" +
 	"\x12ProductBookedSeats\x12\"\n" +
-	"\fBookedSeatID\x18\x01 \x01(\x05R\fBookedSeatID\"\x86\x04\n" +
+	"\fBookedSeatID\x18\x01 \x01(\x05R\fBookedSeatID\"\xad\x04\n" +
 	"!Create_Payment_Intent_INR_Request\x12\x1f\n" +
 	"\vsuccess_url\x18\x03 \x01(\tR\n" +
 	"successUrl\x125\n" +
@@ -1474,7 +1718,8 @@ const file_payment_service_proto_rawDesc = "" +
 	"\rseatMatrixIDs\x18\x12 \x03(\x05R\rseatMatrixIDs\x12\x19\n" +
 	"\bvenue_id\x18\x13 \x01(\x05R\avenueId\x12+\n" +
 	"\x12movie_time_slot_id\x18\x14 \x01(\x05R\x0fmovieTimeSlotId\x12#\n" +
-	"\rcustomer_name\x18\x15 \x01(\tR\fcustomerNameJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03J\x04\b\x05\x10\x06J\x04\b\b\x10\tJ\x04\b\x0f\x10\x10J\x04\b\x10\x10\x11J\x04\b\x11\x10\x12\"D\n" +
+	"\rcustomer_name\x18\x15 \x01(\tR\fcustomerName\x12%\n" +
+	"\x0eidempotent_key\x18\x16 \x01(\tR\ridempotentKeyJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03J\x04\b\x05\x10\x06J\x04\b\b\x10\tJ\x04\b\x0f\x10\x10J\x04\b\x10\x10\x11J\x04\b\x11\x10\x12\"D\n" +
 	"\x1bIsValidIdempotentKeyRequest\x12%\n" +
 	"\x0eidempotent_key\x18\x01 \x01(\tR\ridempotentKey\"i\n" +
 	"\x1cIsValidIdempotentKeyResponse\x12\x19\n" +
@@ -1492,21 +1737,23 @@ const file_payment_service_proto_rawDesc = "" +
 	"\x06status\x18\x01 \x01(\x05R\x06status\x12\x14\n" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
 	"\amessage\x18\x03 \x01(\tR\amessage\x12!\n" +
-	"\fpayment_link\x18\x06 \x01(\tR\vpaymentLinkJ\x04\b\x04\x10\x05J\x04\b\x05\x10\x06\"\x80\x01\n" +
+	"\fpayment_link\x18\x06 \x01(\tR\vpaymentLinkJ\x04\b\x04\x10\x05J\x04\b\x05\x10\x06\"\x9e\x01\n" +
 	"\x05Order\x12!\n" +
-	"\fproduct_name\x18\x01 \x01(\tR\vproductName\x12#\n" +
-	"\rproduct_price\x18\x02 \x01(\x05R\fproductPrice\x12/\n" +
-	"\x13product_description\x18\x03 \x01(\tR\x12productDescription\"\xc3\x01\n" +
+	"\fproduct_name\x18\x01 \x01(\tR\vproductName\x12/\n" +
+	"\x13product_description\x18\x03 \x01(\tR\x12productDescription\x12;\n" +
+	"\rproduct_price\x18\x04 \x01(\v2\x16.moviedb_service.MoneyR\fproductPriceJ\x04\b\x02\x10\x03\"\xfa\x01\n" +
 	"\x14Create_Order_Request\x12%\n" +
 	"\x0eidempotent_key\x18\x05 \x01(\tR\ridempotentKey\x12$\n" +
 	"\rseatMatrixIDs\x18\x06 \x03(\x05R\rseatMatrixIDs\x12\x19\n" +
 	"\bvenue_id\x18\a \x01(\x05R\avenueId\x12+\n" +
-	"\x12movie_time_slot_id\x18\b \x01(\x05R\x0fmovieTimeSlotIdJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03J\x04\b\x03\x10\x04J\x04\b\x04\x10\x05\"z\n" +
+	"\x12movie_time_slot_id\x18\b \x01(\x05R\x0fmovieTimeSlotId\x125\n" +
+	"\bcurrency\x18\t \x01(\x0e2\x19.moviedb_service.CurrencyR\bcurrencyJ\x04\b\x01\x10\x02J\x04\b\x02\x10\x03J\x04\b\x03\x10\x04J\x04\b\x04\x10\x05\"\xbe\x01\n" +
 	"\x15Create_Order_Response\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\x05R\x06status\x12\x14\n" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
 	"\amessage\x18\x03 \x01(\tR\amessage\x12\x19\n" +
-	"\border_id\x18\x04 \x03(\tR\aorderId\"\x92\x02\n" +
+	"\border_id\x18\x04 \x03(\tR\aorderId\x12B\n" +
+	"\x0fhold_expires_at\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\rholdExpiresAt\"\x92\x02\n" +
 	"\x15CreateCustomerRequest\x12#\n" +
 	"\rcustomer_name\x18\x01 \x01(\tR\fcustomerName\x12!\n" +
 	"\fphone_number\x18\x02 \x01(\tR\vphoneNumber\x12\x14\n" +
@@ -1522,14 +1769,32 @@ const file_payment_service_proto_rawDesc = "" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
 	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1f\n" +
 	"\vcustomer_id\x18\x04 \x01(\tR\n" +
-	"customerId\"A\n" +
+	"customerId\"\x81\x01\n" +
 	"\x18CreatePaymentLinkRequest\x12%\n" +
-	"\x0eidempotent_key\x18\x01 \x01(\tR\ridempotentKey\"\x86\x01\n" +
+	"\x0eidempotent_key\x18\x01 \x01(\tR\ridempotentKey\x12\x1f\n" +
+	"\vsuccess_url\x18\x02 \x01(\tR\n" +
+	"successUrl\x12\x1d\n" +
+	"\n" +
+	"cancel_url\x18\x03 \x01(\tR\tcancelUrl\"\x86\x01\n" +
 	"\x19CreatePaymentLinkResponse\x12\x16\n" +
 	"\x06status\x18\x01 \x01(\x05R\x06status\x12\x14\n" +
 	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
 	"\amessage\x18\x03 \x01(\tR\amessage\x12!\n" +
-	"\fpayment_link\x18\x04 \x01(\tR\vpaymentLink*\xd0\x01\n" +
+	"\fpayment_link\x18\x04 \x01(\tR\vpaymentLink\"\x9e\x01\n" +
+	"\x14RefundPaymentRequest\x12%\n" +
+	"\x0eidempotent_key\x18\x01 \x01(\tR\ridempotentKey\x12\x1d\n" +
+	"\n" +
+	"payment_id\x18\x02 \x01(\tR\tpaymentId\x12(\n" +
+	"\x10booked_seats_ids\x18\x03 \x03(\x05R\x0ebookedSeatsIds\x12\x16\n" +
+	"\x06reason\x18\x04 \x01(\tR\x06reason\"\xcb\x01\n" +
+	"\x15RefundPaymentResponse\x12\x16\n" +
+	"\x06status\x18\x01 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12\x1b\n" +
+	"\trefund_id\x18\x04 \x01(\tR\brefundId\x12\x1d\n" +
+	"\n" +
+	"is_partial\x18\x05 \x01(\bR\tisPartial\x12.\n" +
+	"\x06amount\x18\x06 \x01(\v2\x16.moviedb_service.MoneyR\x06amount*\xd0\x01\n" +
 	"\bCurrency\x12\a\n" +
 	"\x03INR\x10\x00\x12\a\n" +
 	"\x03USD\x10\x01\x12\a\n" +
@@ -1560,7 +1825,7 @@ const file_payment_service_proto_rawDesc = "" +
 	"\x15PAYMENT_STATUS_FAILED\x10\x02*,\n" +
 	"\vPaymentType\x12\x12\n" +
 	"\x0eTICKET_BOOKING\x10\x00\x12\t\n" +
-	"\x05MEALS\x10\x012\x8d\b\n" +
+	"\x05MEALS\x10\x012\xed\b\n" +
 	"\x0ePaymentService\x12v\n" +
 	"\x15CreateCheckOutSession\x12-.moviedb_service.CreateCheckoutSessionRequest\x1a..moviedb_service.CreateCheckoutSessionResponse\x12|\n" +
 	"\x11CreatePaymentLink\x122.moviedb_service.Create_Payment_Intent_INR_Request\x1a3.moviedb_service.Create_Payment_Intent_INR_Response\x12s\n" +
@@ -1570,7 +1835,8 @@ const file_payment_service_proto_rawDesc = "" +
 	"\x10CommitCustomerID\x12+.moviedb_service.CommitIdempotentKeyRequest\x1a3.moviedb_service.Create_Payment_Intent_INR_Response\x12r\n" +
 	"\x0eCommitOrderIds\x12+.moviedb_service.CommitIdempotentKeyRequest\x1a3.moviedb_service.Create_Payment_Intent_INR_Response\x12a\n" +
 	"\x0eCreateCustomer\x12&.moviedb_service.CreateCustomerRequest\x1a'.moviedb_service.CreateCustomerResponse\x12l\n" +
-	"\x13GeneratePaymentLink\x12).moviedb_service.CreatePaymentLinkRequest\x1a*.moviedb_service.CreatePaymentLinkResponseBNZLgithub.com/kartik7120/booking_payment_service/cmd/grpcServer;payment_serviceb\x06proto3"
+	"\x13GeneratePaymentLink\x12).moviedb_service.CreatePaymentLinkRequest\x1a*.moviedb_service.CreatePaymentLinkResponse\x12^\n" +
+	"\rRefundPayment\x12%.moviedb_service.RefundPaymentRequest\x1a&.moviedb_service.RefundPaymentResponseBNZLgithub.com/kartik7120/booking_payment_service/cmd/grpcServer;payment_serviceb\x06proto3"
 
 var (
 	file_payment_service_proto_rawDescOnce sync.Once
@@ -1585,58 +1851,69 @@ func file_payment_service_proto_rawDescGZIP() []byte {
 }
 
 var file_payment_service_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_payment_service_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
+var file_payment_service_proto_msgTypes = make([]protoimpl.MessageInfo, 20)
 var file_payment_service_proto_goTypes = []any{
 	(Currency)(0),                              // 0: moviedb_service.Currency
 	(PaymentStatus)(0),                         // 1: moviedb_service.PaymentStatus
 	(PaymentType)(0),                           // 2: moviedb_service.PaymentType
-	(*CheckoutSessionLineItemParam)(nil),       // 3: moviedb_service.CheckoutSessionLineItemParam
-	(*PaymentIntent)(nil),                      // 4: moviedb_service.PaymentIntent
-	(*CreateCheckoutSessionRequest)(nil),       // 5: moviedb_service.CreateCheckoutSessionRequest
-	(*CreateCheckoutSessionResponse)(nil),      // 6: moviedb_service.CreateCheckoutSessionResponse
-	(*ProductBookedSeats)(nil),                 // 7: moviedb_service.ProductBookedSeats
-	(*Create_Payment_Intent_INR_Request)(nil),  // 8: moviedb_service.Create_Payment_Intent_INR_Request
-	(*IsValidIdempotentKeyRequest)(nil),        // 9: moviedb_service.IsValidIdempotentKeyRequest
-	(*IsValidIdempotentKeyResponse)(nil),       // 10: moviedb_service.IsValidIdempotentKeyResponse
-	(*CommitIdempotentKeyRequest)(nil),         // 11: moviedb_service.CommitIdempotentKeyRequest
-	(*Create_Payment_Intent_INR_Response)(nil), // 12: moviedb_service.Create_Payment_Intent_INR_Response
-	(*Order)(nil),                              // 13: moviedb_service.Order
-	(*Create_Order_Request)(nil),               // 14: moviedb_service.Create_Order_Request
-	(*Create_Order_Response)(nil),              // 15: moviedb_service.Create_Order_Response
-	(*CreateCustomerRequest)(nil),              // 16: moviedb_service.CreateCustomerRequest
-	(*CreateCustomerResponse)(nil),             // 17: moviedb_service.CreateCustomerResponse
-	(*CreatePaymentLinkRequest)(nil),           // 18: moviedb_service.CreatePaymentLinkRequest
-	(*CreatePaymentLinkResponse)(nil),          // 19: moviedb_service.CreatePaymentLinkResponse
-	(*timestamp.Timestamp)(nil),                // 20: google.protobuf.Timestamp
+	(*Money)(nil),                              // 3: moviedb_service.Money
+	(*CheckoutSessionLineItemParam)(nil),       // 4: moviedb_service.CheckoutSessionLineItemParam
+	(*PaymentIntent)(nil),                      // 5: moviedb_service.PaymentIntent
+	(*CreateCheckoutSessionRequest)(nil),       // 6: moviedb_service.CreateCheckoutSessionRequest
+	(*CreateCheckoutSessionResponse)(nil),      // 7: moviedb_service.CreateCheckoutSessionResponse
+	(*ProductBookedSeats)(nil),                 // 8: moviedb_service.ProductBookedSeats
+	(*Create_Payment_Intent_INR_Request)(nil),  // 9: moviedb_service.Create_Payment_Intent_INR_Request
+	(*IsValidIdempotentKeyRequest)(nil),        // 10: moviedb_service.IsValidIdempotentKeyRequest
+	(*IsValidIdempotentKeyResponse)(nil),       // 11: moviedb_service.IsValidIdempotentKeyResponse
+	(*CommitIdempotentKeyRequest)(nil),         // 12: moviedb_service.CommitIdempotentKeyRequest
+	(*Create_Payment_Intent_INR_Response)(nil), // 13: moviedb_service.Create_Payment_Intent_INR_Response
+	(*Order)(nil),                              // 14: moviedb_service.Order
+	(*Create_Order_Request)(nil),               // 15: moviedb_service.Create_Order_Request
+	(*Create_Order_Response)(nil),              // 16: moviedb_service.Create_Order_Response
+	(*CreateCustomerRequest)(nil),              // 17: moviedb_service.CreateCustomerRequest
+	(*CreateCustomerResponse)(nil),             // 18: moviedb_service.CreateCustomerResponse
+	(*CreatePaymentLinkRequest)(nil),           // 19: moviedb_service.CreatePaymentLinkRequest
+	(*CreatePaymentLinkResponse)(nil),          // 20: moviedb_service.CreatePaymentLinkResponse
+	(*RefundPaymentRequest)(nil),               // 21: moviedb_service.RefundPaymentRequest
+	(*RefundPaymentResponse)(nil),              // 22: moviedb_service.RefundPaymentResponse
+	(*timestamp.Timestamp)(nil),                // 23: google.protobuf.Timestamp
 }
 var file_payment_service_proto_depIdxs = []int32{
 	2,  // 0: moviedb_service.CheckoutSessionLineItemParam.paymentType:type_name -> moviedb_service.PaymentType
-	20, // 1: moviedb_service.PaymentIntent.created:type_name -> google.protobuf.Timestamp
-	3,  // 2: moviedb_service.CreateCheckoutSessionRequest.payment_items:type_name -> moviedb_service.CheckoutSessionLineItemParam
-	0,  // 3: moviedb_service.Create_Payment_Intent_INR_Request.currency:type_name -> moviedb_service.Currency
-	5,  // 4: moviedb_service.PaymentService.CreateCheckOutSession:input_type -> moviedb_service.CreateCheckoutSessionRequest
-	8,  // 5: moviedb_service.PaymentService.CreatePaymentLink:input_type -> moviedb_service.Create_Payment_Intent_INR_Request
-	9,  // 6: moviedb_service.PaymentService.IsValidIdempotentKey:input_type -> moviedb_service.IsValidIdempotentKeyRequest
-	11, // 7: moviedb_service.PaymentService.CommitIdempotentKey:input_type -> moviedb_service.CommitIdempotentKeyRequest
-	14, // 8: moviedb_service.PaymentService.CreateOrder:input_type -> moviedb_service.Create_Order_Request
-	11, // 9: moviedb_service.PaymentService.CommitCustomerID:input_type -> moviedb_service.CommitIdempotentKeyRequest
-	11, // 10: moviedb_service.PaymentService.CommitOrderIds:input_type -> moviedb_service.CommitIdempotentKeyRequest
-	16, // 11: moviedb_service.PaymentService.CreateCustomer:input_type -> moviedb_service.CreateCustomerRequest
-	18, // 12: moviedb_service.PaymentService.GeneratePaymentLink:input_type -> moviedb_service.CreatePaymentLinkRequest
-	6,  // 13: moviedb_service.PaymentService.CreateCheckOutSession:output_type -> moviedb_service.CreateCheckoutSessionResponse
-	12, // 14: moviedb_service.PaymentService.CreatePaymentLink:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
-	10, // 15: moviedb_service.PaymentService.IsValidIdempotentKey:output_type -> moviedb_service.IsValidIdempotentKeyResponse
-	12, // 16: moviedb_service.PaymentService.CommitIdempotentKey:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
-	15, // 17: moviedb_service.PaymentService.CreateOrder:output_type -> moviedb_service.Create_Order_Response
-	12, // 18: moviedb_service.PaymentService.CommitCustomerID:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
-	12, // 19: moviedb_service.PaymentService.CommitOrderIds:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
-	17, // 20: moviedb_service.PaymentService.CreateCustomer:output_type -> moviedb_service.CreateCustomerResponse
-	19, // 21: moviedb_service.PaymentService.GeneratePaymentLink:output_type -> moviedb_service.CreatePaymentLinkResponse
-	13, // [13:22] is the sub-list for method output_type
-	4,  // [4:13] is the sub-list for method input_type
-	4,  // [4:4] is the sub-list for extension type_name
-	4,  // [4:4] is the sub-list for extension extendee
-	0,  // [0:4] is the sub-list for field type_name
+	3,  // 1: moviedb_service.CheckoutSessionLineItemParam.price:type_name -> moviedb_service.Money
+	23, // 2: moviedb_service.PaymentIntent.created:type_name -> google.protobuf.Timestamp
+	3,  // 3: moviedb_service.PaymentIntent.amount:type_name -> moviedb_service.Money
+	4,  // 4: moviedb_service.CreateCheckoutSessionRequest.payment_items:type_name -> moviedb_service.CheckoutSessionLineItemParam
+	0,  // 5: moviedb_service.Create_Payment_Intent_INR_Request.currency:type_name -> moviedb_service.Currency
+	3,  // 6: moviedb_service.Order.product_price:type_name -> moviedb_service.Money
+	0,  // 7: moviedb_service.Create_Order_Request.currency:type_name -> moviedb_service.Currency
+	23, // 8: moviedb_service.Create_Order_Response.hold_expires_at:type_name -> google.protobuf.Timestamp
+	3,  // 9: moviedb_service.RefundPaymentResponse.amount:type_name -> moviedb_service.Money
+	6,  // 10: moviedb_service.PaymentService.CreateCheckOutSession:input_type -> moviedb_service.CreateCheckoutSessionRequest
+	9,  // 11: moviedb_service.PaymentService.CreatePaymentLink:input_type -> moviedb_service.Create_Payment_Intent_INR_Request
+	10, // 12: moviedb_service.PaymentService.IsValidIdempotentKey:input_type -> moviedb_service.IsValidIdempotentKeyRequest
+	12, // 13: moviedb_service.PaymentService.CommitIdempotentKey:input_type -> moviedb_service.CommitIdempotentKeyRequest
+	15, // 14: moviedb_service.PaymentService.CreateOrder:input_type -> moviedb_service.Create_Order_Request
+	12, // 15: moviedb_service.PaymentService.CommitCustomerID:input_type -> moviedb_service.CommitIdempotentKeyRequest
+	12, // 16: moviedb_service.PaymentService.CommitOrderIds:input_type -> moviedb_service.CommitIdempotentKeyRequest
+	17, // 17: moviedb_service.PaymentService.CreateCustomer:input_type -> moviedb_service.CreateCustomerRequest
+	19, // 18: moviedb_service.PaymentService.GeneratePaymentLink:input_type -> moviedb_service.CreatePaymentLinkRequest
+	21, // 19: moviedb_service.PaymentService.RefundPayment:input_type -> moviedb_service.RefundPaymentRequest
+	7,  // 20: moviedb_service.PaymentService.CreateCheckOutSession:output_type -> moviedb_service.CreateCheckoutSessionResponse
+	13, // 21: moviedb_service.PaymentService.CreatePaymentLink:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
+	11, // 22: moviedb_service.PaymentService.IsValidIdempotentKey:output_type -> moviedb_service.IsValidIdempotentKeyResponse
+	13, // 23: moviedb_service.PaymentService.CommitIdempotentKey:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
+	16, // 24: moviedb_service.PaymentService.CreateOrder:output_type -> moviedb_service.Create_Order_Response
+	13, // 25: moviedb_service.PaymentService.CommitCustomerID:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
+	13, // 26: moviedb_service.PaymentService.CommitOrderIds:output_type -> moviedb_service.Create_Payment_Intent_INR_Response
+	18, // 27: moviedb_service.PaymentService.CreateCustomer:output_type -> moviedb_service.CreateCustomerResponse
+	20, // 28: moviedb_service.PaymentService.GeneratePaymentLink:output_type -> moviedb_service.CreatePaymentLinkResponse
+	22, // 29: moviedb_service.PaymentService.RefundPayment:output_type -> moviedb_service.RefundPaymentResponse
+	20, // [20:30] is the sub-list for method output_type
+	10, // [10:20] is the sub-list for method input_type
+	10, // [10:10] is the sub-list for extension type_name
+	10, // [10:10] is the sub-list for extension extendee
+	0,  // [0:10] is the sub-list for field type_name
 }
 
 func init() { file_payment_service_proto_init() }
@@ -1650,7 +1927,7 @@ func file_payment_service_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_payment_service_proto_rawDesc), len(file_payment_service_proto_rawDesc)),
 			NumEnums:      3,
-			NumMessages:   17,
+			NumMessages:   20,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
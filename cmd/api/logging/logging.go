@@ -0,0 +1,102 @@
+// Package logging sets up the logrus output of the payment service and carries
+// a request-scoped logger in the context of every call. Entries of one gRPC
+// call or HTTP request share its request ID, RPC name, idempotent key and trace
+// ID. Personal data is masked before anything is written.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	log "github.com/sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type contextKey struct{}
+
+// Setup writes the entries of logger to stdout in format at level and masks
+// personal data in them
+func Setup(logger *log.Logger, format string, level string) error {
+
+	lvl, err := log.ParseLevel(level)
+
+	if err != nil {
+		return fmt.Errorf("invalid log level: %w", err)
+	}
+
+	var formatter log.Formatter
+
+	switch format {
+	case config.LogFormatJSON:
+		formatter = &log.JSONFormatter{TimestampFormat: time.RFC3339Nano}
+	case config.LogFormatText:
+		formatter = &log.TextFormatter{FullTimestamp: true}
+	default:
+		return fmt.Errorf("unknown log format %q", format)
+	}
+
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&RedactingFormatter{Next: formatter})
+	logger.SetLevel(lvl)
+
+	return nil
+}
+
+// NewContext returns a copy of ctx carrying entry
+func NewContext(ctx context.Context, entry *log.Entry) context.Context {
+	return context.WithValue(ctx, contextKey{}, entry)
+}
+
+// FromContext returns the logger of the call ctx belongs to, the standard
+// logger when there is none
+func FromContext(ctx context.Context) *log.Entry {
+	return FromContextOr(ctx, log.StandardLogger())
+}
+
+// FromContextOr returns the logger of the call ctx belongs to, logger when
+// there is none
+func FromContextOr(ctx context.Context, logger *log.Logger) *log.Entry {
+
+	if ctx != nil {
+		if entry, ok := ctx.Value(contextKey{}).(*log.Entry); ok {
+			return entry
+		}
+	}
+
+	return log.NewEntry(logger)
+}
+
+// WithFields returns a copy of ctx whose logger adds fields to every entry
+func WithFields(ctx context.Context, fields log.Fields) context.Context {
+	return NewContext(ctx, FromContext(ctx).WithFields(fields))
+}
+
+// traceFields ties entries to the trace of ctx, if it has one
+func traceFields(ctx context.Context, fields log.Fields) {
+
+	sc := trace.SpanContextFromContext(ctx)
+
+	if !sc.IsValid() {
+		return
+	}
+
+	fields["trace_id"] = sc.TraceID().String()
+	fields["span_id"] = sc.SpanID().String()
+}
+
+// newRequestID returns a random ID for a request that came without one
+func newRequestID() string {
+
+	b := make([]byte, 8)
+
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+
+	return hex.EncodeToString(b)
+}
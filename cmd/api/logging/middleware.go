@@ -0,0 +1,133 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// RequestIDHeader carries the request ID in gRPC metadata and HTTP headers. An
+// ID sent by the caller is kept, so one ID follows a request across services.
+const RequestIDHeader = "x-request-id"
+
+// maxRequestIDLength caps request IDs sent by callers
+const maxRequestIDLength = 128
+
+// UnaryServerInterceptor puts a logger for the call in its context and logs
+// the outcome of the call. It goes after the tracing stats handler so entries
+// carry the trace ID.
+func UnaryServerInterceptor(logger *log.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		fields := callFields(ctx, info.FullMethod)
+
+		if r, ok := req.(interface{ GetIdempotentKey() string }); ok && r.GetIdempotentKey() != "" {
+			fields["idempotent_key"] = r.GetIdempotentKey()
+		}
+
+		entry := logger.WithFields(fields)
+
+		start := time.Now()
+
+		resp, err := handler(NewContext(ctx, entry), req)
+
+		logCall(entry, start, err)
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs
+func StreamServerInterceptor(logger *log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		entry := logger.WithFields(callFields(ss.Context(), info.FullMethod))
+
+		start := time.Now()
+
+		err := handler(srv, &loggerStream{ServerStream: ss, ctx: NewContext(ss.Context(), entry)})
+
+		logCall(entry, start, err)
+
+		return err
+	}
+}
+
+type loggerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *loggerStream) Context() context.Context {
+	return s.ctx
+}
+
+// callFields takes the request ID from the metadata of the call, or makes one
+// up, and sends it back to the caller
+func callFields(ctx context.Context, fullMethod string) log.Fields {
+
+	requestID := ""
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if ids := md.Get(RequestIDHeader); len(ids) > 0 {
+			requestID = ids[0]
+		}
+	}
+
+	requestID = requestIDOrNew(requestID)
+
+	grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, requestID))
+
+	fields := log.Fields{"request_id": requestID, "rpc": fullMethod}
+
+	traceFields(ctx, fields)
+
+	return fields
+}
+
+func logCall(entry *log.Entry, start time.Time, err error) {
+
+	entry = entry.WithFields(log.Fields{
+		"grpc_code":   status.Code(err).String(),
+		"duration_ms": time.Since(start).Milliseconds(),
+	})
+
+	if err != nil {
+		entry.Info("Finished call with error")
+		return
+	}
+
+	entry.Info("Finished call")
+}
+
+// Handler puts a logger for the request in its context, with the request ID
+// of the X-Request-Id header or a new one that is sent back
+func Handler(logger *log.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+
+		requestID := requestIDOrNew(r.Header.Get(RequestIDHeader))
+
+		w.Header().Set(RequestIDHeader, requestID)
+
+		fields := log.Fields{"request_id": requestID, "path": r.URL.Path}
+
+		traceFields(r.Context(), fields)
+
+		h.ServeHTTP(w, r.WithContext(NewContext(r.Context(), logger.WithFields(fields))))
+	})
+}
+
+// requestIDOrNew keeps the request ID of the caller unless it is empty or too long
+func requestIDOrNew(requestID string) string {
+
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return newRequestID()
+	}
+
+	return requestID
+}
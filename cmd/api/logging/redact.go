@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	cardPattern  = regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`)
+	// International numbers with a country code, e.g. +91 98765 43210, and
+	// national ten digit numbers
+	phonePattern = regexp.MustCompile(`\+\d[\d -]{6,17}\d|\b\d{10}\b`)
+)
+
+// Redact masks email addresses, card numbers and phone numbers in s. Enough is
+// kept to tell values apart: the first letter and the domain of an email, the
+// last four digits of a card and the last two of a phone number.
+func Redact(s string) string {
+
+	s = emailPattern.ReplaceAllStringFunc(s, func(email string) string {
+		at := strings.LastIndex(email, "@")
+		return email[:1] + "***" + email[at:]
+	})
+
+	s = cardPattern.ReplaceAllStringFunc(s, func(match string) string {
+
+		digits := onlyDigits(match)
+
+		if !luhn(digits) {
+			return match
+		}
+
+		return "****" + digits[len(digits)-4:]
+	})
+
+	s = phonePattern.ReplaceAllStringFunc(s, func(match string) string {
+
+		digits := onlyDigits(match)
+
+		if len(digits) < 8 || len(digits) > 15 {
+			return match
+		}
+
+		return "***" + digits[len(digits)-2:]
+	})
+
+	return s
+}
+
+// RedactingFormatter masks personal data in the message and the fields of every
+// entry before Next writes it, so nothing logged anywhere in the service leaks
+// an email, a phone or a card number
+type RedactingFormatter struct {
+	Next log.Formatter
+}
+
+func (f *RedactingFormatter) Format(entry *log.Entry) ([]byte, error) {
+
+	redacted := *entry
+	redacted.Message = Redact(entry.Message)
+	redacted.Data = make(log.Fields, len(entry.Data))
+
+	for key, value := range entry.Data {
+		switch v := value.(type) {
+		case string:
+			redacted.Data[key] = Redact(v)
+		case error:
+			redacted.Data[key] = Redact(v.Error())
+		default:
+			redacted.Data[key] = value
+		}
+	}
+
+	return f.Next.Format(&redacted)
+}
+
+func onlyDigits(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, s)
+}
+
+// luhn reports whether digits pass the checksum of card numbers, which keeps
+// other long numbers such as amounts in minor units readable
+func luhn(digits string) bool {
+
+	sum := 0
+
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+
+		if (len(digits)-i)%2 == 0 {
+			d *= 2
+
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+	}
+
+	return sum%10 == 0
+}
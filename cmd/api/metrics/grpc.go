@@ -0,0 +1,88 @@
+package metrics
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// UnaryServerInterceptor records the grpc_server metrics of every unary RPC.
+// It goes first in the chain so calls rejected by later interceptors, e.g.
+// for missing credentials, are counted too.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		service, method := splitMethod(info.FullMethod)
+
+		RPCsStarted.WithLabelValues("unary", service, method).Inc()
+
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		RPCDuration.WithLabelValues("unary", service, method).Observe(time.Since(start).Seconds())
+		RPCsHandled.WithLabelValues("unary", service, method, status.Code(err).String()).Inc()
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is UnaryServerInterceptor for streaming RPCs
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+
+		service, method := splitMethod(info.FullMethod)
+
+		rpcType := "bidi_stream"
+
+		switch {
+		case info.IsClientStream && !info.IsServerStream:
+			rpcType = "client_stream"
+		case !info.IsClientStream && info.IsServerStream:
+			rpcType = "server_stream"
+		}
+
+		RPCsStarted.WithLabelValues(rpcType, service, method).Inc()
+
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		RPCDuration.WithLabelValues(rpcType, service, method).Observe(time.Since(start).Seconds())
+		RPCsHandled.WithLabelValues(rpcType, service, method, status.Code(err).String()).Inc()
+
+		return err
+	}
+}
+
+// UnaryClientInterceptor records the latency of every call made on a client
+// connection to service, the operation is the RPC name
+func UnaryClientInterceptor(service string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, fullMethod string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+
+		_, method := splitMethod(fullMethod)
+
+		start := time.Now()
+
+		err := invoker(ctx, fullMethod, req, reply, cc, opts...)
+
+		ObserveOutbound(service, method, start, err)
+
+		return err
+	}
+}
+
+// splitMethod splits /package.Service/Method into the service and the method
+func splitMethod(fullMethod string) (string, string) {
+
+	service, method, ok := strings.Cut(strings.TrimPrefix(fullMethod, "/"), "/")
+
+	if !ok {
+		return "unknown", "unknown"
+	}
+
+	return service, method
+}
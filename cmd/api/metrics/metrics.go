@@ -0,0 +1,159 @@
+// Package metrics holds the Prometheus metrics of the payment service: gRPC
+// server metrics per RPC, latencies, retries and circuit breaker states of
+// calls to the payment provider and the movie DB service, and business
+// counters of the booking flow. Everything is
+// registered in Registry, which Handler serves.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Services named by the service label of outbound calls
+const (
+	ServiceDodo    = "dodo"
+	ServiceMovieDB = "moviedb"
+)
+
+// Registry holds every metric of the service, the default registry is left
+// alone so libraries cannot add to the endpoint unnoticed
+var Registry = prometheus.NewRegistry()
+
+var (
+	RPCsStarted = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "RPCs started on the server.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+
+	RPCsHandled = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "RPCs completed on the server, by status code.",
+	}, []string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+
+	RPCDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Time the server took to handle RPCs.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})
+
+	OutboundDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "payment_service_outbound_request_duration_seconds",
+		Help:    "Latency of calls to the payment provider and the movie DB service.",
+		Buckets: []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"service", "operation", "outcome"})
+
+	OutboundRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_outbound_retries_total",
+		Help: "Calls to other services that failed and were made again.",
+	}, []string{"service", "operation"})
+
+	CircuitBreakerState = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "payment_service_circuit_breaker_state",
+		Help: "State of the circuit breaker in front of a service: 0 closed, 1 half-open, 2 open.",
+	}, []string{"service"})
+
+	CircuitBreakerTransitions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_circuit_breaker_transitions_total",
+		Help: "Changes of circuit breaker state, by the state entered.",
+	}, []string{"service", "state"})
+
+	OrdersCreated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_orders_created_total",
+		Help: "Booking sessions whose seats were held and priced.",
+	}, []string{"currency", "venue"})
+
+	PaymentLinksGenerated = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_payment_links_generated_total",
+		Help: "Payment links handed out to customers, retries after a failed payment included.",
+	}, []string{"currency", "venue"})
+
+	PaymentsSucceeded = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_payments_succeeded_total",
+		Help: "Payments captured by the payment provider.",
+	}, []string{"currency", "venue"})
+
+	PaymentsFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_payments_failed_total",
+		Help: "Payment attempts that failed.",
+	}, []string{"currency", "venue"})
+
+	Refunds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_refunds_total",
+		Help: "Refunds issued, by whether only some seats were refunded.",
+	}, []string{"currency", "venue", "partial"})
+
+	SessionsExpired = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "payment_service_sessions_expired_total",
+		Help: "Booking sessions that expired before they were paid for.",
+	}, []string{"currency", "venue"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		RPCsStarted,
+		RPCsHandled,
+		RPCDuration,
+		OutboundDuration,
+		OutboundRetries,
+		CircuitBreakerState,
+		CircuitBreakerTransitions,
+		OrdersCreated,
+		PaymentLinksGenerated,
+		PaymentsSucceeded,
+		PaymentsFailed,
+		Refunds,
+		SessionsExpired,
+	)
+}
+
+// Handler serves the metrics of Registry in the Prometheus text format
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+// Venue is the venue label of a venue ID, unknown for sessions created before
+// the venue was recorded
+func Venue(venueID uint) string {
+
+	if venueID == 0 {
+		return "unknown"
+	}
+
+	return strconv.FormatUint(uint64(venueID), 10)
+}
+
+// ObserveOutbound records a call to service that started at start and ended with err
+func ObserveOutbound(service string, operation string, start time.Time, err error) {
+
+	outcome := "ok"
+
+	if err != nil {
+		outcome = "error"
+	}
+
+	OutboundDuration.WithLabelValues(service, operation, outcome).Observe(time.Since(start).Seconds())
+}
+
+// Register adds collectors of other packages, e.g. gauges read from the
+// database, to Registry
+func Register(cs ...prometheus.Collector) error {
+
+	var errs []error
+
+	for _, c := range cs {
+		if err := Registry.Register(c); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
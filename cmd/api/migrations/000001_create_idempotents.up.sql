@@ -0,0 +1,21 @@
+-- Databases created by AutoMigrate before migrations existed already have this table
+CREATE TABLE IF NOT EXISTS idempotents (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    payment_id text DEFAULT NULL,
+    customer_id text NOT NULL,
+    idempotent_key text NOT NULL,
+    order_ids text[],
+    expired_at timestamptz NOT NULL,
+    payment_status text DEFAULT 'pending',
+    booked_seats_id integer[],
+    movie_time_slot_id bigint NOT NULL,
+    is_ticket_sent boolean DEFAULT false,
+    is_mail_send boolean DEFAULT false,
+    CONSTRAINT uni_idempotents_payment_id UNIQUE (payment_id),
+    CONSTRAINT uni_idempotents_idempotent_key UNIQUE (idempotent_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotents_deleted_at ON idempotents (deleted_at);
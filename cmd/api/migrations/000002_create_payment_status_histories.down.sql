@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS payment_status_histories;
+
+ALTER TABLE idempotents ALTER COLUMN payment_status SET DEFAULT 'pending';
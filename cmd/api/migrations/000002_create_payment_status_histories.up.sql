@@ -0,0 +1,15 @@
+ALTER TABLE idempotents ALTER COLUMN payment_status SET DEFAULT 'PENDING';
+
+CREATE TABLE IF NOT EXISTS payment_status_histories (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    idempotent_key text NOT NULL,
+    from_status varchar(32),
+    to_status varchar(32) NOT NULL,
+    reason varchar(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payment_status_histories_deleted_at ON payment_status_histories (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_payment_status_histories_idempotent_key ON payment_status_histories (idempotent_key);
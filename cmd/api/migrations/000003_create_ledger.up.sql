@@ -0,0 +1,55 @@
+CREATE TABLE IF NOT EXISTS account_types (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    code varchar(50) NOT NULL,
+    name varchar(100) NOT NULL,
+    normal_balance varchar(6) NOT NULL,
+    CONSTRAINT uni_account_types_code UNIQUE (code)
+);
+
+CREATE INDEX IF NOT EXISTS idx_account_types_deleted_at ON account_types (deleted_at);
+
+CREATE TABLE IF NOT EXISTS accounts (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    type varchar(50) NOT NULL,
+    owner_id varchar(100) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_accounts_deleted_at ON accounts (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_account_type_owner ON accounts (type, owner_id);
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    reference varchar(150) NOT NULL,
+    idempotent_key text,
+    description varchar(255),
+    CONSTRAINT uni_journal_entries_reference UNIQUE (reference)
+);
+
+CREATE INDEX IF NOT EXISTS idx_journal_entries_deleted_at ON journal_entries (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_journal_entries_idempotent_key ON journal_entries (idempotent_key);
+
+CREATE TABLE IF NOT EXISTS postings (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    journal_entry_id bigint NOT NULL,
+    account_id bigint NOT NULL,
+    amount bigint NOT NULL,
+    currency varchar(3) NOT NULL,
+    CONSTRAINT fk_journal_entries_postings FOREIGN KEY (journal_entry_id) REFERENCES journal_entries (id),
+    CONSTRAINT fk_postings_account FOREIGN KEY (account_id) REFERENCES accounts (id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_postings_deleted_at ON postings (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_postings_account_id ON postings (account_id);
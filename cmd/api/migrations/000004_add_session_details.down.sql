@@ -0,0 +1,9 @@
+ALTER TABLE idempotents
+    DROP COLUMN IF EXISTS currency,
+    DROP COLUMN IF EXISTS billing_country,
+    DROP COLUMN IF EXISTS billing_state,
+    DROP COLUMN IF EXISTS billing_city,
+    DROP COLUMN IF EXISTS billing_street,
+    DROP COLUMN IF EXISTS billing_zipcode,
+    DROP COLUMN IF EXISTS success_url,
+    DROP COLUMN IF EXISTS cancel_url;
@@ -0,0 +1,9 @@
+ALTER TABLE idempotents
+    ADD COLUMN IF NOT EXISTS currency varchar(3) DEFAULT 'INR',
+    ADD COLUMN IF NOT EXISTS billing_country varchar(2),
+    ADD COLUMN IF NOT EXISTS billing_state text,
+    ADD COLUMN IF NOT EXISTS billing_city text,
+    ADD COLUMN IF NOT EXISTS billing_street text,
+    ADD COLUMN IF NOT EXISTS billing_zipcode text,
+    ADD COLUMN IF NOT EXISTS success_url text,
+    ADD COLUMN IF NOT EXISTS cancel_url text;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS catalog_products (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    catalog_key varchar(64) NOT NULL,
+    movie_name varchar(255) NOT NULL,
+    seat_type varchar(50) NOT NULL,
+    price_amount bigint NOT NULL,
+    price_currency varchar(3) NOT NULL,
+    version bigint NOT NULL DEFAULT 1,
+    active boolean NOT NULL DEFAULT true,
+    product_id varchar(100) NOT NULL,
+    CONSTRAINT uni_catalog_products_catalog_key UNIQUE (catalog_key),
+    CONSTRAINT uni_catalog_products_product_id UNIQUE (product_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_catalog_products_deleted_at ON catalog_products (deleted_at);
+CREATE INDEX IF NOT EXISTS idx_catalog_product_line ON catalog_products (movie_name, seat_type);
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS booked_seats (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    seat_number text NOT NULL,
+    movie_time_slot_id bigint NOT NULL,
+    seat_matrix_id bigint NOT NULL,
+    booked_seat_id integer,
+    is_booked boolean,
+    email text,
+    phone_number text,
+    locked_until timestamptz,
+    hold_key varchar(255)
+);
+
+CREATE INDEX IF NOT EXISTS idx_booked_seats_deleted_at ON booked_seats (deleted_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_unique_booked_seats ON booked_seats (movie_time_slot_id, seat_matrix_id);
+CREATE INDEX IF NOT EXISTS idx_booked_seats_booked_seat_id ON booked_seats (booked_seat_id);
+CREATE INDEX IF NOT EXISTS idx_booked_seats_hold_key ON booked_seats (hold_key);
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS payments (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    movie_id bigint NOT NULL,
+    amount_amount bigint NOT NULL,
+    amount_currency varchar(3) NOT NULL,
+    email text NOT NULL,
+    phone text NOT NULL,
+    address text NOT NULL,
+    movie_name text NOT NULL,
+    payment_status text NOT NULL,
+    payment_method text NOT NULL,
+    transaction_id text NOT NULL,
+    quantity bigint NOT NULL,
+    price_amount bigint NOT NULL,
+    price_currency varchar(3) NOT NULL,
+    customer_id text NOT NULL,
+    venue_id bigint NOT NULL,
+    movie_time_slot_id bigint NOT NULL,
+    CONSTRAINT uni_payments_transaction_id UNIQUE (transaction_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_payments_deleted_at ON payments (deleted_at);
+
+CREATE TABLE IF NOT EXISTS orders (
+    id bigserial PRIMARY KEY,
+    created_at timestamptz,
+    updated_at timestamptz,
+    deleted_at timestamptz,
+    product_id bigint NOT NULL,
+    quantity bigint NOT NULL,
+    price_amount bigint NOT NULL,
+    price_currency varchar(3) NOT NULL,
+    payment_id bigint NOT NULL,
+    customer_id text NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_orders_deleted_at ON orders (deleted_at);
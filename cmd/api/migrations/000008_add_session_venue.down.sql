@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    DROP COLUMN IF EXISTS venue_id;
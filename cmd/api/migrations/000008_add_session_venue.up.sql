@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    ADD COLUMN IF NOT EXISTS venue_id bigint NOT NULL DEFAULT 0;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    DROP COLUMN IF EXISTS payment_link;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    DROP COLUMN IF EXISTS seats_claimed_until;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    ADD COLUMN IF NOT EXISTS seats_claimed_until timestamptz;
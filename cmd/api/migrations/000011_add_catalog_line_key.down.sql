@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS idx_catalog_product_line_active;
+DROP INDEX IF EXISTS idx_catalog_product_line_version;
+
+CREATE INDEX IF NOT EXISTS idx_catalog_product_line ON catalog_products (movie_name, seat_type);
+
+ALTER TABLE catalog_products
+    DROP COLUMN IF EXISTS line_key;
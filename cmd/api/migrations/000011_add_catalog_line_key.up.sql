@@ -0,0 +1,33 @@
+ALTER TABLE catalog_products
+    ADD COLUMN IF NOT EXISTS line_key varchar(64);
+
+-- Same normalization as server.CatalogLineKey, lines forked by differently cased
+-- movie names become one line again
+
+UPDATE catalog_products
+SET line_key = encode(sha256(convert_to(lower(btrim(movie_name)) || chr(31) || upper(seat_type) || chr(31) || price_currency, 'UTF8')), 'hex');
+
+-- Versions of merged lines are numbered again in their order, the latest one stays active
+
+UPDATE catalog_products c
+SET version = numbered.version
+FROM (
+    SELECT id, row_number() OVER (PARTITION BY line_key ORDER BY version, id) AS version
+    FROM catalog_products
+) numbered
+WHERE c.id = numbered.id;
+
+UPDATE catalog_products c
+SET active = false
+WHERE active AND EXISTS (
+    SELECT 1 FROM catalog_products newer
+    WHERE newer.line_key = c.line_key AND newer.active AND newer.version > c.version
+);
+
+ALTER TABLE catalog_products
+    ALTER COLUMN line_key SET NOT NULL;
+
+DROP INDEX IF EXISTS idx_catalog_product_line;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_catalog_product_line_version ON catalog_products (line_key, version);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_catalog_product_line_active ON catalog_products (line_key) WHERE active;
@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    DROP COLUMN IF EXISTS refunded_seats_id;
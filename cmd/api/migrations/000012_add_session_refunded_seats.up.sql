@@ -0,0 +1,2 @@
+ALTER TABLE idempotents
+    ADD COLUMN IF NOT EXISTS refunded_seats_id integer[];
@@ -0,0 +1,238 @@
+// Package migrations holds the versioned SQL schema of the payment service. The
+// files are embedded in the binary and applied with golang-migrate, which keeps
+// the applied version in the schema_migrations table.
+package migrations
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+var (
+	ErrSchemaOutdated = errors.New("database schema is not up to date")
+	ErrSchemaDirty    = errors.New("database schema is dirty, a migration failed half way")
+)
+
+// Status is the schema version of a database against the embedded migrations
+type Status struct {
+	Version uint   // Applied version, 0 when nothing was applied
+	Dirty   bool   // A migration failed and has to be fixed by hand
+	Latest  uint   // Version of the newest embedded migration
+	Pending []uint // Versions not applied yet, oldest first
+}
+
+func (s Status) String() string {
+
+	state := "up to date"
+
+	switch {
+	case s.Dirty:
+		state = "dirty"
+	case len(s.Pending) > 0:
+		state = fmt.Sprintf("%d pending", len(s.Pending))
+	}
+
+	return fmt.Sprintf("version %d of %d, %s", s.Version, s.Latest, state)
+}
+
+// Versions returns the versions of the embedded migrations, oldest first
+func Versions() ([]uint, error) {
+
+	names, err := fs.Glob(files, "*.up.sql")
+
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []uint
+
+	for _, name := range names {
+		prefix, _, ok := strings.Cut(name, "_")
+
+		if !ok {
+			return nil, fmt.Errorf("migration %s has no version prefix", name)
+		}
+
+		version, err := strconv.ParseUint(prefix, 10, 64)
+
+		if err != nil {
+			return nil, fmt.Errorf("migration %s has an invalid version: %w", name, err)
+		}
+
+		versions = append(versions, uint(version))
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	return versions, nil
+}
+
+// Files returns the embedded migration files
+func Files() fs.FS {
+	return files
+}
+
+// Latest returns the version of the newest embedded migration
+func Latest() (uint, error) {
+
+	versions, err := Versions()
+
+	if err != nil {
+		return 0, err
+	}
+
+	if len(versions) == 0 {
+		return 0, nil
+	}
+
+	return versions[len(versions)-1], nil
+}
+
+// Migrator applies the embedded migrations to a database
+type Migrator struct {
+	m *migrate.Migrate
+}
+
+// New prepares the migrations for the database
+func New(db *sql.DB) (*Migrator, error) {
+
+	source, err := iofs.New(files, ".")
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedded migrations: %w", err)
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare database for migrations: %w", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare migrations: %w", err)
+	}
+
+	return &Migrator{m: m}, nil
+}
+
+// Up applies every pending migration
+func (mg *Migrator) Up() error {
+
+	if err := mg.m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to apply migrations: %w", err)
+	}
+
+	return nil
+}
+
+// Down rolls back the given number of migrations, newest first
+func (mg *Migrator) Down(steps int) error {
+
+	if steps <= 0 {
+		return fmt.Errorf("number of migrations to roll back must be positive, got %d", steps)
+	}
+
+	if err := mg.m.Steps(-steps); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("failed to roll back migrations: %w", err)
+	}
+
+	return nil
+}
+
+// Status reports the applied version and the migrations still pending
+func (mg *Migrator) Status() (Status, error) {
+
+	version, dirty, err := mg.m.Version()
+
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return Status{}, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	return newStatus(version, dirty)
+}
+
+// Close releases the database connection, the *sql.DB passed to New is closed with it
+func (mg *Migrator) Close() error {
+
+	sourceErr, databaseErr := mg.m.Close()
+
+	return errors.Join(sourceErr, databaseErr)
+}
+
+// Check reads the schema version straight from schema_migrations and fails
+// unless every embedded migration has been applied. It does not take the
+// migration lock, so it is cheap enough to run on every start.
+func Check(db *sql.DB) (Status, error) {
+
+	var version uint
+	var dirty bool
+	var applied bool
+
+	// Without the schema_migrations table no migration was ever applied
+
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_migrations')").Scan(&applied)
+
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to look up schema_migrations: %w", err)
+	}
+
+	if applied {
+		err = db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return Status{}, fmt.Errorf("failed to read schema version: %w", err)
+		}
+	}
+
+	status, err := newStatus(version, dirty)
+
+	if err != nil {
+		return status, err
+	}
+
+	if status.Dirty {
+		return status, fmt.Errorf("%w: version %d", ErrSchemaDirty, status.Version)
+	}
+
+	if status.Version < status.Latest {
+		return status, fmt.Errorf("%w: version %d, expected %d, run the migrate up subcommand", ErrSchemaOutdated, status.Version, status.Latest)
+	}
+
+	return status, nil
+}
+
+func newStatus(version uint, dirty bool) (Status, error) {
+
+	versions, err := Versions()
+
+	if err != nil {
+		return Status{}, err
+	}
+
+	status := Status{Version: version, Dirty: dirty}
+
+	for _, v := range versions {
+		if v > version {
+			status.Pending = append(status.Pending, v)
+		}
+
+		status.Latest = v
+	}
+
+	return status, nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"gorm.io/gorm"
+)
+
+// CatalogProduct caches the payment provider product sold for a kind of seat,
+// so every booking reuses the same product instead of creating a new one per seat.
+// A price change creates a new version, older versions are kept for refunds of
+// bookings that were paid at the old price.
+type CatalogProduct struct {
+	gorm.Model
+	Key       string      `json:"key" gorm:"column:catalog_key;size:64;not null;unique"`                                                                                             // Hash of movie, seat type and price, see server.CatalogKey
+	LineKey   string      `json:"line_key" gorm:"size:64;not null;uniqueIndex:idx_catalog_product_line_version,priority:1;uniqueIndex:idx_catalog_product_line_active,where:active"` // Hash of movie, seat type and currency shared by every version, see server.CatalogLineKey
+	MovieName string      `json:"movie_name" gorm:"size:255;not null"`                                                                                                               // Movie the seats are sold for
+	SeatType  string      `json:"seat_type" gorm:"size:50;not null"`                                                                                                                 // Seat type as named by the movie DB service, e.g. VIP
+	Price     money.Money `json:"price" gorm:"embedded;embeddedPrefix:price_"`                                                                                                       // Price of a single seat
+	Version   int         `json:"version" gorm:"not null;default:1;uniqueIndex:idx_catalog_product_line_version,priority:2"`                                                         // Increases with every new price of the same movie, seat type and currency
+	Active    bool        `json:"active" gorm:"not null;default:true"`                                                                                                               // Whether this version is the current price
+	ProductID string      `json:"product_id" gorm:"size:100;not null;unique"`                                                                                                        // Product ID at the payment provider
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"gorm.io/gorm"
+)
+
+// Normal balance side of an account type
+const (
+	NormalBalanceDebit  = "debit"
+	NormalBalanceCredit = "credit"
+)
+
+// Account types every deployment starts with, more can be added as rows
+// in the account_types table without touching the schema
+const (
+	AccountTypeCustomer        = "customer"
+	AccountTypePlatformRevenue = "platform_revenue"
+	AccountTypeVenuePayable    = "venue_payable"
+	AccountTypeTaxPayable      = "tax_payable"
+)
+
+var DefaultAccountTypes = []AccountType{
+	{Code: AccountTypeCustomer, Name: "Customer", NormalBalance: NormalBalanceDebit},
+	{Code: AccountTypePlatformRevenue, Name: "Platform revenue", NormalBalance: NormalBalanceCredit},
+	{Code: AccountTypeVenuePayable, Name: "Venue payable", NormalBalance: NormalBalanceCredit},
+	{Code: AccountTypeTaxPayable, Name: "Tax payable", NormalBalance: NormalBalanceCredit},
+}
+
+// AccountType describes a kind of ledger account
+type AccountType struct {
+	gorm.Model
+	Code          string `json:"code" gorm:"size:50;not null;unique"`   // Stable identifier referenced by accounts, e.g. venue_payable
+	Name          string `json:"name" gorm:"size:100;not null"`         // Human readable name
+	NormalBalance string `json:"normal_balance" gorm:"size:6;not null"` // debit or credit, the side on which the balance grows
+}
+
+// Account is a single ledger account, there is one per type and owner
+type Account struct {
+	gorm.Model
+	Type    string `json:"type" gorm:"size:50;not null;uniqueIndex:idx_account_type_owner"`      // Code of the AccountType
+	OwnerID string `json:"owner_id" gorm:"size:100;not null;uniqueIndex:idx_account_type_owner"` // Customer or venue the account belongs to, empty for platform wide accounts
+}
+
+// JournalEntry groups postings that were booked together, the postings of an
+// entry always sum to zero per currency
+type JournalEntry struct {
+	gorm.Model
+	Reference     string    `json:"reference" gorm:"size:150;not null;unique"` // Idempotency reference, e.g. payment:<payment_id>
+	IdempotentKey string    `json:"idempotent_key" gorm:"index"`               // Booking session the entry belongs to
+	Description   string    `json:"description" gorm:"size:255"`
+	Postings      []Posting `json:"postings"`
+}
+
+// Posting moves an amount into or out of an account. Debits are positive and
+// credits are negative.
+type Posting struct {
+	gorm.Model
+	JournalEntryID uint        `json:"journal_entry_id" gorm:"not null;index"`
+	AccountID      uint        `json:"account_id" gorm:"not null;index"`
+	Account        Account     `json:"account"`
+	Amount         money.Money `json:"amount" gorm:"embedded"` // Stored as the amount and currency columns
+}
@@ -3,35 +3,36 @@ package models
 import (
 	"time"
 
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
 	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
 type Payment struct {
 	gorm.Model
-	MovieID         uint   `json:"movie_id" gorm:"not null"`              // ID of the movie for which the payment is made
-	Amount          uint   `json:"amount" gorm:"not null"`                // Amount to be paid
-	Email           string `json:"email" gorm:"not null"`                 // Email of the user making the payment
-	Phone           string `json:"phone" gorm:"not null"`                 // Phone number of the user making the payment
-	Address         string `json:"address" gorm:"not null"`               // Address of the user making the payment
-	MovieName       string `json:"movie_name" gorm:"not null"`            // Name of the movie for which the payment is made
-	PaymentStatus   string `json:"payment_status" gorm:"not null"`        // Status of the payment (e.g., pending, completed, failed)
-	PaymentMethod   string `json:"payment_method" gorm:"not null"`        // Method of payment (e.g., credit card, PayPal)
-	TransactionID   string `json:"transaction_id" gorm:"not null;unique"` // Unique transaction ID for the payment
-	Quantity        uint   `json:"quantity" gorm:"not null"`              // Number of tickets purchased
-	Price           uint   `json:"price" gorm:"not null"`                 // Price per ticket
-	CustomerID      string `json:"customer_id" gorm:"not null"`           // Unique ID of the customer making the payment
-	VenueID         uint   `json:"venue_id" gorm:"not null"`              // ID of the venue where the movie is being shown
-	MovieTimeSlotID uint   `json:"movie_time_slot_id" gorm:"not null"`    // ID of the movie time slot for which the payment is made
+	MovieID         uint        `json:"movie_id" gorm:"not null"`                      // ID of the movie for which the payment is made
+	Amount          money.Money `json:"amount" gorm:"embedded;embeddedPrefix:amount_"` // Amount to be paid
+	Email           string      `json:"email" gorm:"not null"`                         // Email of the user making the payment
+	Phone           string      `json:"phone" gorm:"not null"`                         // Phone number of the user making the payment
+	Address         string      `json:"address" gorm:"not null"`                       // Address of the user making the payment
+	MovieName       string      `json:"movie_name" gorm:"not null"`                    // Name of the movie for which the payment is made
+	PaymentStatus   string      `json:"payment_status" gorm:"not null"`                // Status of the payment (e.g., pending, completed, failed)
+	PaymentMethod   string      `json:"payment_method" gorm:"not null"`                // Method of payment (e.g., credit card, PayPal)
+	TransactionID   string      `json:"transaction_id" gorm:"not null;unique"`         // Unique transaction ID for the payment
+	Quantity        uint        `json:"quantity" gorm:"not null"`                      // Number of tickets purchased
+	Price           money.Money `json:"price" gorm:"embedded;embeddedPrefix:price_"`   // Price per ticket
+	CustomerID      string      `json:"customer_id" gorm:"not null"`                   // Unique ID of the customer making the payment
+	VenueID         uint        `json:"venue_id" gorm:"not null"`                      // ID of the venue where the movie is being shown
+	MovieTimeSlotID uint        `json:"movie_time_slot_id" gorm:"not null"`            // ID of the movie time slot for which the payment is made
 }
 
 type Order struct {
 	gorm.Model
-	ProductID  uint   `json:"product_id" gorm:"not null"`  // ID of the product being ordered
-	Quantity   uint   `json:"quantity" gorm:"not null"`    // Number of products ordered
-	Price      uint   `json:"price" gorm:"not null"`       // Price per product
-	PaymentID  uint   `json:"payment_id" gorm:"not null"`  // ID of the payment associated with the order
-	CustomerID string `json:"customer_id" gorm:"not null"` // Unique ID of the customer placing the order
+	ProductID  uint        `json:"product_id" gorm:"not null"`                  // ID of the product being ordered
+	Quantity   uint        `json:"quantity" gorm:"not null"`                    // Number of products ordered
+	Price      money.Money `json:"price" gorm:"embedded;embeddedPrefix:price_"` // Price per product
+	PaymentID  uint        `json:"payment_id" gorm:"not null"`                  // ID of the payment associated with the order
+	CustomerID string      `json:"customer_id" gorm:"not null"`                 // Unique ID of the customer placing the order
 }
 
 type Idempotent struct {
@@ -44,14 +45,30 @@ type Idempotent struct {
 	// UpdatedAt  int64  `json:"updated_at" gorm:"not null"`        // Timestamp when the idempotency key was last updated
 	// DeletedAt  *int64 `json:"deleted_at" gorm:"index"`           // Timestamp when the idempotency key was deleted, if applicable
 	// ID         uint   `json:"id" gorm:"primaryKey"`              // Primary key for the idempotency record
-	ExpiredAt     time.Time `json:"expired_at" gorm:"not null"`            // Timestamp when the idempotency key expires
-	PaymentStatus string    `json:"payment_status" gorm:"default:pending"` // Status of the payment associated with the idempotency key
-	// VenueID         uint          `json:"venue_id" gorm:"not null"`       // ID of the venue associated with the idempotency key
+	ExpiredAt     time.Time     `json:"expired_at" gorm:"not null"`            // Timestamp when the idempotency key expires
+	PaymentStatus PaymentStatus `json:"payment_status" gorm:"default:PENDING"` // Status of the payment associated with the idempotency key
+	VenueID       uint          `json:"venue_id" gorm:"not null;default:0"`    // ID of the venue the seats are booked at, 0 when not known
 	// MovieID         uint          `json:"movie_id" gorm:"not null"`
-	BookedSeatsId   pq.Int32Array `json:"booked_seats_id" gorm:"type:integer[]"` // List of booked seat IDs associated with the idempotency key
-	MovieTimeSlotID uint          `json:"movie_time_slot_id" gorm:"not null"`    // ID of the movie time slot associated with the idempotency key
-	IsTicketSent    bool          `json:"is_ticket_sent" gorm:"default:false"`   // Flag to indicate if the ticket has been sent
-	IsMailSend      bool          `json:"is_mail_send" gorm:"default:false"`     // Flag to indicate if the mail has been sent
+	BookedSeatsId     pq.Int32Array  `json:"booked_seats_id" gorm:"type:integer[]"`           // List of booked seat IDs associated with the idempotency key
+	RefundedSeatsId   pq.Int32Array  `json:"refunded_seats_id" gorm:"type:integer[]"`         // Booked seats a refund was issued for
+	MovieTimeSlotID   uint           `json:"movie_time_slot_id" gorm:"not null"`              // ID of the movie time slot associated with the idempotency key
+	IsTicketSent      bool           `json:"is_ticket_sent" gorm:"default:false"`             // Flag to indicate if the ticket has been sent
+	IsMailSend        bool           `json:"is_mail_send" gorm:"default:false"`               // Flag to indicate if the mail has been sent
+	SeatsClaimedUntil *time.Time     `json:"seats_claimed_until"`                             // Until when a webhook delivery is booking the seats, nil when none is
+	Currency          string         `json:"currency" gorm:"size:3;default:INR"`              // ISO 4217 code the customer is billed in
+	Billing           BillingAddress `json:"billing" gorm:"embedded;embeddedPrefix:billing_"` // Billing address collected with the customer details
+	SuccessURL        string         `json:"success_url"`                                     // Where the customer is sent after paying
+	CancelURL         string         `json:"cancel_url"`                                      // Where the customer is sent when the payment is not completed
+	PaymentLink       string         `json:"payment_link"`                                    // Checkout URL of PaymentID, handed out again while the session is LINK_ISSUED
+}
+
+// BillingAddress is the address a customer is billed at
+type BillingAddress struct {
+	Country string `json:"country" gorm:"size:2"` // ISO 3166 alpha-2 code
+	State   string `json:"state"`
+	City    string `json:"city"`
+	Street  string `json:"street"`
+	Zipcode string `json:"zipcode"`
 }
 
 // type BookedSeats struct {
@@ -64,62 +81,18 @@ type Idempotent struct {
 // 	PhoneNumber     string  `json:"phone_number" validate:"required,e164"`
 // }
 
+// BookedSeats holds seats for a booking while it is being paid for. A seat is
+// keyed by its movie time slot and seat matrix ID and is held by the session in
+// HoldKey until LockedUntil, after which any other session may take it.
 type BookedSeats struct {
 	gorm.Model
-	SeatNumber      string     `json:"seat_number" gorm:"not null;uniqueIndex:idx_unique_booked_seats"`
+	SeatNumber      string     `json:"seat_number" gorm:"not null"`
 	MovieTimeSlotID uint       `json:"movie_time_slot_id" gorm:"not null;uniqueIndex:idx_unique_booked_seats"` // Link booking to a movie show
 	SeatMatrixID    uint       `json:"seat_matrix_id" gorm:"not null;uniqueIndex:idx_unique_booked_seats"`     // Reference seat matrix for consistency
+	BookedSeatID    int32      `json:"booked_seat_id" gorm:"index"`                                            // ID of the seat in the movie DB service
 	IsBooked        bool       `json:"is_booked"`
 	Email           *string    `json:"email" validate:"required,email"`
 	PhoneNumber     string     `json:"phone_number" validate:"required,e164"`
-	LockedUntil     *time.Time `json:"locked_until"` // Optional field to lock the seat for a certain period
-}
-
-// type Wallet struct {
-// 	gorm.Model
-// 	CustomerID    string `json:"customer_id" gorm:"not null;unique"`    //
-// 	Balance       uint   `json:"balance" gorm:"not null"`               // Current balance in the wallet
-// 	TransactionID string `json:"transaction_id" gorm:"not null;unique"` // Unique transaction ID for the wallet operation
-// 	Amount        uint   `json:"amount" gorm:"not null"`                // Amount to be added or deducted from the walle
-// 	// TransactionType indicates whether the transaction is a credit or debit
-// 	// TransactionType string `json:"transaction_type" gorm:"not null"` // Type of
-// 	TransactionType string `json:"transaction_type" gorm:"not null"`     // Type of transaction (credit or debit)
-// 	IdempotentID    string `json:"idempotent_id" gorm:"not null;unique"` // Unique idempotency key to ensure the operation is not repeated
-// }
-
-// Wallet model to manage user wallets
-// It tracks the balance, transactions, and associated user
-// It can be used for payments, refunds, and other financial operations
-type Wallet struct {
-	gorm.Model
-	UserID   string  `gorm:"index"` // Associated user, a phone number
-	Balance  float64 `gorm:"type:numeric(12,2)"`
-	Currency string  `gorm:"size:3;default:'INR'"`
-}
-
-// type Ledger struct {
-// 	gorm.Model
-// 	CustomerID      string `json:"customer_id" gorm:"not null"`           //
-// 	TransactionID   string `json:"transaction_id" gorm:"not null;unique"` // Unique transaction ID for the ledger entry
-// 	Amount          uint   `json:"amount" gorm:"not null"`                // Amount involved in the transaction
-// 	TransactionType string `json:"transaction_type" gorm:"not null"`      // Type
-// 	// TransactionType string `json:"transaction_type" gorm:"not null"` // Type of transaction (credit or debit)
-// 	PaymentID string `json:"payment_id" gorm:"not null"` //
-// 	// PaymentID     string `json:"payment_id" gorm:"not null"`            // ID of the payment associated with the ledger entry
-// 	WalletID string `json:"wallet_id" gorm:"not null"`
-// 	// ID of the wallet associated with the ledger entry
-// }
-
-// Ledger is a record of transactions in the wallet
-// It tracks credits, debits, and refunds
-// It can be used for auditing and reporting purposes
-type Ledger struct {
-	gorm.Model
-	WalletID      uint    `gorm:"index"`       // Wallet association
-	OrderID       *uint   `gorm:"index"`       // Optional: ties to order
-	TransactionID string  `gorm:"uniqueIndex"` // External PSP reference
-	Amount        float64 `gorm:"type:numeric(12,2)"`
-	Type          string  `gorm:"size:20"` // 'credit', 'debit', 'refund'
-	Description   string  `gorm:"size:255"`
-	PSPRefID      string  `gorm:"size:100"` // Optional external ref
+	LockedUntil     *time.Time `json:"locked_until"`                   // Optional field to lock the seat for a certain period
+	HoldKey         string     `json:"hold_key" gorm:"index;size:255"` // Idempotent key of the session holding the seat
 }
@@ -0,0 +1,105 @@
+package models
+
+import (
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// PaymentStatus is the lifecycle state of a payment session tracked by an Idempotent row
+type PaymentStatus string
+
+const (
+	PaymentStatusPending          PaymentStatus = "PENDING"           // Idempotent key committed, nothing else done yet
+	PaymentStatusOrderCreated     PaymentStatus = "ORDER_CREATED"     // Seats validated and products created for the order
+	PaymentStatusCustomerAttached PaymentStatus = "CUSTOMER_ATTACHED" // Customer created and attached to the session
+	PaymentStatusLinkIssued       PaymentStatus = "LINK_ISSUED"       // Payment link handed out to the customer
+	PaymentStatusSucceeded        PaymentStatus = "SUCCEEDED"         // Payment captured by the provider
+	PaymentStatusFailed           PaymentStatus = "FAILED"            // Payment attempt failed, a new link may be issued
+	PaymentStatusExpired          PaymentStatus = "EXPIRED"           // Session expired before the payment succeeded
+	PaymentStatusRefunded         PaymentStatus = "REFUNDED"          // Payment refunded to the customer
+	PaymentStatusDisputed         PaymentStatus = "DISPUTED"          // Customer raised a dispute against the payment
+)
+
+// paymentStatusTransitions lists the states reachable from every state,
+// any transition not listed here is rejected. A state lists itself when
+// repeating the step that led to it is harmless, e.g. a redelivered webhook.
+// LINK_ISSUED does not, every new link is another payment the customer can make.
+var paymentStatusTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusPending:          {PaymentStatusOrderCreated, PaymentStatusCustomerAttached, PaymentStatusFailed, PaymentStatusExpired},
+	PaymentStatusOrderCreated:     {PaymentStatusOrderCreated, PaymentStatusCustomerAttached, PaymentStatusLinkIssued, PaymentStatusFailed, PaymentStatusExpired},
+	PaymentStatusCustomerAttached: {PaymentStatusCustomerAttached, PaymentStatusOrderCreated, PaymentStatusLinkIssued, PaymentStatusFailed, PaymentStatusExpired},
+	PaymentStatusLinkIssued:       {PaymentStatusSucceeded, PaymentStatusFailed, PaymentStatusExpired},
+	PaymentStatusFailed:           {PaymentStatusFailed, PaymentStatusLinkIssued, PaymentStatusSucceeded, PaymentStatusExpired},
+	PaymentStatusSucceeded:        {PaymentStatusSucceeded, PaymentStatusRefunded, PaymentStatusDisputed},
+	PaymentStatusDisputed:         {PaymentStatusDisputed, PaymentStatusSucceeded, PaymentStatusRefunded},
+	PaymentStatusExpired:          {},
+	PaymentStatusRefunded:         {},
+}
+
+// NormalizePaymentStatus maps values written before the state machine existed
+// onto their current equivalent
+func NormalizePaymentStatus(status string) PaymentStatus {
+	switch status {
+	case "", "pending":
+		return PaymentStatusPending
+	case "INITIATED":
+		return PaymentStatusOrderCreated
+	}
+
+	return PaymentStatus(status)
+}
+
+// ExpirablePaymentStatuses returns every stored status of a session that has
+// not been paid for and may still expire, values written before the state
+// machine existed included
+func ExpirablePaymentStatuses() []string {
+
+	statuses := []string{"", "pending", "INITIATED"}
+
+	for status := range paymentStatusTransitions {
+		if status.CanTransitionTo(PaymentStatusExpired) {
+			statuses = append(statuses, string(status))
+		}
+	}
+
+	sort.Strings(statuses)
+
+	return statuses
+}
+
+func (s PaymentStatus) IsValid() bool {
+	_, ok := paymentStatusTransitions[s]
+	return ok
+}
+
+// IsTerminal reports whether no further transition is possible from the state
+func (s PaymentStatus) IsTerminal() bool {
+	return s.IsValid() && len(paymentStatusTransitions[s]) == 0
+}
+
+// CanTransitionTo reports whether moving from s to next is allowed. Staying in
+// the same state is only allowed where paymentStatusTransitions lists it.
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+
+	if !s.IsValid() || !next.IsValid() {
+		return false
+	}
+
+	for _, allowed := range paymentStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PaymentStatusHistory records every transition applied to an Idempotent row
+type PaymentStatusHistory struct {
+	gorm.Model
+	IdempotentKey string        `json:"idempotent_key" gorm:"not null;index"` // Idempotency key of the session that changed state
+	FromStatus    PaymentStatus `json:"from_status" gorm:"size:32"`           // State before the transition, empty when the session was created
+	ToStatus      PaymentStatus `json:"to_status" gorm:"size:32;not null"`    // State after the transition
+	Reason        string        `json:"reason" gorm:"size:255"`               // What caused the transition
+}
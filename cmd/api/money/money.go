@@ -0,0 +1,415 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCurrencyMismatch = errors.New("currency mismatch")
+	ErrUnknownCurrency  = errors.New("unknown currency")
+	ErrOverflow         = errors.New("amount overflows int64 minor units")
+	ErrInvalidAmount    = errors.New("invalid amount")
+	ErrDivisionByZero   = errors.New("division by zero")
+)
+
+const (
+	INR = "INR"
+	USD = "USD"
+	EUR = "EUR"
+	GBP = "GBP"
+	JPY = "JPY"
+)
+
+// exponents is the number of minor unit digits of every supported ISO 4217 currency
+var exponents = map[string]int{
+	"INR": 2, "USD": 2, "EUR": 2, "GBP": 2, "JPY": 0, "AUD": 2,
+	"CAD": 2, "CNY": 2, "CHF": 2, "SEK": 2, "NZD": 2, "RUB": 2,
+	"ZAR": 2, "KRW": 0, "SGD": 2, "HKD": 2, "AED": 2, "BRL": 2,
+	"MXN": 2, "TRY": 2, "IDR": 2, "MYR": 2,
+}
+
+// homeCountries is the ISO 3166 alpha-2 country billed when a customer paying in
+// the currency gave no billing country. The euro has no single home, Germany is used.
+var homeCountries = map[string]string{
+	"INR": "IN", "USD": "US", "EUR": "DE", "GBP": "GB", "JPY": "JP", "AUD": "AU",
+	"CAD": "CA", "CNY": "CN", "CHF": "CH", "SEK": "SE", "NZD": "NZ", "RUB": "RU",
+	"ZAR": "ZA", "KRW": "KR", "SGD": "SG", "HKD": "HK", "AED": "AE", "BRL": "BR",
+	"MXN": "MX", "TRY": "TR", "IDR": "ID", "MYR": "MY",
+}
+
+// RoundingMode decides what happens to the part of an amount smaller than one minor unit
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest minor unit and ties to the even one, it is the default
+	// because it does not drift when many amounts are rounded
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest minor unit and ties away from zero
+	RoundHalfUp
+	// RoundDown truncates towards zero
+	RoundDown
+)
+
+// Money is an amount in the minor unit of its currency, e.g. paise for INR.
+// Amounts are never floats, so rupee/paise mix-ups and rounding drift cannot happen.
+// Stored with GORM as two columns, embed it with `gorm:"embedded;embeddedPrefix:price_"`.
+type Money struct {
+	Amount   int64  `json:"amount" gorm:"not null"`          // Amount in minor units
+	Currency string `json:"currency" gorm:"size:3;not null"` // ISO 4217 code
+}
+
+// New returns an amount of minor units, e.g. New(25000, INR) is ₹250.00
+func New(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: strings.ToUpper(currency)}
+}
+
+// Zero returns no money in the given currency
+func Zero(currency string) Money {
+	return New(0, currency)
+}
+
+// FromMajor converts a whole amount of the major unit, e.g. rupees, into minor units
+func FromMajor(major int64, currency string) (Money, error) {
+
+	exp, err := Exponent(currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	minor, ok := mul64(major, pow10(exp))
+
+	if !ok {
+		return Money{}, ErrOverflow
+	}
+
+	return New(minor, currency), nil
+}
+
+// Parse reads a decimal amount in the major unit, e.g. "250.50". Digits beyond the
+// minor unit of the currency are rounded with mode.
+func Parse(s string, currency string, mode RoundingMode) (Money, error) {
+
+	exp, err := Exponent(currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+
+	if !ok || strings.ContainsAny(s, "eE/") {
+		return Money{}, fmt.Errorf("%w: %q", ErrInvalidAmount, s)
+	}
+
+	r.Mul(r, new(big.Rat).SetInt64(pow10(exp)))
+
+	minor, err := roundRat(r, mode)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	return New(minor, currency), nil
+}
+
+// Exponent returns the number of minor unit digits of the currency
+func Exponent(currency string) (int, error) {
+
+	exp, ok := exponents[strings.ToUpper(currency)]
+
+	if !ok {
+		return 0, fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	return exp, nil
+}
+
+// HomeCountry returns the country billed by default for the currency
+func HomeCountry(currency string) (string, error) {
+
+	country, ok := homeCountries[strings.ToUpper(currency)]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrUnknownCurrency, currency)
+	}
+
+	return country, nil
+}
+
+// Validate reports whether the currency is a supported ISO 4217 code
+func (m Money) Validate() error {
+	_, err := Exponent(m.Currency)
+	return err
+}
+
+func (m Money) IsZero() bool     { return m.Amount == 0 }
+func (m Money) IsPositive() bool { return m.Amount > 0 }
+func (m Money) IsNegative() bool { return m.Amount < 0 }
+
+// SameCurrency reports whether both amounts can be combined
+func (m Money) SameCurrency(o Money) bool {
+	return m.Currency == o.Currency
+}
+
+func (m Money) Neg() Money {
+	return New(-m.Amount, m.Currency)
+}
+
+func (m Money) Add(o Money) (Money, error) {
+
+	if !m.SameCurrency(o) {
+		return Money{}, fmt.Errorf("%w: %s + %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	sum, ok := add64(m.Amount, o.Amount)
+
+	if !ok {
+		return Money{}, ErrOverflow
+	}
+
+	return New(sum, m.Currency), nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+
+	if !m.SameCurrency(o) {
+		return Money{}, fmt.Errorf("%w: %s - %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	diff, ok := add64(m.Amount, -o.Amount)
+
+	if !ok || o.Amount == math.MinInt64 {
+		return Money{}, ErrOverflow
+	}
+
+	return New(diff, m.Currency), nil
+}
+
+// Mul multiplies by a whole quantity, e.g. the number of tickets
+func (m Money) Mul(n int64) (Money, error) {
+
+	product, ok := mul64(m.Amount, n)
+
+	if !ok {
+		return Money{}, ErrOverflow
+	}
+
+	return New(product, m.Currency), nil
+}
+
+// MulRatio returns m * num / den rounded with mode, e.g. MulRatio(250, 10000, RoundDown) takes 2.5%
+func (m Money) MulRatio(num int64, den int64, mode RoundingMode) (Money, error) {
+
+	if den == 0 {
+		return Money{}, ErrDivisionByZero
+	}
+
+	r := new(big.Rat).SetFrac(big.NewInt(m.Amount), big.NewInt(1))
+	r.Mul(r, new(big.Rat).SetFrac(big.NewInt(num), big.NewInt(den)))
+
+	amount, err := roundRat(r, mode)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	return New(amount, m.Currency), nil
+}
+
+// Allocate splits m by the given weights without losing a minor unit, the
+// remainder goes one unit at a time to the first shares
+func (m Money) Allocate(weights ...int64) ([]Money, error) {
+
+	var total int64
+
+	for _, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("%w: negative weight %d", ErrInvalidAmount, w)
+		}
+
+		var ok bool
+
+		if total, ok = add64(total, w); !ok {
+			return nil, ErrOverflow
+		}
+	}
+
+	if total == 0 {
+		return nil, ErrDivisionByZero
+	}
+
+	shares := make([]Money, len(weights))
+	remainder := m.Amount
+
+	for i, w := range weights {
+		share, err := m.MulRatio(w, total, RoundDown)
+
+		if err != nil {
+			return nil, err
+		}
+
+		shares[i] = share
+		remainder -= share.Amount
+	}
+
+	unit := int64(1)
+
+	if remainder < 0 {
+		unit = -1
+	}
+
+	for i := 0; remainder != 0; i++ {
+		if weights[i%len(weights)] == 0 {
+			continue
+		}
+
+		shares[i%len(weights)].Amount += unit
+		remainder -= unit
+	}
+
+	return shares, nil
+}
+
+// Cmp compares two amounts of the same currency, returning -1, 0 or +1
+func (m Money) Cmp(o Money) (int, error) {
+
+	if !m.SameCurrency(o) {
+		return 0, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+
+	return 0, nil
+}
+
+// Exchange converts the amount into another currency at rate, the number of
+// major units of currency one major unit of m is worth
+func (m Money) Exchange(rate *big.Rat, currency string, mode RoundingMode) (Money, error) {
+
+	fromExp, err := Exponent(m.Currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	toExp, err := Exponent(currency)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	if rate == nil || rate.Sign() <= 0 {
+		return Money{}, fmt.Errorf("%w: exchange rate must be positive", ErrInvalidAmount)
+	}
+
+	r := new(big.Rat).SetInt64(m.Amount)
+	r.Mul(r, rate)
+	r.Mul(r, new(big.Rat).SetFrac(big.NewInt(pow10(toExp)), big.NewInt(pow10(fromExp))))
+
+	amount, err := roundRat(r, mode)
+
+	if err != nil {
+		return Money{}, err
+	}
+
+	return New(amount, currency), nil
+}
+
+// Major formats the amount as a decimal in the major unit, e.g. "250.50"
+func (m Money) Major() string {
+
+	exp, err := Exponent(m.Currency)
+
+	if err != nil || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+
+	sign := ""
+	abs := new(big.Int).Abs(big.NewInt(m.Amount)).String()
+
+	if m.Amount < 0 {
+		sign = "-"
+	}
+
+	if len(abs) <= exp {
+		abs = strings.Repeat("0", exp-len(abs)+1) + abs
+	}
+
+	return sign + abs[:len(abs)-exp] + "." + abs[len(abs)-exp:]
+}
+
+func (m Money) String() string {
+	return m.Currency + " " + m.Major()
+}
+
+func pow10(exp int) int64 {
+
+	p := int64(1)
+
+	for i := 0; i < exp; i++ {
+		p *= 10
+	}
+
+	return p
+}
+
+func add64(a, b int64) (int64, bool) {
+
+	c := a + b
+
+	if (c > a) != (b > 0) {
+		return 0, false
+	}
+
+	return c, true
+}
+
+func mul64(a, b int64) (int64, bool) {
+
+	if a == 0 || b == 0 {
+		return 0, true
+	}
+
+	c := a * b
+
+	if c/b != a || (a == -1 && b == math.MinInt64) || (b == -1 && a == math.MinInt64) {
+		return 0, false
+	}
+
+	return c, true
+}
+
+// roundRat rounds a rational amount of minor units to a whole one
+func roundRat(r *big.Rat, mode RoundingMode) (int64, error) {
+
+	quo, rem := new(big.Int).QuoRem(r.Num(), r.Denom(), new(big.Int))
+
+	if rem.Sign() != 0 && mode != RoundDown {
+		// compare twice the remainder with the denominator to find out which side of the half we are on
+		half := new(big.Int).Abs(rem)
+		half.Lsh(half, 1)
+
+		c := half.Cmp(r.Denom())
+
+		if c > 0 || (c == 0 && (mode == RoundHalfUp || quo.Bit(0) == 1)) {
+			quo.Add(quo, big.NewInt(int64(r.Sign())))
+		}
+	}
+
+	if !quo.IsInt64() {
+		return 0, ErrOverflow
+	}
+
+	return quo.Int64(), nil
+}
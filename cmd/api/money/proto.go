@@ -0,0 +1,47 @@
+package money
+
+import (
+	"fmt"
+
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+)
+
+// Proto converts the amount into its protobuf message
+func (m Money) Proto() *payment_service.Money {
+	return &payment_service.Money{
+		Amount:   m.Amount,
+		Currency: m.Currency,
+	}
+}
+
+// FromProto converts a protobuf amount, rejecting unknown currencies
+func FromProto(pb *payment_service.Money) (Money, error) {
+
+	if pb == nil {
+		return Money{}, ErrInvalidAmount
+	}
+
+	m := New(pb.Amount, pb.Currency)
+
+	if err := m.Validate(); err != nil {
+		return Money{}, err
+	}
+
+	return m, nil
+}
+
+// CurrencyFromProto returns the ISO 4217 code of the Currency enum, the zero value is INR
+func CurrencyFromProto(currency payment_service.Currency) (string, error) {
+
+	code, ok := payment_service.Currency_name[int32(currency)]
+
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownCurrency, currency)
+	}
+
+	if _, err := Exponent(code); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
@@ -0,0 +1,185 @@
+// Package resilience keeps calls to other services from failing on every
+// transient error and from piling up on a service that is down. Conn retries
+// idempotent gRPC calls with jittered exponential backoff within a budget per
+// method, and a Breaker fails calls fast while the service keeps failing.
+package resilience
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrOpen is returned by Allow while the breaker is open
+var ErrOpen = errors.New("circuit breaker is open")
+
+// State of a Breaker, the values are those of the circuit breaker state metric
+type State int
+
+const (
+	StateClosed State = iota
+	StateHalfOpen
+	StateOpen
+)
+
+func (s State) String() string {
+
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half-open"
+	case StateOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// Result is the outcome of a call let through by a Breaker
+type Result int
+
+const (
+	// Succeeded calls got an answer from the service, errors of the request included
+	Succeeded Result = iota
+	// Failed calls found the service unavailable or too slow
+	Failed
+	// Abandoned calls were given up by the caller and say nothing about the service
+	Abandoned
+)
+
+// Breaker opens after Failures calls in a row failed and then fails every call
+// with ErrOpen for Cooldown. After that a single probe call is let through,
+// which closes the breaker when it succeeds and opens it again when it fails.
+type Breaker struct {
+	name     string
+	failures int
+	cooldown time.Duration
+
+	mu    sync.Mutex
+	state State
+	// generation changes with the state, results of calls let through in an
+	// earlier generation are ignored
+	generation uint64
+	failed     int
+	openedAt   time.Time
+	probing    bool
+}
+
+// NewBreaker returns a closed breaker for the calls to the service name, which
+// also labels its metrics
+func NewBreaker(name string, failures int, cooldown time.Duration) *Breaker {
+
+	metrics.CircuitBreakerState.WithLabelValues(name).Set(float64(StateClosed))
+
+	return &Breaker{
+		name:     name,
+		failures: max(failures, 1),
+		cooldown: cooldown,
+	}
+}
+
+// State returns the current state of the breaker
+func (b *Breaker) State() State {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		return StateHalfOpen
+	}
+
+	return b.state
+}
+
+// Allow lets a call through unless the breaker is open. The returned function
+// must be called with the result of the call. A nil breaker lets every call
+// through.
+func (b *Breaker) Allow() (func(Result), error) {
+
+	if b == nil {
+		return func(Result) {}, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == StateOpen && time.Since(b.openedAt) >= b.cooldown {
+		b.setState(StateHalfOpen)
+	}
+
+	switch b.state {
+	case StateOpen:
+		return nil, ErrOpen
+	case StateHalfOpen:
+		if b.probing {
+			return nil, ErrOpen
+		}
+
+		b.probing = true
+	}
+
+	generation := b.generation
+
+	return func(result Result) { b.done(generation, result) }, nil
+}
+
+func (b *Breaker) done(generation uint64, result Result) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case StateClosed:
+		switch result {
+		case Succeeded:
+			b.failed = 0
+		case Failed:
+			b.failed++
+
+			if b.failed >= b.failures {
+				b.setState(StateOpen)
+			}
+		}
+	case StateHalfOpen:
+		b.probing = false
+
+		switch result {
+		case Succeeded:
+			b.setState(StateClosed)
+		case Failed:
+			b.setState(StateOpen)
+		}
+	}
+}
+
+// setState moves the breaker to state, b.mu must be held
+func (b *Breaker) setState(state State) {
+
+	entry := log.WithFields(log.Fields{"service": b.name, "from": b.state.String()})
+
+	if state == StateOpen {
+		entry.Warnf("Circuit breaker of %s opened, calls fail fast for %s", b.name, b.cooldown)
+	} else {
+		entry.Infof("Circuit breaker of %s is now %s", b.name, state)
+	}
+
+	b.state = state
+	b.generation++
+	b.failed = 0
+	b.probing = false
+
+	if state == StateOpen {
+		b.openedAt = time.Now()
+	}
+
+	metrics.CircuitBreakerState.WithLabelValues(b.name).Set(float64(state))
+	metrics.CircuitBreakerTransitions.WithLabelValues(b.name, state.String()).Inc()
+}
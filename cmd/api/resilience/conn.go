@@ -0,0 +1,156 @@
+package resilience
+
+import (
+	"context"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Policy is how calls to one RPC are made
+type Policy struct {
+	// MaxAttempts is how often the RPC is tried, only RPCs that are safe to
+	// repeat may have more than one attempt
+	MaxAttempts int
+	// AttemptTimeout limits a single attempt, zero leaves it to the budget
+	AttemptTimeout time.Duration
+	// Budget limits all attempts and the backoff between them, zero leaves it
+	// to the deadline of the caller
+	Budget time.Duration
+	// Backoff is the wait between attempts
+	Backoff Backoff
+}
+
+// Backoff grows exponentially from Initial up to Max. The wait is drawn at
+// random up to that bound, so callers that failed together do not all retry
+// at the same time.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// Delay returns the wait after the given failed attempt, counted from 1
+func (b Backoff) Delay(attempt int) time.Duration {
+
+	if b.Initial <= 0 {
+		return 0
+	}
+
+	bound := b.Initial
+
+	for i := 1; i < attempt && (b.Max <= 0 || bound < b.Max); i++ {
+		bound *= 2
+	}
+
+	if b.Max > 0 && bound > b.Max {
+		bound = b.Max
+	}
+
+	return rand.N(bound) + 1
+}
+
+// Conn makes the unary calls of a client over ClientConnInterface with the
+// Policy of their method, Default for methods without one, and through Breaker
+// when it is set. Streams are passed through as they are.
+type Conn struct {
+	grpc.ClientConnInterface
+
+	// Service labels the metrics of the calls
+	Service  string
+	Breaker  *Breaker
+	Policies map[string]Policy
+	Default  Policy
+}
+
+func (c *Conn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+
+	policy, ok := c.Policies[method]
+
+	if !ok {
+		policy = c.Default
+	}
+
+	if policy.Budget > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, policy.Budget)
+		defer cancel()
+	}
+
+	operation := method[strings.LastIndex(method, "/")+1:]
+
+	for attempt := 1; ; attempt++ {
+
+		done, err := c.Breaker.Allow()
+
+		if err != nil {
+			return status.Errorf(codes.Unavailable, "%s: %v", c.Service, err)
+		}
+
+		err = c.invoke(ctx, policy.AttemptTimeout, method, args, reply, opts...)
+
+		done(result(err))
+
+		if err == nil || attempt >= policy.MaxAttempts || !Retryable(err) || ctx.Err() != nil {
+			return err
+		}
+
+		delay := policy.Backoff.Delay(attempt)
+
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+
+		logging.FromContext(ctx).Warnf("Calling %s failed on attempt %d, retrying in %s: %v", method, attempt, delay, err)
+
+		metrics.OutboundRetries.WithLabelValues(c.Service, operation).Inc()
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(delay):
+		}
+	}
+}
+
+func (c *Conn) invoke(ctx context.Context, timeout time.Duration, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return c.ClientConnInterface.Invoke(ctx, method, args, reply, opts...)
+}
+
+// Retryable reports whether a call that failed with err may succeed when made again
+func Retryable(err error) bool {
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+		return true
+	}
+
+	return false
+}
+
+// result tells the breaker whether err says the service is unhealthy
+func result(err error) Result {
+
+	switch status.Code(err) {
+	case codes.Canceled:
+		return Abandoned
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return Failed
+	}
+
+	return Succeeded
+}
@@ -0,0 +1,296 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// Retry policy used while the movie DB service is unreachable
+var (
+	BookSeatsMaxAttempts    = 5
+	BookSeatsInitialBackoff = 500 * time.Millisecond
+	BookSeatsMaxBackoff     = 8 * time.Second
+)
+
+// SeatConfirmationLease is how long a webhook delivery may spend booking the seats
+// of a session before another delivery may try again, it covers every attempt
+// of bookSeatsWithRetry
+var SeatConfirmationLease = 2 * time.Minute
+
+var ErrSeatsUnavailable = errors.New("seats are no longer available")
+
+// Confirm_Booked_Seats books the seats of a paid session in the movie DB service.
+// The session is claimed with a conditional update before the movie DB is called
+// so that duplicate webhook deliveries cannot book the same seats twice, and
+// IsTicketSent is set once the movie DB has confirmed them. No row stays locked
+// during the calls, a delivery that dies half way holds the claim only until
+// SeatConfirmationLease runs out. When the seats were taken by someone else in
+// the meantime the payment is refunded automatically.
+func (m *Payment_Service) Confirm_Booked_Seats(ctx context.Context, idempotentKey string) error {
+
+	var idempotent models.Idempotent
+
+	result := m.DB.WithContext(ctx).Where("idempotent_key = ?", idempotentKey).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrIdempotentKeyNotFound, idempotentKey)
+		}
+		m.log(ctx).Error("Error fetching idempotent key: ", result.Error)
+		return fmt.Errorf("error fetching idempotent key: %w", result.Error)
+	}
+
+	if idempotent.IsTicketSent {
+		m.log(ctx).Infof("Seats for idempotent key %s are already confirmed", idempotentKey)
+		return nil
+	}
+
+	paymentStatus := models.NormalizePaymentStatus(string(idempotent.PaymentStatus))
+
+	if paymentStatus != models.PaymentStatusSucceeded {
+		return fmt.Errorf("%w: cannot confirm seats in status %s", ErrInvalidPaymentTransition, paymentStatus)
+	}
+
+	now := m.now()
+
+	result = m.DB.WithContext(ctx).Model(&models.Idempotent{}).
+		Where("idempotent_key = ? AND payment_status = ? AND NOT is_ticket_sent", idempotentKey, idempotent.PaymentStatus).
+		Where("seats_claimed_until IS NULL OR seats_claimed_until < ?", now).
+		Update("seats_claimed_until", now.Add(SeatConfirmationLease))
+
+	if result.Error != nil {
+		m.log(ctx).Error("Error claiming seat confirmation: ", result.Error)
+		return fmt.Errorf("error claiming seat confirmation: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		// Failing the delivery makes the provider retry it once the other delivery is done
+		return fmt.Errorf("%w: seats of idempotent key %s are being confirmed by another delivery", ErrPaymentStatusConflict, idempotentKey)
+	}
+
+	err := m.bookSessionSeats(ctx, idempotent)
+
+	if errors.Is(err, ErrSeatsUnavailable) {
+		m.log(ctx).Warnf("Seats for idempotent key %s were taken before they could be confirmed: %v", idempotentKey, err)
+
+		err = m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+			if err := m.releaseSeatHolds(tx, idempotentKey); err != nil {
+				return err
+			}
+
+			// The whole payment is refunded below, Refund_Payment must not refund the seats again
+
+			result := tx.Model(&models.Idempotent{}).Where("idempotent_key = ?", idempotentKey).Updates(map[string]interface{}{
+				"seats_claimed_until": nil,
+				"refunded_seats_id":   gorm.Expr("booked_seats_id"),
+			})
+
+			return result.Error
+		})
+
+		if err != nil || idempotent.PaymentID == nil {
+			return err
+		}
+
+		return m.refundPayment(ctx, idempotentKey, idempotent.CustomerID, idempotent.VenueID, *idempotent.PaymentID, "Seats were no longer available")
+	}
+
+	if err != nil {
+		m.log(ctx).Errorf("Failed to confirm seats for idempotent key %s: %v", idempotentKey, err)
+
+		// The next delivery may try again right away instead of waiting for the lease
+
+		if releaseErr := m.releaseSeatClaim(m.DB.WithContext(ctx), idempotentKey); releaseErr != nil {
+			m.log(ctx).Errorf("Failed to release seat confirmation of idempotent key %s: %v", idempotentKey, releaseErr)
+		}
+
+		return err
+	}
+
+	err = m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		if err := m.confirmSeatHolds(tx, idempotentKey); err != nil {
+			return err
+		}
+
+		// The session is SUCCEEDED already, there is no change of state to count
+
+		_, err := m.transitionPaymentStatus(tx, idempotentKey, models.PaymentStatusSucceeded, "seats confirmed", map[string]interface{}{
+			"is_ticket_sent":      true,
+			"seats_claimed_until": nil,
+		})
+
+		return err
+	})
+
+	if err != nil {
+		m.log(ctx).Errorf("Seats for idempotent key %s were booked but could not be recorded: %v", idempotentKey, err)
+		return err
+	}
+
+	m.log(ctx).Infof("Seats confirmed for idempotent key %s", idempotentKey)
+
+	return nil
+}
+
+// bookSessionSeats books the seats of the session for its customer
+func (m *Payment_Service) bookSessionSeats(ctx context.Context, idempotent models.Idempotent) error {
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	customer, err := m.Gateway.GetCustomer(gatewayCtx, idempotent.CustomerID)
+	cancel()
+
+	if err != nil {
+		m.log(ctx).Error("Failed to find customer details: ", err)
+		return fmt.Errorf("failed to find customer details: %w", err)
+	}
+
+	var seats []*moviedb_service.BookedSeats
+
+	for _, id := range idempotent.BookedSeatsId {
+		seats = append(seats, &moviedb_service.BookedSeats{
+			Id:              id,
+			MovieTimeSlotID: int32(idempotent.MovieTimeSlotID),
+		})
+	}
+
+	return m.bookSeatsWithRetry(ctx, &moviedb_service.BookSeatsRequest{
+		Seats:           seats,
+		MovieTimeSlotId: int32(idempotent.MovieTimeSlotID),
+		Email:           customer.Email,
+		PhoneNumber:     customer.PhoneNumber,
+	})
+}
+
+// releaseSeatClaim lets the next delivery confirm the seats of the session
+func (m *Payment_Service) releaseSeatClaim(tx *gorm.DB, key string) error {
+
+	result := tx.Model(&models.Idempotent{}).Where("idempotent_key = ?", key).Update("seats_claimed_until", nil)
+
+	if result.Error != nil {
+		m.log(tx.Statement.Context).Error("Error releasing seat confirmation: ", result.Error)
+		return fmt.Errorf("error releasing seat confirmation: %w", result.Error)
+	}
+
+	return nil
+}
+
+// bookSeatsWithRetry calls BookSeats, retrying with exponential backoff while
+// the movie DB service is unavailable
+func (m *Payment_Service) bookSeatsWithRetry(ctx context.Context, request *moviedb_service.BookSeatsRequest) error {
+
+	backoff := BookSeatsInitialBackoff
+
+	var lastErr error
+
+	for attempt := 1; attempt <= BookSeatsMaxAttempts; attempt++ {
+
+		attemptCtx, cancel := m.movieDBContext(ctx)
+		response, err := m.MovieDB.BookSeats(attemptCtx, request)
+		cancel()
+
+		if err == nil && response != nil && response.Status == http.StatusOK {
+			return nil
+		}
+
+		if err == nil && response != nil && (response.Status == http.StatusConflict || response.Status == http.StatusBadRequest) {
+			return fmt.Errorf("%w: %s", ErrSeatsUnavailable, response.Error)
+		}
+
+		if err != nil {
+			switch status.Code(err) {
+			case codes.AlreadyExists, codes.FailedPrecondition:
+				return fmt.Errorf("%w: %v", ErrSeatsUnavailable, err)
+			case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted:
+				lastErr = err
+			default:
+				return fmt.Errorf("failed to book seats: %w", err)
+			}
+		} else if response == nil {
+			lastErr = errors.New("empty response from movie DB service")
+		} else {
+			lastErr = fmt.Errorf("movie DB service returned status %d: %s", response.Status, response.Error)
+		}
+
+		if attempt == BookSeatsMaxAttempts {
+			break
+		}
+
+		m.log(ctx).Warnf("Booking seats failed on attempt %d, retrying in %s: %v", attempt, backoff, lastErr)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("stopped booking seats after %d attempts: %w", attempt, ctx.Err())
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+
+		if backoff > BookSeatsMaxBackoff {
+			backoff = BookSeatsMaxBackoff
+		}
+	}
+
+	return fmt.Errorf("failed to book seats after %d attempts: %w", BookSeatsMaxAttempts, lastErr)
+}
+
+// refundPayment refunds the whole payment unless it already has a refund
+func (m *Payment_Service) refundPayment(ctx context.Context, idempotentKey string, customerID string, venueID uint, paymentID string, reason string) error {
+
+	// A redelivered webhook must not refund the same payment twice
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	payment, err := m.Gateway.GetPayment(gatewayCtx, paymentID)
+	cancel()
+
+	if err != nil {
+		m.log(ctx).Error("Failed to fetch payment details: ", err)
+		return fmt.Errorf("failed to fetch payment details: %w", err)
+	}
+
+	if len(payment.Refunds) > 0 {
+		m.log(ctx).Infof("Payment %s already has a refund, skipping automatic refund", paymentID)
+		return nil
+	}
+
+	m.log(ctx).Infof("Refunding payment %s for idempotent key %s: %s", paymentID, idempotentKey, reason)
+
+	gatewayCtx, cancel = m.gatewayContext(ctx)
+	refund, err := m.Gateway.CreateRefund(gatewayCtx, gateway.RefundParams{
+		PaymentID: paymentID,
+		Reason:    reason,
+	})
+	cancel()
+
+	if err != nil {
+		m.log(ctx).Error("Failed to refund payment: ", err)
+		return fmt.Errorf("failed to refund payment %s: %w", paymentID, err)
+	}
+
+	// The session moves to REFUNDED once the refund.succeeded webhook arrives
+
+	m.log(ctx).Infof("Refund %s started for payment %s", refund.RefundID, paymentID)
+
+	currency := refund.Amount.Currency
+
+	if currency == "" {
+		currency = payment.TotalAmount.Currency
+	}
+
+	metrics.Refunds.WithLabelValues(currency, metrics.Venue(venueID), strconv.FormatBool(false)).Inc()
+
+	return m.Post_Refund_Journal(ctx, refund, idempotentKey, customerID, venueID, reason)
+}
@@ -0,0 +1,221 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"gorm.io/gorm"
+)
+
+// CatalogKey identifies a catalog product by movie, seat type and price
+func CatalogKey(movieName string, seatType string, price money.Money) string {
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(movieName)),
+		strings.ToUpper(seatType),
+		fmt.Sprint(price.Amount),
+		price.Currency,
+	}, "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CatalogLineKey identifies the versions of a movie and seat type sold in a
+// currency, normalized like CatalogKey. The separator is one PostgreSQL text
+// can hold, so the migration adding the column can compute it for old rows.
+func CatalogLineKey(movieName string, seatType string, currency string) string {
+
+	sum := sha256.Sum256([]byte(strings.Join([]string{
+		strings.ToLower(strings.TrimSpace(movieName)),
+		strings.ToUpper(seatType),
+		currency,
+	}, "\x1f")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// CatalogVersionAttempts is how often Catalog_Product numbers a new version
+// when another price of the same line takes the version number first
+var CatalogVersionAttempts = 3
+
+// Catalog_Product returns the product to sell a seat of the given movie, seat type and price.
+// The provider product is created the first time the combination is seen and reused afterwards.
+func (m *Payment_Service) Catalog_Product(ctx context.Context, movieName string, seatType string, price money.Money) (*models.CatalogProduct, error) {
+
+	key := CatalogKey(movieName, seatType, price)
+
+	var product models.CatalogProduct
+
+	result := m.DB.WithContext(ctx).Where("catalog_key = ?", key).First(&product)
+
+	if result.Error == nil {
+
+		if !product.Active {
+			// The price went back to an earlier version, make it current again
+			if err := m.activateCatalogProduct(ctx, &product); err != nil {
+				return nil, err
+			}
+		}
+
+		return &product, nil
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		m.log(ctx).Error("Error fetching catalog product: ", result.Error)
+		return nil, fmt.Errorf("error fetching catalog product: %w", result.Error)
+	}
+
+	// Not in the catalog yet, the provider call is kept outside of the transaction
+
+	created, err := m.Create_Product_Ticket(ctx, Product{
+		ProductName:        fmt.Sprintf("%s - %s", movieName, seatType),
+		Price:              price,
+		ProductDescription: fmt.Sprintf("%s seat for movie %s", seatType, movieName),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	product = models.CatalogProduct{
+		Key:       key,
+		LineKey:   CatalogLineKey(movieName, seatType, price.Currency),
+		MovieName: movieName,
+		SeatType:  seatType,
+		Price:     price,
+		Active:    true,
+		ProductID: created.ProductID,
+	}
+
+	for attempt := 1; ; attempt++ {
+
+		err = m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+			var latest models.CatalogProduct
+
+			// A chain is not reused, the finished query would leak into the update
+
+			line := func() *gorm.DB {
+				return tx.Model(&models.CatalogProduct{}).Where("line_key = ?", product.LineKey)
+			}
+
+			if result := line().Order("version DESC").Limit(1).Find(&latest); result.Error != nil {
+				return result.Error
+			}
+
+			product.Version = latest.Version + 1
+
+			if result := line().Update("active", false); result.Error != nil {
+				return result.Error
+			}
+
+			return tx.Create(&product).Error
+		})
+
+		if !errors.Is(err, gorm.ErrDuplicatedKey) || attempt == CatalogVersionAttempts {
+			break
+		}
+
+		var existing models.CatalogProduct
+
+		result := m.DB.WithContext(ctx).Where("catalog_key = ?", key).First(&existing)
+
+		if result.Error == nil {
+			// Another booking created the same catalog entry first, use theirs
+			m.log(ctx).Warnf("Catalog product %s was created concurrently, provider product %s is unused", key, created.ProductID)
+			return &existing, nil
+		}
+
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("error fetching catalog product: %w", result.Error)
+		}
+
+		// Another price of the line took the version first, number this one after it
+
+		m.log(ctx).Warnf("Catalog line of %s %s changed concurrently, retrying version %d", movieName, seatType, product.Version)
+	}
+
+	if err != nil {
+		m.log(ctx).Error("Error creating catalog product: ", err)
+		return nil, fmt.Errorf("error creating catalog product: %w", err)
+	}
+
+	m.log(ctx).Infof("Catalog product %s version %d created for %s %s at %s", product.ProductID, product.Version, movieName, seatType, price)
+
+	return &product, nil
+}
+
+func (m *Payment_Service) activateCatalogProduct(ctx context.Context, product *models.CatalogProduct) error {
+
+	// Only one version of a line may be active, the current one is switched off first
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Model(&models.CatalogProduct{}).
+			Where("line_key = ? AND active AND id <> ?", product.LineKey, product.ID).
+			Update("active", false)
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return tx.Model(&models.CatalogProduct{}).Where("id = ?", product.ID).Update("active", true).Error
+	})
+
+	if err != nil {
+		m.log(ctx).Error("Error activating catalog product: ", err)
+		return fmt.Errorf("error activating catalog product: %w", err)
+	}
+
+	product.Active = true
+
+	return nil
+}
+
+// Catalog_Prices returns the unit price of every catalog product in productIDs,
+// products that are not in the catalog are left out
+func (m *Payment_Service) Catalog_Prices(ctx context.Context, productIDs []string) (map[string]money.Money, error) {
+
+	var products []models.CatalogProduct
+
+	if result := m.DB.WithContext(ctx).Where("product_id IN ?", productIDs).Find(&products); result.Error != nil {
+		m.log(ctx).Error("Error fetching catalog prices: ", result.Error)
+		return nil, fmt.Errorf("error fetching catalog prices: %w", result.Error)
+	}
+
+	prices := make(map[string]money.Money, len(products))
+
+	for _, p := range products {
+		prices[p.ProductID] = p.Price
+	}
+
+	return prices, nil
+}
+
+// CartItems turns the product of every booked seat into line items, seats
+// sharing a product become one line with a quantity
+func CartItems(productIDs []string) []gateway.CartItem {
+
+	var items []gateway.CartItem
+	index := map[string]int{}
+
+	for _, id := range productIDs {
+
+		if i, ok := index[id]; ok {
+			items[i].Quantity++
+			continue
+		}
+
+		index[id] = len(items)
+		items = append(items, gateway.CartItem{ProductID: id, Quantity: 1})
+	}
+
+	return items
+}
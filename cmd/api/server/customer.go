@@ -3,62 +3,77 @@ package server
 import (
 	"context"
 	"errors"
+	"fmt"
 
-	"github.com/dodopayments/dodopayments-go"
-	log "github.com/sirupsen/logrus"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
 )
 
-func (m *Payment_Service) Create_Customer(email string, name string, phone_number string, idempotent_key string) (*dodopayments.Customer, error) {
+// Create_Customer creates the customer at the payment provider and attaches it, with
+// the billing address, to the booking session of idempotent_key
+func (m *Payment_Service) Create_Customer(ctx context.Context, email string, name string, phone_number string, idempotent_key string, billing models.BillingAddress) (*gateway.Customer, error) {
 
 	// Validate the input parameters
 
 	if email == "" || name == "" || phone_number == "" {
-		log.Error("Email, name, and phone number must be provided")
-		return nil, errors.New("email, name, and phone number must be provided")
+		m.log(ctx).Error("Email, name, and phone number must be provided")
+		return nil, fmt.Errorf("%w: email, name, and phone number must be provided", ErrInvalidArgument)
 	}
 
 	if m.Validator.Var(email, "email") != nil {
-		log.Error("Invalid email format: ", email)
-		return nil, errors.New("invalid email format")
+		m.log(ctx).Error("Invalid email format")
+		return nil, invalidField("email", "invalid email format")
 	}
 
 	if m.Validator.Var(phone_number, "e164") != nil {
-		log.Error("Invalid phone number format: ", phone_number)
-		return nil, errors.New("invalid phone number format")
+		m.log(ctx).Error("Invalid phone number format")
+		return nil, invalidField("phone_number", "invalid phone number format, expected E.164")
 	}
 
 	if m.Validator.Var(name, "required") != nil {
-		log.Error("Name is required")
-		return nil, errors.New("name is required")
+		m.log(ctx).Error("Name is required")
+		return nil, invalidField("customer_name", "name is required")
 	}
 
-	customer, err := m.Client.Customers.New(context.Background(), dodopayments.CustomerNewParams{
-		Email:       dodopayments.F(email),
-		PhoneNumber: dodopayments.F(phone_number), // Replace with actual phone number
-		Name:        dodopayments.F(name),         // Replace with actual customer name
-	})
+	if billing.Country != "" && m.Validator.Var(billing.Country, "iso3166_1_alpha2") != nil {
+		m.log(ctx).Error("Invalid billing country: ", billing.Country)
+		return nil, invalidField("country", "billing country must be an ISO 3166 alpha-2 code")
+	}
 
-	// Commit customer details with idempotent key
+	// Without a session there is nothing to attach the customer to, check before creating it at the provider
 
-	if idempotent_key != "" {
-		err := m.CommitCustomerPaymentSession(idempotent_key, customer.CustomerID)
-
-		if err != nil {
-			log.Error("Failed to commit customer ID with idempotent key: ", err)
-			return nil, err
-		}
-	} else {
-		// Return an error if idempotent key is not provided
-		log.Error("Idempotent key is required for committing customer details")
-		return nil, errors.New("idempotent key is required for committing customer details")
+	if idempotent_key == "" {
+		m.log(ctx).Error("Idempotent key is required for committing customer details")
+		return nil, invalidField("idempotent_key", "idempotent key is required for committing customer details")
 	}
 
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	customer, err := m.Gateway.CreateCustomer(gatewayCtx, gateway.CustomerParams{
+		Email:       email,
+		PhoneNumber: phone_number,
+		Name:        name,
+	})
+
 	if err != nil {
-		log.Error("Failed to create customer: ", err)
+		m.log(ctx).Error("Failed to create customer: ", err)
+		return nil, fmt.Errorf("failed to create customer: %w", err)
+	}
+
+	if customer == nil {
+		m.log(ctx).Error("Payment provider returned no customer")
+		return nil, errors.New("payment provider returned no customer")
+	}
+
+	// Commit customer details with idempotent key
+
+	if err := m.CommitCustomerPaymentSession(ctx, idempotent_key, customer.CustomerID, &billing); err != nil {
+		m.log(ctx).Error("Failed to commit customer ID with idempotent key: ", err)
 		return nil, err
 	}
 
-	log.Info("Customer created successfully with ID: ", customer.CustomerID)
+	m.log(ctx).Info("Customer created successfully with ID: ", customer.CustomerID)
 
 	return customer, nil
 }
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"gorm.io/gorm"
+)
+
+// SessionTTL is how long a session may take from committing its idempotent key to being paid
+var SessionTTL = 24 * time.Hour
+
+// OpenPaymentGrace is how long past its ExpiredAt a session whose payment is still
+// open at the provider is kept. After that it is expired without asking the
+// provider again, a payment captured later is refunded when its webhook arrives.
+var OpenPaymentGrace = time.Hour
+
+var ErrSessionExpired = errors.New("payment session has expired")
+
+// Expiry_Sweeper periodically expires sessions that were not paid for before
+// their ExpiredAt and whose payment, if any, is closed at the provider. It
+// releases their seat holds and soft-deletes them.
+type Expiry_Sweeper struct {
+	Ps        *Payment_Service
+	Interval  time.Duration
+	BatchSize int
+}
+
+// NewExpirySweeper scans for expired sessions every interval, batchSize at a time
+func NewExpirySweeper(ps *Payment_Service, interval time.Duration, batchSize int) (*Expiry_Sweeper, error) {
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("sweep interval must be positive, got %s", interval)
+	}
+
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("sweep batch size must be positive, got %d", batchSize)
+	}
+
+	return &Expiry_Sweeper{
+		Ps:        ps,
+		Interval:  interval,
+		BatchSize: batchSize,
+	}, nil
+}
+
+// Run sweeps once right away and then every Interval until ctx is cancelled
+func (s *Expiry_Sweeper) Run(ctx context.Context) {
+
+	s.Ps.logger().Infof("Session expiry sweeper started, scanning every %s in batches of %d", s.Interval, s.BatchSize)
+
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := s.Sweep(ctx); err != nil {
+			s.Ps.logger().Error("Session expiry sweep failed: ", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			s.Ps.logger().Info("Session expiry sweeper stopped")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sweep looks at expired sessions batch by batch until it has seen every one of
+// them or ctx is cancelled. Sessions that are kept, e.g. because their payment can
+// still be completed, do not stop the sweep from reaching the ones after them.
+func (s *Expiry_Sweeper) Sweep(ctx context.Context) (int, error) {
+
+	total := 0
+
+	var after uint
+
+	for ctx.Err() == nil {
+
+		expired, next, err := s.Ps.Expire_Sessions(ctx, s.Ps.now(), after, s.BatchSize)
+
+		total += expired
+
+		if err != nil {
+			return total, err
+		}
+
+		if next == 0 {
+			break
+		}
+
+		after = next
+	}
+
+	if total > 0 {
+		s.Ps.logger().Infof("Expired %d payment sessions", total)
+	}
+
+	return total, nil
+}
+
+// closedPaymentStatuses are the statuses of a payment at the provider that can no longer be paid
+var closedPaymentStatuses = map[string]bool{
+	"failed":    true,
+	"cancelled": true,
+	"expired":   true,
+}
+
+// Expire_Sessions expires unpaid sessions whose ExpiredAt is before now, looking
+// at up to limit of them with an ID above after. A session with a payment the
+// customer can still complete is kept for up to OpenPaymentGrace, expiring it
+// would turn a late payment into a refund. It returns how many were expired and the ID to continue after, 0 once
+// there are no more sessions to look at. Sessions that changed state while being
+// expired are skipped and picked up again by a later sweep if needed.
+func (m *Payment_Service) Expire_Sessions(ctx context.Context, now time.Time, after uint, limit int) (int, uint, error) {
+
+	var sessions []models.Idempotent
+
+	result := m.DB.WithContext(ctx).Select("id", "idempotent_key", "payment_status", "payment_id", "expired_at").
+		Where("id > ? AND expired_at < ? AND payment_status IN ?", after, now, models.ExpirablePaymentStatuses()).
+		Order("id asc").
+		Limit(limit).
+		Find(&sessions)
+
+	if result.Error != nil {
+		m.log(ctx).Error("Error fetching expired sessions: ", result.Error)
+		return 0, 0, fmt.Errorf("error fetching expired sessions: %w", result.Error)
+	}
+
+	expired := 0
+
+	var next uint
+
+	for _, session := range sessions {
+
+		next = session.ID
+
+		if !m.paymentClosed(ctx, session, now) {
+			continue
+		}
+
+		err := m.expireSession(ctx, session.IdempotentKey)
+
+		if errors.Is(err, ErrInvalidPaymentTransition) || errors.Is(err, ErrPaymentStatusConflict) {
+			m.log(ctx).Warnf("Skipping expiry of idempotent key %s: %v", session.IdempotentKey, err)
+			continue
+		}
+
+		if err != nil {
+			return expired, 0, err
+		}
+
+		expired++
+	}
+
+	if len(sessions) < limit {
+		next = 0
+	}
+
+	return expired, next, nil
+}
+
+// paymentClosed reports whether the session has no payment left that the
+// customer could still complete at the provider, or has been kept open for
+// longer than OpenPaymentGrace
+func (m *Payment_Service) paymentClosed(ctx context.Context, session models.Idempotent, now time.Time) bool {
+
+	paymentStatus := models.NormalizePaymentStatus(string(session.PaymentStatus))
+
+	if session.PaymentID == nil || *session.PaymentID == "" || !paymentStatus.CanTransitionTo(models.PaymentStatusSucceeded) {
+		return true
+	}
+
+	if now.After(session.ExpiredAt.Add(OpenPaymentGrace)) {
+		m.log(ctx).Warnf("Expiring idempotent key %s, payment %s is still open %s after the session expired", session.IdempotentKey, *session.PaymentID, OpenPaymentGrace)
+		return true
+	}
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	payment, err := m.Gateway.GetPayment(gatewayCtx, *session.PaymentID)
+
+	if err != nil {
+		m.log(ctx).Warnf("Not expiring idempotent key %s, payment %s could not be checked: %v", session.IdempotentKey, *session.PaymentID, err)
+		return false
+	}
+
+	if !closedPaymentStatuses[payment.Status] {
+		m.log(ctx).Warnf("Not expiring idempotent key %s, payment %s is %s at the provider", session.IdempotentKey, *session.PaymentID, payment.Status)
+		return false
+	}
+
+	return true
+}
+
+// expireSession marks the session EXPIRED, releases its seat holds and
+// soft-deletes it in one transaction
+func (m *Payment_Service) expireSession(ctx context.Context, key string) error {
+
+	var change *statusChange
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var err error
+
+		if change, err = m.transitionPaymentStatus(tx, key, models.PaymentStatusExpired, "session expired", nil); err != nil {
+			return err
+		}
+
+		if err := m.releaseSeatHolds(tx, key); err != nil {
+			return err
+		}
+
+		result := tx.Where("idempotent_key = ?", key).Delete(&models.Idempotent{})
+
+		if result.Error != nil {
+			m.log(ctx).Error("Error deleting expired session: ", result.Error)
+			return fmt.Errorf("error deleting expired session %s: %w", key, result.Error)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	change.count()
+
+	return nil
+}
@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gorm.io/gorm"
+)
+
+// ErrorDomain is the domain of the ErrorInfo attached to every error of the PaymentService RPCs
+const ErrorDomain = "payment_service.booking"
+
+var (
+	ErrInvalidArgument    = errors.New("invalid argument")
+	ErrMovieDBUnavailable = errors.New("movie DB service is unavailable")
+)
+
+// UnavailableRetryDelay is the RetryInfo delay suggested to clients for Unavailable errors
+var UnavailableRetryDelay = time.Second
+
+// FieldError is an invalid field of a request
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Description
+}
+
+func (e *FieldError) Is(target error) bool {
+	return target == ErrInvalidArgument
+}
+
+func invalidField(field string, description string) error {
+	return &FieldError{Field: field, Description: description}
+}
+
+// domainErrors maps the errors of the service to gRPC codes, the first match wins
+var domainErrors = []struct {
+	err    error
+	code   codes.Code
+	reason string
+}{
+	{ErrInvalidArgument, codes.InvalidArgument, "INVALID_ARGUMENT"},
+	{ErrInvalidRedirectURL, codes.InvalidArgument, "INVALID_REDIRECT_URL"},
+	{money.ErrUnknownCurrency, codes.InvalidArgument, "UNSUPPORTED_CURRENCY"},
+	{ErrSeatNotInBooking, codes.InvalidArgument, "SEAT_NOT_IN_BOOKING"},
+	{ErrIdempotentKeyNotFound, codes.NotFound, "SESSION_NOT_FOUND"},
+	{gorm.ErrRecordNotFound, codes.NotFound, "NOT_FOUND"},
+	{ErrSeatHeld, codes.AlreadyExists, "SEAT_HELD"},
+	{ErrSeatsUnavailable, codes.AlreadyExists, "SEATS_UNAVAILABLE"},
+	{ErrPaymentStatusConflict, codes.Aborted, "PAYMENT_STATUS_CONFLICT"},
+	{ErrSessionExpired, codes.FailedPrecondition, "SESSION_EXPIRED"},
+	{ErrSeatAlreadyRefunded, codes.FailedPrecondition, "SEAT_ALREADY_REFUNDED"},
+	{ErrInvalidPaymentTransition, codes.FailedPrecondition, "INVALID_PAYMENT_STATUS"},
+	{fx.ErrRateNotFound, codes.FailedPrecondition, "EXCHANGE_RATE_NOT_FOUND"},
+	{gateway.ErrUnavailable, codes.Unavailable, "PAYMENT_PROVIDER_UNAVAILABLE"},
+	{ErrMovieDBUnavailable, codes.Unavailable, "MOVIEDB_UNAVAILABLE"},
+}
+
+// classify returns the gRPC code of err and the reason reported in its ErrorInfo
+func classify(err error) (codes.Code, string) {
+
+	var validationErrs validator.ValidationErrors
+
+	if errors.As(err, &validationErrs) {
+		return codes.InvalidArgument, "INVALID_ARGUMENT"
+	}
+
+	// The caller went away, whatever failed after that is not an error of the service
+
+	if errors.Is(err, context.Canceled) || status.Code(err) == codes.Canceled {
+		return codes.Canceled, "CANCELED"
+	}
+
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			return d.code, d.reason
+		}
+	}
+
+	return codes.Internal, "INTERNAL"
+}
+
+// describe is the text of the domain error err matches, without whatever
+// was wrapped around it on the way up
+func describe(err error) string {
+
+	for _, d := range domainErrors {
+		if errors.Is(err, d.err) {
+			return d.err.Error()
+		}
+	}
+
+	return ""
+}
+
+// legacyStatus is the HTTP-like value of the Status field for a gRPC code
+func legacyStatus(code codes.Code) int32 {
+
+	switch code {
+	case codes.OK:
+		return 200
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument:
+		return 400
+	case codes.NotFound:
+		return 404
+	case codes.AlreadyExists, codes.Aborted:
+		return 409
+	case codes.FailedPrecondition:
+		return 412
+	case codes.Unavailable:
+		return 503
+	default:
+		return 500
+	}
+}
+
+// movieDBError marks transient failures of a movie DB call as ErrMovieDBUnavailable
+func movieDBError(err error) error {
+
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return fmt.Errorf("%w: %w", ErrMovieDBUnavailable, err)
+	}
+
+	return err
+}
+
+// statusError is the gRPC error a handler returns for err. Besides the
+// errdetails matching its code, the status carries legacy, the response the
+// RPC used to return with a nil error, with its Status, Error and Message
+// fields filled in so clients still reading them can unpack it during the
+// transition.
+func statusError(ctx context.Context, err error, message string, legacy proto.Message) error {
+
+	code, reason := classify(err)
+
+	legacyCode := legacyStatus(code)
+
+	logger := logging.FromContext(ctx).WithField("reason", reason)
+
+	if code == codes.Internal {
+		logger.Errorf("%s: %v", message, err)
+	} else {
+		logger.Warnf("%s: %v", message, err)
+	}
+
+	// Internal errors carry SQL, driver and provider messages, the client only gets
+	// the message of the handler and the rest stays in the log
+
+	errText := message
+	st := status.New(code, message)
+
+	if code != codes.Internal {
+		errText = err.Error()
+		st = status.New(code, fmt.Sprintf("%s: %s", message, errText))
+	}
+
+	details := []protoadapt.MessageV1{
+		&errdetails.ErrorInfo{
+			Reason: reason,
+			Domain: ErrorDomain,
+			Metadata: map[string]string{
+				"legacy_status": strconv.Itoa(int(legacyCode)),
+			},
+		},
+	}
+
+	switch code {
+	case codes.InvalidArgument:
+		if violations := fieldViolations(err); len(violations) > 0 {
+			details = append(details, &errdetails.BadRequest{FieldViolations: violations})
+		}
+	case codes.NotFound:
+		details = append(details, &errdetails.ResourceInfo{
+			ResourceType: "payment_session",
+			Description:  describe(err),
+		})
+	case codes.FailedPrecondition:
+		details = append(details, &errdetails.PreconditionFailure{
+			Violations: []*errdetails.PreconditionFailure_Violation{{
+				Type:        reason,
+				Description: describe(err),
+			}},
+		})
+	case codes.Unavailable:
+		details = append(details, &errdetails.RetryInfo{
+			RetryDelay: durationpb.New(UnavailableRetryDelay),
+		})
+	}
+
+	if legacy != nil {
+		setLegacyFields(legacy, legacyCode, errText, message)
+		details = append(details, protoadapt.MessageV1Of(legacy))
+	}
+
+	withDetails, detailsErr := st.WithDetails(details...)
+
+	if detailsErr != nil {
+		logging.FromContext(ctx).Error("Failed to attach error details: ", detailsErr)
+		return st.Err()
+	}
+
+	return withDetails.Err()
+}
+
+func fieldViolations(err error) []*errdetails.BadRequest_FieldViolation {
+
+	var violations []*errdetails.BadRequest_FieldViolation
+
+	var fieldErr *FieldError
+
+	if errors.As(err, &fieldErr) {
+		violations = append(violations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldErr.Field,
+			Description: fieldErr.Description,
+		})
+	}
+
+	var validationErrs validator.ValidationErrors
+
+	if errors.As(err, &validationErrs) {
+		for _, fe := range validationErrs {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fe.Field(),
+				Description: fe.Error(),
+			})
+		}
+	}
+
+	return violations
+}
+
+// setLegacyFields fills in the Status, Error and Message fields the PaymentService responses share
+func setLegacyFields(msg proto.Message, statusCode int32, errText string, message string) {
+
+	m := msg.ProtoReflect()
+
+	fields := m.Descriptor().Fields()
+
+	if f := fields.ByName("status"); f != nil && f.Kind() == protoreflect.Int32Kind {
+		m.Set(f, protoreflect.ValueOfInt32(statusCode))
+	}
+
+	if f := fields.ByName("error"); f != nil && f.Kind() == protoreflect.StringKind {
+		m.Set(f, protoreflect.ValueOfString(errText))
+	}
+
+	if f := fields.ByName("message"); f != nil && f.Kind() == protoreflect.StringKind {
+		m.Set(f, protoreflect.ValueOfString(message))
+	}
+}
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ReadinessTimeout bounds every readiness check
+var ReadinessTimeout = 5 * time.Second
+
+// Readiness_Check is a dependency the server cannot serve without
+type Readiness_Check struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// Health_Checker runs the readiness checks periodically and reports the result
+// through the grpc.health.v1 service, for the whole server and for
+// PaymentService. The server is NOT_SERVING until the first checks pass.
+type Health_Checker struct {
+	Health   *health.Server
+	Checks   []Readiness_Check
+	Interval time.Duration
+	Ps       *Payment_Service
+
+	mu    sync.Mutex
+	ready *bool
+}
+
+// NewHealthChecker checks the readiness of the server every interval
+func NewHealthChecker(ps *Payment_Service, checks []Readiness_Check, interval time.Duration) (*Health_Checker, error) {
+
+	if interval <= 0 {
+		return nil, fmt.Errorf("health check interval must be positive, got %s", interval)
+	}
+
+	h := &Health_Checker{
+		Health:   health.NewServer(),
+		Checks:   checks,
+		Interval: interval,
+		Ps:       ps,
+	}
+
+	h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+
+	return h, nil
+}
+
+// Run checks once right away and then every Interval until ctx is cancelled
+func (h *Health_Checker) Run(ctx context.Context) {
+
+	ticker := time.NewTicker(h.Interval)
+	defer ticker.Stop()
+
+	for {
+		h.Check(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Check runs every readiness check concurrently, updates the reported status
+// and returns the failed checks
+func (h *Health_Checker) Check(ctx context.Context) error {
+
+	errs := make([]error, len(h.Checks))
+
+	var wg sync.WaitGroup
+
+	for i, check := range h.Checks {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, ReadinessTimeout)
+			defer cancel()
+
+			if err := check.Check(checkCtx); err != nil {
+				errs[i] = fmt.Errorf("%s: %w", check.Name, err)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	err := errors.Join(errs...)
+
+	h.report(err)
+
+	return err
+}
+
+// Drain reports NOT_SERVING from now on, whatever the checks say, so load
+// balancers stop sending calls before the server stops
+func (h *Health_Checker) Drain() {
+	h.Ps.logger().Info("Draining, health reports NOT_SERVING")
+	h.Health.Shutdown()
+}
+
+// report logs only changes of readiness, the checks run every few seconds
+func (h *Health_Checker) report(err error) {
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ready := err == nil
+
+	if h.ready != nil && *h.ready == ready {
+		return
+	}
+
+	h.ready = &ready
+
+	if ready {
+		h.Ps.logger().Info("Payment server is ready")
+		h.setStatus(healthpb.HealthCheckResponse_SERVING)
+	} else {
+		h.Ps.logger().Warn("Payment server is not ready: ", err)
+		h.setStatus(healthpb.HealthCheckResponse_NOT_SERVING)
+	}
+}
+
+func (h *Health_Checker) setStatus(s healthpb.HealthCheckResponse_ServingStatus) {
+	h.Health.SetServingStatus("", s)
+	h.Health.SetServingStatus(payment_service.PaymentService_ServiceDesc.ServiceName, s)
+}
+
+// ReadinessChecks are the dependencies of the payment server: the database,
+// the movie DB service when its connection is known and the payment gateway
+func (p *Payment_Server) ReadinessChecks() []Readiness_Check {
+
+	checks := []Readiness_Check{
+		{Name: "postgres", Check: p.Ps.checkDatabase},
+		{Name: "payment_gateway", Check: p.Ps.checkGateway},
+	}
+
+	if p.movieDBConn != nil {
+		checks = append(checks, Readiness_Check{Name: "moviedb", Check: func(ctx context.Context) error {
+			return checkMovieDB(ctx, p.movieDBConn)
+		}})
+	}
+
+	return checks
+}
+
+func (m *Payment_Service) checkDatabase(ctx context.Context) error {
+
+	if m.DB == nil {
+		return errors.New("no database connection")
+	}
+
+	sqlDB, err := m.DB.DB()
+
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.PingContext(ctx)
+}
+
+func (m *Payment_Service) checkGateway(ctx context.Context) error {
+
+	if m.Gateway == nil {
+		return errors.New("no payment gateway")
+	}
+
+	if checker, ok := m.Gateway.(gateway.Checker); ok {
+		return checker.Check(ctx)
+	}
+
+	return nil
+}
+
+// checkMovieDB asks the movie DB service for its health. Any answer but
+// Unavailable or a timeout, e.g. Unimplemented when it has no health service,
+// shows the service is reachable.
+func checkMovieDB(ctx context.Context, conn grpc.ClientConnInterface) error {
+
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+
+	switch status.Code(err) {
+	case codes.OK:
+		if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+			return fmt.Errorf("movie DB service reports %s", resp.GetStatus())
+		}
+
+		return nil
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Canceled:
+		return fmt.Errorf("movie DB service is unreachable: %w", err)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,412 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrUnbalancedJournalEntry = errors.New("journal entry postings do not sum to zero")
+	ErrUnknownAccountType     = errors.New("unknown account type")
+)
+
+// PostingInput is one leg of a journal entry. Debits are positive, credits negative.
+type PostingInput struct {
+	AccountType string
+	OwnerID     string
+	Amount      money.Money
+}
+
+// Post_Journal_Entry books the postings as a single balanced journal entry.
+// The reference makes posting idempotent, posting the same reference again
+// returns the entry that was booked the first time.
+func (m *Payment_Service) Post_Journal_Entry(ctx context.Context, reference string, idempotentKey string, description string, postings []PostingInput) (*models.JournalEntry, error) {
+
+	totals := map[string]money.Money{}
+
+	for _, p := range postings {
+
+		if err := p.Amount.Validate(); err != nil {
+			return nil, err
+		}
+
+		total, ok := totals[p.Amount.Currency]
+
+		if !ok {
+			total = money.Zero(p.Amount.Currency)
+		}
+
+		total, err := total.Add(p.Amount)
+
+		if err != nil {
+			return nil, err
+		}
+
+		totals[p.Amount.Currency] = total
+	}
+
+	for _, total := range totals {
+		if !total.IsZero() {
+			return nil, fmt.Errorf("%w: %s is off by %s", ErrUnbalancedJournalEntry, total.Currency, total.Major())
+		}
+	}
+
+	var entry models.JournalEntry
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Where("reference = ?", reference).Preload("Postings").First(&entry)
+
+		if result.Error == nil {
+			m.log(ctx).Infof("Journal entry %s is already posted", reference)
+			return nil
+		}
+
+		if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("error fetching journal entry: %w", result.Error)
+		}
+
+		entry = models.JournalEntry{
+			Reference:     reference,
+			IdempotentKey: idempotentKey,
+			Description:   description,
+		}
+
+		for _, p := range postings {
+
+			if p.Amount.IsZero() {
+				continue
+			}
+
+			account, err := ensureAccount(tx, p.AccountType, p.OwnerID)
+
+			if err != nil {
+				return err
+			}
+
+			entry.Postings = append(entry.Postings, models.Posting{
+				AccountID: account.ID,
+				Amount:    p.Amount,
+			})
+		}
+
+		if result := tx.Create(&entry); result.Error != nil {
+			return fmt.Errorf("error creating journal entry: %w", result.Error)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		m.log(ctx).Errorf("Failed to post journal entry %s: %v", reference, err)
+		return nil, err
+	}
+
+	m.log(ctx).Infof("Journal entry %s posted with %d postings", reference, len(entry.Postings))
+
+	return &entry, nil
+}
+
+// ensureAccount returns the account of the given type and owner, creating it on first use
+func ensureAccount(tx *gorm.DB, accountType string, ownerID string) (*models.Account, error) {
+
+	if _, err := ensureAccountType(tx, accountType); err != nil {
+		return nil, err
+	}
+
+	account := models.Account{Type: accountType, OwnerID: ownerID}
+
+	result := tx.Where(models.Account{Type: accountType, OwnerID: ownerID}).FirstOrCreate(&account)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("error fetching account %s/%s: %w", accountType, ownerID, result.Error)
+	}
+
+	return &account, nil
+}
+
+// ensureAccountType looks the type up in the account_types table. The default
+// types are created on first use so a fresh database needs no seeding.
+func ensureAccountType(tx *gorm.DB, code string) (*models.AccountType, error) {
+
+	var accountType models.AccountType
+
+	result := tx.Where("code = ?", code).First(&accountType)
+
+	if result.Error == nil {
+		return &accountType, nil
+	}
+
+	if !errors.Is(result.Error, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("error fetching account type %s: %w", code, result.Error)
+	}
+
+	for _, defaultType := range models.DefaultAccountTypes {
+		if defaultType.Code == code {
+			accountType = defaultType
+
+			if result := tx.Create(&accountType); result.Error != nil {
+				return nil, fmt.Errorf("error creating account type %s: %w", code, result.Error)
+			}
+
+			return &accountType, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownAccountType, code)
+}
+
+// Account_Balance derives the balance of an account from its postings, per
+// currency. Balances are reported on the normal side of the account type, so
+// a venue payable account that is owed money has a positive balance.
+func (m *Payment_Service) Account_Balance(ctx context.Context, accountType string, ownerID string) (map[string]money.Money, error) {
+
+	at, err := ensureAccountType(m.DB.WithContext(ctx), accountType)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Currency string
+		Total    int64
+	}
+
+	result := m.DB.WithContext(ctx).Model(&models.Posting{}).
+		Select("postings.currency AS currency, SUM(postings.amount) AS total").
+		Joins("JOIN accounts ON accounts.id = postings.account_id AND accounts.deleted_at IS NULL").
+		Where("accounts.type = ? AND accounts.owner_id = ?", accountType, ownerID).
+		Group("postings.currency").
+		Scan(&rows)
+
+	if result.Error != nil {
+		m.log(ctx).Error("Error computing account balance: ", result.Error)
+		return nil, fmt.Errorf("error computing account balance: %w", result.Error)
+	}
+
+	balances := map[string]money.Money{}
+
+	for _, row := range rows {
+		balance := money.New(row.Total, row.Currency)
+
+		if at.NormalBalance == models.NormalBalanceCredit {
+			balance = balance.Neg()
+		}
+
+		balances[row.Currency] = balance
+	}
+
+	return balances, nil
+}
+
+// PaymentPostings splits a captured payment between tax, the platform fee and
+// the venue. The customer account is debited with the full amount. The fee is
+// rounded down, the venue gets the minor units left over.
+func PaymentPostings(customerID string, venueID string, total money.Money, tax money.Money, feeBasisPoints int64) ([]PostingInput, error) {
+
+	net, err := total.Sub(tax)
+
+	if err != nil {
+		return nil, err
+	}
+
+	fee, err := net.MulRatio(feeBasisPoints, 10000, money.RoundDown)
+
+	if err != nil {
+		return nil, err
+	}
+
+	venue, err := net.Sub(fee)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []PostingInput{
+		{AccountType: models.AccountTypeCustomer, OwnerID: customerID, Amount: total},
+		{AccountType: models.AccountTypeTaxPayable, Amount: tax.Neg()},
+		{AccountType: models.AccountTypePlatformRevenue, Amount: fee.Neg()},
+		{AccountType: models.AccountTypeVenuePayable, OwnerID: venueID, Amount: venue.Neg()},
+	}, nil
+}
+
+// VenueOwner is the owner of the venue_payable account of a venue, the account
+// without owner when the venue of the session is not known
+func VenueOwner(venueID uint) string {
+
+	if venueID == 0 {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(venueID), 10)
+}
+
+// Post_Payment_Journal books a captured payment into the ledger
+func (m *Payment_Service) Post_Payment_Journal(ctx context.Context, idempotent_key string, venueID uint, transaction_id string) error {
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	payment, err := m.Gateway.GetPayment(gatewayCtx, transaction_id)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to fetch payment details: ", err)
+		return fmt.Errorf("failed to fetch payment details: %w", err)
+	}
+
+	postings, err := PaymentPostings(payment.Customer.CustomerID, VenueOwner(venueID), payment.TotalAmount, payment.Tax, m.PlatformFeeBasisPoints)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to split payment: ", err)
+		return fmt.Errorf("failed to split payment %s: %w", payment.PaymentID, err)
+	}
+
+	_, err = m.Post_Journal_Entry(ctx,
+		"payment:"+payment.PaymentID,
+		idempotent_key,
+		fmt.Sprintf("Payment %s received from customer %s", payment.PaymentID, payment.Customer.CustomerID),
+		postings,
+	)
+
+	return err
+}
+
+// RefundPostings reverses refund out of the split PaymentPostings made of the
+// payment. The customer is credited and the tax, platform and venue accounts
+// are debited in proportion to what they were credited. Shares are taken of
+// everything refunded so far, refundedBefore included, so partial refunds do
+// not drift by a minor unit and a complete refund brings every account back
+// to zero.
+func RefundPostings(customerID string, venueID string, refund money.Money, refundedBefore money.Money, total money.Money, tax money.Money, feeBasisPoints int64) ([]PostingInput, error) {
+
+	payment, err := PaymentPostings(customerID, venueID, total, tax, feeBasisPoints)
+
+	if err != nil {
+		return nil, err
+	}
+
+	credited := map[string]int64{}
+	owners := map[string]string{}
+
+	for _, p := range payment {
+		credited[p.AccountType] = -p.Amount.Amount
+		owners[p.AccountType] = p.OwnerID
+	}
+
+	refunded, err := refundedBefore.Add(refund)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The venue comes first so it takes the rounding, as it does when the payment is split
+
+	accounts := []string{models.AccountTypeVenuePayable, models.AccountTypeTaxPayable, models.AccountTypePlatformRevenue}
+
+	weights := make([]int64, len(accounts))
+
+	for i, account := range accounts {
+		weights[i] = credited[account]
+	}
+
+	after, err := refunded.Allocate(weights...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	before := make([]money.Money, len(accounts))
+
+	if refundedBefore.IsZero() {
+		for i := range before {
+			before[i] = money.Zero(refund.Currency)
+		}
+	} else if before, err = refundedBefore.Allocate(weights...); err != nil {
+		return nil, err
+	}
+
+	postings := []PostingInput{{AccountType: models.AccountTypeCustomer, OwnerID: customerID, Amount: refund.Neg()}}
+
+	for i, account := range accounts {
+
+		share, err := after[i].Sub(before[i])
+
+		if err != nil {
+			return nil, err
+		}
+
+		postings = append(postings, PostingInput{AccountType: account, OwnerID: owners[account], Amount: share})
+	}
+
+	return postings, nil
+}
+
+// Post_Refund_Journal books a refund against the split of its payment, see RefundPostings
+func (m *Payment_Service) Post_Refund_Journal(ctx context.Context, refund *gateway.Refund, idempotentKey string, customerID string, venueID uint, reason string) error {
+	return m.postReversal(ctx, "refund:"+refund.RefundID, refund.RefundID, refund.PaymentID, refund.Amount.Amount, idempotentKey, customerID, venueID,
+		fmt.Sprintf("Refund %s of payment %s: %s", refund.RefundID, refund.PaymentID, reason))
+}
+
+// Post_Dispute_Journal books the funds of a lost or accepted dispute, which the
+// provider returned to the customer, like a refund of the payment
+func (m *Payment_Service) Post_Dispute_Journal(ctx context.Context, dispute DisputeWebhookData, idempotentKey string, customerID string, venueID uint) error {
+	return m.postReversal(ctx, "dispute:"+dispute.DisputeID, "", dispute.PaymentID, dispute.Amount.Amount, idempotentKey, customerID, venueID,
+		fmt.Sprintf("Dispute %s of payment %s is %s", dispute.DisputeID, dispute.PaymentID, dispute.DisputeStatus))
+}
+
+// postReversal books amount of the payment back to the customer under reference.
+// Refunds of the payment listed before refundID, every one when it is empty,
+// have been posted already.
+func (m *Payment_Service) postReversal(ctx context.Context, reference string, refundID string, paymentID string, amount int64, idempotentKey string, customerID string, venueID uint, description string) error {
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	payment, err := m.Gateway.GetPayment(gatewayCtx, paymentID)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to fetch payment details: ", err)
+		return fmt.Errorf("failed to fetch payment details: %w", err)
+	}
+
+	// Providers may leave the currency out of the refund, it is always the one of the payment
+
+	currency := payment.TotalAmount.Currency
+
+	// Failed refunds reversed nothing
+
+	refundedBefore := money.Zero(currency)
+
+	for _, earlier := range payment.Refunds {
+
+		if refundID != "" && earlier.RefundID == refundID {
+			break
+		}
+
+		if earlier.Status == "failed" {
+			continue
+		}
+
+		if refundedBefore, err = refundedBefore.Add(money.New(earlier.Amount.Amount, currency)); err != nil {
+			return err
+		}
+	}
+
+	postings, err := RefundPostings(customerID, VenueOwner(venueID), money.New(amount, currency), refundedBefore, payment.TotalAmount, payment.Tax, m.PlatformFeeBasisPoints)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to split refund: ", err)
+		return fmt.Errorf("failed to split %s: %w", reference, err)
+	}
+
+	_, err = m.Post_Journal_Entry(ctx, reference, idempotentKey, description, postings)
+
+	return err
+}
@@ -0,0 +1,44 @@
+package server
+
+import (
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/resilience"
+	"google.golang.org/grpc"
+)
+
+// MovieDBPolicies are the retry policies of the movie DB RPCs by full method
+// name, as set in cfg. Only RPCs that change nothing are retried here, BookSeats
+// is retried by bookSeatsWithRetry, which knows which of its failures are safe
+// to retry.
+func MovieDBPolicies(cfg *config.Config) map[string]resilience.Policy {
+
+	retried := resilience.Policy{
+		MaxAttempts:    cfg.MovieDBRetryAttempts,
+		AttemptTimeout: cfg.MovieDBAttemptTimeout,
+		Budget:         cfg.MovieDBRetryBudget,
+		Backoff:        resilience.Backoff{Initial: cfg.MovieDBRetryBackoff, Max: cfg.MovieDBRetryMaxBackoff},
+	}
+
+	return map[string]resilience.Policy{
+		moviedb_service.MovieDBService_IsValidToCommitSeatsForBooking_FullMethodName: retried,
+		moviedb_service.MovieDBService_GetSeatMatrix_FullMethodName:                  retried,
+	}
+}
+
+// MovieDBDefaultPolicy is used for movie DB RPCs without a policy, which are
+// tried once within the deadline of the caller
+var MovieDBDefaultPolicy = resilience.Policy{MaxAttempts: 1}
+
+// newMovieDBClient calls the movie DB service over conn with policies by full
+// method name, behind breaker
+func newMovieDBClient(conn grpc.ClientConnInterface, breaker *resilience.Breaker, policies map[string]resilience.Policy) moviedb_service.MovieDBServiceClient {
+	return moviedb_service.NewMovieDBServiceClient(&resilience.Conn{
+		ClientConnInterface: conn,
+		Service:             metrics.ServiceMovieDB,
+		Breaker:             breaker,
+		Policies:            policies,
+		Default:             MovieDBDefaultPolicy,
+	})
+}
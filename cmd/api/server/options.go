@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"gorm.io/gorm"
+)
+
+// Option hands NewPaymentServer a dependency it would otherwise build from the
+// config, so tests and other entry points can inject fakes
+type Option func(*dependencies)
+
+type dependencies struct {
+	gateway gateway.PaymentGateway
+	db      *gorm.DB
+	movieDB moviedb_service.MovieDBServiceClient
+	// movieDBConn is the connection to the movie DB service when known, for
+	// readiness checks
+	movieDBConn grpc.ClientConnInterface
+	rates       fx.RateProvider
+	now         func() time.Time
+	logger      *log.Logger
+}
+
+// WithGateway uses the gateway instead of Dodo Payments
+func WithGateway(g gateway.PaymentGateway) Option {
+	return func(d *dependencies) { d.gateway = g }
+}
+
+// WithDB uses the database instead of connecting to the database URL of the config,
+// it should be opened with TranslateError like the connection it replaces
+func WithDB(db *gorm.DB) Option {
+	return func(d *dependencies) { d.db = db }
+}
+
+// WithMovieDB uses the client instead of dialling the movie DB address of the config
+func WithMovieDB(client moviedb_service.MovieDBServiceClient) Option {
+	return func(d *dependencies) { d.movieDB = client }
+}
+
+// WithMovieDBConn talks to the movie DB service over conn, with the same
+// retries and circuit breaker as a dialled connection. Its reachability is
+// also part of the readiness of the server.
+func WithMovieDBConn(conn grpc.ClientConnInterface) Option {
+	return func(d *dependencies) { d.movieDBConn = conn }
+}
+
+// WithRateProvider uses the provider instead of the FX rates file of the config
+func WithRateProvider(rates fx.RateProvider) Option {
+	return func(d *dependencies) { d.rates = rates }
+}
+
+// WithClock reads the current time from now, e.g. to test expiry
+func WithClock(now func() time.Time) Option {
+	return func(d *dependencies) { d.now = now }
+}
+
+// WithLogger logs to logger instead of the standard logrus logger, calls whose
+// context carries a request logger log to that one
+func WithLogger(logger *log.Logger) Option {
+	return func(d *dependencies) { d.logger = logger }
+}
+
+// now returns the current time from the clock of the service
+func (m *Payment_Service) now() time.Time {
+
+	if m.Now == nil {
+		return time.Now()
+	}
+
+	return m.Now()
+}
+
+// logger returns the logger of the service
+func (m *Payment_Service) logger() *log.Logger {
+
+	if m.Logger == nil {
+		return log.StandardLogger()
+	}
+
+	return m.Logger
+}
+
+// log returns the logger of the call ctx belongs to, the logger of the service
+// when there is none
+func (m *Payment_Service) log(ctx context.Context) *log.Entry {
+	return logging.FromContextOr(ctx, m.logger())
+}
+
+// movieDBContext limits a call to the movie DB service to MovieDBTimeout
+func (m *Payment_Service) movieDBContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, m.MovieDBTimeout)
+}
+
+// gatewayContext limits a call to the payment provider to GatewayTimeout
+func (m *Payment_Service) gatewayContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return withTimeout(ctx, m.GatewayTimeout)
+}
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
@@ -2,15 +2,29 @@ package server
 
 import (
 	"context"
-	"os"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/dodopayments/dodopayments-go"
-	"github.com/dodopayments/dodopayments-go/option"
 	"github.com/go-playground/validator/v10"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
 	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
 	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/resilience"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tlsconfig"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tracing"
 	log "github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -19,65 +33,131 @@ type Payment_Server struct {
 	payment_service.UnimplementedPaymentServiceServer
 	Ps *Payment_Service
 	Ms moviedb_service.MovieDBServiceClient
+
+	// movieDBConn is the connection behind Ms, nil when a client was injected
+	movieDBConn grpc.ClientConnInterface
 }
 
-func NewPaymentServer() *Payment_Server {
-	// Initialize the Payment_Service
-	if os.Getenv("DODOPAYMENT_TOKEN") == "" {
-		panic("DODOPAYMENT_TOKEN environment variable is not set")
+// NewPaymentServer builds the payment server described by cfg. Dependencies not
+// passed as options are built from cfg: the Dodo gateway, the database
+// connection, the movie DB client and the FX rates file.
+func NewPaymentServer(cfg *config.Config, opts ...Option) (*Payment_Server, error) {
+
+	if cfg == nil {
+		cfg = config.Default()
 	}
 
-	if os.Getenv("DB_URL_TEST") == "" {
-		panic("DB_URL environment variable is not set")
+	deps := dependencies{
+		now:    time.Now,
+		logger: log.StandardLogger(),
 	}
 
-	moviedb_client, err := moviedb_service.NewMovieDBClient()
+	for _, opt := range opts {
+		opt(&deps)
+	}
 
-	if err != nil {
-		log.Errorf("Failed to create MovieDB client: %v", err)
-		panic("Failed to create MovieDB client: " + err.Error())
+	logger := deps.logger
+
+	if deps.rates == nil && cfg.FXRatesFile != "" {
+		staticRates, err := fx.LoadStaticRates(cfg.FXRatesFile)
+
+		if err != nil {
+			logger.Errorf("Failed to load exchange rates: %v", err)
+			return nil, fmt.Errorf("failed to load exchange rates: %w", err)
+		}
+
+		deps.rates = staticRates
 	}
 
-	conn, err := gorm.Open(postgres.Open(os.Getenv("DB_URL_TEST")), &gorm.Config{})
+	if deps.gateway == nil {
+		if cfg.DodoToken.IsZero() {
+			return nil, errors.New("dodo_token is required, set DODOPAYMENT_TOKEN")
+		}
 
-	if err != nil {
-		log.Errorf("Failed to connect to the database: %v", err)
-		panic("Failed to connect to the database: " + err.Error())
-	}
-
-	if os.Getenv("ENV") == "test" {
-		return &Payment_Server{
-			Ps: &Payment_Service{
-				Client: dodopayments.NewClient(
-					option.WithBearerToken(os.Getenv("DODOPAYMENT_TOKEN")),
-					option.WithBaseURL("https://test.dodopayments.com"),
-				),
-				Validator: validator.New(),
-				DB:        conn,
-			},
-			Ms: moviedb_client,
+		deps.gateway = gateway.NewInstrumentedGateway(gateway.NewDodoGateway(cfg.DodoToken.Reveal(), cfg.DodoTestMode()), metrics.ServiceDodo)
+	}
+
+	if deps.movieDB == nil && deps.movieDBConn == nil {
+		creds, err := tlsconfig.MovieDBCredentials(cfg)
+
+		if err != nil {
+			logger.Errorf("Failed to set up MovieDB TLS: %v", err)
+			return nil, err
+		}
+
+		conn, err := moviedb_service.DialMovieDB(cfg.MovieDBAddr,
+			grpc.WithTransportCredentials(creds),
+			grpc.WithChainUnaryInterceptor(metrics.UnaryClientInterceptor(metrics.ServiceMovieDB)),
+			grpc.WithStatsHandler(tracing.ClientHandler()),
+		)
+
+		if err != nil {
+			logger.Errorf("Failed to create MovieDB client: %v", err)
+			return nil, fmt.Errorf("failed to create MovieDB client: %w", err)
 		}
+
+		deps.movieDBConn = conn
+	}
+
+	if deps.movieDB == nil {
+		deps.movieDB = newMovieDBClient(deps.movieDBConn, resilience.NewBreaker(metrics.ServiceMovieDB, cfg.MovieDBBreakerFailures, cfg.MovieDBBreakerCooldown), MovieDBPolicies(cfg))
+	}
+
+	if deps.db == nil {
+		if cfg.DatabaseURL.IsZero() {
+			return nil, errors.New("database_url is required, set DB_URL")
+		}
+
+		// Unique violations have to surface as gorm.ErrDuplicatedKey, creating a session
+		// or a catalog product concurrently is detected that way
+
+		conn, err := gorm.Open(postgres.Open(cfg.DatabaseURL.Reveal()), &gorm.Config{TranslateError: true})
+
+		if err != nil {
+			logger.Errorf("Failed to connect to the database: %v", err)
+			return nil, fmt.Errorf("failed to connect to the database: %w", err)
+		}
+
+		if err := conn.Use(&tracing.GormPlugin{}); err != nil {
+			return nil, fmt.Errorf("failed to set up database tracing: %w", err)
+		}
+
+		deps.db = conn
 	}
 
 	return &Payment_Server{
 		Ps: &Payment_Service{
-			Client: dodopayments.NewClient(
-				option.WithBearerToken(os.Getenv("DODOPAYMENT_TOKEN")),
-			),
+			Gateway:   deps.gateway,
 			Validator: validator.New(),
-			DB:        conn,
+			DB:        deps.db,
+			MovieDB:   deps.movieDB,
+			Now:       deps.now,
+			Logger:    logger,
+
+			PlatformFeeBasisPoints: cfg.PlatformFeeBasisPoints,
+			PriceCurrency:          cfg.PriceCurrency,
+			FX:                     deps.rates,
+
+			DefaultSuccessURL: cfg.PaymentSuccessURL,
+			DefaultCancelURL:  cfg.PaymentCancelURL,
+			PublicBaseURL:     cfg.PublicBaseURL,
+			RedirectHosts:     cfg.AllowedRedirectHosts(),
+
+			MovieDBTimeout: cfg.MovieDBTimeout,
+			GatewayTimeout: cfg.PaymentProviderTimeout,
 		},
-		Ms: moviedb_client,
-	}
+		Ms:          deps.movieDB,
+		movieDBConn: deps.movieDBConn,
+	}, nil
 }
 
 // Need to implement the CreateCheckoutSession method
 func (p *Payment_Server) CreateCheckoutSession(ctx context.Context, in *payment_service.CreateCheckoutSessionRequest) (*payment_service.CreateCheckoutSessionResponse, error) {
 
-	_, err := p.Ps.Create_Checkout_Session(in)
+	_, err := p.Ps.Create_Checkout_Session(ctx, in)
 
 	if err != nil {
-		return nil, err
+		return nil, statusError(ctx, err, "Failed to create checkout session", &payment_service.CreateCheckoutSessionResponse{})
 	}
 
 	return &payment_service.CreateCheckoutSessionResponse{
@@ -95,77 +175,113 @@ func (p *Payment_Server) CreatePaymentLink(ctx context.Context, in *payment_serv
 
 	// Also need to implement the success and failure webhook to update the payment status in the database
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
-	defer cancel()
-
 	// Call the moviedb service to get booked seat details
 
 	// Need to write is valid to commit function to check if seat ids given are valid to purchase / commit as booked for a movie_time_slot and seatMatrixIds
 
 	if err := p.Ps.Validator.Struct(in); err != nil {
-		return nil, err
+		return nil, statusError(ctx, err, "Invalid payment link request", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
-	response, err := p.Ms.IsValidToCommitSeatsForBooking(ctx, &moviedb_service.IsValidToCommitSeatsForBooking_Request{
+	if in.IdempotentKey == "" {
+		return nil, statusError(ctx, invalidField("idempotent_key", "cannot be empty"), "Invalid payment link request", &payment_service.Create_Payment_Intent_INR_Response{})
+	}
+
+	currency, err := money.CurrencyFromProto(in.Currency)
+
+	if err != nil {
+		return nil, statusError(ctx, err, "Unsupported currency", &payment_service.Create_Payment_Intent_INR_Response{})
+	}
+
+	movieDBCtx, cancel := p.Ps.movieDBContext(ctx)
+	defer cancel()
+
+	response, err := p.Ms.IsValidToCommitSeatsForBooking(movieDBCtx, &moviedb_service.IsValidToCommitSeatsForBooking_Request{
 		MovieTimeSlotId: in.MovieTimeSlotId,
 		SeatMatrixIds:   in.SeatMatrixIDs,
 	})
 
-	if response == nil {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "",
-		}, nil
+	if err != nil {
+		return nil, statusError(ctx, movieDBError(err), "Failed to validate seats", &payment_service.Create_Payment_Intent_INR_Response{})
+	}
 
+	if response == nil {
+		return nil, statusError(ctx, errors.New("empty response from movie DB service"), "Failed to validate seats", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	if !response.Isvalid {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  400,
-			Error:   response.Error,
-			Message: "Seats are already booked",
-		}, nil
+		return nil, statusError(ctx, fmt.Errorf("%w: %s", ErrSeatsUnavailable, response.Error), "Seats are already booked", &payment_service.Create_Payment_Intent_INR_Response{})
+	}
+
+	// The link is issued right away, the seats are held for as long as the customer has to pay
+
+	_, err = p.Ps.Hold_Seats(ctx, in.IdempotentKey, in.MovieTimeSlotId, response.ToBeBookedSeats, SeatHoldLinkTTL)
+
+	if errors.Is(err, ErrSeatHeld) {
+		return nil, statusError(ctx, err, "Seats are held by another booking", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	if err != nil {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  400,
-			Error:   response.Error,
-			Message: "",
-		}, err
+		return nil, statusError(ctx, err, "Failed to hold seats", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	// Call moviedb to get the seat prices as the logic to check if it is valid to commit the seat for booking is already done
 
+	seatTypes, err := p.seatTypes(ctx, in.VenueId)
+
+	if err != nil {
+		p.releaseHolds(ctx, in.IdempotentKey)
+		return nil, statusError(ctx, err, "Failed to fetch seat types", &payment_service.Create_Payment_Intent_INR_Response{})
+	}
+
 	var productBookedSeats []ProductBookedSeats
 
 	for _, v := range response.ToBeBookedSeats {
+		price, err := p.Ps.seatPrice(ctx, v.Price, currency)
+
+		if err != nil {
+			p.releaseHolds(ctx, in.IdempotentKey)
+			return nil, statusError(ctx, err, "Failed to price seats", &payment_service.Create_Payment_Intent_INR_Response{})
+		}
+
 		productBookedSeats = append(productBookedSeats, ProductBookedSeats{
 			BookedSeatsID: uint(v.Id),
 			Quantity:      1,
-			Price:         uint(v.Price),
+			Price:         price,
 			SeatNumber:    v.SeatNumber,
+			SeatType:      seatTypes[v.SeatMatrixID],
 			MovieName:     v.MovieName,
 		})
 	}
 
-	paymentLink, err := p.Ps.Create_Payment_Intent_INR(
+	paymentLink, err := p.Ps.Create_Payment_Intent_INR(ctx,
 		CreatePaymentIntentPayload{
-			Email:       in.Email,
-			PhoneNumber: in.PhoneNumber,
-			Country:     in.Country,
-			State:       in.State,
-			City:        in.City,
-			Street:      in.Street,
-			Zipcode:     string(in.Zipcode),
-			Name:        in.CustomerName,
-			Products:    productBookedSeats,
+			Email:           in.Email,
+			PhoneNumber:     in.PhoneNumber,
+			Country:         in.Country,
+			State:           in.State,
+			City:            in.City,
+			Street:          in.Street,
+			Zipcode:         strconv.Itoa(int(in.Zipcode)),
+			Name:            in.CustomerName,
+			Products:        productBookedSeats,
+			Currency:        currency,
+			SuccessURL:      in.SuccessUrl,
+			CancelURL:       in.CancelUrl,
+			IdempotentKey:   in.IdempotentKey,
+			VenueID:         uint(in.VenueId),
+			MovieTimeSlotID: uint(in.MovieTimeSlotId),
 		},
 	)
 
 	if err != nil {
-		return nil, err
+		// A session that has moved on keeps its holds, they belong to the link issued before
+
+		if !errors.Is(err, ErrInvalidPaymentTransition) && !errors.Is(err, ErrPaymentStatusConflict) {
+			p.releaseHolds(ctx, in.IdempotentKey)
+		}
+
+		return nil, statusError(ctx, err, "Failed to create payment intent", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	return &payment_service.Create_Payment_Intent_INR_Response{
@@ -178,14 +294,14 @@ func (p *Payment_Server) CreatePaymentLink(ctx context.Context, in *payment_serv
 
 func (p *Payment_Server) IsValidIdempotentKey(ctx context.Context, in *payment_service.IsValidIdempotentKeyRequest) (*payment_service.IsValidIdempotentKeyResponse, error) {
 	// Check if the idempotent key is valid
-	isValid, err := p.Ps.IsValidateItempotentKey(in.IdempotentKey)
+	isValid, err := p.Ps.IsValidateItempotentKey(ctx, in.IdempotentKey)
+
+	if errors.Is(err, ErrSessionExpired) {
+		return nil, statusError(ctx, err, "Idempotent key has expired", &payment_service.IsValidIdempotentKeyResponse{})
+	}
 
 	if err != nil {
-		return &payment_service.IsValidIdempotentKeyResponse{
-			IsValid: false,
-			Error:   err.Error(),
-			Message: "Failed to validate idempotent key",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to validate idempotent key", &payment_service.IsValidIdempotentKeyResponse{})
 	}
 
 	return &payment_service.IsValidIdempotentKeyResponse{
@@ -197,14 +313,10 @@ func (p *Payment_Server) IsValidIdempotentKey(ctx context.Context, in *payment_s
 
 func (p *Payment_Server) CommitIdempotentKey(ctx context.Context, in *payment_service.CommitIdempotentKeyRequest) (*payment_service.Create_Payment_Intent_INR_Response, error) {
 	// Commit the idempotent key
-	err := p.Ps.CommitIdempotentKey(in.IdempotentKey, in.CustomerId, in.OrderIds, in.MovieTimeSlotId, in.BookedSeatsIds)
+	err := p.Ps.CommitIdempotentKey(ctx, in.IdempotentKey, in.CustomerId, in.OrderIds, in.MovieTimeSlotId, in.BookedSeatsIds)
 
 	if err != nil {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to commit idempotent key",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to commit idempotent key", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	return &payment_service.Create_Payment_Intent_INR_Response{
@@ -218,67 +330,84 @@ func (p *Payment_Server) CreateOrder(ctx context.Context, in *payment_service.Cr
 
 	var productIds []string
 
-	if in.MovieTimeSlotId == 0 || len(in.SeatMatrixIDs) == 0 {
-		return &payment_service.Create_Order_Response{
-			Status:  400,
-			Error:   "Movie time slot ID and seat matrix IDs cannot be empty",
-			Message: "Failed to create order",
-		}, nil
+	if in.MovieTimeSlotId == 0 {
+		return nil, statusError(ctx, invalidField("movie_time_slot_id", "cannot be empty"), "Failed to create order", &payment_service.Create_Order_Response{})
+	}
+
+	if len(in.SeatMatrixIDs) == 0 {
+		return nil, statusError(ctx, invalidField("seat_matrix_ids", "cannot be empty"), "Failed to create order", &payment_service.Create_Order_Response{})
 	}
 
 	// Validate the idempotent key
 
 	if in.IdempotentKey == "" {
-		return &payment_service.Create_Order_Response{
-			Status:  400,
-			Error:   "Idempotent key cannot be empty",
-			Message: "Failed to create order",
-		}, nil
+		return nil, statusError(ctx, invalidField("idempotent_key", "cannot be empty"), "Failed to create order", &payment_service.Create_Order_Response{})
+	}
+
+	currency, err := money.CurrencyFromProto(in.Currency)
+
+	if err != nil {
+		return nil, statusError(ctx, err, "Unsupported currency", &payment_service.Create_Order_Response{})
 	}
 
 	// Call the moviedb service to check if the movie time slot ID and seat matrix IDs are valid
 
-	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	movieDBCtx, cancel := p.Ps.movieDBContext(ctx)
 	defer cancel()
 
-	response, err := p.Ms.IsValidToCommitSeatsForBooking(ctx, &moviedb_service.IsValidToCommitSeatsForBooking_Request{
+	response, err := p.Ms.IsValidToCommitSeatsForBooking(movieDBCtx, &moviedb_service.IsValidToCommitSeatsForBooking_Request{
 		MovieTimeSlotId: in.MovieTimeSlotId,
 		SeatMatrixIds:   in.SeatMatrixIDs,
 	})
 
 	if err != nil {
-		return &payment_service.Create_Order_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to validate movie time slot and seat matrix IDs",
-		}, nil
+		return nil, statusError(ctx, movieDBError(err), "Failed to validate movie time slot and seat matrix IDs", &payment_service.Create_Order_Response{})
+	}
+
+	if response == nil {
+		return nil, statusError(ctx, errors.New("empty response from movie DB service"), "Failed to validate movie time slot and seat matrix IDs", &payment_service.Create_Order_Response{})
+	}
+
+	if !response.Isvalid {
+		return nil, statusError(ctx, fmt.Errorf("%w: %s", ErrSeatsUnavailable, response.Error), "Invalid movie time slot or seat matrix IDs", &payment_service.Create_Order_Response{})
+	}
+
+	// Hold the seats so no other customer can book them while this one pays
+
+	holdExpiresAt, err := p.Ps.Hold_Seats(ctx, in.IdempotentKey, in.MovieTimeSlotId, response.ToBeBookedSeats, SeatHoldTTL)
+
+	if errors.Is(err, ErrSeatHeld) {
+		return nil, statusError(ctx, err, "Seats are held by another booking", &payment_service.Create_Order_Response{})
+	}
+
+	if err != nil {
+		return nil, statusError(ctx, err, "Failed to hold seats", &payment_service.Create_Order_Response{})
 	}
 
-	if response == nil || !response.Isvalid {
-		return &payment_service.Create_Order_Response{
-			Status:  400,
-			Error:   response.Error,
-			Message: "Invalid movie time slot or seat matrix IDs",
-		}, nil
+	seatTypes, err := p.seatTypes(ctx, in.VenueId)
+
+	if err != nil {
+		p.releaseHolds(ctx, in.IdempotentKey)
+		return nil, statusError(ctx, err, "Failed to fetch seat types", &payment_service.Create_Order_Response{})
 	}
 
 	// Call the moviedb service to get information about the movie name, seats that need to be booked, and their prices
 
 	for _, order := range response.ToBeBookedSeats {
-		// Create a product for each booked seat
+		// Seats of the same movie, type and price share one catalog product
 
-		product, err := p.Ps.Create_Product_Ticket(Product{
-			ProductName:        order.MovieName + " - " + order.SeatNumber,
-			Price:              int64(order.Price),
-			ProductDescription: "Seat " + order.SeatNumber + " for movie " + order.MovieName,
-		})
+		price, err := p.Ps.seatPrice(ctx, order.Price, currency)
 
 		if err != nil {
-			return &payment_service.Create_Order_Response{
-				Status:  500,
-				Error:   err.Error(),
-				Message: "Failed to create product",
-			}, nil
+			p.releaseHolds(ctx, in.IdempotentKey)
+			return nil, statusError(ctx, err, "Failed to price seats", &payment_service.Create_Order_Response{})
+		}
+
+		product, err := p.Ps.Catalog_Product(ctx, order.MovieName, seatTypes[order.SeatMatrixID], price)
+
+		if err != nil {
+			p.releaseHolds(ctx, in.IdempotentKey)
+			return nil, statusError(ctx, err, "Failed to create product", &payment_service.Create_Order_Response{})
 		}
 
 		productIds = append(productIds, product.ProductID)
@@ -293,35 +422,71 @@ func (p *Payment_Server) CreateOrder(ctx context.Context, in *payment_service.Cr
 		bookedSeatsID = append(bookedSeatsID, v.Id)
 	}
 
-	err = p.Ps.CommitOrderIDs(in.IdempotentKey, productIds, int(in.MovieTimeSlotId), bookedSeatsID)
+	err = p.Ps.CommitOrderIDs(ctx, in.IdempotentKey, productIds, int(in.MovieTimeSlotId), uint(in.VenueId), bookedSeatsID, currency)
 
 	if err != nil {
-		return &payment_service.Create_Order_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to commit order IDs",
-		}, nil
+		p.releaseHolds(ctx, in.IdempotentKey)
+		return nil, statusError(ctx, err, "Failed to commit order IDs", &payment_service.Create_Order_Response{})
 	}
 
 	return &payment_service.Create_Order_Response{
-		Status:  200,
-		Error:   "",
-		Message: "Order created successfully",
-		OrderId: productIds,
+		Status:        200,
+		Error:         "",
+		Message:       "Order created successfully",
+		OrderId:       productIds,
+		HoldExpiresAt: timestamppb.New(holdExpiresAt),
 	}, nil
 }
 
+// releaseHolds gives the seats of a failed order back, the holds would lapse on their own otherwise
+func (p *Payment_Server) releaseHolds(ctx context.Context, idempotentKey string) {
+
+	if err := p.Ps.Release_Seat_Holds(ctx, idempotentKey); err != nil {
+		logging.FromContext(ctx).Errorf("Failed to release seat holds for idempotent key %s: %v", idempotentKey, err)
+	}
+}
+
+// seatTypes names the type of every seat of the venue by seat matrix ID, the
+// seats to be booked do not carry it. Seats of an unknown venue have no type.
+func (p *Payment_Server) seatTypes(ctx context.Context, venueID int32) (map[int32]string, error) {
+
+	types := map[int32]string{}
+
+	if venueID == 0 {
+		return types, nil
+	}
+
+	movieDBCtx, cancel := p.Ps.movieDBContext(ctx)
+	defer cancel()
+
+	response, err := p.Ms.GetSeatMatrix(movieDBCtx, &moviedb_service.GetSeatMatrixRequest{Venueid: venueID})
+
+	if err != nil {
+		return nil, movieDBError(err)
+	}
+
+	if response == nil {
+		return nil, errors.New("empty response from movie DB service")
+	}
+
+	if response.Status != http.StatusOK {
+		return nil, fmt.Errorf("movie DB service returned status %d for the seat matrix of venue %d: %s", response.Status, venueID, response.Error)
+	}
+
+	for _, seat := range response.Seats {
+		types[seat.Id] = seat.Type.String()
+	}
+
+	return types, nil
+}
+
 func (p *Payment_Server) CommitCustomerID(ctx context.Context, in *payment_service.CommitIdempotentKeyRequest) (*payment_service.Create_Payment_Intent_INR_Response, error) {
 
 	// Commit the customer ID to the idempotent key
-	err := p.Ps.CommitCustomerPaymentSession(in.IdempotentKey, in.CustomerId)
+	err := p.Ps.CommitCustomerPaymentSession(ctx, in.IdempotentKey, in.CustomerId, nil)
 
 	if err != nil {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to commit customer ID",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to commit customer ID", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	return &payment_service.Create_Payment_Intent_INR_Response{
@@ -334,14 +499,10 @@ func (p *Payment_Server) CommitCustomerID(ctx context.Context, in *payment_servi
 func (p *Payment_Server) CommitOrderIds(ctx context.Context, in *payment_service.CommitIdempotentKeyRequest) (*payment_service.Create_Payment_Intent_INR_Response, error) {
 
 	// Commit the order IDs to the idempotent key
-	err := p.Ps.CommitOrderIDs(in.IdempotentKey, in.OrderIds, 0, []int32{})
+	err := p.Ps.CommitOrderIDs(ctx, in.IdempotentKey, in.OrderIds, 0, 0, []int32{}, "")
 
 	if err != nil {
-		return &payment_service.Create_Payment_Intent_INR_Response{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to commit order IDs",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to commit order IDs", &payment_service.Create_Payment_Intent_INR_Response{})
 	}
 
 	return &payment_service.Create_Payment_Intent_INR_Response{
@@ -353,14 +514,23 @@ func (p *Payment_Server) CommitOrderIds(ctx context.Context, in *payment_service
 
 func (p *Payment_Server) CreateCustomer(ctx context.Context, in *payment_service.CreateCustomerRequest) (*payment_service.CreateCustomerResponse, error) {
 	// Create a customer in the database with the given details
-	customer, err := p.Ps.Create_Customer(in.Email, in.CustomerName, in.PhoneNumber, in.IdempotentKey)
+	// The billing address is kept with the session and used when the payment link is generated
+
+	billing := models.BillingAddress{
+		Country: strings.ToUpper(in.Country),
+		State:   in.State,
+		City:    in.City,
+		Street:  in.Street,
+	}
+
+	if in.Zipcode != 0 {
+		billing.Zipcode = strconv.Itoa(int(in.Zipcode))
+	}
+
+	customer, err := p.Ps.Create_Customer(ctx, in.Email, in.CustomerName, in.PhoneNumber, in.IdempotentKey, billing)
 
 	if err != nil {
-		return &payment_service.CreateCustomerResponse{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to create customer",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to create customer", &payment_service.CreateCustomerResponse{})
 	}
 
 	return &payment_service.CreateCustomerResponse{
@@ -373,14 +543,14 @@ func (p *Payment_Server) CreateCustomer(ctx context.Context, in *payment_service
 
 func (p *Payment_Server) GeneratePaymentLink(ctx context.Context, in *payment_service.CreatePaymentLinkRequest) (*payment_service.CreatePaymentLinkResponse, error) {
 	// Generate a payment link for the customer
-	paymentLink, err := p.Ps.GeneratePaymentLink(in.IdempotentKey)
+	paymentLink, err := p.Ps.GeneratePaymentLink(ctx, in.IdempotentKey, in.SuccessUrl, in.CancelUrl)
+
+	if errors.Is(err, ErrSeatHeld) {
+		return nil, statusError(ctx, err, "Seats are no longer held for this booking", &payment_service.CreatePaymentLinkResponse{})
+	}
 
 	if err != nil {
-		return &payment_service.CreatePaymentLinkResponse{
-			Status:  500,
-			Error:   err.Error(),
-			Message: "Failed to generate payment link",
-		}, nil
+		return nil, statusError(ctx, err, "Failed to generate payment link", &payment_service.CreatePaymentLinkResponse{})
 	}
 
 	return &payment_service.CreatePaymentLinkResponse{
@@ -390,3 +560,30 @@ func (p *Payment_Server) GeneratePaymentLink(ctx context.Context, in *payment_se
 		PaymentLink: paymentLink,
 	}, nil
 }
+
+func (p *Payment_Server) RefundPayment(ctx context.Context, in *payment_service.RefundPaymentRequest) (*payment_service.RefundPaymentResponse, error) {
+
+	if in.IdempotentKey == "" && in.PaymentId == "" {
+		return nil, statusError(ctx, invalidField("idempotent_key", "idempotent key or payment ID must be provided"), "Failed to refund payment", &payment_service.RefundPaymentResponse{})
+	}
+
+	refund, err := p.Ps.Refund_Payment(ctx, RefundPaymentPayload{
+		IdempotentKey:  in.IdempotentKey,
+		PaymentID:      in.PaymentId,
+		BookedSeatsIDs: in.BookedSeatsIds,
+		Reason:         in.Reason,
+	})
+
+	if err != nil {
+		return nil, statusError(ctx, err, "Failed to refund payment", &payment_service.RefundPaymentResponse{})
+	}
+
+	return &payment_service.RefundPaymentResponse{
+		Status:    200,
+		Error:     "",
+		Message:   "Refund initiated successfully",
+		RefundId:  refund.RefundID,
+		IsPartial: refund.IsPartial,
+		Amount:    refund.Amount.Proto(),
+	}, nil
+}
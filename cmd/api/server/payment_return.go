@@ -0,0 +1,172 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"gorm.io/gorm"
+)
+
+// PaymentReturnPath is where ReturnHandler is mounted, followed by the idempotent key
+const PaymentReturnPath = "/payments/return/"
+
+var ErrInvalidRedirectURL = errors.New("invalid redirect URL")
+
+type redirectURLs struct {
+	SuccessURL string
+	CancelURL  string
+}
+
+// resolveRedirectURLs takes every URL from the first candidate that has one, the
+// service defaults come last. Without a cancel URL customers always go to the success URL.
+func (m *Payment_Service) resolveRedirectURLs(candidates ...redirectURLs) (redirectURLs, error) {
+
+	var resolved redirectURLs
+
+	candidates = append(candidates, redirectURLs{SuccessURL: m.DefaultSuccessURL, CancelURL: m.DefaultCancelURL})
+
+	for _, c := range candidates {
+		if resolved.SuccessURL == "" {
+			resolved.SuccessURL = c.SuccessURL
+		}
+
+		if resolved.CancelURL == "" {
+			resolved.CancelURL = c.CancelURL
+		}
+	}
+
+	if resolved.SuccessURL == "" {
+		return resolved, fmt.Errorf("%w: no success URL given and no default configured", ErrInvalidRedirectURL)
+	}
+
+	if resolved.CancelURL == "" {
+		resolved.CancelURL = resolved.SuccessURL
+	}
+
+	for _, raw := range []string{resolved.SuccessURL, resolved.CancelURL} {
+		u, err := url.Parse(raw)
+
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return resolved, fmt.Errorf("%w: %q", ErrInvalidRedirectURL, raw)
+		}
+
+		if !m.redirectHostAllowed(u) {
+			return resolved, fmt.Errorf("%w: host of %q is not allowed", ErrInvalidRedirectURL, raw)
+		}
+	}
+
+	return resolved, nil
+}
+
+// redirectHostAllowed reports whether customers may be sent to u, only hosts in
+// RedirectHosts are allowed so PublicBaseURL cannot be used as an open redirect
+func (m *Payment_Service) redirectHostAllowed(u *url.URL) bool {
+
+	for _, host := range m.RedirectHosts {
+		if strings.EqualFold(u.Hostname(), host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// paymentReturnURL is the URL the provider sends the customer to after checkout.
+// The provider only takes a single return URL, so when PublicBaseURL is set it
+// points at ReturnHandler, which picks the success or cancel URL of the session.
+func (m *Payment_Service) paymentReturnURL(idempotentKey string, successURL string) string {
+
+	if m.PublicBaseURL == "" {
+		return successURL
+	}
+
+	return strings.TrimRight(m.PublicBaseURL, "/") + PaymentReturnPath + url.PathEscape(idempotentKey)
+}
+
+// Payment_Return_Target returns where to send a customer coming back from checkout
+// with the given provider status, the query of the provider is passed on
+func (m *Payment_Service) Payment_Return_Target(ctx context.Context, idempotentKey string, query url.Values) (string, error) {
+
+	var idempotent models.Idempotent
+
+	result := m.DB.WithContext(ctx).Where("idempotent_key = ?", idempotentKey).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w: %s", ErrIdempotentKeyNotFound, idempotentKey)
+		}
+		return "", fmt.Errorf("error fetching idempotent key: %w", result.Error)
+	}
+
+	target := idempotent.SuccessURL
+
+	if query.Get("status") != "succeeded" && idempotent.CancelURL != "" {
+		target = idempotent.CancelURL
+	}
+
+	if target == "" {
+		return "", fmt.Errorf("%w: session %s has no redirect URL", ErrInvalidRedirectURL, idempotentKey)
+	}
+
+	u, err := url.Parse(target)
+
+	// Sessions created before the host allowlist may hold any URL
+	if err != nil || !m.redirectHostAllowed(u) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidRedirectURL, target)
+	}
+
+	merged := u.Query()
+
+	for _, name := range []string{"payment_id", "status"} {
+		if value := query.Get(name); value != "" {
+			merged.Set(name, value)
+		}
+	}
+
+	u.RawQuery = merged.Encode()
+
+	return u.String(), nil
+}
+
+// ReturnHandler sends customers coming back from checkout on to the success or
+// cancel URL of their session
+type ReturnHandler struct {
+	Ps *Payment_Service
+}
+
+func (h *ReturnHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := strings.TrimPrefix(r.URL.Path, PaymentReturnPath)
+
+	target, err := h.Ps.Payment_Return_Target(r.Context(), key, r.URL.Query())
+
+	if err != nil {
+		logging.FromContext(r.Context()).Warnf("Cannot redirect customer returning for session %s: %v", key, err)
+
+		if errors.Is(err, ErrIdempotentKeyNotFound) {
+			http.Error(w, "booking not found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, ErrInvalidRedirectURL) {
+			http.Error(w, "invalid redirect URL", http.StatusBadRequest)
+			return
+		}
+
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
@@ -3,32 +3,58 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"net/http"
-	"os"
+	"strings"
 	"time"
 
-	"github.com/dodopayments/dodopayments-go"
 	"github.com/go-playground/validator/v10"
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
 	moviedb "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
 	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
 	"github.com/lib/pq"
 	log "github.com/sirupsen/logrus"
 	"gorm.io/gorm"
 )
 
 type Payment_Service struct {
-	Client    *dodopayments.Client
+	Gateway   gateway.PaymentGateway
 	Validator *validator.Validate
 	DB        *gorm.DB
+	MovieDB   moviedb_service.MovieDBServiceClient
+	// Clock and logger of the service, time.Now and the standard logger when nil
+	Now    func() time.Time
+	Logger *log.Logger
+	// Used when a request and its session carry no success or cancel URL
+	DefaultSuccessURL string
+	DefaultCancelURL  string
+	// Public address of the HTTP server, when set the provider returns customers through
+	// ReturnHandler so they can be sent to the cancel URL of failed payments
+	PublicBaseURL string
+	// Hosts customers may be sent to after checkout, success and cancel URLs on any other host are rejected
+	RedirectHosts []string
+	// Share of every payment, net of tax, booked as platform revenue instead of venue payable
+	PlatformFeeBasisPoints int64
+	// Currency the movie DB service quotes seat prices in, INR when empty
+	PriceCurrency string
+	// Converts seat prices when the customer pays in another currency, may be nil
+	FX fx.RateProvider
+	// Limits of single calls to the movie DB service and the payment provider,
+	// only the deadline of the caller applies when zero
+	MovieDBTimeout time.Duration
+	GatewayTimeout time.Duration
 }
 
 type ProductBookedSeats struct {
-	BookedSeatsID uint   `json:"booked_seats_id" gorm:"not null"`
-	Quantity      uint   `json:"quantity" gorm:"not null;default:1"` // number of tickets booked
-	Price         uint   `json:"price" gorm:"not null"`              // price per ticket
-	SeatNumber    string `json:"seat_number" gorm:"not null"`        // seat number booked
-	MovieName     string `json:"movie_name" gorm:"not null"`         // name of the movie for which the seat is booked
+	BookedSeatsID uint        `json:"booked_seats_id" gorm:"not null"`
+	Quantity      uint        `json:"quantity" gorm:"not null;default:1"`          // number of tickets booked
+	Price         money.Money `json:"price" gorm:"embedded;embeddedPrefix:price_"` // price per ticket
+	SeatNumber    string      `json:"seat_number" gorm:"not null"`                 // seat number booked
+	SeatType      string      `json:"seat_type"`                                   // seat type as named by the movie DB service, e.g. VIP
+	MovieName     string      `json:"movie_name" gorm:"not null"`                  // name of the movie for which the seat is booked
 }
 
 type CreatePaymentIntentPayload struct {
@@ -44,6 +70,12 @@ type CreatePaymentIntentPayload struct {
 	Street        string `json:"street" validate:"required"`
 	Zipcode       string `json:"zipcode" validate:"required"`
 	IdempotentKey string `json:"idempotent_key" validate:"required"`
+	Currency      string `json:"currency" validate:"required,len=3"` // ISO 4217 code the customer is billed in
+	SuccessURL    string `json:"success_url" validate:"omitempty,url"`
+	CancelURL     string `json:"cancel_url" validate:"omitempty,url"`
+	VenueID       uint   `json:"venue_id"` // Venue the seats are booked at, 0 when not known
+	// Movie time slot of the seats, recorded with them so the payment.succeeded webhook can book them
+	MovieTimeSlotID uint `json:"movie_time_slot_id"`
 }
 
 type PaymentDetail struct {
@@ -71,17 +103,7 @@ type PaymentDetail struct {
 	DigitalProductsDelivered bool   `json:"digital_products_delivered"`
 	DiscountID               string `json:"discount_id"`
 
-	Disputes []struct {
-		Amount        string `json:"amount"`
-		BusinessID    string `json:"business_id"`
-		CreatedAt     string `json:"created_at"`
-		Currency      string `json:"currency"`
-		DisputeID     string `json:"dispute_id"`
-		DisputeStage  string `json:"dispute_stage"`
-		DisputeStatus string `json:"dispute_status"`
-		PaymentID     string `json:"payment_id"`
-		Remarks       string `json:"remarks"`
-	} `json:"disputes"`
+	Disputes []DisputeWebhookData `json:"disputes"`
 
 	ErrorCode         string                 `json:"error_code"`
 	ErrorMessage      string                 `json:"error_message"`
@@ -95,70 +117,53 @@ type PaymentDetail struct {
 		Quantity  int    `json:"quantity"`
 	} `json:"product_cart"`
 
-	Refunds []struct {
-		Amount     int     `json:"amount"`
-		BusinessID string  `json:"business_id"`
-		CreatedAt  string  `json:"created_at"`
-		Currency   *string `json:"currency"`
-		IsPartial  bool    `json:"is_partial"`
-		PaymentID  string  `json:"payment_id"`
-		Reason     string  `json:"reason"`
-		RefundID   string  `json:"refund_id"`
-		Status     string  `json:"status"`
-	} `json:"refunds"`
-
-	SettlementAmount   int     `json:"settlement_amount"`
-	SettlementCurrency string  `json:"settlement_currency"`
-	SettlementTax      int     `json:"settlement_tax"`
-	Status             *string `json:"status"`
-	SubscriptionID     string  `json:"subscription_id"`
-	Tax                int     `json:"tax"`
-	TotalAmount        int     `json:"total_amount"`
-	UpdatedAt          string  `json:"updated_at"`
+	Refunds []RefundWebhookData `json:"refunds"`
+
+	// Amounts are sent as plain minor units next to the currency, see UnmarshalJSON
+	SettlementAmount   money.Money `json:"-"`
+	SettlementCurrency string      `json:"settlement_currency"`
+	SettlementTax      money.Money `json:"-"`
+	Status             *string     `json:"status"`
+	SubscriptionID     string      `json:"subscription_id"`
+	Tax                money.Money `json:"-"`
+	TotalAmount        money.Money `json:"-"`
+	UpdatedAt          string      `json:"updated_at"`
 }
 
-type CustomerDetail struct {
-	BusinessID  string `json:"business_id"`
-	CreatedAt   string `json:"created_at"` // Consider time.Time if using custom unmarshalling
-	CustomerID  string `json:"customer_id"`
-	Email       string `json:"email"`
-	Name        string `json:"name"`
-	PhoneNumber string `json:"phone_number"`
-}
+func (p *PaymentDetail) UnmarshalJSON(data []byte) error {
 
-type ProductDetail struct {
-	Addons                     []string `json:"addons"`
-	BrandID                    string   `json:"brand_id"`
-	BusinessID                 string   `json:"business_id"`
-	CreatedAt                  string   `json:"created_at"` // use time.Time with custom parsing if needed
-	Description                string   `json:"description"`
-	DigitalProductDelivery     *string  `json:"digital_product_delivery"` // nullable
-	Image                      string   `json:"image"`
-	IsRecurring                bool     `json:"is_recurring"`
-	LicenseKeyActivationMsg    string   `json:"license_key_activation_message"`
-	LicenseKeyActivationsLimit int      `json:"license_key_activations_limit"`
-	LicenseKeyDuration         *string  `json:"license_key_duration"` // nullable
-	LicenseKeyEnabled          bool     `json:"license_key_enabled"`
-	Name                       string   `json:"name"`
-	Price                      struct {
-		Currency              string `json:"currency"`
-		Discount              int    `json:"discount"`
-		PayWhatYouWant        bool   `json:"pay_what_you_want"`
-		Price                 int    `json:"price"`
-		PurchasingPowerParity bool   `json:"purchasing_power_parity"`
-		SuggestedPrice        int    `json:"suggested_price"`
-		TaxInclusive          bool   `json:"tax_inclusive"`
-		Type                  string `json:"type"`
-	} `json:"price"`
-	ProductID   string `json:"product_id"`
-	TaxCategory string `json:"tax_category"`
-	UpdatedAt   string `json:"updated_at"` // could be time.Time
-}
+	type paymentDetail PaymentDetail
+
+	var wire struct {
+		paymentDetail
+		SettlementAmount int64 `json:"settlement_amount"`
+		SettlementTax    int64 `json:"settlement_tax"`
+		Tax              int64 `json:"tax"`
+		TotalAmount      int64 `json:"total_amount"`
+	}
+
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	*p = PaymentDetail(wire.paymentDetail)
 
-// Need to create a webhook to handle payment success and failure events
-// and update the payment status in the database accordingly
+	p.TotalAmount = money.New(wire.TotalAmount, p.Currency)
+	p.Tax = money.New(wire.Tax, p.Currency)
+	p.SettlementAmount = money.New(wire.SettlementAmount, p.SettlementCurrency)
+	p.SettlementTax = money.New(wire.SettlementTax, p.SettlementCurrency)
+
+	// refunds may leave their currency out, it is always the one of the payment
+	for i := range p.Refunds {
+		if p.Refunds[i].Amount.Currency == "" {
+			p.Refunds[i].Amount.Currency = p.Currency
+		}
+	}
+
+	return nil
+}
 
-func (m *Payment_Service) Create_Checkout_Session(request *moviedb.CreateCheckoutSessionRequest) (int, error) {
+func (m *Payment_Service) Create_Checkout_Session(ctx context.Context, request *moviedb.CreateCheckoutSessionRequest) (int, error) {
 	// Create a ticket product
 	// Create a checkout session with the ticket product
 	// Return the session ID
@@ -194,163 +199,249 @@ func (m *Payment_Service) Create_Checkout_Session(request *moviedb.CreateCheckou
 	return 200, nil
 }
 
-func (m *Payment_Service) Create_Payment_Intent_INR(payload CreatePaymentIntentPayload) (string, error) {
+func (m *Payment_Service) Create_Payment_Intent_INR(ctx context.Context, payload CreatePaymentIntentPayload) (string, error) {
 
-	log.Infof("Email %s, Name: %s and phone_number: %s", payload.Email, payload.Name, payload.PhoneNumber)
+	m.log(ctx).Info("Creating payment link for idempotent key ", payload.IdempotentKey)
 
 	// Validate the input payload
 
 	if err := m.Validator.Struct(payload); err != nil {
-		log.Error("Validation failed for CreatePaymentIntentPayload: ", err)
+		m.log(ctx).Error("Validation failed for CreatePaymentIntentPayload: ", err)
 		return "", fmt.Errorf("validation failed: %w", err)
 	}
 
-	customer, err := m.Create_Customer(payload.Email, payload.Name, payload.PhoneNumber, payload.IdempotentKey)
+	// A retried request for a session that already has a link gets that link,
+	// without creating another customer at the provider
+
+	var idempotent models.Idempotent
+
+	result := m.DB.WithContext(ctx).Select("payment_status", "payment_link").Where("idempotent_key = ?", payload.IdempotentKey).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return "", fmt.Errorf("%w: %s", ErrIdempotentKeyNotFound, payload.IdempotentKey)
+		}
+		m.log(ctx).Error("Error fetching idempotent key: ", result.Error)
+		return "", fmt.Errorf("error fetching idempotent key: %w", result.Error)
+	}
+
+	if models.NormalizePaymentStatus(string(idempotent.PaymentStatus)) == models.PaymentStatusLinkIssued && idempotent.PaymentLink != "" {
+		m.log(ctx).Infof("Payment link for idempotent key %s was already issued, returning it", payload.IdempotentKey)
+		return idempotent.PaymentLink, nil
+	}
+
+	billing := models.BillingAddress{
+		Country: strings.ToUpper(payload.Country),
+		State:   payload.State,
+		City:    payload.City,
+		Street:  payload.Street,
+		Zipcode: payload.Zipcode,
+	}
+
+	urls, err := m.resolveRedirectURLs(redirectURLs{SuccessURL: payload.SuccessURL, CancelURL: payload.CancelURL})
 
 	if err != nil {
+		m.log(ctx).Error("Invalid redirect URLs: ", err)
 		return "", err
 	}
 
-	var ProductArr []*dodopayments.Product
+	customer, err := m.Create_Customer(ctx, payload.Email, payload.Name, payload.PhoneNumber, payload.IdempotentKey, billing)
 
-	// Product, err := m.Create_Product_Ticket(Product{
-	// 	ProductName:        payload.MovieName,
-	// 	Price:              int64(payload.Price),
-	// 	ProductDescription: fmt.Sprintf("Ticket for movie: %s", payload.MovieName),
-	// })
+	if err != nil {
+		return "", err
+	}
+
+	var productIDs []string
+	var bookedSeatsIDs pq.Int32Array
 
 	// First check if these seats are already booked or exist in the database
 
 	for _, v := range payload.Products {
-		Product, err := m.Create_Product_Ticket(Product{
-			ProductName:        v.MovieName,
-			Price:              int64(v.Price),
-			ProductDescription: fmt.Sprintf("Ticket for movie: %s", v.MovieName),
-		})
-
-		log.Infof("Creating payment intent for product: %s with price: %d and quintity: %d", Product.ProductID, v.Price, v.Quantity)
+		product, err := m.Catalog_Product(ctx, v.MovieName, v.SeatType, v.Price)
 
 		if err != nil {
-			log.Error("Failed to create product: ", err)
-			return "", fmt.Errorf("failed to create product: %w", err)
+			m.log(ctx).Error("Failed to find catalog product: ", err)
+			return "", fmt.Errorf("failed to find catalog product: %w", err)
 		}
 
-		ProductArr = append(ProductArr, Product)
-	}
+		m.log(ctx).Infof("Creating payment intent for product: %s with price: %s and quantity: %d", product.ProductID, v.Price, v.Quantity)
 
-	ProductCartItems := make([]dodopayments.OneTimeProductCartItemParam, len(ProductArr))
-
-	for i, product := range ProductArr {
-		ProductCartItems[i] = dodopayments.OneTimeProductCartItemParam{
-			ProductID: dodopayments.F(product.ProductID),
-			Quantity:  dodopayments.F(int64(1)), // Assuming quantity is always 1 for each product
+		for i := uint(0); i < max(v.Quantity, 1); i++ {
+			productIDs = append(productIDs, product.ProductID)
+			bookedSeatsIDs = append(bookedSeatsIDs, int32(v.BookedSeatsID))
 		}
 	}
 
-	dodopayments.NewWebhookEventService()
-	payment, err := m.Client.Payments.New(
-		context.TODO(),
-		dodopayments.PaymentNewParams{
-			PaymentLink: dodopayments.F(true),
-			ProductCart: dodopayments.F(ProductCartItems),
-			Billing: dodopayments.F(
-				dodopayments.BillingAddressParam{
-					Country: dodopayments.F(dodopayments.CountryCodeIn),
-					State:   dodopayments.F(payload.State),
-					City:    dodopayments.F(payload.City),
-					Street:  dodopayments.F(payload.Street),
-					Zipcode: dodopayments.F(payload.Zipcode),
-				},
-			),
-			Customer: dodopayments.F[dodopayments.CustomerRequestUnionParam](dodopayments.AttachExistingCustomerParam{
-				CustomerID: dodopayments.F(customer.CustomerID),
-			}),
-			ReturnURL:       dodopayments.F("https://example.com/return"), // Replace with your return URL
-			BillingCurrency: dodopayments.F(dodopayments.CurrencyInr),
+	ProductCartItems := CartItems(productIDs)
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	payment, err := m.Gateway.CreatePayment(
+		gatewayCtx,
+		gateway.PaymentParams{
+			ProductCart: ProductCartItems,
+			Billing: gateway.BillingAddress{
+				Country: billing.Country,
+				State:   billing.State,
+				City:    billing.City,
+				Street:  billing.Street,
+				Zipcode: billing.Zipcode,
+			},
+			CustomerID: customer.CustomerID,
+			ReturnURL:  m.paymentReturnURL(payload.IdempotentKey, urls.SuccessURL),
+			Currency:   payload.Currency,
+			Metadata: map[string]string{
+				"idempotent_key": payload.IdempotentKey,
+			},
 		},
 	)
 
-	// confimation of the booked seats will be handled by the webhooks
+	// confimation of the booked seats is handled by the payment.succeeded webhook
 
 	if err != nil {
-		log.Error("Failed to create payment intent: ", err)
+		m.log(ctx).Error("Failed to create payment intent: ", err)
 		return "", fmt.Errorf("failed to create payment intent: %w", err)
 	}
 
+	if payment == nil {
+		m.log(ctx).Error("Payment provider returned no payment")
+		return "", errors.New("payment provider returned no payment")
+	}
+
+	updates := map[string]interface{}{
+		"payment_id":   payment.PaymentID,
+		"payment_link": payment.PaymentLink,
+		"success_url":  urls.SuccessURL,
+		"cancel_url":   urls.CancelURL,
+	}
+
+	if payload.VenueID != 0 {
+		updates["venue_id"] = payload.VenueID
+	}
+
+	// The seats are booked once the payment succeeds and refunded by their position in order_ids
+
+	if payload.MovieTimeSlotID != 0 {
+		updates["movie_time_slot_id"] = payload.MovieTimeSlotID
+		updates["booked_seats_id"] = bookedSeatsIDs
+		updates["order_ids"] = pq.StringArray(productIDs)
+	}
+
+	err = m.Transition_Payment_Status(ctx, payload.IdempotentKey, models.PaymentStatusLinkIssued, "payment intent created", updates)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to record issued payment link: ", err)
+		return "", fmt.Errorf("failed to record issued payment link: %w", err)
+	}
+
 	return payment.PaymentLink, nil
 }
 
-func (m *Payment_Service) IsValidateItempotentKey(key string) (bool, error) {
+func (m *Payment_Service) IsValidateItempotentKey(ctx context.Context, key string) (bool, error) {
 
 	var idempotent models.Idempotent
 
-	result := m.DB.Where("idempotent_key = ?", key).First(&idempotent)
+	// Expired sessions are soft-deleted by the sweeper, they still hold on to their key
+
+	result := m.DB.WithContext(ctx).Unscoped().Where("idempotent_key = ?", key).First(&idempotent)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			log.Infof("Idempotent key %s not found", key)
+			m.log(ctx).Infof("Idempotent key %s not found", key)
 			return false, nil // Key not found, so it's valid to use
 		}
-		log.Error("Error checking idempotent key: ", result.Error)
+		m.log(ctx).Error("Error checking idempotent key: ", result.Error)
 		return false, fmt.Errorf("error checking idempotent key: %w", result.Error)
 	}
 
-	log.Infof("Idempotent key %s found, created at %s", key, fmt.Sprint(idempotent.CreatedAt))
+	m.log(ctx).Infof("Idempotent key %s found, created at %s", key, fmt.Sprint(idempotent.CreatedAt))
+
+	// A session past its expiry is expired even if the sweeper has not got to it yet
+
+	paymentStatus := models.NormalizePaymentStatus(string(idempotent.PaymentStatus))
+
+	if idempotent.DeletedAt.Valid || paymentStatus == models.PaymentStatusExpired ||
+		(paymentStatus.CanTransitionTo(models.PaymentStatusExpired) && idempotent.ExpiredAt.Before(m.now())) {
+		m.log(ctx).Infof("Idempotent key %s expired at %s", key, idempotent.ExpiredAt)
+		return false, fmt.Errorf("%w: %s", ErrSessionExpired, key)
+	}
 
 	return true, nil // Key found, so it's not valid to use again
 }
 
-func (m *Payment_Service) CommitIdempotentKey(key string, customer_id string, orderIds []string, movie_time_slot_id int32, booked_seats_ids []int32) error {
+func (m *Payment_Service) CommitIdempotentKey(ctx context.Context, key string, customer_id string, orderIds []string, movie_time_slot_id int32, booked_seats_ids []int32) error {
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
 
-	result := m.DB.Model(models.Idempotent{}).Create(&models.Idempotent{
-		IdempotentKey:   key,
-		CustomerID:      customer_id,
-		OrderIDs:        orderIds,
-		ExpiredAt:       time.Now().Add(24 * time.Hour), // Set expiration time to 24 hours from now
-		MovieTimeSlotID: uint(movie_time_slot_id),
-		BookedSeatsId:   booked_seats_ids,
-		PaymentStatus:   "PENDING",
+		result := tx.Model(models.Idempotent{}).Create(&models.Idempotent{
+			IdempotentKey:   key,
+			CustomerID:      customer_id,
+			OrderIDs:        orderIds,
+			ExpiredAt:       m.now().Add(SessionTTL),
+			MovieTimeSlotID: uint(movie_time_slot_id),
+			BookedSeatsId:   booked_seats_ids,
+			PaymentStatus:   models.PaymentStatusPending,
+		})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		return m.recordPaymentStatus(tx, key, "", models.PaymentStatusPending, "idempotent key committed")
 	})
 
-	if result.Error != nil {
-		log.Error("Error committing idempotent key: ", result.Error)
+	if err != nil {
+		m.log(ctx).Error("Error committing idempotent key: ", err)
 
-		if result.Error == gorm.ErrDuplicatedKey {
-			log.Infof("Idempotent key %s already exists, skipping commit", key)
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			m.log(ctx).Infof("Idempotent key %s already exists, skipping commit", key)
 			return nil // Key already exists, so we can skip committing it again
 		}
 
-		return fmt.Errorf("error committing idempotent key: %w", result.Error)
+		return fmt.Errorf("error committing idempotent key: %w", err)
 	}
 
-	log.Infof("Idempotent key %s committed successfully for customer", key)
+	m.log(ctx).Infof("Idempotent key %s committed successfully for customer", key)
 
 	return nil
 }
 
-func (m *Payment_Service) CommitCustomerPaymentSession(key string, customerID string) error {
+// CommitCustomerPaymentSession attaches the customer to the session, billing is left
+// untouched when nil
+func (m *Payment_Service) CommitCustomerPaymentSession(ctx context.Context, key string, customerID string, billing *models.BillingAddress) error {
 
 	// Add customer id to the idempotent table
 
-	result := m.DB.Model(&models.Idempotent{}).Where("idempotent_key = ?", key).Updates(models.Idempotent{
-		CustomerID: customerID,
-	})
+	updates := map[string]interface{}{
+		"customer_id": customerID,
+	}
 
-	if result.Error != nil {
-		log.Error("Error committing customer payment session: ", result.Error)
-		return fmt.Errorf("error committing customer payment session: %w", result.Error)
+	if billing != nil {
+		updates["billing_country"] = strings.ToUpper(billing.Country)
+		updates["billing_state"] = billing.State
+		updates["billing_city"] = billing.City
+		updates["billing_street"] = billing.Street
+		updates["billing_zipcode"] = billing.Zipcode
 	}
 
-	log.Infof("Customer payment session committed successfully for idempotent key %s with customer ID %s", key, customerID)
+	err := m.Transition_Payment_Status(ctx, key, models.PaymentStatusCustomerAttached, "customer attached", updates)
+
+	if err != nil {
+		m.log(ctx).Error("Error committing customer payment session: ", err)
+		return fmt.Errorf("error committing customer payment session: %w", err)
+	}
+
+	m.log(ctx).Infof("Customer payment session committed successfully for idempotent key %s with customer ID %s", key, customerID)
 
 	return nil
 }
 
-func (c *Payment_Service) CommitOrderIDs(key string, orderIDs []string, movieTimeSlotID int, bookedSeatsID []int32) error {
+func (c *Payment_Service) CommitOrderIDs(ctx context.Context, key string, orderIDs []string, movieTimeSlotID int, venueID uint, bookedSeatsID []int32, currency string) error {
 
 	// Add order IDs to the idempotent table
-	log.Infof("Committing order IDs for idempotent key %s", key)
-	log.Infof("Order IDs: %v, Movie Time Slot ID: %d, Booked Seats ID: %v", orderIDs, movieTimeSlotID, bookedSeatsID)
+	c.log(ctx).Infof("Committing order IDs for idempotent key %s", key)
+	c.log(ctx).Infof("Order IDs: %v, Movie Time Slot ID: %d, Booked Seats ID: %v", orderIDs, movieTimeSlotID, bookedSeatsID)
 
 	var orderIds pq.StringArray
 
@@ -364,29 +455,52 @@ func (c *Payment_Service) CommitOrderIDs(key string, orderIDs []string, movieTim
 		bookedSeatsId = append(bookedSeatsId, int32(seatID))
 	}
 
-	result := c.DB.Model(&models.Idempotent{}).Where("idempotent_key = ?", key).Updates(&models.Idempotent{
-		OrderIDs:        orderIds,
-		MovieTimeSlotID: uint(movieTimeSlotID),
-		BookedSeatsId:   bookedSeatsId,
-		PaymentStatus:   "INITIATED",
-	})
+	// Zero values are left untouched, callers may only commit the order IDs
 
-	if result.Error != nil {
-		log.Error("Error committing order IDs: ", result.Error)
-		return fmt.Errorf("error committing order IDs: %w", result.Error)
+	updates := map[string]interface{}{}
+
+	if len(orderIds) > 0 {
+		updates["order_ids"] = orderIds
+	}
+
+	if movieTimeSlotID != 0 {
+		updates["movie_time_slot_id"] = uint(movieTimeSlotID)
 	}
 
-	log.Infof("Order IDs committed successfully for idempotent key %s", key)
+	if len(bookedSeatsId) > 0 {
+		updates["booked_seats_id"] = bookedSeatsId
+	}
+
+	if venueID != 0 {
+		updates["venue_id"] = venueID
+	}
+
+	if currency != "" {
+		updates["currency"] = currency
+	}
+
+	err := c.Transition_Payment_Status(ctx, key, models.PaymentStatusOrderCreated, "order created", updates)
+
+	if err != nil {
+		c.log(ctx).Error("Error committing order IDs: ", err)
+		return fmt.Errorf("error committing order IDs: %w", err)
+	}
+
+	c.log(ctx).Infof("Order IDs committed successfully for idempotent key %s", key)
 
 	return nil
 }
 
-func (c *Payment_Service) GeneratePaymentLink(idempotentKey string) (string, error) {
+// GeneratePaymentLink issues the payment link of a session. The success and cancel
+// URLs fall back to the ones stored on the session and then to the service defaults.
+// Once a link is issued the same link is returned until the session expires or the
+// payment fails, so the customer never holds two payable links for one booking.
+func (c *Payment_Service) GeneratePaymentLink(ctx context.Context, idempotentKey string, successURL string, cancelURL string) (string, error) {
 
-	log.Infof("Generating payment link for idempotent key: %s", idempotentKey)
+	c.log(ctx).Infof("Generating payment link for idempotent key: %s", idempotentKey)
 
 	// Check if the idempotent key exists
-	exists, err := c.IsValidateItempotentKey(idempotentKey)
+	exists, err := c.IsValidateItempotentKey(ctx, idempotentKey)
 	if err != nil {
 		return "", fmt.Errorf("error validating idempotent key: %w", err)
 	}
@@ -407,24 +521,46 @@ func (c *Payment_Service) GeneratePaymentLink(idempotentKey string) (string, err
 
 	var Idempotent models.Idempotent
 
-	result := c.DB.Where("idempotent_key = ?", idempotentKey).First(&Idempotent)
+	result := c.DB.WithContext(ctx).Where("idempotent_key = ?", idempotentKey).First(&Idempotent)
 
 	if result.Error != nil {
 		if result.Error == gorm.ErrRecordNotFound {
-			log.Errorf("Idempotent key %s not found", idempotentKey)
+			c.log(ctx).Errorf("Idempotent key %s not found", idempotentKey)
 			return "", fmt.Errorf("idempotent key %s not found", idempotentKey)
 		}
-		log.Error("Error fetching idempotent key: ", result.Error)
+		c.log(ctx).Error("Error fetching idempotent key: ", result.Error)
 		return "", fmt.Errorf("error fetching idempotent key: %w", result.Error)
 	}
 
-	log.Infof("Idempotent key %s found, customer ID: %s", idempotentKey, Idempotent.CustomerID)
+	c.log(ctx).Infof("Idempotent key %s found, customer ID: %s", idempotentKey, Idempotent.CustomerID)
 
 	if Idempotent.CustomerID == "" {
-		log.Error("Customer ID is empty for idempotent key: ", idempotentKey)
+		c.log(ctx).Error("Customer ID is empty for idempotent key: ", idempotentKey)
 		return "", fmt.Errorf("customer ID is empty for idempotent key: %s", idempotentKey)
 	}
 
+	// Do not hand out a link for a session that is already paid, refunded or expired
+
+	paymentStatus := models.NormalizePaymentStatus(string(Idempotent.PaymentStatus))
+
+	if paymentStatus == models.PaymentStatusLinkIssued && Idempotent.PaymentLink != "" {
+
+		// The seats stay held for as long as the link is handed out
+
+		if _, err := c.Extend_Seat_Holds(ctx, idempotentKey, Idempotent.MovieTimeSlotID, Idempotent.BookedSeatsId, SeatHoldLinkTTL); err != nil {
+			return "", err
+		}
+
+		c.log(ctx).Infof("Payment link for idempotent key %s was already issued, returning it", idempotentKey)
+
+		return Idempotent.PaymentLink, nil
+	}
+
+	if !paymentStatus.CanTransitionTo(models.PaymentStatusLinkIssued) {
+		c.log(ctx).Errorf("Cannot generate payment link for idempotent key %s in status %s", idempotentKey, paymentStatus)
+		return "", fmt.Errorf("%w: %s -> %s", ErrInvalidPaymentTransition, paymentStatus, models.PaymentStatusLinkIssued)
+	}
+
 	// Fetch seat details from the database using bookedSeatsId
 
 	// var bookedSeats []models.BookedSeats
@@ -449,278 +585,100 @@ func (c *Payment_Service) GeneratePaymentLink(idempotentKey string) (string, err
 	// 	bookedSeats = append(bookedSeats, seat)
 	// }
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
-	var productCartArr []dodopayments.OneTimeProductCartItemParam
-
-	for _, v := range Idempotent.OrderIDs {
-		productCartArr = append(productCartArr, dodopayments.OneTimeProductCartItemParam{
-			ProductID: dodopayments.F(v),
-			Quantity:  dodopayments.F(int64(1)), // Assuming quantity is always 1 for each product
-		})
-	}
+	// Order IDs hold the product of every seat, seats sharing a product are one line with a quantity
 
-	dodopayments.NewWebhookEventService()
+	productCartArr := CartItems(Idempotent.OrderIDs)
 
 	seatsJSON, _ := json.Marshal(Idempotent.BookedSeatsId)
 
-	// Get the customer details
-
-	customer, err := c.Client.Customers.Get(context.TODO(), Idempotent.CustomerID)
+	currency := Idempotent.Currency
 
-	if err != nil {
-		log.Error("Failed to find customer details: ", err)
-		return "", fmt.Errorf("failed to find customer details: %w", err)
-	}
-
-	paymentLink, err := c.Client.Payments.New(ctx, dodopayments.PaymentNewParams{
-		Billing: dodopayments.F(dodopayments.BillingAddressParam{
-			Country: dodopayments.F(dodopayments.CountryCodeIn),
-			State:   dodopayments.F("Karnataka"),
-			City:    dodopayments.F("Banglore"),
-			Street:  dodopayments.F("123 Example Street"),
-			Zipcode: dodopayments.F("560001"),
-		}),
-		Customer: dodopayments.F[dodopayments.CustomerRequestUnionParam](dodopayments.AttachExistingCustomerParam{
-			CustomerID: dodopayments.F(Idempotent.CustomerID),
-		}),
-		ProductCart:     dodopayments.F(productCartArr),
-		PaymentLink:     dodopayments.F(true),
-		ReturnURL:       dodopayments.F("http://localhost:5173/confirmingBooking"),
-		BillingCurrency: dodopayments.F(dodopayments.CurrencyInr),
-		Metadata: dodopayments.F(map[string]string{
-			"idempotent_key":     idempotentKey,
-			"movie_time_slot_id": fmt.Sprint(Idempotent.MovieTimeSlotID),
-			"booked_seats_id":    string(seatsJSON), // ✅ JSON array as string
-			"customer_id":        Idempotent.CustomerID,
-			"customer_phone":     customer.PhoneNumber,
-		}),
-	})
-
-	if err != nil {
-		log.Error("Failed to create payment link: ", err)
-		return "", fmt.Errorf("failed to create payment link: %w", err)
+	if currency == "" {
+		currency = money.INR
 	}
 
-	log.Infof("Payment link created successfully: %s", paymentLink.PaymentLink)
+	billing := Idempotent.Billing
 
-	return paymentLink.PaymentLink, nil
-}
+	// Sessions created before the address was collected only know the currency
 
-func (m *Payment_Service) Update_Wallet_Ledger(idempotent_key string, transaction_id string) error {
+	if billing.Country == "" {
+		billing.Country, err = money.HomeCountry(currency)
 
-	tx := m.DB.Begin()
-
-	if tx.Error != nil {
-		log.Error("Failed to begin transaction: ", tx.Error)
-		return fmt.Errorf("failed to begin transaction: %w", tx.Error)
-	}
-
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-			log.Error("Transaction rolled back due to panic: ", r)
+		if err != nil {
+			c.log(ctx).Error("Invalid billing currency: ", err)
+			return "", fmt.Errorf("invalid billing currency: %w", err)
 		}
-	}()
-
-	// Fetch the payment details using the transaction id
-
-	url := fmt.Sprintf("https://test.dodopayments.com/payments/%s", transaction_id)
-
-	req, err := http.NewRequest("GET", url, nil)
-
-	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to create HTTP request: ", err)
-		return fmt.Errorf("failed to create HTTP request: %w", err)
 	}
 
-	req.Header.Set("Authorization", os.Getenv("DODOPAYMENT_TOKEN"))
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-
-	resp, err := client.Do(req)
+	urls, err := c.resolveRedirectURLs(
+		redirectURLs{SuccessURL: successURL, CancelURL: cancelURL},
+		redirectURLs{SuccessURL: Idempotent.SuccessURL, CancelURL: Idempotent.CancelURL},
+	)
 
 	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to send HTTP request: ", err)
-		return fmt.Errorf("failed to send HTTP request: %w", err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		tx.Rollback()
-		log.Errorf("Failed to fetch payment details, status code: %d", resp.StatusCode)
-		return fmt.Errorf("failed to fetch payment details, status code: %d", resp.StatusCode)
+		c.log(ctx).Error("Invalid redirect URLs: ", err)
+		return "", err
 	}
 
-	var paymentDetail PaymentDetail
+	// Keep the seats held while the customer pays, a lapsed hold is taken again unless another booking took the seats
 
-	err = json.NewDecoder(resp.Body).Decode(&paymentDetail)
+	_, err = c.Extend_Seat_Holds(ctx, idempotentKey, Idempotent.MovieTimeSlotID, Idempotent.BookedSeatsId, SeatHoldLinkTTL)
 
 	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to decode payment details: ", err)
-		return fmt.Errorf("failed to decode payment details: %w", err)
+		return "", err
 	}
 
-	log.Infof("Payment details fetched successfully for transaction ID: %s", transaction_id)
-
-	// Use the payment object to fetch customer details and product details and update wallet and ledger accordingly
-
-	customerID := paymentDetail.Customer.CustomerID
-
-	orderIds := make([]string, len(paymentDetail.ProductCart))
-
-	for i, product := range paymentDetail.ProductCart {
-		orderIds[i] = product.ProductID
-	}
+	// Get the customer details
 
-	url = fmt.Sprintf("https://test.dodopayments.com/customers/%s", customerID)
+	gatewayCtx, cancel := c.gatewayContext(ctx)
+	defer cancel()
 
-	req, err = http.NewRequest("GET", url, nil)
+	customer, err := c.Gateway.GetCustomer(gatewayCtx, Idempotent.CustomerID)
 
 	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to create HTTP request for customer details: ", err)
-		return fmt.Errorf("failed to create HTTP request for customer details: %w", err)
+		c.log(ctx).Error("Failed to find customer details: ", err)
+		return "", fmt.Errorf("failed to find customer details: %w", err)
 	}
 
-	req.Header.Set("Authorization", os.Getenv("DODOPAYMENT_TOKEN"))
-	req.Header.Set("Content-Type", "application/json")
-	resp, err = client.Do(req)
+	paymentLink, err := c.Gateway.CreatePayment(gatewayCtx, gateway.PaymentParams{
+		Billing: gateway.BillingAddress{
+			Country: billing.Country,
+			State:   billing.State,
+			City:    billing.City,
+			Street:  billing.Street,
+			Zipcode: billing.Zipcode,
+		},
+		CustomerID:  Idempotent.CustomerID,
+		ProductCart: productCartArr,
+		ReturnURL:   c.paymentReturnURL(idempotentKey, urls.SuccessURL),
+		Currency:    currency,
+		Metadata: map[string]string{
+			"idempotent_key":     idempotentKey,
+			"movie_time_slot_id": fmt.Sprint(Idempotent.MovieTimeSlotID),
+			"booked_seats_id":    string(seatsJSON), // ✅ JSON array as string
+			"customer_id":        Idempotent.CustomerID,
+			"customer_phone":     customer.PhoneNumber,
+		},
+	})
 
 	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to send HTTP request for customer details: ", err)
-		return fmt.Errorf("failed to send HTTP request for customer details: %w", err)
-	}
-
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		tx.Rollback()
-		log.Errorf("Failed to fetch customer details, status code: %d", resp.StatusCode)
-		return fmt.Errorf("failed to fetch customer details, status code: %d", resp.StatusCode)
+		c.log(ctx).Error("Failed to create payment link: ", err)
+		return "", fmt.Errorf("failed to create payment link: %w", err)
 	}
 
-	var customerDetail CustomerDetail
-
-	err = json.NewDecoder(resp.Body).Decode(&customerDetail)
+	err = c.Transition_Payment_Status(ctx, idempotentKey, models.PaymentStatusLinkIssued, "payment link generated", map[string]interface{}{
+		"payment_id":   paymentLink.PaymentID,
+		"payment_link": paymentLink.PaymentLink,
+		"success_url":  urls.SuccessURL,
+		"cancel_url":   urls.CancelURL,
+	})
 
 	if err != nil {
-		tx.Rollback()
-		log.Error("Failed to decode customer details: ", err)
-		return fmt.Errorf("failed to decode customer details: %w", err)
+		c.log(ctx).Error("Failed to record issued payment link: ", err)
+		return "", fmt.Errorf("failed to record issued payment link: %w", err)
 	}
 
-	log.Infof("Customer details fetched successfully for customer ID: %s", customerID)
-
-	// Get product details from the database using order IDs
-
-	var products []ProductDetail
-
-	for _, orderID := range orderIds {
-		url = fmt.Sprintf("https://test.dodopayments.com/products/%s", orderID)
-
-		req, err = http.NewRequest("GET", url, nil)
-
-		if err != nil {
-			tx.Rollback()
-			log.Error("Failed to create HTTP request for product details: ", err)
-			return fmt.Errorf("failed to create HTTP request for product details: %w", err)
-		}
-
-		req.Header.Set("Authorization", os.Getenv("DODOPAYMENT_TOKEN"))
-		req.Header.Set("Content-Type", "application/json")
-
-		resp, err = client.Do(req)
-
-		if err != nil {
-			tx.Rollback()
-			log.Error("Failed to send HTTP request for product details: ", err)
-			return fmt.Errorf("failed to send HTTP request for product details: %w", err)
-		}
-
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			tx.Rollback()
-			log.Errorf("Failed to fetch product details for order ID %s, status code: %d", orderID, resp.StatusCode)
-			return fmt.Errorf("failed to fetch product details for order ID %s, status code: %d", orderID, resp.StatusCode)
-		}
-
-		var productDetail ProductDetail
-
-		err = json.NewDecoder(resp.Body).Decode(&productDetail)
+	c.log(ctx).Infof("Payment link created successfully: %s", paymentLink.PaymentLink)
 
-		if err != nil {
-			tx.Rollback()
-			log.Error("Failed to decode product details: ", err)
-			return fmt.Errorf("failed to decode product details: %w", err)
-		}
-
-		log.Infof("Product details fetched successfully for product ID: %s", productDetail.ProductID)
-
-		products = append(products, productDetail)
-
-	}
-
-	// Update the wallet balance and create a ledger entry
-
-	wallet := models.Wallet{
-		UserID:   customerDetail.CustomerID,
-		Balance:  float64(paymentDetail.TotalAmount) / 100, // Convert to float64
-		Currency: paymentDetail.Currency,
-	}
-
-	result := tx.Model(&models.Wallet{}).Create(&wallet)
-
-	if result.Error != nil {
-		tx.Rollback()
-		log.Error("Failed to create wallet entry: ", result.Error)
-		return fmt.Errorf("failed to create wallet entry: %w", result.Error)
-	}
-
-	log.Infof("Wallet entry created successfully for user ID: %s", wallet.UserID)
-
-	var ledgerArr []models.Ledger
-
-	for _, product := range products {
-		ledger := models.Ledger{
-			WalletID:      wallet.ID,
-			OrderID:       nil, // Assuming no order ID is associated
-			TransactionID: transaction_id,
-			Amount:        float64(product.Price.Price) / 100, // Convert to float64
-			Type:          "credit",
-			Description:   fmt.Sprintf("Payment received for product %s", product.Name),
-			PSPRefID:      paymentDetail.PaymentID,
-		}
-
-		ledgerArr = append(ledgerArr, ledger)
-	}
-
-	for _, ledger := range ledgerArr {
-		result := tx.Model(&models.Ledger{}).Create(&ledger)
-
-		if result.Error != nil {
-			tx.Rollback()
-			log.Error("Failed to create ledger entry: ", result.Error)
-			return fmt.Errorf("failed to create ledger entry: %w", result.Error)
-		}
-
-		log.Infof("Ledger entry created successfully for wallet ID: %d", ledger.WalletID)
-	}
-
-	if err := tx.Commit().Error; err != nil {
-		log.Error("Failed to commit transaction: ", err)
-		return fmt.Errorf("failed to commit transaction: %w", err)
-	}
-
-	log.Info("Transaction committed successfully")
-
-	return nil
+	return paymentLink.PaymentLink, nil
 }
@@ -0,0 +1,190 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/prometheus/client_golang/prometheus"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotentKeyNotFound    = errors.New("idempotent key not found")
+	ErrInvalidPaymentTransition = errors.New("invalid payment status transition")
+	ErrPaymentStatusConflict    = errors.New("payment status was changed concurrently")
+)
+
+// Transition_Payment_Status moves the session identified by key to the next
+// state. The row is only updated when it is still in the state that was read,
+// so two concurrent callers cannot both apply a transition from the same state.
+// Any extra column updates are applied in the same statement and every actual
+// change of state is recorded in PaymentStatusHistory.
+func (m *Payment_Service) Transition_Payment_Status(ctx context.Context, key string, next models.PaymentStatus, reason string, updates map[string]interface{}) error {
+
+	var change *statusChange
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		var err error
+
+		change, err = m.transitionPaymentStatus(tx, key, next, reason, updates)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	change.count()
+
+	return nil
+}
+
+// statusChange is a change of state written by transitionPaymentStatus. The
+// caller counts it in the metrics once the transaction has committed.
+type statusChange struct {
+	from     models.PaymentStatus
+	to       models.PaymentStatus
+	currency string
+	venueID  uint
+}
+
+// count adds the change to the business metrics, a nil change is not counted
+func (c *statusChange) count() {
+
+	if c == nil {
+		return
+	}
+
+	var counter *prometheus.CounterVec
+
+	switch c.to {
+	case models.PaymentStatusOrderCreated:
+		counter = metrics.OrdersCreated
+	case models.PaymentStatusLinkIssued:
+		counter = metrics.PaymentLinksGenerated
+	case models.PaymentStatusSucceeded:
+		// A won dispute moves the payment back to SUCCEEDED, it was counted when captured
+		if c.from == models.PaymentStatusDisputed {
+			return
+		}
+		counter = metrics.PaymentsSucceeded
+	case models.PaymentStatusFailed:
+		counter = metrics.PaymentsFailed
+	case models.PaymentStatusExpired:
+		counter = metrics.SessionsExpired
+	default:
+		return
+	}
+
+	counter.WithLabelValues(c.currency, metrics.Venue(c.venueID)).Inc()
+}
+
+// transitionPaymentStatus returns the change it wrote, nil when the session
+// already was in the next state
+func (m *Payment_Service) transitionPaymentStatus(tx *gorm.DB, key string, next models.PaymentStatus, reason string, updates map[string]interface{}) (*statusChange, error) {
+
+	var idempotent models.Idempotent
+
+	// Expired sessions are soft-deleted, they are still found so that moving them on is
+	// rejected as a transition out of EXPIRED instead of looking like an unknown key
+
+	result := tx.Unscoped().Select("id", "payment_status", "currency", "venue_id").Where("idempotent_key = ?", key).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrIdempotentKeyNotFound, key)
+		}
+		m.log(tx.Statement.Context).Error("Error fetching payment status: ", result.Error)
+		return nil, fmt.Errorf("error fetching payment status: %w", result.Error)
+	}
+
+	stored := idempotent.PaymentStatus
+	current := models.NormalizePaymentStatus(string(stored))
+
+	if !current.CanTransitionTo(next) {
+		m.log(tx.Statement.Context).Warnf("Rejected payment status transition %s -> %s for idempotent key %s", current, next, key)
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidPaymentTransition, current, next)
+	}
+
+	values := map[string]interface{}{}
+
+	for column, value := range updates {
+		values[column] = value
+	}
+
+	values["payment_status"] = next
+
+	result = tx.Model(&models.Idempotent{}).
+		Where("idempotent_key = ? AND payment_status = ?", key, stored).
+		Updates(values)
+
+	if result.Error != nil {
+		m.log(tx.Statement.Context).Error("Error updating payment status: ", result.Error)
+		return nil, fmt.Errorf("error updating payment status: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return nil, fmt.Errorf("%w: idempotent key %s is no longer %s", ErrPaymentStatusConflict, key, current)
+	}
+
+	if current == next {
+		return nil, nil
+	}
+
+	if err := m.recordPaymentStatus(tx, key, current, next, reason); err != nil {
+		return nil, err
+	}
+
+	m.log(tx.Statement.Context).Infof("Payment status for idempotent key %s moved from %s to %s", key, current, next)
+
+	change := &statusChange{from: current, to: next, currency: idempotent.Currency, venueID: idempotent.VenueID}
+
+	// The update may set the currency or the venue, e.g. when the order is created
+
+	if currency, ok := values["currency"].(string); ok {
+		change.currency = currency
+	}
+
+	if venueID, ok := values["venue_id"].(uint); ok {
+		change.venueID = venueID
+	}
+
+	return change, nil
+}
+
+func (m *Payment_Service) recordPaymentStatus(tx *gorm.DB, key string, from models.PaymentStatus, to models.PaymentStatus, reason string) error {
+
+	result := tx.Create(&models.PaymentStatusHistory{
+		IdempotentKey: key,
+		FromStatus:    from,
+		ToStatus:      to,
+		Reason:        reason,
+	})
+
+	if result.Error != nil {
+		m.log(tx.Statement.Context).Error("Error recording payment status history: ", result.Error)
+		return fmt.Errorf("error recording payment status history: %w", result.Error)
+	}
+
+	return nil
+}
+
+// Payment_Status_History returns the recorded transitions of a session, oldest first
+func (m *Payment_Service) Payment_Status_History(ctx context.Context, key string) ([]models.PaymentStatusHistory, error) {
+
+	var history []models.PaymentStatusHistory
+
+	result := m.DB.WithContext(ctx).Where("idempotent_key = ?", key).Order("id asc").Find(&history)
+
+	if result.Error != nil {
+		m.log(ctx).Error("Error fetching payment status history: ", result.Error)
+		return nil, fmt.Errorf("error fetching payment status history: %w", result.Error)
+	}
+
+	return history, nil
+}
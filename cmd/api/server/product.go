@@ -4,40 +4,67 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/dodopayments/dodopayments-go"
-	log "github.com/sirupsen/logrus"
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
 )
 
 type Product struct {
-	ProductName        string `json:"product_name" validate:"required"`
-	Price              int64  `json:"price" validate:"required;min=1"`
-	ProductDescription string `json:"product_description" validate:"required"`
+	ProductName        string      `json:"product_name" validate:"required"`
+	Price              money.Money `json:"price"`
+	ProductDescription string      `json:"product_description" validate:"required"`
 }
 
-func (m *Payment_Service) Create_Product_Ticket(product Product) (*dodopayments.Product, error) {
+// seatPrice converts the price of a seat returned by the movie DB service, which
+// quotes whole units of PriceCurrency, into the currency the customer pays in
+func (m *Payment_Service) seatPrice(ctx context.Context, price int32, currency string) (money.Money, error) {
+
+	priceCurrency := m.PriceCurrency
+
+	if priceCurrency == "" {
+		priceCurrency = money.INR
+	}
+
+	quoted, err := money.FromMajor(int64(price), priceCurrency)
+
+	if err != nil {
+		return money.Money{}, fmt.Errorf("invalid seat price: %w", err)
+	}
+
+	converted, err := fx.Convert(ctx, m.FX, quoted, currency)
+
+	if err != nil {
+		m.log(ctx).Errorf("Failed to convert seat price %s to %s: %v", quoted, currency, err)
+		return money.Money{}, fmt.Errorf("failed to convert seat price: %w", err)
+	}
+
+	return converted, nil
+}
+
+func (m *Payment_Service) Create_Product_Ticket(ctx context.Context, product Product) (*gateway.Product, error) {
 	// Create a product with the given name and price
 
-	log.Infof("Creating product with name: %s, price: %d", product.ProductName, product.Price)
-
-	p, err := m.Client.Products.New(context.Background(), dodopayments.ProductNewParams{
-		Price: dodopayments.F[dodopayments.PriceUnionParam](dodopayments.PriceOneTimePriceParam{
-			Currency:              dodopayments.F(dodopayments.CurrencyInr),
-			Price:                 dodopayments.F(product.Price * 100), // Convert to paise as Dodo Payments expects price in the smallest denomination in the currency that is being used
-			Type:                  dodopayments.F(dodopayments.PriceOneTimePriceTypeOneTimePrice),
-			Discount:              dodopayments.Float(0),
-			PurchasingPowerParity: dodopayments.F(false),
-		}),
-		Name:        dodopayments.F(product.ProductName),
-		Description: dodopayments.F(product.ProductDescription),
-		TaxCategory: dodopayments.F(dodopayments.TaxCategoryDigitalProducts),
+	m.log(ctx).Infof("Creating product with name: %s, price: %s", product.ProductName, product.Price)
+
+	if err := product.Price.Validate(); err != nil || !product.Price.IsPositive() {
+		return nil, fmt.Errorf("invalid price %s for product %s: %w", product.Price, product.ProductName, money.ErrInvalidAmount)
+	}
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	p, err := m.Gateway.CreateProduct(gatewayCtx, gateway.ProductParams{
+		Name:        product.ProductName,
+		Description: product.ProductDescription,
+		Price:       product.Price,
 	})
 
 	if err != nil {
-		log.Error("Failed to create product: ", err)
+		m.log(ctx).Error("Failed to create product: ", err)
 		return nil, fmt.Errorf("failed to create product: %w", err)
 	}
 
-	log.Info("Product created successfully: ", p.ProductID)
+	m.log(ctx).Info("Product created successfully: ", p.ProductID)
 
 	return p, nil
 }
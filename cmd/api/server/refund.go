@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+var ErrSeatNotInBooking = errors.New("seat is not part of the booking")
+
+var ErrSeatAlreadyRefunded = errors.New("seat is already refunded")
+
+type RefundPaymentPayload struct {
+	IdempotentKey  string  `json:"idempotent_key" validate:"required_without=PaymentID"`
+	PaymentID      string  `json:"payment_id" validate:"required_without=IdempotentKey"`
+	BookedSeatsIDs []int32 `json:"booked_seats_ids"` // seats to refund, empty for every seat not refunded yet
+	Reason         string  `json:"reason"`
+}
+
+// Refund_Payment refunds a paid booking, either completely or only the
+// selected seats. Refunded seats are recorded on the session before the
+// provider is called, so a repeated request cannot refund a seat twice. The
+// refund is posted to the ledger, the seats stay booked.
+func (m *Payment_Service) Refund_Payment(ctx context.Context, payload RefundPaymentPayload) (*gateway.Refund, error) {
+
+	if err := m.Validator.Struct(payload); err != nil {
+		m.log(ctx).Error("Validation failed for RefundPaymentPayload: ", err)
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+
+	var idempotent models.Idempotent
+
+	query := m.DB.WithContext(ctx).Model(&models.Idempotent{})
+
+	if payload.IdempotentKey != "" {
+		query = query.Where("idempotent_key = ?", payload.IdempotentKey)
+	} else {
+		query = query.Where("payment_id = ?", payload.PaymentID)
+	}
+
+	result := query.First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("%w: no booking found for idempotent key %q or payment %q", ErrIdempotentKeyNotFound, payload.IdempotentKey, payload.PaymentID)
+		}
+		m.log(ctx).Error("Error fetching idempotent key: ", result.Error)
+		return nil, fmt.Errorf("error fetching idempotent key: %w", result.Error)
+	}
+
+	// A disputed payment is settled through the dispute, a refund on top of it would pay the customer twice
+
+	paymentStatus := models.NormalizePaymentStatus(string(idempotent.PaymentStatus))
+
+	if paymentStatus != models.PaymentStatusSucceeded || idempotent.PaymentID == nil {
+		m.log(ctx).Errorf("Cannot refund idempotent key %s in status %s", idempotent.IdempotentKey, paymentStatus)
+		return nil, fmt.Errorf("%w: %s -> %s", ErrInvalidPaymentTransition, paymentStatus, models.PaymentStatusRefunded)
+	}
+
+	paymentID := *idempotent.PaymentID
+
+	seatsToRefund, remaining, err := refundableSeats(idempotent, payload.BookedSeatsIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// OrderIDs holds the product of every seat, in the same order as BookedSeatsId.
+	// Seats may share a catalog product, so each seat refunds the unit price of its product.
+
+	prices, err := m.Catalog_Prices(ctx, idempotent.OrderIDs)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var items []gateway.RefundItem
+	itemIndex := map[string]int{}
+
+	for _, seatID := range seatsToRefund {
+
+		productID := idempotent.OrderIDs[seatIndex(idempotent.BookedSeatsId, seatID)]
+
+		price, ok := prices[productID]
+
+		if !ok {
+			// Products created before the catalog were one per seat, refunding the whole item is one seat
+			items = append(items, gateway.RefundItem{ItemID: productID})
+			continue
+		}
+
+		if i, ok := itemIndex[productID]; ok {
+			if items[i].Amount, err = items[i].Amount.Add(price); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		itemIndex[productID] = len(items)
+		items = append(items, gateway.RefundItem{ItemID: productID, Amount: price})
+	}
+
+	// Partial when seats of the booking stay paid for, the payment is refunded
+	// without items only when no seat of it was refunded before
+
+	isPartial := len(seatsToRefund) < len(remaining)
+	wholePayment := !isPartial && len(idempotent.RefundedSeatsId) == 0
+
+	reason := payload.Reason
+
+	if reason == "" {
+		reason = "Booking cancelled"
+	}
+
+	params := gateway.RefundParams{
+		PaymentID: paymentID,
+		Reason:    reason,
+	}
+
+	if !wholePayment {
+		params.Items = items
+	}
+
+	refunded := append(pq.Int32Array{}, idempotent.RefundedSeatsId...)
+	claimed := append(append(pq.Int32Array{}, refunded...), seatsToRefund...)
+
+	if err := m.claimRefundedSeats(ctx, idempotent, refunded, claimed); err != nil {
+		return nil, err
+	}
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	defer cancel()
+
+	refund, err := m.Gateway.CreateRefund(gatewayCtx, params)
+
+	if err != nil {
+		m.log(ctx).Error("Failed to create refund: ", err)
+
+		// Nothing was refunded, the seats may be refunded again
+
+		if releaseErr := m.claimRefundedSeats(ctx, idempotent, claimed, refunded); releaseErr != nil {
+			m.log(ctx).Errorf("Seats %v of idempotent key %s stay marked as refunded: %v", seatsToRefund, idempotent.IdempotentKey, releaseErr)
+		}
+
+		return nil, fmt.Errorf("failed to create refund: %w", err)
+	}
+
+	m.log(ctx).Infof("Refund %s created for payment %s, partial: %t", refund.RefundID, paymentID, isPartial)
+
+	currency := refund.Amount.Currency
+
+	if currency == "" {
+		currency = idempotent.Currency
+	}
+
+	metrics.Refunds.WithLabelValues(currency, metrics.Venue(idempotent.VenueID), strconv.FormatBool(isPartial)).Inc()
+
+	// The refund has been issued, failures after this point must not hide that from the caller
+
+	if err := m.Post_Refund_Journal(ctx, refund, idempotent.IdempotentKey, idempotent.CustomerID, idempotent.VenueID, reason); err != nil {
+		m.log(ctx).Errorf("Refund %s issued but not posted to the ledger: %v", refund.RefundID, err)
+	}
+
+	// Once every seat is refunded the booking is, whether in one refund or several partial ones
+
+	if !isPartial {
+		if err := m.Transition_Payment_Status(ctx, idempotent.IdempotentKey, models.PaymentStatusRefunded, "every seat refunded", nil); err != nil {
+			m.log(ctx).Errorf("Refund %s issued but idempotent key %s is not marked as refunded: %v", refund.RefundID, idempotent.IdempotentKey, err)
+		}
+	}
+
+	// The refunded seats stay booked. The movie DB service has no RPC to release
+	// booked seats, freeing them here would hold seats it never lets anyone book.
+
+	return refund, nil
+}
+
+// refundableSeats returns the seats to refund, requested without duplicates or
+// every seat not refunded yet when none are requested, and the seats of the
+// booking that are not refunded yet
+func refundableSeats(idempotent models.Idempotent, requested []int32) ([]int32, []int32, error) {
+
+	refunded := map[int32]bool{}
+
+	for _, id := range idempotent.RefundedSeatsId {
+		refunded[id] = true
+	}
+
+	var remaining []int32
+
+	for _, id := range idempotent.BookedSeatsId {
+		if !refunded[id] {
+			remaining = append(remaining, id)
+		}
+	}
+
+	if len(requested) == 0 {
+		if len(remaining) == 0 {
+			return nil, nil, fmt.Errorf("%w: every seat of idempotent key %s is refunded", ErrSeatAlreadyRefunded, idempotent.IdempotentKey)
+		}
+
+		return remaining, remaining, nil
+	}
+
+	var seats []int32
+	seen := map[int32]bool{}
+
+	for _, id := range requested {
+
+		if seen[id] {
+			continue
+		}
+
+		seen[id] = true
+
+		if index := seatIndex(idempotent.BookedSeatsId, id); index == -1 || index >= len(idempotent.OrderIDs) {
+			return nil, nil, fmt.Errorf("%w: %d", ErrSeatNotInBooking, id)
+		}
+
+		if refunded[id] {
+			return nil, nil, fmt.Errorf("%w: %d", ErrSeatAlreadyRefunded, id)
+		}
+
+		seats = append(seats, id)
+	}
+
+	return seats, remaining, nil
+}
+
+// seatIndex returns the position of the seat in the booking, -1 when it is not part of it
+func seatIndex(bookedSeats []int32, seatID int32) int {
+
+	for i, id := range bookedSeats {
+		if id == seatID {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// claimRefundedSeats replaces the refunded seats of the session, provided they
+// are still from and the payment has not changed state in the meantime
+func (m *Payment_Service) claimRefundedSeats(ctx context.Context, idempotent models.Idempotent, from pq.Int32Array, to pq.Int32Array) error {
+
+	result := m.DB.WithContext(ctx).Model(&models.Idempotent{}).
+		Where("idempotent_key = ? AND payment_status = ? AND COALESCE(refunded_seats_id, '{}') = ?", idempotent.IdempotentKey, idempotent.PaymentStatus, from).
+		Update("refunded_seats_id", to)
+
+	if result.Error != nil {
+		m.log(ctx).Error("Error recording refunded seats: ", result.Error)
+		return fmt.Errorf("error recording refunded seats: %w", result.Error)
+	}
+
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("%w: refunds of idempotent key %s changed concurrently", ErrPaymentStatusConflict, idempotent.IdempotentKey)
+	}
+
+	return nil
+}
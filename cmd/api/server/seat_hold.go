@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// How long seats are held for a session
+var (
+	// SeatHoldTTL covers the time between creating the order and issuing the payment link
+	SeatHoldTTL = 10 * time.Minute
+	// SeatHoldLinkTTL covers the time a customer has to pay once the payment link is issued
+	SeatHoldLinkTTL = 30 * time.Minute
+)
+
+var ErrSeatHeld = errors.New("seat is held by another booking")
+
+// holdAvailable matches a seat row that the session may take: it is not booked
+// and either already held by the session or its hold has lapsed
+const holdAvailable = "NOT booked_seats.is_booked AND (booked_seats.hold_key = ? OR booked_seats.locked_until IS NULL OR booked_seats.locked_until < ?)"
+
+// Hold_Seats places a hold on every seat for the session until now + ttl. The
+// seats are held together or not at all, when any seat is booked or held by
+// another session nothing is held and ErrSeatHeld is returned. Holding seats
+// the session already holds extends their hold.
+func (m *Payment_Service) Hold_Seats(ctx context.Context, key string, movieTimeSlotID int32, seats []*moviedb_service.BookedSeats, ttl time.Duration) (time.Time, error) {
+
+	now := m.now()
+	until := now.Add(ttl)
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		for _, seat := range seats {
+
+			row := models.BookedSeats{
+				SeatNumber:      seat.SeatNumber,
+				MovieTimeSlotID: uint(movieTimeSlotID),
+				SeatMatrixID:    uint(seat.SeatMatrixID),
+				BookedSeatID:    seat.Id,
+				LockedUntil:     &until,
+				HoldKey:         key,
+			}
+
+			// The conditional upsert either takes the seat or leaves it alone in a single statement,
+			// so two sessions racing for the same seat cannot both get it
+
+			result := tx.Clauses(clause.OnConflict{
+				Columns: []clause.Column{{Name: "movie_time_slot_id"}, {Name: "seat_matrix_id"}},
+				DoUpdates: clause.Assignments(map[string]interface{}{
+					"seat_number":    seat.SeatNumber,
+					"booked_seat_id": seat.Id,
+					"locked_until":   until,
+					"hold_key":       key,
+					"updated_at":     now,
+					"deleted_at":     nil,
+				}),
+				Where: clause.Where{Exprs: []clause.Expression{gorm.Expr(holdAvailable, key, now)}},
+			}).Create(&row)
+
+			if result.Error != nil {
+				m.log(ctx).Error("Error holding seat: ", result.Error)
+				return fmt.Errorf("error holding seat %s: %w", seat.SeatNumber, result.Error)
+			}
+
+			if result.RowsAffected == 0 {
+				return fmt.Errorf("%w: seat %s of movie time slot %d", ErrSeatHeld, seat.SeatNumber, movieTimeSlotID)
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		m.log(ctx).Warnf("Failed to hold seats for idempotent key %s: %v", key, err)
+		return time.Time{}, err
+	}
+
+	m.log(ctx).Infof("Held %d seats for idempotent key %s until %s", len(seats), key, until.Format(time.RFC3339))
+
+	return until, nil
+}
+
+// Extend_Seat_Holds holds the seats of a session until now + ttl. Holds that were
+// released or have lapsed are taken again as long as no other session took the
+// seat in the meantime, otherwise nothing changes and ErrSeatHeld is returned.
+func (m *Payment_Service) Extend_Seat_Holds(ctx context.Context, key string, movieTimeSlotID uint, bookedSeatIDs []int32, ttl time.Duration) (time.Time, error) {
+
+	now := m.now()
+	until := now.Add(ttl)
+
+	if len(bookedSeatIDs) == 0 {
+		return until, nil
+	}
+
+	err := m.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+
+		result := tx.Model(&models.BookedSeats{}).
+			Where("movie_time_slot_id = ? AND booked_seat_id IN ?", movieTimeSlotID, bookedSeatIDs).
+			Where(holdAvailable, key, now).
+			Updates(map[string]interface{}{
+				"locked_until": until,
+				"hold_key":     key,
+			})
+
+		if result.Error != nil {
+			m.log(ctx).Error("Error extending seat holds: ", result.Error)
+			return fmt.Errorf("error extending seat holds: %w", result.Error)
+		}
+
+		if result.RowsAffected < int64(len(bookedSeatIDs)) {
+			return fmt.Errorf("%w: only %d of %d seats could be held", ErrSeatHeld, result.RowsAffected, len(bookedSeatIDs))
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		m.log(ctx).Warnf("Failed to extend seat holds for idempotent key %s: %v", key, err)
+		return time.Time{}, err
+	}
+
+	m.log(ctx).Infof("Seat holds for idempotent key %s extended until %s", key, until.Format(time.RFC3339))
+
+	return until, nil
+}
+
+// Release_Seat_Holds releases every seat the session holds but has not booked
+func (m *Payment_Service) Release_Seat_Holds(ctx context.Context, key string) error {
+	return m.releaseSeatHolds(m.DB.WithContext(ctx), key)
+}
+
+func (m *Payment_Service) releaseSeatHolds(tx *gorm.DB, key string) error {
+
+	result := tx.Model(&models.BookedSeats{}).
+		Where("hold_key = ? AND NOT is_booked", key).
+		Updates(map[string]interface{}{
+			"locked_until": nil,
+			"hold_key":     "",
+		})
+
+	if result.Error != nil {
+		m.log(tx.Statement.Context).Error("Error releasing seat holds: ", result.Error)
+		return fmt.Errorf("error releasing seat holds: %w", result.Error)
+	}
+
+	m.log(tx.Statement.Context).Infof("Released %d seat holds for idempotent key %s", result.RowsAffected, key)
+
+	return nil
+}
+
+// confirmSeatHolds marks the seats held by the session as booked, they are no
+// longer released when the hold lapses
+func (m *Payment_Service) confirmSeatHolds(tx *gorm.DB, key string) error {
+
+	result := tx.Model(&models.BookedSeats{}).
+		Where("hold_key = ?", key).
+		Updates(map[string]interface{}{
+			"is_booked":    true,
+			"locked_until": nil,
+		})
+
+	if result.Error != nil {
+		m.log(tx.Statement.Context).Error("Error confirming seat holds: ", result.Error)
+		return fmt.Errorf("error confirming seat holds: %w", result.Error)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	activeSeatHoldsDesc = prometheus.NewDesc(
+		"payment_service_active_seat_holds",
+		"Seats held for a booking that is being paid for.",
+		nil, nil,
+	)
+
+	pendingSessionsDesc = prometheus.NewDesc(
+		"payment_service_pending_sessions",
+		"Booking sessions that are neither paid for nor expired.",
+		nil, nil,
+	)
+)
+
+// State_Collector reports gauges counted in the database whenever the metrics
+// are scraped, so they are right whichever replica changed the rows
+type State_Collector struct {
+	Ps      *Payment_Service
+	Timeout time.Duration
+}
+
+// NewStateCollector counts the seat holds and pending sessions of ps
+func NewStateCollector(ps *Payment_Service) *State_Collector {
+	return &State_Collector{Ps: ps, Timeout: 5 * time.Second}
+}
+
+func (c *State_Collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeSeatHoldsDesc
+	ch <- pendingSessionsDesc
+}
+
+func (c *State_Collector) Collect(ch chan<- prometheus.Metric) {
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.Timeout)
+	defer cancel()
+
+	var holds int64
+
+	err := c.Ps.DB.WithContext(ctx).Model(&models.BookedSeats{}).
+		Where("is_booked = ? AND locked_until > ?", false, c.Ps.now()).
+		Count(&holds).Error
+
+	c.gauge(ch, activeSeatHoldsDesc, holds, err)
+
+	var pending int64
+
+	err = c.Ps.DB.WithContext(ctx).Model(&models.Idempotent{}).
+		Where("payment_status IN ? AND payment_status <> ?", models.ExpirablePaymentStatuses(), models.PaymentStatusExpired).
+		Count(&pending).Error
+
+	c.gauge(ch, pendingSessionsDesc, pending, err)
+}
+
+func (c *State_Collector) gauge(ch chan<- prometheus.Metric, desc *prometheus.Desc, value int64, err error) {
+
+	if err != nil {
+		c.Ps.logger().Error("Failed to count database gauges for the metrics: ", err)
+		ch <- prometheus.NewInvalidMetric(desc, err)
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, float64(value))
+}
@@ -0,0 +1,493 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"gorm.io/gorm"
+)
+
+// Dodo Payments delivers webhooks following the Standard Webhooks specification
+// https://www.standardwebhooks.com, every request carries these three headers
+const (
+	WebhookIDHeader        = "webhook-id"
+	WebhookTimestampHeader = "webhook-timestamp"
+	WebhookSignatureHeader = "webhook-signature"
+)
+
+// Default window in which a webhook timestamp is accepted, anything older or
+// further in the future is treated as a replay
+const DefaultWebhookTolerance = 5 * time.Minute
+
+// Upper bound on the webhook body we are willing to read
+const maxWebhookBodyBytes = 1 << 20
+
+var (
+	ErrWebhookMissingHeaders   = errors.New("missing webhook headers")
+	ErrWebhookInvalidTimestamp = errors.New("invalid webhook timestamp")
+	ErrWebhookTimestampExpired = errors.New("webhook timestamp outside of tolerance window")
+	ErrWebhookInvalidSignature = errors.New("no matching webhook signature found")
+)
+
+type WebhookEvent struct {
+	BusinessID string          `json:"business_id"`
+	Type       string          `json:"type"`
+	Timestamp  string          `json:"timestamp"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// RefundWebhookData is the data object sent with refund.* events
+type RefundWebhookData struct {
+	RefundID  string      `json:"refund_id"`
+	PaymentID string      `json:"payment_id"`
+	Amount    money.Money `json:"-"` // sent as amount and an optional currency
+	IsPartial bool        `json:"is_partial"`
+	Status    string      `json:"status"`
+	Reason    string      `json:"reason"`
+	CreatedAt string      `json:"created_at"`
+}
+
+func (r *RefundWebhookData) UnmarshalJSON(data []byte) error {
+
+	type refundWebhookData RefundWebhookData
+
+	var wire struct {
+		refundWebhookData
+		Amount   int64   `json:"amount"`
+		Currency *string `json:"currency"`
+	}
+
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	*r = RefundWebhookData(wire.refundWebhookData)
+
+	r.Amount = money.New(wire.Amount, "")
+
+	if wire.Currency != nil {
+		r.Amount = money.New(wire.Amount, *wire.Currency)
+	}
+
+	return nil
+}
+
+// DisputeWebhookData is the data object sent with dispute.* events
+type DisputeWebhookData struct {
+	DisputeID     string      `json:"dispute_id"`
+	PaymentID     string      `json:"payment_id"`
+	Amount        money.Money `json:"-"` // sent as a string of minor units and the currency
+	DisputeStage  string      `json:"dispute_stage"`
+	DisputeStatus string      `json:"dispute_status"`
+	Remarks       string      `json:"remarks"`
+	CreatedAt     string      `json:"created_at"`
+}
+
+func (d *DisputeWebhookData) UnmarshalJSON(data []byte) error {
+
+	type disputeWebhookData DisputeWebhookData
+
+	var wire struct {
+		disputeWebhookData
+		Amount   string `json:"amount"`
+		Currency string `json:"currency"`
+	}
+
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+
+	*d = DisputeWebhookData(wire.disputeWebhookData)
+
+	amount, err := strconv.ParseInt(wire.Amount, 10, 64)
+
+	if err != nil && wire.Amount != "" {
+		return fmt.Errorf("invalid dispute amount %q: %w", wire.Amount, money.ErrInvalidAmount)
+	}
+
+	d.Amount = money.New(amount, wire.Currency)
+
+	return nil
+}
+
+type Webhook_Server struct {
+	Ps        *Payment_Service
+	Secret    []byte
+	Tolerance time.Duration
+	Now       func() time.Time
+}
+
+func NewWebhookServer(ps *Payment_Service, secret string) (*Webhook_Server, error) {
+
+	if secret == "" {
+		return nil, errors.New("webhook secret is not set, set DODOPAYMENT_WEBHOOK_SECRET")
+	}
+
+	key, err := DecodeWebhookSecret(secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Webhook_Server{
+		Ps:        ps,
+		Secret:    key,
+		Tolerance: DefaultWebhookTolerance,
+		Now:       ps.now,
+	}, nil
+}
+
+// DecodeWebhookSecret decodes a "whsec_" prefixed base64 secret as handed out by the dashboard
+func DecodeWebhookSecret(secret string) ([]byte, error) {
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(secret, "whsec_"))
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhook secret: %w", err)
+	}
+
+	return key, nil
+}
+
+// VerifyWebhookSignature checks the Standard Webhooks signature of a payload.
+// The signed content is "<webhook-id>.<webhook-timestamp>.<body>" and the
+// signature header holds one or more space separated "v1,<base64>" entries.
+func VerifyWebhookSignature(secret []byte, header http.Header, body []byte, now time.Time, tolerance time.Duration) error {
+
+	msgID := header.Get(WebhookIDHeader)
+	msgTimestamp := header.Get(WebhookTimestampHeader)
+	msgSignature := header.Get(WebhookSignatureHeader)
+
+	if msgID == "" || msgTimestamp == "" || msgSignature == "" {
+		return ErrWebhookMissingHeaders
+	}
+
+	unix, err := strconv.ParseInt(msgTimestamp, 10, 64)
+
+	if err != nil {
+		return ErrWebhookInvalidTimestamp
+	}
+
+	sentAt := time.Unix(unix, 0)
+
+	if now.Sub(sentAt) > tolerance || sentAt.Sub(now) > tolerance {
+		return ErrWebhookTimestampExpired
+	}
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(msgID + "." + msgTimestamp + "."))
+	mac.Write(body)
+	expected := mac.Sum(nil)
+
+	for _, versioned := range strings.Fields(msgSignature) {
+		version, signature, found := strings.Cut(versioned, ",")
+
+		if !found || version != "v1" {
+			continue
+		}
+
+		decoded, err := base64.StdEncoding.DecodeString(signature)
+
+		if err != nil {
+			continue
+		}
+
+		if hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return ErrWebhookInvalidSignature
+}
+
+func (w *Webhook_Server) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	logger := logging.FromContext(r.Context()).WithField("webhook_id", r.Header.Get(WebhookIDHeader))
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodyBytes))
+
+	if err != nil {
+		logger.Error("Failed to read webhook body: ", err)
+		http.Error(rw, "failed to read body", http.StatusBadRequest)
+		return
+	}
+
+	if err := VerifyWebhookSignature(w.Secret, r.Header, body, w.Now(), w.Tolerance); err != nil {
+		logger.Warn("Rejected webhook: ", err)
+		http.Error(rw, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var event WebhookEvent
+
+	if err := json.Unmarshal(body, &event); err != nil {
+		logger.Error("Failed to decode webhook event: ", err)
+		http.Error(rw, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	logger = logger.WithField("event_type", event.Type)
+
+	logger.Info("Received webhook")
+
+	err = w.Ps.Handle_Webhook_Event(r.Context(), event)
+
+	if errors.Is(err, ErrInvalidPaymentTransition) {
+		// Retrying the delivery cannot make the transition legal, acknowledge it
+		logger.Warn("Ignoring webhook event: ", err)
+		rw.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if err != nil {
+		logger.Error("Failed to handle webhook event: ", err)
+		// A non 2xx response makes Dodo retry the delivery later
+		http.Error(rw, "failed to handle event", http.StatusInternalServerError)
+		return
+	}
+
+	rw.WriteHeader(http.StatusOK)
+}
+
+func (m *Payment_Service) Handle_Webhook_Event(ctx context.Context, event WebhookEvent) error {
+
+	switch {
+	case event.Type == "payment.succeeded":
+		return m.handlePaymentEvent(ctx, event, models.PaymentStatusSucceeded)
+	case event.Type == "payment.failed":
+		return m.handlePaymentEvent(ctx, event, models.PaymentStatusFailed)
+	case strings.HasPrefix(event.Type, "refund."):
+		return m.handleRefundEvent(ctx, event)
+	case strings.HasPrefix(event.Type, "dispute."):
+		return m.handleDisputeEvent(ctx, event)
+	}
+
+	m.log(ctx).Infof("Ignoring unhandled webhook event type %s", event.Type)
+
+	return nil
+}
+
+func (m *Payment_Service) handlePaymentEvent(ctx context.Context, event WebhookEvent, paymentStatus models.PaymentStatus) error {
+
+	var payment PaymentDetail
+
+	if err := json.Unmarshal(event.Data, &payment); err != nil {
+		return fmt.Errorf("failed to decode payment data: %w", err)
+	}
+
+	key, _ := payment.Metadata["idempotent_key"].(string)
+
+	if key == "" {
+		return fmt.Errorf("payment %s has no idempotent_key in its metadata", payment.PaymentID)
+	}
+
+	ctx = logging.NewContext(ctx, m.log(ctx).WithField("idempotent_key", key))
+
+	// Expired sessions are soft-deleted by the sweeper, a payment may still arrive for them
+
+	var idempotent models.Idempotent
+
+	result := m.DB.WithContext(ctx).Unscoped().Where("idempotent_key = ?", key).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return fmt.Errorf("%w: %s", ErrIdempotentKeyNotFound, key)
+		}
+		m.log(ctx).Error("Error fetching idempotent key: ", result.Error)
+		return fmt.Errorf("error fetching idempotent key: %w", result.Error)
+	}
+
+	current := models.NormalizePaymentStatus(string(idempotent.PaymentStatus))
+	samePayment := idempotent.PaymentID != nil && *idempotent.PaymentID == payment.PaymentID
+
+	if paymentStatus == models.PaymentStatusSucceeded {
+		switch {
+		case samePayment && (current == models.PaymentStatusRefunded || current == models.PaymentStatusDisputed):
+			m.log(ctx).Infof("Payment %s for idempotent key %s is already %s", payment.PaymentID, key, current)
+			return nil
+		case idempotent.DeletedAt.Valid || !current.CanTransitionTo(models.PaymentStatusSucceeded) || (current == models.PaymentStatusSucceeded && !samePayment):
+			return m.refundUnexpectedCapture(ctx, key, idempotent.VenueID, current, payment.PaymentID)
+		}
+	} else if idempotent.DeletedAt.Valid {
+		m.log(ctx).Infof("Ignoring %s of payment %s, idempotent key %s has expired", event.Type, payment.PaymentID, key)
+		return nil
+	} else if !samePayment {
+		// A late or redelivered failure of an earlier link must not fail the link issued after it
+		m.log(ctx).Infof("Ignoring %s of payment %s, idempotent key %s has moved on to another payment", event.Type, payment.PaymentID, key)
+		return nil
+	}
+
+	err := m.Transition_Payment_Status(ctx, key, paymentStatus, event.Type, map[string]interface{}{
+		"payment_id": payment.PaymentID,
+	})
+
+	if errors.Is(err, ErrInvalidPaymentTransition) && paymentStatus == models.PaymentStatusSucceeded {
+		// The session changed state, e.g. expired, after it was read
+		return m.refundUnexpectedCapture(ctx, key, idempotent.VenueID, current, payment.PaymentID)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	m.log(ctx).Infof("Payment %s for idempotent key %s marked as %s", payment.PaymentID, key, paymentStatus)
+
+	if paymentStatus == models.PaymentStatusSucceeded {
+
+		if err := m.Post_Payment_Journal(ctx, key, idempotent.VenueID, payment.PaymentID); err != nil {
+			return err
+		}
+
+		return m.Confirm_Booked_Seats(ctx, key)
+	}
+
+	// The customer may retry with a new payment link, which holds the seats again if they are still free
+
+	return m.Release_Seat_Holds(ctx, key)
+}
+
+// refundUnexpectedCapture refunds a payment captured for a session that cannot
+// take it any more, e.g. one that expired or was paid with another payment. The
+// capture is booked into the ledger first so the refund has something to reverse.
+func (m *Payment_Service) refundUnexpectedCapture(ctx context.Context, key string, venueID uint, current models.PaymentStatus, paymentID string) error {
+
+	m.log(ctx).Warnf("Payment %s captured for idempotent key %s in status %s, refunding it", paymentID, key, current)
+
+	if err := m.Post_Payment_Journal(ctx, key, venueID, paymentID); err != nil {
+		return err
+	}
+
+	gatewayCtx, cancel := m.gatewayContext(ctx)
+	payment, err := m.Gateway.GetPayment(gatewayCtx, paymentID)
+	cancel()
+
+	if err != nil {
+		m.log(ctx).Error("Failed to fetch payment details: ", err)
+		return fmt.Errorf("failed to fetch payment details: %w", err)
+	}
+
+	return m.refundPayment(ctx, key, payment.Customer.CustomerID, venueID, paymentID, "Booking session was no longer payable")
+}
+
+func (m *Payment_Service) handleRefundEvent(ctx context.Context, event WebhookEvent) error {
+
+	var refund RefundWebhookData
+
+	if err := json.Unmarshal(event.Data, &refund); err != nil {
+		return fmt.Errorf("failed to decode refund data: %w", err)
+	}
+
+	if event.Type != "refund.succeeded" {
+		m.log(ctx).Infof("Refund %s for payment %s is %s, partial: %t", refund.RefundID, refund.PaymentID, event.Type, refund.IsPartial)
+		return nil
+	}
+
+	idempotent, err := m.sessionByPaymentID(ctx, refund.PaymentID, event.Type)
+
+	if err != nil || idempotent == nil {
+		return err
+	}
+
+	ctx = logging.NewContext(ctx, m.log(ctx).WithField("idempotent_key", idempotent.IdempotentKey))
+
+	// Refunds issued through Refund_Payment are posted already and the entry is
+	// keyed by the refund, refunds issued at the provider are posted here
+
+	if err := m.Post_Refund_Journal(ctx, &gateway.Refund{
+		RefundID:  refund.RefundID,
+		PaymentID: refund.PaymentID,
+		Amount:    refund.Amount,
+		IsPartial: refund.IsPartial,
+		Status:    refund.Status,
+		Reason:    refund.Reason,
+	}, idempotent.IdempotentKey, idempotent.CustomerID, idempotent.VenueID, refund.Reason); err != nil {
+		return err
+	}
+
+	// Only a full refund changes the state of the booking, a partially
+	// refunded booking stays paid for the remaining seats
+
+	if refund.IsPartial {
+		m.log(ctx).Infof("Refund %s for payment %s is %s, partial: %t", refund.RefundID, refund.PaymentID, event.Type, refund.IsPartial)
+		return nil
+	}
+
+	return m.Transition_Payment_Status(ctx, idempotent.IdempotentKey, models.PaymentStatusRefunded, event.Type, nil)
+}
+
+func (m *Payment_Service) handleDisputeEvent(ctx context.Context, event WebhookEvent) error {
+
+	var dispute DisputeWebhookData
+
+	if err := json.Unmarshal(event.Data, &dispute); err != nil {
+		return fmt.Errorf("failed to decode dispute data: %w", err)
+	}
+
+	m.log(ctx).Infof("Dispute %s for payment %s is %s", dispute.DisputeID, dispute.PaymentID, dispute.DisputeStatus)
+
+	idempotent, err := m.sessionByPaymentID(ctx, dispute.PaymentID, event.Type)
+
+	if err != nil || idempotent == nil {
+		return err
+	}
+
+	ctx = logging.NewContext(ctx, m.log(ctx).WithField("idempotent_key", idempotent.IdempotentKey))
+
+	next := models.PaymentStatusDisputed
+
+	switch event.Type {
+	case "dispute.won", "dispute.cancelled", "dispute.expired":
+		// The dispute was closed in our favour, the payment stands
+		next = models.PaymentStatusSucceeded
+	case "dispute.lost", "dispute.accepted":
+		// The funds were returned to the customer, the entry is keyed by the
+		// dispute so a redelivery or a second closing event posts nothing
+		if err := m.Post_Dispute_Journal(ctx, dispute, idempotent.IdempotentKey, idempotent.CustomerID, idempotent.VenueID); err != nil {
+			return err
+		}
+
+		next = models.PaymentStatusRefunded
+	}
+
+	return m.Transition_Payment_Status(ctx, idempotent.IdempotentKey, next, event.Type, nil)
+}
+
+// sessionByPaymentID returns the session the payment belongs to, nil when there is none
+func (m *Payment_Service) sessionByPaymentID(ctx context.Context, paymentID string, reason string) (*models.Idempotent, error) {
+
+	var idempotent models.Idempotent
+
+	result := m.DB.WithContext(ctx).Unscoped().Select("idempotent_key", "customer_id", "venue_id").Where("payment_id = ?", paymentID).First(&idempotent)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			// A capture no session took, e.g. a second payment for a paid booking, is refunded
+			// when it arrives. Its refund and disputes have no session to update.
+			m.log(ctx).Warnf("No idempotent key found for payment %s, ignoring %s", paymentID, reason)
+			return nil, nil
+		}
+		m.log(ctx).Error("Error fetching idempotent key by payment ID: ", result.Error)
+		return nil, fmt.Errorf("error fetching idempotent key by payment ID: %w", result.Error)
+	}
+
+	return &idempotent, nil
+}
@@ -0,0 +1,401 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/kartik7120/booking_payment_service/cmd/api/auth"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	commitOrderIDsMethod = "/payment_service.PaymentService/CommitOrderIds"
+	createOrderMethod    = "/payment_service.PaymentService/CreateOrder"
+)
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// writeJWKS writes a JWKS file with the RSA key as kid rsa-1 and the Ed25519 key as kid ed-1
+func writeJWKS(t *testing.T, rsaKey *rsa.PrivateKey, edKey ed25519.PrivateKey) string {
+
+	document := map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa-1", "use": "sig", "n": b64(rsaKey.N.Bytes()), "e": b64(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{"kty": "OKP", "kid": "ed-1", "crv": "Ed25519", "x": b64(edKey.Public().(ed25519.PublicKey))},
+			{"kty": "RSA", "kid": "enc-1", "use": "enc", "n": "AQAB", "e": "AQAB"},
+		},
+	}
+
+	data, err := json.Marshal(document)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.RegisteredClaims) string {
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = kid
+
+	signed, err := token.SignedString(key)
+
+	if err != nil {
+		t.Fatalf("Failed to sign token: %v", err)
+	}
+
+	return signed
+}
+
+func TestAuthInterceptor(t *testing.T) {
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := auth.LoadKeySet(writeJWKS(t, rsaKey, edKey))
+
+	if err != nil {
+		t.Fatalf("Failed to load JWKS: %v", err)
+	}
+
+	if keys.Len() != 2 {
+		t.Errorf("Expected the encryption key to be skipped, got %d keys", keys.Len())
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	authenticator := &auth.Authenticator{
+		Keys:      keys,
+		Issuer:    "https://auth.example.com",
+		Audience:  "payment_service",
+		AllowMTLS: true,
+		Policy:    auth.DefaultPolicy(),
+		Public:    []string{"grpc.health.v1.Health"},
+		Now:       func() time.Time { return now },
+	}
+
+	claims := func(subject string) jwt.RegisteredClaims {
+		return jwt.RegisteredClaims{
+			Subject:   subject,
+			Issuer:    "https://auth.example.com",
+			Audience:  jwt.ClaimStrings{"payment_service"},
+			IssuedAt:  jwt.NewNumericDate(now.Add(-time.Minute)),
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Hour)),
+		}
+	}
+
+	bearer := func(token string) context.Context {
+		return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	}
+
+	expired := claims(auth.BookingGateway)
+	expired.ExpiresAt = jwt.NewNumericDate(now.Add(-time.Hour))
+
+	wrongIssuer := claims(auth.BookingGateway)
+	wrongIssuer.Issuer = "https://evil.example.com"
+
+	wrongAudience := claims(auth.BookingGateway)
+	wrongAudience.Audience = jwt.ClaimStrings{"ledger_service"}
+
+	noExpiry := claims(auth.BookingGateway)
+	noExpiry.ExpiresAt = nil
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		method  string
+		code    codes.Code
+		subject string
+	}{
+		{
+			name:    "RSAToken",
+			ctx:     bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims(auth.BookingGateway))),
+			method:  commitOrderIDsMethod,
+			code:    codes.OK,
+			subject: auth.BookingGateway,
+		},
+		{
+			name:    "Ed25519Token",
+			ctx:     bearer(signToken(t, jwt.SigningMethodEdDSA, "ed-1", edKey, claims("checkout-ui"))),
+			method:  createOrderMethod,
+			code:    codes.OK,
+			subject: "checkout-ui",
+		},
+		{
+			name:   "NoCredentials",
+			ctx:    context.Background(),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "NotBearer",
+			ctx:    metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Basic dXNlcjpwYXNz")),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "Expired",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, expired)),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "NoExpiry",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, noExpiry)),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "WrongIssuer",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, wrongIssuer)),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "WrongAudience",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, wrongAudience)),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "UnknownKey",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-2", rsaKey, claims(auth.BookingGateway))),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			// An HMAC token keyed with the public key must not pass as RS256
+			name:   "AlgorithmConfusion",
+			ctx:    bearer(signToken(t, jwt.SigningMethodHS256, "rsa-1", x509.MarshalPKCS1PublicKey(&rsaKey.PublicKey), claims(auth.BookingGateway))),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+		{
+			name:   "NotAllowedByPolicy",
+			ctx:    bearer(signToken(t, jwt.SigningMethodRS256, "rsa-1", rsaKey, claims("checkout-ui"))),
+			method: commitOrderIDsMethod,
+			code:   codes.PermissionDenied,
+		},
+		{
+			name:    "ClientCertificate",
+			ctx:     peer.NewContext(context.Background(), &peer.Peer{AuthInfo: verifiedTLS(auth.BookingGateway)}),
+			method:  commitOrderIDsMethod,
+			code:    codes.OK,
+			subject: auth.BookingGateway,
+		},
+		{
+			name:   "PublicHealthCheck",
+			ctx:    context.Background(),
+			method: "/grpc.health.v1.Health/Check",
+			code:   codes.OK,
+		},
+		{
+			name:   "UnverifiedClientCertificate",
+			ctx:    peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{}}),
+			method: createOrderMethod,
+			code:   codes.Unauthenticated,
+		},
+	}
+
+	interceptor := authenticator.UnaryServerInterceptor()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			var identity auth.Identity
+			var caller string
+			called := false
+
+			_, err := interceptor(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, func(ctx context.Context, req interface{}) (interface{}, error) {
+				called = true
+				identity, _ = auth.FromContext(ctx)
+				caller, _ = logging.FromContext(ctx).Data["caller"].(string)
+				return nil, nil
+			})
+
+			if got := status.Code(err); got != tt.code {
+				t.Fatalf("Expected code %s, got %s: %v", tt.code, got, err)
+			}
+
+			if called != (tt.code == codes.OK) {
+				t.Errorf("Expected the handler to be called only for authorized calls, called %t", called)
+			}
+
+			if identity.Subject != tt.subject {
+				t.Errorf("Expected caller %q, got %q", tt.subject, identity.Subject)
+			}
+
+			if caller != tt.subject {
+				t.Errorf("Expected the call to be logged for caller %q, got %q", tt.subject, caller)
+			}
+		})
+	}
+}
+
+func verifiedTLS(commonName string) credentials.TLSInfo {
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+
+	return credentials.TLSInfo{State: tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+}
+
+func TestAuthKeySet(t *testing.T) {
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecJWK := `{"kty":"EC","kid":"ec-1","crv":"P-256","x":"` + b64(ecKey.X.FillBytes(make([]byte, 32))) + `","y":"` + b64(ecKey.Y.FillBytes(make([]byte, 32))) + `"}`
+
+	if _, err := auth.ParseKeySet([]byte(`{"keys":[` + ecJWK + `]}`)); err != nil {
+		t.Errorf("Unexpected error for an EC key: %v", err)
+	}
+
+	for name, document := range map[string]string{
+		"Empty":        `{"keys":[]}`,
+		"MissingKid":   `{"keys":[{"kty":"OKP","crv":"Ed25519","x":"` + b64(make([]byte, 32)) + `"}]}`,
+		"DuplicateKid": `{"keys":[` + ecJWK + `,` + ecJWK + `]}`,
+		"ShortRSA":     `{"keys":[{"kty":"RSA","kid":"rsa-1","n":"` + b64(big.NewInt(1<<62).Bytes()) + `","e":"AQAB"}]}`,
+		"OffCurve":     `{"keys":[{"kty":"EC","kid":"ec-1","crv":"P-256","x":"AQ","y":"AQ"}]}`,
+		"Symmetric":    `{"keys":[{"kty":"oct","kid":"hmac-1","k":"c2VjcmV0"}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := auth.ParseKeySet([]byte(document)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestAuthPolicy(t *testing.T) {
+
+	t.Run("Default", func(t *testing.T) {
+		policy := auth.DefaultPolicy()
+
+		if policy.Allowed(commitOrderIDsMethod, "checkout-ui") || !policy.Allowed(commitOrderIDsMethod, auth.BookingGateway) {
+			t.Error("Expected CommitOrderIds to be limited to the booking gateway")
+		}
+
+		if !policy.Allowed(createOrderMethod, "checkout-ui") {
+			t.Error("Expected RPCs without a rule to be open to every caller")
+		}
+	})
+
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+
+		if err := os.WriteFile(path, []byte("CreateOrder: [checkout-ui]\nCommitOrderIds: [\"*\"]\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		policy, err := auth.LoadPolicy(path)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if policy.Allowed(createOrderMethod, auth.BookingGateway) || !policy.Allowed(commitOrderIDsMethod, "anyone") {
+			t.Errorf("Unexpected policy %v", policy)
+		}
+	})
+
+	t.Run("InvalidFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+
+		if err := os.WriteFile(path, []byte("/payment_service.PaymentService/CreateOrder: [checkout-ui]\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := auth.LoadPolicy(path); err == nil {
+			t.Error("Expected an error for a full method name")
+		}
+	})
+}
+
+func TestNewAuthenticator(t *testing.T) {
+
+	t.Run("RequiredInProduction", func(t *testing.T) {
+		if _, err := auth.NewAuthenticator(config.Default()); err == nil {
+			t.Error("Expected an error without a JWKS file in production")
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.AuthDisabled = true
+
+		a, err := auth.NewAuthenticator(cfg)
+
+		if err != nil || a != nil {
+			t.Errorf("Expected no authenticator, got %v %v", a, err)
+		}
+	})
+
+	t.Run("Development", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.Env = config.EnvDevelopment
+
+		a, err := auth.NewAuthenticator(cfg)
+
+		if err != nil || a != nil {
+			t.Errorf("Expected no authenticator without a JWKS file, got %v %v", a, err)
+		}
+	})
+	t.Run("ClientCertificatesInProduction", func(t *testing.T) {
+		cfg := config.Default()
+		cfg.TLSClientAuth = config.ClientAuthRequire
+
+		a, err := auth.NewAuthenticator(cfg)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if a == nil || !a.AllowMTLS || a.Keys != nil {
+			t.Errorf("Expected an authenticator accepting only client certificates, got %+v", a)
+		}
+	})
+}
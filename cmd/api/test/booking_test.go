@@ -0,0 +1,142 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestConfirmBookedSeats(t *testing.T) {
+
+	attempts, initial, max := server.BookSeatsMaxAttempts, server.BookSeatsInitialBackoff, server.BookSeatsMaxBackoff
+
+	server.BookSeatsMaxAttempts, server.BookSeatsInitialBackoff, server.BookSeatsMaxBackoff = 3, time.Millisecond, time.Millisecond
+
+	t.Cleanup(func() {
+		server.BookSeatsMaxAttempts, server.BookSeatsInitialBackoff, server.BookSeatsMaxBackoff = attempts, initial, max
+	})
+
+	unavailable := status.Error(codes.Unavailable, "movie DB is restarting")
+
+	tests := []struct {
+		name       string
+		ticketSent bool
+		claimed    bool
+		booked     *moviedb_service.BookSeatsResponse
+		bookErrs   []error
+		bookings   int
+		wantErr    error
+		refunded   bool
+	}{
+		{name: "Success", booked: &moviedb_service.BookSeatsResponse{Status: http.StatusOK}, bookings: 1},
+		{name: "RecoversFromUnavailable", booked: &moviedb_service.BookSeatsResponse{Status: http.StatusOK}, bookErrs: []error{unavailable}, bookings: 2},
+		{name: "RetriesExhausted", bookErrs: []error{unavailable, unavailable, unavailable}, bookings: 3},
+		{name: "SeatsTaken", booked: &moviedb_service.BookSeatsResponse{Status: http.StatusConflict, Error: "seat A1 is booked"}, bookings: 1, refunded: true},
+		{name: "AlreadyConfirmed", ticketSent: true},
+		{name: "ClaimedByAnotherDelivery", claimed: true, wantErr: server.ErrPaymentStatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			movieDB := &seatCheckMovieDB{booked: tt.booked, bookErrs: tt.bookErrs}
+
+			env := newRPCEnv(t, movieDB)
+
+			payment := fakePayment(t, env.gateway)
+
+			if err := env.gateway.SucceedPayment(payment.PaymentID); err != nil {
+				t.Fatalf("Failed to capture payment: %v", err)
+			}
+
+			env.mock.ExpectQuery(`SELECT \* FROM "idempotents" WHERE idempotent_key = \$1`).WillReturnRows(sessionRows(map[string]interface{}{
+				"id":                 1,
+				"idempotent_key":     "key-1",
+				"customer_id":        payment.Customer.CustomerID,
+				"payment_status":     string(models.PaymentStatusSucceeded),
+				"payment_id":         payment.PaymentID,
+				"booked_seats_id":    "{11,12}",
+				"movie_time_slot_id": 7,
+				"is_ticket_sent":     tt.ticketSent,
+			}))
+
+			if !tt.ticketSent {
+				claim := env.mock.ExpectExec(`UPDATE "idempotents" SET "seats_claimed_until"=\$1.* AND \(seats_claimed_until IS NULL OR seats_claimed_until < \$\d\)`)
+
+				if tt.claimed {
+					claim.WillReturnResult(sqlmock.NewResult(0, 0))
+				} else {
+					claim.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+
+			switch {
+			case tt.ticketSent || tt.claimed:
+			case tt.refunded:
+				env.mock.ExpectBegin()
+				env.mock.ExpectExec(`UPDATE "booked_seats" SET "hold_key"`).WillReturnResult(sqlmock.NewResult(0, 2))
+				env.mock.ExpectExec(`UPDATE "idempotents" SET "refunded_seats_id"=booked_seats_id,"seats_claimed_until"=\$1`).WithArgs(nil, sqlmock.AnyArg(), "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+				env.mock.ExpectCommit()
+				expectJournalEntry(env.mock, 2)
+			case tt.booked == nil:
+				env.mock.ExpectExec(`UPDATE "idempotents" SET "seats_claimed_until"=\$1`).WithArgs(nil, sqlmock.AnyArg(), "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+			default:
+				env.mock.ExpectBegin()
+				env.mock.ExpectExec(`UPDATE "booked_seats" SET "is_booked"`).WillReturnResult(sqlmock.NewResult(0, 2))
+				env.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(models.PaymentStatusSucceeded), "INR", 0),
+				)
+				env.mock.ExpectExec(`UPDATE "idempotents" SET .*"is_ticket_sent"=\$\d.*"seats_claimed_until"=\$\d`).WillReturnResult(sqlmock.NewResult(0, 1))
+				env.mock.ExpectCommit()
+			}
+
+			err := env.server.Ps.Confirm_Booked_Seats(context.Background(), "key-1")
+
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+			case tt.booked == nil && tt.bookings > 0:
+				if status.Code(errors.Unwrap(err)) != codes.Unavailable {
+					t.Fatalf("Expected the last unavailable error, got %v", err)
+				}
+			case err != nil:
+				t.Fatalf("Expected the seats to be confirmed, got %v", err)
+			}
+
+			if len(movieDB.bookings) != tt.bookings {
+				t.Fatalf("Expected %d calls to BookSeats, got %d", tt.bookings, len(movieDB.bookings))
+			}
+
+			for _, booking := range movieDB.bookings {
+				if len(booking.Seats) != 2 || booking.MovieTimeSlotId != 7 || booking.Email != "asha@example.com" {
+					t.Fatalf("Unexpected booking request: %v", booking)
+				}
+			}
+
+			captured, err := env.gateway.GetPayment(context.Background(), payment.PaymentID)
+
+			if err != nil {
+				t.Fatalf("Failed to fetch payment: %v", err)
+			}
+
+			if refunded := len(captured.Refunds) > 0; refunded != tt.refunded {
+				t.Fatalf("Expected refunded %v, got %v", tt.refunded, refunded)
+			}
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
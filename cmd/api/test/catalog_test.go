@@ -0,0 +1,202 @@
+package test
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+)
+
+func TestCartItems(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		productIDs []string
+		want       []gateway.CartItem
+	}{
+		{name: "Empty", productIDs: nil, want: nil},
+		{name: "OneSeat", productIDs: []string{"pdt_1"}, want: []gateway.CartItem{{ProductID: "pdt_1", Quantity: 1}}},
+		{
+			name:       "SharedProducts",
+			productIDs: []string{"pdt_1", "pdt_2", "pdt_1", "pdt_1"},
+			want:       []gateway.CartItem{{ProductID: "pdt_1", Quantity: 3}, {ProductID: "pdt_2", Quantity: 1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := server.CartItems(tt.productIDs); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Expected %+v, got %+v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestCatalogKey(t *testing.T) {
+
+	base := server.CatalogKey("Dune", "VIP", money.New(25000, money.INR))
+
+	if server.CatalogKey(" dune ", "vip", money.New(25000, money.INR)) != base {
+		t.Error("Expected the key to ignore case and surrounding spaces")
+	}
+
+	others := []string{
+		server.CatalogKey("Dune 2", "VIP", money.New(25000, money.INR)),
+		server.CatalogKey("Dune", "NORMAL", money.New(25000, money.INR)),
+		server.CatalogKey("Dune", "VIP", money.New(30000, money.INR)),
+		server.CatalogKey("Dune", "VIP", money.New(25000, money.USD)),
+	}
+
+	for i, other := range others {
+		if other == base {
+			t.Errorf("Expected key %d to differ from the base key", i)
+		}
+	}
+}
+
+func TestCatalogLineKey(t *testing.T) {
+
+	base := server.CatalogLineKey("Dune", "VIP", money.INR)
+
+	if server.CatalogLineKey(" DUNE ", "vip", money.INR) != base {
+		t.Error("Expected the line key to ignore case and surrounding spaces")
+	}
+
+	if server.CatalogLineKey("Dune", "NORMAL", money.INR) == base || server.CatalogLineKey("Dune", "VIP", money.USD) == base {
+		t.Error("Expected another seat type or currency to be another line")
+	}
+}
+
+func TestCatalogProduct(t *testing.T) {
+
+	columns := []string{"id", "catalog_key", "line_key", "movie_name", "seat_type", "price_amount", "price_currency", "version", "active", "product_id"}
+
+	price := money.New(25000, money.INR)
+	key := server.CatalogKey("Dune", "VIP", price)
+	line := server.CatalogLineKey("Dune", "VIP", money.INR)
+
+	duplicate := &pgconn.PgError{Code: "23505", Message: "duplicate key value violates unique constraint"}
+
+	// expectVersion scripts numbering a new version after latest, insertErr fails the insert
+	expectVersion := func(env *rpcEnv, latest int, insertErr error) {
+		env.mock.ExpectBegin()
+
+		versions := sqlmock.NewRows(columns)
+
+		if latest > 0 {
+			versions.AddRow(1, "old", line, "dune", "VIP", 30000, money.INR, latest, true, "pdt_old")
+		}
+
+		env.mock.ExpectQuery(`SELECT \* FROM "catalog_products" WHERE line_key = \$1 .*ORDER BY version DESC`).WithArgs(line, sqlmock.AnyArg()).WillReturnRows(versions)
+		env.mock.ExpectExec(`UPDATE "catalog_products" SET "active"=\$1,"updated_at"=\$2 WHERE line_key = \$3`).WillReturnResult(sqlmock.NewResult(0, int64(latest)))
+
+		insert := env.mock.ExpectQuery(`INSERT INTO "catalog_products"`).WithArgs(
+			sqlmock.AnyArg(), sqlmock.AnyArg(), nil, key, line, "Dune", "VIP", price.Amount, price.Currency, latest+1, true, sqlmock.AnyArg(),
+		)
+
+		if insertErr != nil {
+			insert.WillReturnError(insertErr)
+			env.mock.ExpectRollback()
+			return
+		}
+
+		insert.WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+		env.mock.ExpectCommit()
+	}
+
+	tests := []struct {
+		name        string
+		script      func(env *rpcEnv)
+		wantVersion int
+		wantProduct string
+	}{
+		{
+			name: "CurrentPrice",
+			script: func(env *rpcEnv) {
+				env.mock.ExpectQuery(`SELECT \* FROM "catalog_products" WHERE catalog_key = \$1`).WillReturnRows(
+					sqlmock.NewRows(columns).AddRow(1, key, line, "Dune", "VIP", price.Amount, price.Currency, 1, true, "pdt_current"),
+				)
+			},
+			wantVersion: 1,
+			wantProduct: "pdt_current",
+		},
+		{
+			name: "EarlierPrice",
+			script: func(env *rpcEnv) {
+				env.mock.ExpectQuery(`SELECT \* FROM "catalog_products" WHERE catalog_key = \$1`).WillReturnRows(
+					sqlmock.NewRows(columns).AddRow(1, key, line, "Dune", "VIP", price.Amount, price.Currency, 1, false, "pdt_earlier"),
+				)
+				env.mock.ExpectBegin()
+				env.mock.ExpectExec(`UPDATE "catalog_products" SET "active"=\$1,"updated_at"=\$2 WHERE \(line_key = \$3 AND active AND id <> \$4\)`).
+					WithArgs(false, sqlmock.AnyArg(), line, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				env.mock.ExpectExec(`UPDATE "catalog_products" SET "active"=\$1,"updated_at"=\$2 WHERE id = \$3`).
+					WithArgs(true, sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+				env.mock.ExpectCommit()
+			},
+			wantVersion: 1,
+			wantProduct: "pdt_earlier",
+		},
+		{
+			name: "NewPrice",
+			script: func(env *rpcEnv) {
+				env.expectCatalogMiss()
+				expectVersion(env, 1, nil)
+			},
+			wantVersion: 2,
+		},
+		{
+			name: "CreatedConcurrently",
+			script: func(env *rpcEnv) {
+				env.expectCatalogMiss()
+				expectVersion(env, 1, duplicate)
+				env.mock.ExpectQuery(`SELECT \* FROM "catalog_products" WHERE catalog_key = \$1`).WillReturnRows(
+					sqlmock.NewRows(columns).AddRow(3, key, line, "Dune", "VIP", price.Amount, price.Currency, 2, true, "pdt_theirs"),
+				)
+			},
+			wantVersion: 2,
+			wantProduct: "pdt_theirs",
+		},
+		{
+			name: "OtherPriceTookTheVersion",
+			script: func(env *rpcEnv) {
+				env.expectCatalogMiss()
+				expectVersion(env, 1, duplicate)
+				env.expectCatalogMiss()
+				expectVersion(env, 2, nil)
+			},
+			wantVersion: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			tt.script(env)
+
+			product, err := env.server.Ps.Catalog_Product(context.Background(), "Dune", "VIP", price)
+
+			if err != nil {
+				t.Fatalf("Expected a catalog product, got %v", err)
+			}
+
+			if product.Version != tt.wantVersion || !product.Active {
+				t.Errorf("Expected active version %d, got version %d active %v", tt.wantVersion, product.Version, product.Active)
+			}
+
+			if tt.wantProduct != "" && product.ProductID != tt.wantProduct {
+				t.Errorf("Expected product %s, got %s", tt.wantProduct, product.ProductID)
+			}
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Fatalf("Unmet database expectations: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// hangingMovieDB answers IsValidToCommitSeatsForBooking only once the context of the call is done
+type hangingMovieDB struct {
+	moviedb_service.MovieDBServiceClient
+	done chan error
+}
+
+func (m *hangingMovieDB) IsValidToCommitSeatsForBooking(ctx context.Context, in *moviedb_service.IsValidToCommitSeatsForBooking_Request, opts ...grpc.CallOption) (*moviedb_service.IsValidToCommitSeatsForBooking_Response, error) {
+
+	<-ctx.Done()
+
+	m.done <- ctx.Err()
+
+	return nil, status.FromContextError(ctx.Err()).Err()
+}
+
+func TestContextPropagation(t *testing.T) {
+
+	newServer := func(t *testing.T, cfg *config.Config, movieDB moviedb_service.MovieDBServiceClient) *server.Payment_Server {
+		db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=unused"}), &gorm.Config{DisableAutomaticPing: true})
+
+		if err != nil {
+			t.Fatalf("Failed to open database handle: %v", err)
+		}
+
+		ps, err := server.NewPaymentServer(cfg,
+			server.WithGateway(gatewaytest.NewFakeGateway(nil)),
+			server.WithDB(db),
+			server.WithMovieDB(movieDB),
+		)
+
+		if err != nil {
+			t.Fatalf("Failed to create payment server: %v", err)
+		}
+
+		return ps
+	}
+
+	request := &payment_service.Create_Order_Request{IdempotentKey: "key-1", MovieTimeSlotId: 1, SeatMatrixIDs: []int32{1}}
+
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		cancel  bool
+		want    error
+		code    codes.Code
+	}{
+		{name: "MovieDBTimeout", timeout: 20 * time.Millisecond, want: context.DeadlineExceeded, code: codes.Unavailable},
+		{name: "CallerCanceled", timeout: time.Minute, cancel: true, want: context.Canceled, code: codes.Canceled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cfg := config.Default()
+			cfg.MovieDBTimeout = tt.timeout
+
+			movieDB := &hangingMovieDB{done: make(chan error, 1)}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			if tt.cancel {
+				time.AfterFunc(20*time.Millisecond, cancel)
+			}
+
+			start := time.Now()
+
+			_, err := newServer(t, cfg, movieDB).CreateOrder(ctx, request)
+
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("Expected the call to stop early, took %s", elapsed)
+			}
+
+			if got := <-movieDB.done; got != tt.want {
+				t.Errorf("Expected the movie DB call to end with %v, got %v", tt.want, got)
+			}
+
+			if status.Code(err) != tt.code {
+				t.Errorf("Expected %s, got %v", tt.code, err)
+			}
+		})
+	}
+}
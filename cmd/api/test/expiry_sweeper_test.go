@@ -0,0 +1,239 @@
+package test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+)
+
+func TestNewExpirySweeper(t *testing.T) {
+
+	t.Run("Valid", func(t *testing.T) {
+		sweeper, err := server.NewExpirySweeper(&server.Payment_Service{}, 30*time.Second, 25)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if sweeper.Interval != 30*time.Second || sweeper.BatchSize != 25 {
+			t.Errorf("Got interval %s and batch size %d", sweeper.Interval, sweeper.BatchSize)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if _, err := server.NewExpirySweeper(&server.Payment_Service{}, -time.Second, 25); err == nil {
+			t.Error("Expected an error for a negative interval")
+		}
+
+		if _, err := server.NewExpirySweeper(&server.Payment_Service{}, time.Second, 0); err == nil {
+			t.Error("Expected an error for an empty batch")
+		}
+	})
+}
+
+// expectExpiry scripts expiring a session that is still in the given state
+func expectExpiry(mock sqlmock.Sqlmock, from models.PaymentStatus) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(from), money.INR, 0),
+	)
+	mock.ExpectExec(`UPDATE "idempotents" SET "payment_status"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(`INSERT INTO "payment_status_histories"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec(`UPDATE "booked_seats"`).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec(`UPDATE "idempotents" SET "deleted_at"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+func expiredSessions(sessions ...[]driver.Value) *sqlmock.Rows {
+
+	rows := sqlmock.NewRows([]string{"id", "idempotent_key", "payment_status", "payment_id", "expired_at"})
+
+	for _, s := range sessions {
+		rows.AddRow(s...)
+	}
+
+	return rows
+}
+
+// sweepArgs matches the arguments of a batch of one looking at sessions after the given ID
+func sweepArgs(after uint) []driver.Value {
+
+	args := []driver.Value{after, sqlmock.AnyArg()}
+
+	for range models.ExpirablePaymentStatuses() {
+		args = append(args, sqlmock.AnyArg())
+	}
+
+	return append(args, 1)
+}
+
+func TestExpireSessions(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		status  models.PaymentStatus
+		payment func(*testing.T, *gatewaytest.FakeGateway) string
+		overdue time.Duration
+		expired int
+	}{
+		{
+			name:    "NoPaymentYet",
+			status:  models.PaymentStatusOrderCreated,
+			expired: 1,
+		},
+		{
+			name:   "LinkStillPayable",
+			status: models.PaymentStatusLinkIssued,
+			payment: func(t *testing.T, fake *gatewaytest.FakeGateway) string {
+				return fakePayment(t, fake).PaymentID
+			},
+		},
+		{
+			name:   "PaidMeanwhile",
+			status: models.PaymentStatusLinkIssued,
+			payment: func(t *testing.T, fake *gatewaytest.FakeGateway) string {
+				payment := fakePayment(t, fake)
+
+				if err := fake.SucceedPayment(payment.PaymentID); err != nil {
+					t.Fatalf("Failed to settle payment: %v", err)
+				}
+
+				return payment.PaymentID
+			},
+		},
+		{
+			name:   "PaymentClosed",
+			status: models.PaymentStatusLinkIssued,
+			payment: func(t *testing.T, fake *gatewaytest.FakeGateway) string {
+				payment := fakePayment(t, fake)
+
+				if err := fake.FailPayment(payment.PaymentID); err != nil {
+					t.Fatalf("Failed to settle payment: %v", err)
+				}
+
+				return payment.PaymentID
+			},
+			expired: 1,
+		},
+		{
+			name:   "OpenPastGrace",
+			status: models.PaymentStatusLinkIssued,
+			payment: func(t *testing.T, fake *gatewaytest.FakeGateway) string {
+				return "pay_unknown"
+			},
+			overdue: server.OpenPaymentGrace + time.Minute,
+			expired: 1,
+		},
+		{
+			name:   "ProviderDoesNotKnowPayment",
+			status: models.PaymentStatusFailed,
+			payment: func(t *testing.T, fake *gatewaytest.FakeGateway) string {
+				return "pay_unknown"
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			var paymentID driver.Value
+
+			if tt.payment != nil {
+				paymentID = tt.payment(t, env.gateway)
+			}
+
+			now := time.Now()
+			expiredAt := now.Add(-time.Minute - tt.overdue)
+
+			env.mock.ExpectQuery(`SELECT "id","idempotent_key","payment_status","payment_id","expired_at" FROM "idempotents"`).
+				WillReturnRows(expiredSessions([]driver.Value{1, "key-1", string(tt.status), paymentID, expiredAt}))
+
+			if tt.expired > 0 {
+				expectExpiry(env.mock, tt.status)
+			}
+
+			expired, next, err := env.server.Ps.Expire_Sessions(context.Background(), now, 0, 10)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if expired != tt.expired || next != 0 {
+				t.Errorf("Expected %d expired and no next batch, got %d expired and next %d", tt.expired, expired, next)
+			}
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Database calls did not match: %v", err)
+			}
+		})
+	}
+
+	t.Run("ChangedWhileExpiring", func(t *testing.T) {
+
+		env := newRPCEnv(t, &seatCheckMovieDB{})
+
+		expiredAt := time.Now().Add(-time.Minute)
+
+		env.mock.ExpectQuery(`SELECT "id","idempotent_key","payment_status","payment_id","expired_at" FROM "idempotents"`).
+			WillReturnRows(expiredSessions([]driver.Value{1, "key-1", string(models.PaymentStatusPending), nil, expiredAt}))
+		env.mock.ExpectBegin()
+		env.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+			sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(models.PaymentStatusSucceeded), money.INR, 0),
+		)
+		env.mock.ExpectRollback()
+
+		expired, _, err := env.server.Ps.Expire_Sessions(context.Background(), time.Now(), 0, 10)
+
+		if err != nil || expired != 0 {
+			t.Errorf("Expected the paid session to be skipped, got %d expired and %v", expired, err)
+		}
+
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Database calls did not match: %v", err)
+		}
+	})
+
+	t.Run("KeptSessionsDoNotBlockTheSweep", func(t *testing.T) {
+
+		env := newRPCEnv(t, &seatCheckMovieDB{})
+
+		payable := fakePayment(t, env.gateway)
+		expiredAt := time.Now().Add(-time.Minute)
+
+		sweeper, err := server.NewExpirySweeper(env.server.Ps, time.Minute, 1)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		env.mock.ExpectQuery(`SELECT "id","idempotent_key","payment_status","payment_id","expired_at" FROM "idempotents" WHERE \(id > \$1`).
+			WithArgs(sweepArgs(0)...).
+			WillReturnRows(expiredSessions([]driver.Value{4, "key-4", string(models.PaymentStatusLinkIssued), payable.PaymentID, expiredAt}))
+		env.mock.ExpectQuery(`SELECT "id","idempotent_key","payment_status","payment_id","expired_at" FROM "idempotents" WHERE \(id > \$1`).
+			WithArgs(sweepArgs(4)...).
+			WillReturnRows(expiredSessions([]driver.Value{9, "key-9", string(models.PaymentStatusPending), nil, expiredAt}))
+		expectExpiry(env.mock, models.PaymentStatusPending)
+		env.mock.ExpectQuery(`SELECT "id","idempotent_key","payment_status","payment_id","expired_at" FROM "idempotents" WHERE \(id > \$1`).
+			WithArgs(sweepArgs(9)...).
+			WillReturnRows(expiredSessions())
+
+		total, err := sweeper.Sweep(context.Background())
+
+		if err != nil || total != 1 {
+			t.Errorf("Expected 1 session expired, got %d and %v", total, err)
+		}
+
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("Database calls did not match: %v", err)
+		}
+	})
+}
@@ -0,0 +1,92 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/fx"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+)
+
+func TestStaticRates(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "rates.json")
+
+	if err := os.WriteFile(path, []byte(`{"base": "INR", "rates": {"USD": "0.012", "jpy": "1.8"}}`), 0o600); err != nil {
+		t.Fatalf("Failed to write rates file: %v", err)
+	}
+
+	rates, err := fx.LoadStaticRates(path)
+
+	if err != nil {
+		t.Fatalf("Failed to load rates: %v", err)
+	}
+
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		in   money.Money
+		to   string
+		want money.Money
+	}{
+		{name: "SameCurrency", in: money.New(25000, money.INR), to: money.INR, want: money.New(25000, money.INR)},
+		{name: "FromBase", in: money.New(25000, money.INR), to: money.USD, want: money.New(300, money.USD)},
+		{name: "ToBase", in: money.New(300, money.USD), to: money.INR, want: money.New(25000, money.INR)},
+		{name: "ZeroDecimalCurrency", in: money.New(25000, money.INR), to: money.JPY, want: money.New(450, money.JPY)},
+		{name: "CrossRate", in: money.New(300, money.USD), to: money.JPY, want: money.New(450, money.JPY)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := fx.Convert(ctx, rates, tt.in, tt.to)
+
+			if err != nil || got != tt.want {
+				t.Fatalf("Convert(%s, %s) = %v, %v, want %v", tt.in, tt.to, got, err, tt.want)
+			}
+		})
+	}
+
+	t.Run("MissingRate", func(t *testing.T) {
+		if _, err := fx.Convert(ctx, rates, money.New(100, money.INR), money.EUR); !errors.Is(err, fx.ErrRateNotFound) {
+			t.Fatalf("Expected a missing rate, got %v", err)
+		}
+
+		if _, err := fx.Convert(ctx, nil, money.New(100, money.INR), money.USD); !errors.Is(err, fx.ErrRateNotFound) {
+			t.Fatalf("Expected a missing provider to be reported, got %v", err)
+		}
+	})
+
+	t.Run("InvalidFile", func(t *testing.T) {
+		if _, err := fx.ParseStaticRates([]byte(`{"base": "INR", "rates": {"USD": "-1"}}`)); err == nil {
+			t.Fatal("Expected a negative rate to be rejected")
+		}
+
+		if _, err := fx.ParseStaticRates([]byte(`{"base": "XXX"}`)); err == nil {
+			t.Fatal("Expected an unknown base currency to be rejected")
+		}
+	})
+}
+
+func TestCurrencyFromProto(t *testing.T) {
+
+	for value, name := range payment_service.Currency_name {
+		code, err := money.CurrencyFromProto(payment_service.Currency(value))
+
+		if err != nil || code != name {
+			t.Errorf("Currency %s mapped to %q, %v", name, code, err)
+		}
+
+		if _, err := money.HomeCountry(code); err != nil {
+			t.Errorf("Currency %s has no home country: %v", name, err)
+		}
+	}
+
+	if _, err := money.CurrencyFromProto(payment_service.Currency(99)); !errors.Is(err, money.ErrUnknownCurrency) {
+		t.Errorf("Expected an unknown enum value to be rejected, got %v", err)
+	}
+}
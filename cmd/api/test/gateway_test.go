@@ -0,0 +1,137 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+)
+
+func TestFakeGateway(t *testing.T) {
+
+	secret := []byte("fake-gateway-secret")
+	ctx := context.Background()
+
+	var received []server.WebhookEvent
+
+	f := gatewaytest.NewFakeGateway(secret)
+	f.Webhooks = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		if err := server.VerifyWebhookSignature(secret, r.Header, body, time.Now(), server.DefaultWebhookTolerance); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+
+		var event server.WebhookEvent
+		json.Unmarshal(body, &event)
+		received = append(received, event)
+	})
+
+	customer, err := f.CreateCustomer(ctx, gateway.CustomerParams{Email: "jane@example.com", Name: "Jane", PhoneNumber: "+919999999999"})
+
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+
+	first, _ := f.CreateProduct(ctx, gateway.ProductParams{Name: "Movie - A1", Price: money.New(25000, money.INR)})
+	second, _ := f.CreateProduct(ctx, gateway.ProductParams{Name: "Movie - A2", Price: money.New(25000, money.INR)})
+
+	payment, err := f.CreatePayment(ctx, gateway.PaymentParams{
+		CustomerID:  customer.CustomerID,
+		ProductCart: []gateway.CartItem{{ProductID: first.ProductID, Quantity: 1}, {ProductID: second.ProductID, Quantity: 1}},
+		Currency:    "INR",
+		Metadata:    map[string]string{"idempotent_key": "key-1"},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+
+	if payment.PaymentLink == "" || payment.TotalAmount != money.New(50000, money.INR) {
+		t.Fatalf("Unexpected payment: %+v", payment)
+	}
+
+	t.Run("RefundBeforePayment", func(t *testing.T) {
+		if _, err := f.CreateRefund(ctx, gateway.RefundParams{PaymentID: payment.PaymentID}); err == nil {
+			t.Fatal("Expected refund of an unpaid payment to fail")
+		}
+	})
+
+	t.Run("SucceedPaymentEmitsWebhook", func(t *testing.T) {
+		if err := f.SucceedPayment(payment.PaymentID); err != nil {
+			t.Fatalf("Failed to succeed payment: %v", err)
+		}
+
+		if len(received) != 1 || received[0].Type != "payment.succeeded" {
+			t.Fatalf("Expected a payment.succeeded event, got %+v", received)
+		}
+
+		var data server.PaymentDetail
+		json.Unmarshal(received[0].Data, &data)
+
+		if data.Metadata["idempotent_key"] != "key-1" || data.PaymentID != payment.PaymentID || data.TotalAmount != payment.TotalAmount {
+			t.Fatalf("Unexpected payment data: %+v", data)
+		}
+	})
+
+	t.Run("PartialThenFullRefund", func(t *testing.T) {
+		partial, err := f.CreateRefund(ctx, gateway.RefundParams{
+			PaymentID: payment.PaymentID,
+			Items:     []gateway.RefundItem{{ItemID: first.ProductID}},
+		})
+
+		if err != nil || !partial.IsPartial || partial.Amount != money.New(25000, money.INR) {
+			t.Fatalf("Unexpected partial refund %+v, err: %v", partial, err)
+		}
+
+		if _, err := f.CreateRefund(ctx, gateway.RefundParams{PaymentID: payment.PaymentID}); err == nil {
+			t.Fatal("Expected refund above the remaining amount to fail")
+		}
+
+		rest, err := f.CreateRefund(ctx, gateway.RefundParams{
+			PaymentID: payment.PaymentID,
+			Items:     []gateway.RefundItem{{ItemID: second.ProductID}},
+		})
+
+		if err != nil || rest.IsPartial {
+			t.Fatalf("Expected the remaining refund to complete the payment, got %+v, err: %v", rest, err)
+		}
+
+		stored, _ := f.GetPayment(ctx, payment.PaymentID)
+
+		if len(stored.Refunds) != 2 {
+			t.Fatalf("Expected 2 refunds, got %d", len(stored.Refunds))
+		}
+	})
+
+	t.Run("InjectedFailure", func(t *testing.T) {
+		unavailable := errors.New("gateway unavailable")
+
+		f.FailWith("CreateCustomer", unavailable)
+
+		if _, err := f.CreateCustomer(ctx, gateway.CustomerParams{}); !errors.Is(err, unavailable) {
+			t.Fatalf("Expected injected error, got %v", err)
+		}
+
+		f.FailWith("CreateCustomer", nil)
+
+		if _, err := f.CreateCustomer(ctx, gateway.CustomerParams{}); err != nil {
+			t.Fatalf("Expected failure to be cleared, got %v", err)
+		}
+	})
+
+	for _, event := range f.Emitted() {
+		if event.StatusCode != http.StatusOK {
+			t.Errorf("Webhook %s was rejected with status %d", event.Type, event.StatusCode)
+		}
+	}
+}
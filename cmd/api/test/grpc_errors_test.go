@@ -0,0 +1,220 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// seatCheckMovieDB answers IsValidToCommitSeatsForBooking with a fixed response or error
+type seatCheckMovieDB struct {
+	moviedb_service.MovieDBServiceClient
+	response *moviedb_service.IsValidToCommitSeatsForBooking_Response
+	err      error
+
+	// GetSeatMatrix answers with seats for every venue
+	seats []*moviedb_service.SeatMatrix
+
+	// BookSeats answers with booked until bookErrs runs out
+	booked   *moviedb_service.BookSeatsResponse
+	bookErrs []error
+	bookings []*moviedb_service.BookSeatsRequest
+}
+
+func (m *seatCheckMovieDB) IsValidToCommitSeatsForBooking(ctx context.Context, in *moviedb_service.IsValidToCommitSeatsForBooking_Request, opts ...grpc.CallOption) (*moviedb_service.IsValidToCommitSeatsForBooking_Response, error) {
+	return m.response, m.err
+}
+
+func (m *seatCheckMovieDB) GetSeatMatrix(ctx context.Context, in *moviedb_service.GetSeatMatrixRequest, opts ...grpc.CallOption) (*moviedb_service.GetSeatMatrixResponse, error) {
+	return &moviedb_service.GetSeatMatrixResponse{Status: http.StatusOK, Seats: m.seats}, nil
+}
+
+func (m *seatCheckMovieDB) BookSeats(ctx context.Context, in *moviedb_service.BookSeatsRequest, opts ...grpc.CallOption) (*moviedb_service.BookSeatsResponse, error) {
+
+	m.bookings = append(m.bookings, in)
+
+	if len(m.bookErrs) > 0 {
+		err := m.bookErrs[0]
+		m.bookErrs = m.bookErrs[1:]
+		return nil, err
+	}
+
+	return m.booked, nil
+}
+
+func TestGRPCErrors(t *testing.T) {
+
+	newServer := func(t *testing.T, movieDB moviedb_service.MovieDBServiceClient) *server.Payment_Server {
+		db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=unused"}), &gorm.Config{DisableAutomaticPing: true})
+
+		if err != nil {
+			t.Fatalf("Failed to open database handle: %v", err)
+		}
+
+		ps, err := server.NewPaymentServer(config.Default(),
+			server.WithGateway(gatewaytest.NewFakeGateway(nil)),
+			server.WithDB(db),
+			server.WithMovieDB(movieDB),
+		)
+
+		if err != nil {
+			t.Fatalf("Failed to create payment server: %v", err)
+		}
+
+		return ps
+	}
+
+	validOrder := func() *payment_service.Create_Order_Request {
+		return &payment_service.Create_Order_Request{
+			IdempotentKey:   "key-1",
+			MovieTimeSlotId: 1,
+			SeatMatrixIDs:   []int32{1, 2},
+		}
+	}
+
+	tests := []struct {
+		name         string
+		movieDB      *seatCheckMovieDB
+		request      func(*payment_service.Create_Order_Request)
+		code         codes.Code
+		reason       string
+		legacyStatus int32
+		field        string
+	}{
+		{
+			name:         "MissingIdempotentKey",
+			request:      func(r *payment_service.Create_Order_Request) { r.IdempotentKey = "" },
+			code:         codes.InvalidArgument,
+			reason:       "INVALID_ARGUMENT",
+			legacyStatus: 400,
+			field:        "idempotent_key",
+		},
+		{
+			name:         "MissingSeats",
+			request:      func(r *payment_service.Create_Order_Request) { r.SeatMatrixIDs = nil },
+			code:         codes.InvalidArgument,
+			reason:       "INVALID_ARGUMENT",
+			legacyStatus: 400,
+			field:        "seat_matrix_ids",
+		},
+		{
+			name:         "UnsupportedCurrency",
+			request:      func(r *payment_service.Create_Order_Request) { r.Currency = payment_service.Currency(999) },
+			code:         codes.InvalidArgument,
+			reason:       "UNSUPPORTED_CURRENCY",
+			legacyStatus: 400,
+		},
+		{
+			name:         "MovieDBUnavailable",
+			movieDB:      &seatCheckMovieDB{err: status.Error(codes.Unavailable, "connection refused")},
+			code:         codes.Unavailable,
+			reason:       "MOVIEDB_UNAVAILABLE",
+			legacyStatus: 503,
+		},
+		{
+			name:         "SeatsAlreadyBooked",
+			movieDB:      &seatCheckMovieDB{response: &moviedb_service.IsValidToCommitSeatsForBooking_Response{Isvalid: false, Error: "seat A1 is booked"}},
+			code:         codes.AlreadyExists,
+			reason:       "SEATS_UNAVAILABLE",
+			legacyStatus: 409,
+		},
+		{
+			name:         "MovieDBInternalError",
+			movieDB:      &seatCheckMovieDB{err: status.Error(codes.Internal, "boom")},
+			code:         codes.Internal,
+			reason:       "INTERNAL",
+			legacyStatus: 500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			movieDB := tt.movieDB
+
+			if movieDB == nil {
+				movieDB = &seatCheckMovieDB{}
+			}
+
+			request := validOrder()
+
+			if tt.request != nil {
+				tt.request(request)
+			}
+
+			response, err := newServer(t, movieDB).CreateOrder(context.Background(), request)
+
+			if response != nil {
+				t.Errorf("Expected no response together with an error, got %v", response)
+			}
+
+			st, ok := status.FromError(err)
+
+			if !ok {
+				t.Fatalf("Expected a gRPC status error, got %v", err)
+			}
+
+			if st.Code() != tt.code {
+				t.Errorf("Expected code %s, got %s: %s", tt.code, st.Code(), st.Message())
+			}
+
+			var info *errdetails.ErrorInfo
+			var legacy *payment_service.Create_Order_Response
+			var badRequest *errdetails.BadRequest
+
+			for _, detail := range st.Details() {
+				switch d := detail.(type) {
+				case *errdetails.ErrorInfo:
+					info = d
+				case *payment_service.Create_Order_Response:
+					legacy = d
+				case *errdetails.BadRequest:
+					badRequest = d
+				}
+			}
+
+			if info == nil || info.Reason != tt.reason || info.Domain != server.ErrorDomain {
+				t.Errorf("Expected ErrorInfo with reason %s, got %v", tt.reason, info)
+			}
+
+			if legacy == nil || legacy.Status != tt.legacyStatus || legacy.Error == "" || legacy.Message == "" {
+				t.Errorf("Expected the legacy response with status %d, got %v", tt.legacyStatus, legacy)
+			}
+
+			if tt.code == codes.Internal && (strings.Contains(st.Message(), "boom") || strings.Contains(legacy.GetError(), "boom")) {
+				t.Errorf("Expected the internal error to stay in the log, got %q and %q", st.Message(), legacy.GetError())
+			}
+
+			if tt.field != "" {
+				if badRequest == nil || len(badRequest.FieldViolations) != 1 || badRequest.FieldViolations[0].Field != tt.field {
+					t.Errorf("Expected a field violation for %s, got %v", tt.field, badRequest)
+				}
+			}
+		})
+	}
+
+	t.Run("SuccessKeepsLegacyFields", func(t *testing.T) {
+		response, err := newServer(t, &seatCheckMovieDB{}).CreateCheckoutSession(context.Background(), &payment_service.CreateCheckoutSessionRequest{})
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if response.Status != 200 || response.Error != "" {
+			t.Errorf("Expected status 200 without error, got %d %q", response.Status, response.Error)
+		}
+	})
+}
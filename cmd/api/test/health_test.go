@@ -0,0 +1,251 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var paymentServiceName = payment_service.PaymentService_ServiceDesc.ServiceName
+
+func servingStatus(t *testing.T, h *server.Health_Checker, service string) healthpb.HealthCheckResponse_ServingStatus {
+
+	resp, err := h.Health.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+
+	if err != nil {
+		t.Fatalf("Unexpected health check error: %v", err)
+	}
+
+	return resp.Status
+}
+
+func TestHealthChecker(t *testing.T) {
+
+	ok := func(context.Context) error { return nil }
+	down := func(context.Context) error { return errors.New("connection refused") }
+
+	newChecker := func(t *testing.T, checks ...server.Readiness_Check) *server.Health_Checker {
+
+		h, err := server.NewHealthChecker(&server.Payment_Service{}, checks, 1)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		return h
+	}
+
+	t.Run("NotServingBeforeFirstCheck", func(t *testing.T) {
+		h := newChecker(t, server.Readiness_Check{Name: "postgres", Check: ok})
+
+		for _, service := range []string{"", paymentServiceName} {
+			if got := servingStatus(t, h, service); got != healthpb.HealthCheckResponse_NOT_SERVING {
+				t.Errorf("Expected %q to be NOT_SERVING, got %s", service, got)
+			}
+		}
+	})
+
+	t.Run("FollowsChecks", func(t *testing.T) {
+		database := ok
+
+		h := newChecker(t,
+			server.Readiness_Check{Name: "postgres", Check: func(ctx context.Context) error { return database(ctx) }},
+			server.Readiness_Check{Name: "payment_gateway", Check: ok},
+		)
+
+		steps := []struct {
+			check func(context.Context) error
+			want  healthpb.HealthCheckResponse_ServingStatus
+		}{
+			{ok, healthpb.HealthCheckResponse_SERVING},
+			{down, healthpb.HealthCheckResponse_NOT_SERVING},
+			{ok, healthpb.HealthCheckResponse_SERVING},
+		}
+
+		for i, step := range steps {
+			database = step.check
+
+			err := h.Check(context.Background())
+
+			if (err != nil) != (step.want == healthpb.HealthCheckResponse_NOT_SERVING) {
+				t.Errorf("Step %d: unexpected error %v", i, err)
+			}
+
+			for _, service := range []string{"", paymentServiceName} {
+				if got := servingStatus(t, h, service); got != step.want {
+					t.Errorf("Step %d: expected %q to be %s, got %s", i, service, step.want, got)
+				}
+			}
+		}
+	})
+
+	t.Run("DrainOverridesChecks", func(t *testing.T) {
+		h := newChecker(t, server.Readiness_Check{Name: "postgres", Check: ok})
+
+		h.Check(context.Background())
+		h.Drain()
+		h.Check(context.Background())
+
+		if got := servingStatus(t, h, ""); got != healthpb.HealthCheckResponse_NOT_SERVING {
+			t.Errorf("Expected NOT_SERVING while draining, got %s", got)
+		}
+	})
+
+	t.Run("InvalidInterval", func(t *testing.T) {
+		if _, err := server.NewHealthChecker(&server.Payment_Service{}, nil, 0); err == nil {
+			t.Error("Expected an error for a zero interval")
+		}
+	})
+}
+
+// movieDBConn serves a movie DB stand-in over an in-memory listener, healthy
+// nil registers no health service
+func movieDBConn(t *testing.T, healthy *bool) *grpc.ClientConn {
+
+	lis := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer()
+
+	if healthy != nil {
+		hs := health.NewServer()
+
+		if !*healthy {
+			hs.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+
+		healthpb.RegisterHealthServer(s, hs)
+	}
+
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///moviedb",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func TestReadinessChecks(t *testing.T) {
+
+	serving, notServing := true, false
+
+	tests := []struct {
+		name      string
+		pingErr   error
+		gateway   gateway.PaymentGateway
+		movieDB   func(t *testing.T) *grpc.ClientConn
+		wantReady bool
+	}{
+		{
+			name:      "Ready",
+			gateway:   gatewaytest.NewFakeGateway(nil),
+			movieDB:   func(t *testing.T) *grpc.ClientConn { return movieDBConn(t, &serving) },
+			wantReady: true,
+		},
+		{
+			// A movie DB service without a health service still answers
+			name:      "MovieDBWithoutHealthService",
+			gateway:   gatewaytest.NewFakeGateway(nil),
+			movieDB:   func(t *testing.T) *grpc.ClientConn { return movieDBConn(t, nil) },
+			wantReady: true,
+		},
+		{
+			name:    "DatabaseDown",
+			pingErr: errConnectionReset,
+			gateway: gatewaytest.NewFakeGateway(nil),
+			movieDB: func(t *testing.T) *grpc.ClientConn { return movieDBConn(t, &serving) },
+		},
+		{
+			name:    "MovieDBNotServing",
+			gateway: gatewaytest.NewFakeGateway(nil),
+			movieDB: func(t *testing.T) *grpc.ClientConn { return movieDBConn(t, &notServing) },
+		},
+		{
+			name:    "MovieDBUnreachable",
+			gateway: gatewaytest.NewFakeGateway(nil),
+			movieDB: func(t *testing.T) *grpc.ClientConn {
+				conn := movieDBConn(t, &serving)
+				conn.Close()
+				return conn
+			},
+		},
+		{
+			name:    "GatewayWithoutAPIKey",
+			gateway: gateway.NewDodoGateway("", true),
+			movieDB: func(t *testing.T) *grpc.ClientConn { return movieDBConn(t, &serving) },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			sqlDB, mock, err := sqlmock.New(sqlmock.MonitorPingsOption(true))
+
+			if err != nil {
+				t.Fatalf("Failed to create database mock: %v", err)
+			}
+
+			t.Cleanup(func() { sqlDB.Close() })
+
+			db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true, DisableAutomaticPing: true, Logger: logger.Discard})
+
+			if err != nil {
+				t.Fatalf("Failed to open database handle: %v", err)
+			}
+
+			mock.ExpectPing().WillReturnError(tt.pingErr)
+
+			ps, err := server.NewPaymentServer(config.Default(),
+				server.WithGateway(tt.gateway),
+				server.WithDB(db),
+				server.WithMovieDBConn(tt.movieDB(t)),
+			)
+
+			if err != nil {
+				t.Fatalf("Failed to create payment server: %v", err)
+			}
+
+			checks := ps.ReadinessChecks()
+
+			if len(checks) != 3 {
+				t.Fatalf("Expected the database, gateway and movie DB checks, got %d", len(checks))
+			}
+
+			h, err := server.NewHealthChecker(ps.Ps, checks, 1)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			err = h.Check(context.Background())
+
+			if (err == nil) != tt.wantReady {
+				t.Errorf("Expected ready %t, got %v", tt.wantReady, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+)
+
+func TestPaymentPostings(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		total    int64
+		tax      int64
+		feeBps   int64
+		platform int64
+		venue    int64
+	}{
+		{name: "NoFee", total: 50000, tax: 0, feeBps: 0, platform: 0, venue: 50000},
+		{name: "FeeAndTax", total: 59000, tax: 9000, feeBps: 1000, platform: 5000, venue: 45000},
+		{name: "FeeRoundsDown", total: 999, tax: 0, feeBps: 250, platform: 24, venue: 975},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postings, err := server.PaymentPostings("cus_1", "7", money.New(tt.total, money.INR), money.New(tt.tax, money.INR), tt.feeBps)
+
+			if err != nil {
+				t.Fatalf("Failed to split payment: %v", err)
+			}
+
+			var sum int64
+			amounts := map[string]int64{}
+
+			for _, p := range postings {
+				if p.Amount.Currency != money.INR {
+					t.Fatalf("Unexpected currency %s", p.Amount.Currency)
+				}
+
+				sum += p.Amount.Amount
+				amounts[p.AccountType] = p.Amount.Amount
+
+				if p.AccountType == models.AccountTypeVenuePayable && p.OwnerID != "7" {
+					t.Errorf("Expected the venue share to be owed to venue 7, got owner %q", p.OwnerID)
+				}
+			}
+
+			if sum != 0 {
+				t.Fatalf("Postings do not balance, off by %d", sum)
+			}
+
+			if amounts[models.AccountTypeCustomer] != tt.total {
+				t.Errorf("Expected customer debit of %d, got %d", tt.total, amounts[models.AccountTypeCustomer])
+			}
+
+			if -amounts[models.AccountTypeTaxPayable] != tt.tax {
+				t.Errorf("Expected tax credit of %d, got %d", tt.tax, -amounts[models.AccountTypeTaxPayable])
+			}
+
+			if -amounts[models.AccountTypePlatformRevenue] != tt.platform {
+				t.Errorf("Expected platform credit of %d, got %d", tt.platform, -amounts[models.AccountTypePlatformRevenue])
+			}
+
+			if -amounts[models.AccountTypeVenuePayable] != tt.venue {
+				t.Errorf("Expected venue credit of %d, got %d", tt.venue, -amounts[models.AccountTypeVenuePayable])
+			}
+		})
+	}
+
+	t.Run("CurrencyMismatch", func(t *testing.T) {
+		if _, err := server.PaymentPostings("cus_1", "7", money.New(100, money.INR), money.New(10, money.USD), 0); err == nil {
+			t.Fatal("Expected a tax in another currency to be rejected")
+		}
+	})
+}
+
+func TestRefundPostings(t *testing.T) {
+
+	// Every case refunds the 59000 payment of FeeAndTax, which credited tax 9000, platform 5000 and venue 45000
+
+	tests := []struct {
+		name    string
+		refunds []int64
+	}{
+		{name: "FullRefund", refunds: []int64{59000}},
+		{name: "HalfThenRest", refunds: []int64{29500, 29500}},
+		{name: "UnevenSeats", refunds: []int64{333, 19667, 39000}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			total, tax := money.New(59000, money.INR), money.New(9000, money.INR)
+
+			payment, err := server.PaymentPostings("cus_1", "7", total, tax, 1000)
+
+			if err != nil {
+				t.Fatalf("Failed to split payment: %v", err)
+			}
+
+			balances := map[string]int64{}
+
+			for _, p := range payment {
+				balances[p.AccountType+"/"+p.OwnerID] += p.Amount.Amount
+			}
+
+			refunded := money.Zero(money.INR)
+
+			for _, amount := range tt.refunds {
+
+				postings, err := server.RefundPostings("cus_1", "7", money.New(amount, money.INR), refunded, total, tax, 1000)
+
+				if err != nil {
+					t.Fatalf("Failed to split refund: %v", err)
+				}
+
+				refunded = money.New(refunded.Amount+amount, money.INR)
+
+				var sum int64
+
+				for _, p := range postings {
+					sum += p.Amount.Amount
+					balances[p.AccountType+"/"+p.OwnerID] += p.Amount.Amount
+				}
+
+				if sum != 0 {
+					t.Fatalf("Refund postings do not balance, off by %d", sum)
+				}
+
+				if balances[models.AccountTypeVenuePayable+"/7"] > 0 || balances[models.AccountTypeTaxPayable+"/"] > 0 || balances[models.AccountTypePlatformRevenue+"/"] > 0 {
+					t.Fatalf("Refund reversed more than was credited: %v", balances)
+				}
+			}
+
+			for account, balance := range balances {
+				if balance != 0 {
+					t.Errorf("Expected the refunds to reverse %s exactly, %d left", account, balance)
+				}
+			}
+		})
+	}
+}
+
+// expectJournalEntry scripts posting a new journal entry whose postings go to
+// the given number of accounts, every account and account type already exists
+func expectJournalEntry(mock sqlmock.Sqlmock, accounts int) {
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "journal_entries"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+	postings := sqlmock.NewRows([]string{"id"})
+
+	for i := 1; i <= accounts; i++ {
+		mock.ExpectQuery(`SELECT \* FROM "account_types"`).WillReturnRows(sqlmock.NewRows([]string{"id", "code", "normal_balance"}).AddRow(i, "account", models.NormalBalanceDebit))
+		mock.ExpectQuery(`SELECT \* FROM "accounts"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i))
+		postings.AddRow(i)
+	}
+
+	mock.ExpectQuery(`INSERT INTO "journal_entries"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`INSERT INTO "postings"`).WillReturnRows(postings)
+	mock.ExpectCommit()
+}
+
+// expectJournalEntryPosted expects a journal entry to be found posted already
+func expectJournalEntryPosted(mock sqlmock.Sqlmock) {
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT \* FROM "journal_entries"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(`SELECT \* FROM "postings"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectCommit()
+}
@@ -0,0 +1,229 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestRedact(t *testing.T) {
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"Email", "Email ada.lovelace@example.com is invalid", "Email a***@example.com is invalid"},
+		{"InternationalPhone", "phone +91 98765 43210", "phone ***10"},
+		{"E164Phone", "phone +14155550123", "phone ***23"},
+		{"NationalPhone", "phone 9876543210", "phone ***10"},
+		{"Card", "card 4111 1111 1111 1111 declined", "card ****1111 declined"},
+		{"CardWithoutSpaces", "card 5555555555554444", "card ****4444"},
+		{"LongNumberThatIsNoCard", "amount 1234567890123456", "amount 1234567890123456"},
+		{"Amount", "amount 25000 INR", "amount 25000 INR"},
+		{"Date", "expired at 2025-01-01 12:00:00", "expired at 2025-01-01 12:00:00"},
+		{"IdempotentKey", "key 3f2b8c1e-7d4a-4e0b-9c55-1a2b3c4d5e6f", "key 3f2b8c1e-7d4a-4e0b-9c55-1a2b3c4d5e6f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := logging.Redact(tt.in); got != tt.want {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestLoggingSetup(t *testing.T) {
+
+	t.Run("RedactsEverything", func(t *testing.T) {
+		logger := log.New()
+
+		if err := logging.Setup(logger, config.LogFormatJSON, "info"); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var out bytes.Buffer
+		logger.SetOutput(&out)
+
+		logger.WithFields(log.Fields{
+			"email": "ada@example.com",
+			"error": errors.New("customer +919876543210 not found"),
+			"seats": 3,
+		}).Info("Creating customer ada@example.com")
+
+		line := out.String()
+
+		for _, leaked := range []string{"ada@example.com", "919876543210"} {
+			if strings.Contains(line, leaked) {
+				t.Errorf("Expected %s to be masked, got %s", leaked, line)
+			}
+		}
+
+		for _, want := range []string{`"msg":"Creating customer a***@example.com"`, `"seats":3`, `"level":"info"`} {
+			if !strings.Contains(line, want) {
+				t.Errorf("Expected %s in %s", want, line)
+			}
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		if err := logging.Setup(log.New(), "xml", "info"); err == nil {
+			t.Error("Expected an error for an unknown format")
+		}
+
+		if err := logging.Setup(log.New(), config.LogFormatText, "loud"); err == nil {
+			t.Error("Expected an error for an unknown level")
+		}
+	})
+}
+
+func TestLoggingInterceptor(t *testing.T) {
+
+	info := &grpc.UnaryServerInfo{FullMethod: payment_service.PaymentService_CreateOrder_FullMethodName}
+
+	tests := []struct {
+		name      string
+		requestID string
+		err       error
+	}{
+		{name: "CallerRequestID", requestID: "req-1"},
+		{name: "NewRequestID"},
+		{name: "Failed", requestID: "req-2", err: status.Error(codes.NotFound, "no session")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			logger, hook := logtest.NewNullLogger()
+
+			ctx := context.Background()
+
+			if tt.requestID != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(logging.RequestIDHeader, tt.requestID))
+			}
+
+			_, err := logging.UnaryServerInterceptor(logger)(ctx, &payment_service.Create_Order_Request{IdempotentKey: "key-1"}, info,
+				func(ctx context.Context, req interface{}) (interface{}, error) {
+					logging.FromContext(ctx).Info("Handling call")
+					return nil, tt.err
+				})
+
+			if err != tt.err {
+				t.Errorf("Expected the handler error to pass through, got %v", err)
+			}
+
+			entries := hook.AllEntries()
+
+			if len(entries) != 2 {
+				t.Fatalf("Expected the handler entry and the finished call entry, got %d", len(entries))
+			}
+
+			requestID := entries[0].Data["request_id"]
+
+			if requestID == "" || (tt.requestID != "" && requestID != tt.requestID) {
+				t.Errorf("Unexpected request ID %v", requestID)
+			}
+
+			for _, entry := range entries {
+				if entry.Data["request_id"] != requestID || entry.Data["idempotent_key"] != "key-1" || entry.Data["rpc"] != info.FullMethod {
+					t.Errorf("Expected every entry to carry the call fields, got %v", entry.Data)
+				}
+			}
+
+			if code := entries[1].Data["grpc_code"]; code != status.Code(tt.err).String() {
+				t.Errorf("Expected code %s to be logged, got %v", status.Code(tt.err), code)
+			}
+		})
+	}
+}
+
+func TestLoggingErrorsOfRPCs(t *testing.T) {
+
+	env := newRPCEnv(t, bookableSeats())
+
+	logger, hook := logtest.NewNullLogger()
+
+	ctx := logging.NewContext(context.Background(), logger.WithField("request_id", "req-1"))
+
+	_, err := env.server.CreateOrder(ctx, &payment_service.Create_Order_Request{IdempotentKey: "key-1", SeatMatrixIDs: []int32{1}})
+
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("Expected InvalidArgument, got %v", err)
+	}
+
+	entry := hook.LastEntry()
+
+	if entry == nil || entry.Data["request_id"] != "req-1" || entry.Data["reason"] != "INVALID_ARGUMENT" {
+		t.Errorf("Expected the error to be logged with the request logger, got %v", entry)
+	}
+}
+
+func TestLoggingServiceCalls(t *testing.T) {
+
+	env := newRPCEnv(t, bookableSeats())
+
+	logger, hook := logtest.NewNullLogger()
+
+	ctx := logging.NewContext(context.Background(), logger.WithField("request_id", "req-1"))
+
+	if _, err := env.server.Ps.Create_Customer(ctx, "", "", "", "key-1", models.BillingAddress{}); err == nil {
+		t.Fatal("Expected the customer to be rejected")
+	}
+
+	if err := env.server.Ps.Handle_Webhook_Event(ctx, server.WebhookEvent{Type: "payout.succeeded"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(hook.AllEntries()) != 2 {
+		t.Fatalf("Expected 2 entries from the request logger, got %d", len(hook.AllEntries()))
+	}
+
+	for _, entry := range hook.AllEntries() {
+		if entry.Data["request_id"] != "req-1" {
+			t.Errorf("Expected %q to be logged with the request logger", entry.Message)
+		}
+	}
+}
+
+func TestLoggingHandler(t *testing.T) {
+
+	logger, hook := logtest.NewNullLogger()
+
+	h := logging.Handler(logger, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.FromContext(r.Context()).Info("Handling request")
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/webhooks/dodopayments", nil)
+	req.Header.Set(logging.RequestIDHeader, "req-1")
+
+	rec := httptest.NewRecorder()
+
+	h.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(logging.RequestIDHeader); got != "req-1" {
+		t.Errorf("Expected the request ID to be sent back, got %q", got)
+	}
+
+	entry := hook.LastEntry()
+
+	if entry == nil || entry.Data["request_id"] != "req-1" || entry.Data["path"] != "/webhooks/dodopayments" {
+		t.Errorf("Expected the entry to carry the request fields, got %v", entry)
+	}
+}
@@ -0,0 +1,267 @@
+package test
+
+import (
+	"context"
+	"io"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// outboundCount is the number of calls recorded for service, operation and outcome
+func outboundCount(t *testing.T, service, operation, outcome string) uint64 {
+
+	families, err := metrics.Registry.Gather()
+
+	if err != nil {
+		t.Fatalf("Failed to gather metrics: %v", err)
+	}
+
+	want := map[string]string{"service": service, "operation": operation, "outcome": outcome}
+
+	for _, family := range families {
+		if family.GetName() != "payment_service_outbound_request_duration_seconds" {
+			continue
+		}
+
+	metrics:
+		for _, m := range family.GetMetric() {
+			for _, label := range m.GetLabel() {
+				if want[label.GetName()] != label.GetValue() {
+					continue metrics
+				}
+			}
+
+			return m.GetHistogram().GetSampleCount()
+		}
+	}
+
+	return 0
+}
+
+func TestRPCMetrics(t *testing.T) {
+
+	interceptor := metrics.UnaryServerInterceptor()
+
+	tests := []struct {
+		name   string
+		method string
+		err    error
+		code   string
+	}{
+		{"OK", "/payment.PaymentService/CreateOrder", nil, "OK"},
+		{"NotFound", "/payment.PaymentService/CreateOrder", status.Error(codes.NotFound, "no session"), "NotFound"},
+		{"PlainError", "/payment.PaymentService/Refund", io.EOF, "Unknown"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			service, method, _ := strings.Cut(strings.TrimPrefix(tt.method, "/"), "/")
+
+			started := metrics.RPCsStarted.WithLabelValues("unary", service, method)
+			handled := metrics.RPCsHandled.WithLabelValues("unary", service, method, tt.code)
+
+			startedBefore, handledBefore := testutil.ToFloat64(started), testutil.ToFloat64(handled)
+
+			_, err := interceptor(context.Background(), nil, &grpc.UnaryServerInfo{FullMethod: tt.method},
+				func(context.Context, interface{}) (interface{}, error) { return nil, tt.err })
+
+			if err != tt.err {
+				t.Errorf("Expected the handler error to pass through, got %v", err)
+			}
+
+			if got := testutil.ToFloat64(started) - startedBefore; got != 1 {
+				t.Errorf("Expected 1 started RPC, got %v", got)
+			}
+
+			if got := testutil.ToFloat64(handled) - handledBefore; got != 1 {
+				t.Errorf("Expected 1 RPC handled with %s, got %v", tt.code, got)
+			}
+		})
+	}
+}
+
+func TestOutboundMetrics(t *testing.T) {
+
+	t.Run("Gateway", func(t *testing.T) {
+		fake := gatewaytest.NewFakeGateway(nil)
+		g := gateway.NewInstrumentedGateway(fake, "test_gateway")
+
+		okBefore := outboundCount(t, "test_gateway", "CreateCustomer", "ok")
+		errBefore := outboundCount(t, "test_gateway", "CreateCustomer", "error")
+
+		if _, err := g.CreateCustomer(context.Background(), gateway.CustomerParams{Name: "Ada", Email: "ada@example.com"}); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		fake.FailWith("CreateCustomer", providerDown)
+
+		if _, err := g.CreateCustomer(context.Background(), gateway.CustomerParams{Name: "Ada", Email: "ada@example.com"}); err == nil {
+			t.Fatal("Expected the provider error")
+		}
+
+		if got := outboundCount(t, "test_gateway", "CreateCustomer", "ok") - okBefore; got != 1 {
+			t.Errorf("Expected 1 successful call, got %d", got)
+		}
+
+		if got := outboundCount(t, "test_gateway", "CreateCustomer", "error") - errBefore; got != 1 {
+			t.Errorf("Expected 1 failed call, got %d", got)
+		}
+	})
+
+	t.Run("GRPCClient", func(t *testing.T) {
+		interceptor := metrics.UnaryClientInterceptor("test_client")
+
+		before := outboundCount(t, "test_client", "GetMovie", "error")
+
+		err := interceptor(context.Background(), "/moviedb.MovieDBService/GetMovie", nil, nil, nil,
+			func(context.Context, string, interface{}, interface{}, *grpc.ClientConn, ...grpc.CallOption) error {
+				return status.Error(codes.Unavailable, "connection refused")
+			})
+
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Expected the call error to pass through, got %v", err)
+		}
+
+		if got := outboundCount(t, "test_client", "GetMovie", "error") - before; got != 1 {
+			t.Errorf("Expected 1 failed call, got %d", got)
+		}
+	})
+}
+
+func TestBookingMetrics(t *testing.T) {
+
+	tests := []struct {
+		name  string
+		setup func(*testing.T, *rpcEnv)
+		want  float64
+	}{
+		{
+			name: "CountedOnCommit",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogProduct(t)
+				e.expectTransition(models.PaymentStatusPending)
+			},
+			want: 1,
+		},
+		{
+			name: "NotCountedOnRollback",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogProduct(t)
+				e.expectTransitionError()
+				e.expectRelease()
+			},
+			want: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, bookableSeats())
+
+			tt.setup(t, env)
+
+			created := metrics.OrdersCreated.WithLabelValues(string(money.INR), "3")
+
+			before := testutil.ToFloat64(created)
+
+			env.server.CreateOrder(context.Background(), &payment_service.Create_Order_Request{
+				IdempotentKey:   "key-1",
+				MovieTimeSlotId: 7,
+				VenueId:         3,
+				SeatMatrixIDs:   []int32{1},
+			})
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Unmet database expectations: %v", err)
+			}
+
+			if got := testutil.ToFloat64(created) - before; got != tt.want {
+				t.Errorf("Expected %v orders counted, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestStateCollector(t *testing.T) {
+
+	sqlDB, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("Failed to create database mock: %v", err)
+	}
+
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	collector := server.NewStateCollector(&server.Payment_Service{DB: db, Now: func() time.Time { return now }})
+
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "booked_seats"`)).
+		WithArgs(false, now).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(4))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "idempotents"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+
+	expected := `
+# HELP payment_service_active_seat_holds Seats held for a booking that is being paid for.
+# TYPE payment_service_active_seat_holds gauge
+payment_service_active_seat_holds 4
+# HELP payment_service_pending_sessions Booking sessions that are neither paid for nor expired.
+# TYPE payment_service_pending_sessions gauge
+payment_service_pending_sessions 2
+`
+
+	if err := testutil.CollectAndCompare(collector, strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+
+	metrics.OrdersCreated.WithLabelValues(string(money.INR), metrics.Venue(0)).Add(0)
+
+	rec := httptest.NewRecorder()
+
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := rec.Body.String()
+
+	for _, name := range []string{"payment_service_orders_created_total", `venue="unknown"`, "go_goroutines"} {
+		if !strings.Contains(body, name) {
+			t.Errorf("Expected %s in the metrics output", name)
+		}
+	}
+}
@@ -1,38 +1,91 @@
 package test
 
 import (
+	"fmt"
+	"io/fs"
+	"strings"
 	"testing"
 
-	"github.com/joho/godotenv"
-	"github.com/kartik7120/booking_payment_service/cmd/api/models"
-	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"github.com/kartik7120/booking_payment_service/cmd/api/migrations"
 )
 
-func TestMigrateDB(t *testing.T) {
+func TestMigrations(t *testing.T) {
 
-	t.Run("MigrateDB", func(t *testing.T) {
+	t.Run("VersionsAreContiguous", func(t *testing.T) {
 
-		err := godotenv.Load()
+		versions, err := migrations.Versions()
 
 		if err != nil {
-			t.Fatalf("Error loading .env file: %v", err)
+			t.Fatalf("Failed to read migration versions: %v", err)
 		}
 
-		m := server.NewPaymentServer()
+		if len(versions) == 0 {
+			t.Fatal("Expected embedded migrations")
+		}
+
+		for i, v := range versions {
+			if v != uint(i+1) {
+				t.Fatalf("Expected migration %d to have version %d, got %d", i, i+1, v)
+			}
+		}
+
+		latest, err := migrations.Latest()
+
+		if err != nil {
+			t.Fatalf("Failed to read latest migration: %v", err)
+		}
 
-		m.Ps.DB.AutoMigrate(&models.Idempotent{})
+		if latest != versions[len(versions)-1] {
+			t.Errorf("Expected latest version %d, got %d", versions[len(versions)-1], latest)
+		}
 	})
 
-	t.Run("DropTables", func(t *testing.T) {
-		err := godotenv.Load()
+	t.Run("EveryUpHasADown", func(t *testing.T) {
+
+		ups, err := fs.Glob(migrations.Files(), "*.up.sql")
+
+		if err != nil {
+			t.Fatalf("Failed to list migrations: %v", err)
+		}
+
+		downs, err := fs.Glob(migrations.Files(), "*.down.sql")
 
 		if err != nil {
-			t.Fatalf("Error loading .env file: %v", err)
+			t.Fatalf("Failed to list migrations: %v", err)
 		}
 
-		m := server.NewPaymentServer()
+		if len(ups) != len(downs) {
+			t.Fatalf("Expected as many down as up migrations, got %d up and %d down", len(ups), len(downs))
+		}
+
+		for _, up := range ups {
+			down := strings.TrimSuffix(up, ".up.sql") + ".down.sql"
+
+			data, err := fs.ReadFile(migrations.Files(), down)
+
+			if err != nil {
+				t.Errorf("Expected %s for %s: %v", down, up, err)
+				continue
+			}
+
+			if strings.TrimSpace(string(data)) == "" {
+				t.Errorf("Expected %s to roll something back", down)
+			}
+		}
+	})
 
-		m.Ps.DB.Migrator().DropTable(&models.Idempotent{})
-		// , &models.Payment{}, &models.Order{}, &models.BookedSeats{}, &models.Ledger{}, &models.Wallet{}
+	t.Run("Status", func(t *testing.T) {
+
+		status := migrations.Status{Version: 2, Latest: 4, Pending: []uint{3, 4}}
+
+		if got := status.String(); got != "version 2 of 4, 2 pending" {
+			t.Errorf("Unexpected status %q", got)
+		}
+
+		status = migrations.Status{Version: 4, Latest: 4}
+
+		if got := fmt.Sprint(status); got != "version 4 of 4, up to date" {
+			t.Errorf("Unexpected status %q", got)
+		}
 	})
 }
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+)
+
+func TestMoney(t *testing.T) {
+
+	t.Run("FromMajor", func(t *testing.T) {
+		inr, _ := money.FromMajor(250, money.INR)
+		jpy, _ := money.FromMajor(250, money.JPY)
+
+		if inr != money.New(25000, money.INR) || jpy != money.New(250, money.JPY) {
+			t.Fatalf("Unexpected conversion %v and %v", inr, jpy)
+		}
+
+		if _, err := money.FromMajor(1, "XXX"); !errors.Is(err, money.ErrUnknownCurrency) {
+			t.Fatalf("Expected unknown currency, got %v", err)
+		}
+
+		if _, err := money.FromMajor(math.MaxInt64/10, money.INR); !errors.Is(err, money.ErrOverflow) {
+			t.Fatalf("Expected overflow, got %v", err)
+		}
+	})
+
+	t.Run("Parse", func(t *testing.T) {
+		tests := []struct {
+			in   string
+			mode money.RoundingMode
+			want int64
+		}{
+			{"250.50", money.RoundHalfEven, 25050},
+			{"0.125", money.RoundHalfEven, 12},
+			{"0.135", money.RoundHalfEven, 14},
+			{"0.125", money.RoundHalfUp, 13},
+			{"-0.125", money.RoundHalfUp, -13},
+			{"0.129", money.RoundDown, 12},
+			{"7", money.RoundHalfEven, 700},
+		}
+
+		for _, tt := range tests {
+			got, err := money.Parse(tt.in, money.INR, tt.mode)
+
+			if err != nil || got.Amount != tt.want {
+				t.Errorf("Parse(%q) = %v, %v, want %d", tt.in, got, err, tt.want)
+			}
+		}
+
+		if _, err := money.Parse("1e3", money.INR, money.RoundHalfEven); !errors.Is(err, money.ErrInvalidAmount) {
+			t.Errorf("Expected exponent notation to be rejected, got %v", err)
+		}
+	})
+
+	t.Run("Arithmetic", func(t *testing.T) {
+		a := money.New(1000, money.INR)
+
+		if _, err := a.Add(money.New(1, money.USD)); !errors.Is(err, money.ErrCurrencyMismatch) {
+			t.Fatalf("Expected currency mismatch, got %v", err)
+		}
+
+		if _, err := money.New(math.MaxInt64, money.INR).Add(money.New(1, money.INR)); !errors.Is(err, money.ErrOverflow) {
+			t.Fatalf("Expected overflow, got %v", err)
+		}
+
+		if _, err := money.New(math.MinInt64, money.INR).Sub(money.New(1, money.INR)); !errors.Is(err, money.ErrOverflow) {
+			t.Fatalf("Expected overflow, got %v", err)
+		}
+
+		if _, err := money.New(math.MaxInt64/2+1, money.INR).Mul(2); !errors.Is(err, money.ErrOverflow) {
+			t.Fatalf("Expected overflow, got %v", err)
+		}
+
+		fee, _ := money.New(999, money.INR).MulRatio(250, 10000, money.RoundHalfEven)
+
+		if fee.Amount != 25 {
+			t.Fatalf("Expected 2.5%% of 999 to round to 25, got %d", fee.Amount)
+		}
+	})
+
+	t.Run("Allocate", func(t *testing.T) {
+		shares, err := money.New(1000, money.INR).Allocate(1, 1, 1)
+
+		if err != nil {
+			t.Fatalf("Failed to allocate: %v", err)
+		}
+
+		if shares[0].Amount != 334 || shares[1].Amount != 333 || shares[2].Amount != 333 {
+			t.Fatalf("Unexpected shares %v", shares)
+		}
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		tests := map[money.Money]string{
+			money.New(25050, money.INR): "INR 250.50",
+			money.New(-5, money.INR):    "INR -0.05",
+			money.New(250, money.JPY):   "JPY 250",
+		}
+
+		for m, want := range tests {
+			if m.String() != want {
+				t.Errorf("Expected %s, got %s", want, m.String())
+			}
+		}
+	})
+
+	t.Run("JSONAndProto", func(t *testing.T) {
+		m := money.New(25050, money.INR)
+
+		body, _ := json.Marshal(m)
+
+		if string(body) != `{"amount":25050,"currency":"INR"}` {
+			t.Fatalf("Unexpected JSON %s", body)
+		}
+
+		back, err := money.FromProto(m.Proto())
+
+		if err != nil || back != m {
+			t.Fatalf("Proto round trip returned %v, %v", back, err)
+		}
+	})
+}
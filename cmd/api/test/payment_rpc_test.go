@@ -0,0 +1,754 @@
+package test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+var errConnectionReset = errors.New("connection reset by peer")
+
+// rpcEnv is a payment server on top of the fake gateway, a fake movie DB and a scripted database
+type rpcEnv struct {
+	server  *server.Payment_Server
+	gateway *gatewaytest.FakeGateway
+	mock    sqlmock.Sqlmock
+}
+
+func newRPCEnv(t *testing.T, movieDB *seatCheckMovieDB) *rpcEnv {
+
+	sqlDB, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("Failed to create database mock: %v", err)
+	}
+
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true, TranslateError: true, Logger: logger.Discard})
+
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+
+	fake := gatewaytest.NewFakeGateway(nil)
+
+	cfg := config.Default()
+	cfg.RedirectHosts = "example.com"
+
+	ps, err := server.NewPaymentServer(cfg,
+		server.WithGateway(fake),
+		server.WithDB(db),
+		server.WithMovieDB(movieDB),
+	)
+
+	if err != nil {
+		t.Fatalf("Failed to create payment server: %v", err)
+	}
+
+	return &rpcEnv{server: ps, gateway: fake, mock: mock}
+}
+
+func (e *rpcEnv) expectHold(held bool) {
+
+	rows := sqlmock.NewRows([]string{"id"})
+
+	if held {
+		rows.AddRow(1)
+	}
+
+	e.mock.ExpectBegin()
+	e.mock.ExpectQuery(`INSERT INTO "booked_seats"`).WillReturnRows(rows)
+
+	if held {
+		e.mock.ExpectCommit()
+	} else {
+		e.mock.ExpectRollback()
+	}
+}
+
+func (e *rpcEnv) expectHoldError() {
+	e.mock.ExpectBegin()
+	e.mock.ExpectQuery(`INSERT INTO "booked_seats"`).WillReturnError(errConnectionReset)
+	e.mock.ExpectRollback()
+}
+
+func (e *rpcEnv) expectRelease() {
+	e.mock.ExpectExec(`UPDATE "booked_seats"`).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+// expectCatalogProduct finds the seat in the catalog, the product exists at the provider
+func (e *rpcEnv) expectCatalogProduct(t *testing.T) {
+
+	price, err := money.FromMajor(250, money.INR)
+
+	if err != nil {
+		t.Fatalf("Invalid price: %v", err)
+	}
+
+	product, err := e.gateway.CreateProduct(context.Background(), gateway.ProductParams{Name: "Dune - VIP", Price: price})
+
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	e.mock.ExpectQuery(`SELECT \* FROM "catalog_products"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "catalog_key", "movie_name", "seat_type", "price_amount", "price_currency", "version", "active", "product_id"}).
+			AddRow(1, "key", "Dune", "VIP", price.Amount, price.Currency, 1, true, product.ProductID),
+	)
+}
+
+func (e *rpcEnv) expectCatalogMiss() {
+	e.mock.ExpectQuery(`SELECT \* FROM "catalog_products"`).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+}
+
+func (e *rpcEnv) expectTransition(from models.PaymentStatus) {
+	e.mock.ExpectBegin()
+	e.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(from), money.INR, 0),
+	)
+	e.mock.ExpectExec(`UPDATE "idempotents"`).WillReturnResult(sqlmock.NewResult(0, 1))
+	e.mock.ExpectQuery(`INSERT INTO "payment_status_histories"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	e.mock.ExpectCommit()
+}
+
+// expectSession expects the session to be read before a payment link is created for it
+func (e *rpcEnv) expectSession(status models.PaymentStatus, link string) {
+	e.mock.ExpectQuery(`SELECT "payment_status","payment_link" FROM "idempotents"`).WillReturnRows(
+		sqlmock.NewRows([]string{"payment_status", "payment_link"}).AddRow(string(status), link),
+	)
+}
+
+func (e *rpcEnv) expectTransitionError() {
+	e.mock.ExpectBegin()
+	e.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnError(errConnectionReset)
+	e.mock.ExpectRollback()
+}
+
+func (e *rpcEnv) expectMissingSession() {
+	e.mock.ExpectBegin()
+	e.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}))
+	e.mock.ExpectRollback()
+}
+
+// sessionRows is a single idempotents row made of the given columns
+func sessionRows(columns map[string]interface{}) *sqlmock.Rows {
+
+	names := make([]string, 0, len(columns))
+
+	for name := range columns {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	values := make([]driver.Value, 0, len(names))
+
+	for _, name := range names {
+		values = append(values, columns[name])
+	}
+
+	return sqlmock.NewRows(names).AddRow(values...)
+}
+
+func bookableSeats() *seatCheckMovieDB {
+	return &seatCheckMovieDB{response: &moviedb_service.IsValidToCommitSeatsForBooking_Response{
+		Isvalid: true,
+		ToBeBookedSeats: []*moviedb_service.BookedSeats{{
+			Id:           11,
+			SeatNumber:   "A1",
+			SeatMatrixID: 1,
+			Price:        250,
+			MovieName:    "Dune",
+		}},
+	}, seats: []*moviedb_service.SeatMatrix{{Id: 1, SeatNumber: "A1", Type: moviedb_service.SeatType_VIP}}}
+}
+
+// assertCode checks the gRPC code of err and that every scripted database call was made
+func assertCode(t *testing.T, env *rpcEnv, err error, code codes.Code) {
+	t.Helper()
+
+	if got := status.Code(err); got != code {
+		t.Errorf("Expected code %s, got %s: %v", code, got, err)
+	}
+
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls did not match: %v", err)
+	}
+}
+
+var providerDown = fmt.Errorf("%w: 503 Service Unavailable", gateway.ErrUnavailable)
+
+func TestCreateOrderRPC(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		movieDB *seatCheckMovieDB
+		request func(*payment_service.Create_Order_Request)
+		setup   func(*testing.T, *rpcEnv)
+		code    codes.Code
+	}{
+		{
+			name:    "MissingMovieTimeSlot",
+			request: func(r *payment_service.Create_Order_Request) { r.MovieTimeSlotId = 0 },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "MissingSeats",
+			request: func(r *payment_service.Create_Order_Request) { r.SeatMatrixIDs = nil },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "MissingIdempotentKey",
+			request: func(r *payment_service.Create_Order_Request) { r.IdempotentKey = "" },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "UnsupportedCurrency",
+			request: func(r *payment_service.Create_Order_Request) { r.Currency = payment_service.Currency(999) },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "MovieDBUnavailable",
+			movieDB: &seatCheckMovieDB{err: status.Error(codes.Unavailable, "connection refused")},
+			code:    codes.Unavailable,
+		},
+		{
+			name:    "MovieDBError",
+			movieDB: &seatCheckMovieDB{err: status.Error(codes.Internal, "boom")},
+			code:    codes.Internal,
+		},
+		{
+			name:    "MovieDBEmptyResponse",
+			movieDB: &seatCheckMovieDB{},
+			code:    codes.Internal,
+		},
+		{
+			name:    "SeatsNotBookable",
+			movieDB: &seatCheckMovieDB{response: &moviedb_service.IsValidToCommitSeatsForBooking_Response{Error: "seat A1 is booked"}},
+			code:    codes.AlreadyExists,
+		},
+		{
+			name:  "SeatHeldByAnotherBooking",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectHold(false) },
+			code:  codes.AlreadyExists,
+		},
+		{
+			name:  "HoldFails",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectHoldError() },
+			code:  codes.Internal,
+		},
+		{
+			name:    "NoExchangeRate",
+			request: func(r *payment_service.Create_Order_Request) { r.Currency = payment_service.Currency_USD },
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectRelease()
+			},
+			code: codes.FailedPrecondition,
+		},
+		{
+			name: "ProviderUnavailable",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogMiss()
+				e.gateway.FailWith("CreateProduct", providerDown)
+				e.expectRelease()
+			},
+			code: codes.Unavailable,
+		},
+		{
+			name: "SessionNotFound",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogProduct(t)
+				e.expectMissingSession()
+				e.expectRelease()
+			},
+			code: codes.NotFound,
+		},
+		{
+			name: "CommitOrderFails",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogProduct(t)
+				e.expectTransitionError()
+				e.expectRelease()
+			},
+			code: codes.Internal,
+		},
+		{
+			name: "Success",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectCatalogProduct(t)
+				e.expectTransition(models.PaymentStatusPending)
+			},
+			code: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			movieDB := tt.movieDB
+
+			if movieDB == nil {
+				movieDB = bookableSeats()
+			}
+
+			env := newRPCEnv(t, movieDB)
+
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			request := &payment_service.Create_Order_Request{
+				IdempotentKey:   "key-1",
+				MovieTimeSlotId: 7,
+				SeatMatrixIDs:   []int32{1},
+			}
+
+			if tt.request != nil {
+				tt.request(request)
+			}
+
+			response, err := env.server.CreateOrder(context.Background(), request)
+
+			assertCode(t, env, err, tt.code)
+
+			if tt.code == codes.OK {
+				if response == nil || response.Status != 200 || len(response.OrderId) != 1 || response.HoldExpiresAt == nil {
+					t.Errorf("Unexpected response %v", response)
+				}
+			}
+		})
+	}
+}
+
+func TestCreatePaymentLinkRPC(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		movieDB *seatCheckMovieDB
+		request func(*payment_service.Create_Payment_Intent_INR_Request)
+		setup   func(*testing.T, *rpcEnv)
+		release bool // whether the seats held for the request are released again
+		code    codes.Code
+	}{
+		{
+			name:    "MissingIdempotentKey",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.IdempotentKey = "" },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "UnsupportedCurrency",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.Currency = payment_service.Currency(999) },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "MovieDBUnavailable",
+			movieDB: &seatCheckMovieDB{err: status.Error(codes.DeadlineExceeded, "deadline exceeded")},
+			code:    codes.Unavailable,
+		},
+		{
+			name:    "MovieDBEmptyResponse",
+			movieDB: &seatCheckMovieDB{},
+			code:    codes.Internal,
+		},
+		{
+			name:    "SeatsNotBookable",
+			movieDB: &seatCheckMovieDB{response: &moviedb_service.IsValidToCommitSeatsForBooking_Response{Error: "seat A1 is booked"}},
+			code:    codes.AlreadyExists,
+		},
+		{
+			name:  "SeatsHeldByAnotherBooking",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectHold(false) },
+			code:  codes.AlreadyExists,
+		},
+		{
+			name:  "HoldFails",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectHoldError() },
+			code:  codes.Internal,
+		},
+		{
+			name:    "NoExchangeRate",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.Currency = payment_service.Currency_EUR },
+			setup:   func(t *testing.T, e *rpcEnv) { e.expectHold(true) },
+			release: true,
+			code:    codes.FailedPrecondition,
+		},
+		{
+			name:    "MissingCustomerDetails",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.Street = "" },
+			setup:   func(t *testing.T, e *rpcEnv) { e.expectHold(true) },
+			release: true,
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "InvalidRedirectURL",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.SuccessUrl = "" },
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+			},
+			release: true,
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "RedirectHostNotAllowed",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.CancelUrl = "https://evil.test" },
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+			},
+			release: true,
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "InvalidPhoneNumber",
+			request: func(r *payment_service.Create_Payment_Intent_INR_Request) { r.PhoneNumber = "12345" },
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+			},
+			release: true,
+			code:    codes.InvalidArgument,
+		},
+		{
+			name: "CustomerProviderUnavailable",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.gateway.FailWith("CreateCustomer", providerDown)
+			},
+			release: true,
+			code:    codes.Unavailable,
+		},
+		{
+			name: "CommitCustomerFails",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.expectTransitionError()
+			},
+			release: true,
+			code:    codes.Internal,
+		},
+		{
+			name: "LinkIssuedBefore",
+			setup: func(t *testing.T, e *rpcEnv) {
+				// The holds are extended for the session and the link issued before is
+				// returned, no second customer is created at the provider
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusLinkIssued, "https://checkout.example.com/pay_1")
+			},
+			code: codes.OK,
+		},
+		{
+			name: "CatalogFails",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.expectTransition(models.PaymentStatusOrderCreated)
+				e.mock.ExpectQuery(`SELECT \* FROM "catalog_products"`).WillReturnError(errConnectionReset)
+			},
+			release: true,
+			code:    codes.Internal,
+		},
+		{
+			name: "PaymentProviderUnavailable",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.expectTransition(models.PaymentStatusOrderCreated)
+				e.expectCatalogProduct(t)
+				e.gateway.FailWith("CreatePayment", providerDown)
+			},
+			release: true,
+			code:    codes.Unavailable,
+		},
+		{
+			name: "RecordLinkFails",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.expectTransition(models.PaymentStatusOrderCreated)
+				e.expectCatalogProduct(t)
+				e.expectTransitionError()
+			},
+			release: true,
+			code:    codes.Internal,
+		},
+		{
+			name: "Success",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.expectHold(true)
+				e.expectSession(models.PaymentStatusOrderCreated, "")
+				e.expectTransition(models.PaymentStatusOrderCreated)
+				e.expectCatalogProduct(t)
+
+				// The seats are recorded with the link so the payment.succeeded webhook can book them
+
+				e.mock.ExpectBegin()
+				e.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(models.PaymentStatusCustomerAttached), money.INR, 0),
+				)
+				e.mock.ExpectExec(`UPDATE "idempotents" SET "booked_seats_id"=\$1,"cancel_url"=\$2,"movie_time_slot_id"=\$3,"order_ids"=\$4`).
+					WithArgs(pq.Int32Array{11}, sqlmock.AnyArg(), 7, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "key-1", sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				e.mock.ExpectQuery(`INSERT INTO "payment_status_histories"`).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				e.mock.ExpectCommit()
+			},
+			code: codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			movieDB := tt.movieDB
+
+			if movieDB == nil {
+				movieDB = bookableSeats()
+			}
+
+			env := newRPCEnv(t, movieDB)
+
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			if tt.release {
+				env.expectRelease()
+			}
+
+			request := &payment_service.Create_Payment_Intent_INR_Request{
+				IdempotentKey:   "key-1",
+				MovieTimeSlotId: 7,
+				SeatMatrixIDs:   []int32{1},
+				CustomerName:    "Asha",
+				Email:           "asha@example.com",
+				PhoneNumber:     "+919876543210",
+				Country:         "IN",
+				State:           "KA",
+				City:            "Bengaluru",
+				Street:          "MG Road",
+				Zipcode:         560001,
+				SuccessUrl:      "https://example.com/ok",
+			}
+
+			if tt.request != nil {
+				tt.request(request)
+			}
+
+			response, err := env.server.CreatePaymentLink(context.Background(), request)
+
+			assertCode(t, env, err, tt.code)
+
+			if tt.code == codes.OK && (response == nil || response.Status != 200 || response.PaymentLink == "") {
+				t.Errorf("Unexpected response %v", response)
+			}
+		})
+	}
+}
+
+func TestCreateCustomerRPC(t *testing.T) {
+
+	tests := []struct {
+		name    string
+		request func(*payment_service.CreateCustomerRequest)
+		setup   func(*testing.T, *rpcEnv)
+		code    codes.Code
+	}{
+		{
+			name:    "MissingEmail",
+			request: func(r *payment_service.CreateCustomerRequest) { r.Email = "" },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "InvalidEmail",
+			request: func(r *payment_service.CreateCustomerRequest) { r.Email = "asha" },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:    "InvalidCountry",
+			request: func(r *payment_service.CreateCustomerRequest) { r.Country = "India" },
+			code:    codes.InvalidArgument,
+		},
+		{
+			// The key is checked before the provider is called, a provider failure would show otherwise
+			name:    "MissingIdempotentKey",
+			request: func(r *payment_service.CreateCustomerRequest) { r.IdempotentKey = "" },
+			setup:   func(t *testing.T, e *rpcEnv) { e.gateway.FailWith("CreateCustomer", providerDown) },
+			code:    codes.InvalidArgument,
+		},
+		{
+			name:  "ProviderUnavailable",
+			setup: func(t *testing.T, e *rpcEnv) { e.gateway.FailWith("CreateCustomer", providerDown) },
+			code:  codes.Unavailable,
+		},
+		{
+			name: "ProviderRejects",
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.gateway.FailWith("CreateCustomer", errors.New("422 Unprocessable Entity"))
+			},
+			code: codes.Internal,
+		},
+		{
+			name:  "SessionNotFound",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectMissingSession() },
+			code:  codes.NotFound,
+		},
+		{
+			name:  "CommitFails",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectTransitionError() },
+			code:  codes.Internal,
+		},
+		{
+			name:  "Success",
+			setup: func(t *testing.T, e *rpcEnv) { e.expectTransition(models.PaymentStatusOrderCreated) },
+			code:  codes.OK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			request := &payment_service.CreateCustomerRequest{
+				IdempotentKey: "key-1",
+				CustomerName:  "Asha",
+				Email:         "asha@example.com",
+				PhoneNumber:   "+919876543210",
+				Country:       "IN",
+			}
+
+			if tt.request != nil {
+				tt.request(request)
+			}
+
+			response, err := env.server.CreateCustomer(context.Background(), request)
+
+			assertCode(t, env, err, tt.code)
+
+			if tt.code == codes.OK && (response == nil || response.CustomerId == "") {
+				t.Errorf("Unexpected response %v", response)
+			}
+		})
+	}
+}
+
+func TestGeneratePaymentLinkRPC(t *testing.T) {
+
+	issued := map[string]interface{}{
+		"id":                 1,
+		"idempotent_key":     "key-1",
+		"customer_id":        "cus_1",
+		"payment_status":     string(models.PaymentStatusLinkIssued),
+		"payment_id":         "pay_1",
+		"payment_link":       "https://checkout.example.com/pay_1",
+		"movie_time_slot_id": 7,
+		"booked_seats_id":    "{11}",
+		"expired_at":         time.Now().Add(time.Hour),
+	}
+
+	with := func(column string, value interface{}) map[string]interface{} {
+		row := map[string]interface{}{}
+
+		for k, v := range issued {
+			row[k] = v
+		}
+
+		row[column] = value
+
+		return row
+	}
+
+	tests := []struct {
+		name    string
+		session map[string]interface{}
+		setup   func(*testing.T, *rpcEnv)
+		code    codes.Code
+		link    string
+	}{
+		{
+			name:    "IssuedLinkIsReturned",
+			session: issued,
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.mock.ExpectBegin()
+				e.mock.ExpectExec(`UPDATE "booked_seats"`).WillReturnResult(sqlmock.NewResult(0, 1))
+				e.mock.ExpectCommit()
+			},
+			code: codes.OK,
+			link: "https://checkout.example.com/pay_1",
+		},
+		{
+			name:    "SeatsTakenMeanwhile",
+			session: issued,
+			setup: func(t *testing.T, e *rpcEnv) {
+				e.mock.ExpectBegin()
+				e.mock.ExpectExec(`UPDATE "booked_seats"`).WillReturnResult(sqlmock.NewResult(0, 0))
+				e.mock.ExpectRollback()
+			},
+			code: codes.AlreadyExists,
+		},
+		{
+			// A link issued before links were recorded cannot be handed out again, nor may a second one be created
+			name:    "UnrecordedLink",
+			session: with("payment_link", ""),
+			code:    codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			env.mock.ExpectQuery(`SELECT \* FROM "idempotents"`).WillReturnRows(sessionRows(tt.session))
+			env.mock.ExpectQuery(`SELECT \* FROM "idempotents"`).WillReturnRows(sessionRows(tt.session))
+
+			if tt.setup != nil {
+				tt.setup(t, env)
+			}
+
+			env.gateway.FailWith("CreatePayment", errors.New("no new payment may be created"))
+
+			response, err := env.server.GeneratePaymentLink(context.Background(), &payment_service.CreatePaymentLinkRequest{
+				IdempotentKey: "key-1",
+			})
+
+			assertCode(t, env, err, tt.code)
+
+			if tt.code == codes.OK && (response == nil || response.PaymentLink != tt.link) {
+				t.Errorf("Expected the issued link %s, got %v", tt.link, response)
+			}
+		})
+	}
+}
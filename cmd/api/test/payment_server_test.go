@@ -0,0 +1,105 @@
+package test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	log "github.com/sirupsen/logrus"
+	logtest "github.com/sirupsen/logrus/hooks/test"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestNewPaymentServer(t *testing.T) {
+
+	t.Run("InjectedDependencies", func(t *testing.T) {
+		db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=unused"}), &gorm.Config{DisableAutomaticPing: true})
+
+		if err != nil {
+			t.Fatalf("Failed to open database handle: %v", err)
+		}
+
+		movieDB, err := moviedb_service.NewMovieDBClient("localhost:0")
+
+		if err != nil {
+			t.Fatalf("Failed to create movie DB client: %v", err)
+		}
+
+		fake := gatewaytest.NewFakeGateway(nil)
+		frozen := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+		logger := log.New()
+
+		// The config has neither a database URL nor a Dodo token, nothing may be built from it
+
+		ps, err := server.NewPaymentServer(config.Default(),
+			server.WithGateway(fake),
+			server.WithDB(db),
+			server.WithMovieDB(movieDB),
+			server.WithClock(func() time.Time { return frozen }),
+			server.WithLogger(logger),
+		)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if ps.Ps.Gateway != fake || ps.Ps.DB != db || ps.Ps.MovieDB != movieDB || ps.Ms != movieDB || ps.Ps.Logger != logger {
+			t.Error("Expected the injected dependencies to be used")
+		}
+
+		if !ps.Ps.Now().Equal(frozen) {
+			t.Errorf("Expected the injected clock, got %s", ps.Ps.Now())
+		}
+	})
+
+	t.Run("InjectedLogger", func(t *testing.T) {
+		db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=unused"}), &gorm.Config{DisableAutomaticPing: true})
+
+		if err != nil {
+			t.Fatalf("Failed to open database handle: %v", err)
+		}
+
+		logger, hook := logtest.NewNullLogger()
+
+		ps, err := server.NewPaymentServer(config.Default(),
+			server.WithGateway(gatewaytest.NewFakeGateway(nil)),
+			server.WithDB(db),
+			server.WithMovieDB(&seatCheckMovieDB{}),
+			server.WithLogger(logger),
+		)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// Without a request logger in the context the service logs to the injected one
+
+		if _, err := ps.Ps.Create_Customer(context.Background(), "", "", "", "key-1", models.BillingAddress{}); err == nil {
+			t.Fatal("Expected the customer to be rejected")
+		}
+
+		if hook.LastEntry() == nil {
+			t.Error("Expected the rejection to be logged to the injected logger")
+		}
+	})
+
+	t.Run("MissingDatabaseURL", func(t *testing.T) {
+		_, err := server.NewPaymentServer(config.Default(), server.WithGateway(gatewaytest.NewFakeGateway(nil)))
+
+		if err == nil {
+			t.Error("Expected an error instead of a panic without a database URL")
+		}
+	})
+
+	t.Run("MissingDodoToken", func(t *testing.T) {
+		if _, err := server.NewPaymentServer(config.Default()); err == nil {
+			t.Error("Expected an error instead of a panic without a Dodo token")
+		}
+	})
+}
@@ -0,0 +1,82 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+)
+
+func TestPaymentStatusTransitions(t *testing.T) {
+
+	tests := []struct {
+		name string
+		from models.PaymentStatus
+		to   models.PaymentStatus
+		want bool
+	}{
+		{"PendingToOrderCreated", models.PaymentStatusPending, models.PaymentStatusOrderCreated, true},
+		{"OrderCreatedToCustomerAttached", models.PaymentStatusOrderCreated, models.PaymentStatusCustomerAttached, true},
+		{"CustomerAttachedToLinkIssued", models.PaymentStatusCustomerAttached, models.PaymentStatusLinkIssued, true},
+		{"LinkIssuedToSucceeded", models.PaymentStatusLinkIssued, models.PaymentStatusSucceeded, true},
+		{"FailedToLinkIssued", models.PaymentStatusFailed, models.PaymentStatusLinkIssued, true},
+		{"SucceededToRefunded", models.PaymentStatusSucceeded, models.PaymentStatusRefunded, true},
+		{"DisputedToSucceeded", models.PaymentStatusDisputed, models.PaymentStatusSucceeded, true},
+		{"RedeliveredSuccess", models.PaymentStatusSucceeded, models.PaymentStatusSucceeded, true},
+		{"RepeatedOrder", models.PaymentStatusOrderCreated, models.PaymentStatusOrderCreated, true},
+		{"SecondPaymentLink", models.PaymentStatusLinkIssued, models.PaymentStatusLinkIssued, false},
+		{"PendingToSucceeded", models.PaymentStatusPending, models.PaymentStatusSucceeded, false},
+		{"SucceededToPending", models.PaymentStatusSucceeded, models.PaymentStatusPending, false},
+		{"SucceededToLinkIssued", models.PaymentStatusSucceeded, models.PaymentStatusLinkIssued, false},
+		{"ExpiredToLinkIssued", models.PaymentStatusExpired, models.PaymentStatusLinkIssued, false},
+		{"RefundedToSucceeded", models.PaymentStatusRefunded, models.PaymentStatusSucceeded, false},
+		{"UnknownState", models.PaymentStatus("INITIATED"), models.PaymentStatusLinkIssued, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.from.CanTransitionTo(tt.to); got != tt.want {
+				t.Errorf("CanTransitionTo(%s -> %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+
+	t.Run("LegacyStatuses", func(t *testing.T) {
+		if got := models.NormalizePaymentStatus("pending"); got != models.PaymentStatusPending {
+			t.Errorf("NormalizePaymentStatus(pending) = %s", got)
+		}
+
+		if got := models.NormalizePaymentStatus("INITIATED"); got != models.PaymentStatusOrderCreated {
+			t.Errorf("NormalizePaymentStatus(INITIATED) = %s", got)
+		}
+	})
+
+	t.Run("ExpirableStatuses", func(t *testing.T) {
+		expirable := map[string]bool{}
+
+		for _, status := range models.ExpirablePaymentStatuses() {
+			expirable[status] = true
+		}
+
+		for _, status := range []string{"", "pending", "INITIATED", "PENDING", "LINK_ISSUED", "FAILED"} {
+			if !expirable[status] {
+				t.Errorf("Expected %q to be expirable", status)
+			}
+		}
+
+		for _, status := range []string{"SUCCEEDED", "REFUNDED", "DISPUTED", "EXPIRED"} {
+			if expirable[status] {
+				t.Errorf("Expected %q not to be expirable", status)
+			}
+		}
+	})
+
+	t.Run("TerminalStates", func(t *testing.T) {
+		if !models.PaymentStatusExpired.IsTerminal() || !models.PaymentStatusRefunded.IsTerminal() {
+			t.Error("Expected EXPIRED and REFUNDED to be terminal")
+		}
+
+		if models.PaymentStatusSucceeded.IsTerminal() {
+			t.Error("Expected SUCCEEDED not to be terminal")
+		}
+	})
+}
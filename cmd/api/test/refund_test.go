@@ -0,0 +1,185 @@
+package test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/lib/pq"
+	"google.golang.org/grpc/codes"
+)
+
+// paidBooking captures a payment for two seats of 250 INR sharing one product
+func paidBooking(t *testing.T, fake *gatewaytest.FakeGateway) (*gateway.Payment, *gateway.Product) {
+
+	ctx := context.Background()
+
+	customer, err := fake.CreateCustomer(ctx, gateway.CustomerParams{Email: "asha@example.com", Name: "Asha", PhoneNumber: "+919876543210"})
+
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+
+	product, err := fake.CreateProduct(ctx, gateway.ProductParams{Name: "Dune - VIP", Price: money.New(25000, money.INR)})
+
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	payment, err := fake.CreatePayment(ctx, gateway.PaymentParams{
+		CustomerID:  customer.CustomerID,
+		ProductCart: []gateway.CartItem{{ProductID: product.ProductID, Quantity: 2}},
+		Currency:    money.INR,
+		Metadata:    map[string]string{"idempotent_key": "key-1"},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+
+	if err := fake.SucceedPayment(payment.PaymentID); err != nil {
+		t.Fatalf("Failed to capture payment: %v", err)
+	}
+
+	return payment, product
+}
+
+func TestRefundPaymentRPC(t *testing.T) {
+
+	claimSQL := `UPDATE "idempotents" SET "refunded_seats_id"=\$1,"updated_at"=\$2 WHERE \(idempotent_key = \$3 AND payment_status = \$4 AND COALESCE\(refunded_seats_id, '\{\}'\) = \$5\)`
+
+	tests := []struct {
+		name        string
+		status      models.PaymentStatus
+		refunded    pq.Int32Array
+		seats       []int32
+		claimed     pq.Int32Array // refunded seats recorded before the provider is called, nil when it is not reached
+		conflict    bool
+		providerErr error
+		ledgerErr   bool
+		wantAmount  int64
+		wantPartial bool
+		code        codes.Code
+	}{
+		{name: "FullRefund", status: models.PaymentStatusSucceeded, claimed: pq.Int32Array{11, 12}, wantAmount: 50000, code: codes.OK},
+		{name: "PartialRefund", status: models.PaymentStatusSucceeded, seats: []int32{12}, claimed: pq.Int32Array{12}, wantAmount: 25000, wantPartial: true, code: codes.OK},
+		{name: "DuplicateSeats", status: models.PaymentStatusSucceeded, seats: []int32{11, 11}, claimed: pq.Int32Array{11}, wantAmount: 25000, wantPartial: true, code: codes.OK},
+		{name: "RestAfterPartialRefund", status: models.PaymentStatusSucceeded, refunded: pq.Int32Array{11}, claimed: pq.Int32Array{11, 12}, wantAmount: 25000, code: codes.OK},
+		{name: "RepeatedSeat", status: models.PaymentStatusSucceeded, refunded: pq.Int32Array{11}, seats: []int32{11}, code: codes.FailedPrecondition},
+		{name: "RepeatedFullRefund", status: models.PaymentStatusSucceeded, refunded: pq.Int32Array{11, 12}, code: codes.FailedPrecondition},
+		{name: "SeatNotInBooking", status: models.PaymentStatusSucceeded, seats: []int32{99}, code: codes.InvalidArgument},
+		{name: "Disputed", status: models.PaymentStatusDisputed, code: codes.FailedPrecondition},
+		{name: "AlreadyRefunded", status: models.PaymentStatusRefunded, code: codes.FailedPrecondition},
+		{name: "ConcurrentRefund", status: models.PaymentStatusSucceeded, claimed: pq.Int32Array{11, 12}, conflict: true, code: codes.Aborted},
+		{name: "LedgerDown", status: models.PaymentStatusSucceeded, claimed: pq.Int32Array{11, 12}, ledgerErr: true, wantAmount: 50000, code: codes.OK},
+		{name: "ProviderDown", status: models.PaymentStatusSucceeded, claimed: pq.Int32Array{11, 12}, providerErr: providerDown, code: codes.Unavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			payment, product := paidBooking(t, env.gateway)
+
+			if tt.providerErr != nil {
+				env.gateway.FailWith("CreateRefund", tt.providerErr)
+			}
+
+			// Seats refunded before were refunded at the provider as well
+
+			for range tt.refunded {
+				if _, err := env.gateway.CreateRefund(context.Background(), gateway.RefundParams{
+					PaymentID: payment.PaymentID,
+					Items:     []gateway.RefundItem{{ItemID: product.ProductID, Amount: money.New(25000, money.INR)}},
+				}); err != nil {
+					t.Fatalf("Failed to refund earlier seat: %v", err)
+				}
+			}
+
+			refunded := append(pq.Int32Array{}, tt.refunded...)
+
+			env.mock.ExpectQuery(`SELECT \* FROM "idempotents" WHERE idempotent_key = \$1`).WillReturnRows(sessionRows(map[string]interface{}{
+				"id":                 1,
+				"idempotent_key":     "key-1",
+				"customer_id":        payment.Customer.CustomerID,
+				"payment_status":     string(tt.status),
+				"payment_id":         payment.PaymentID,
+				"booked_seats_id":    "{11,12}",
+				"order_ids":          "{" + product.ProductID + "," + product.ProductID + "}",
+				"refunded_seats_id":  tt.refunded,
+				"movie_time_slot_id": 7,
+				"currency":           money.INR,
+			}))
+
+			if tt.claimed != nil {
+				env.mock.ExpectQuery(`SELECT \* FROM "catalog_products" WHERE product_id IN`).WillReturnRows(
+					sqlmock.NewRows([]string{"id", "product_id", "price_amount", "price_currency"}).AddRow(1, product.ProductID, 25000, money.INR),
+				)
+
+				claim := env.mock.ExpectExec(claimSQL).WithArgs(tt.claimed, sqlmock.AnyArg(), "key-1", string(tt.status), refunded)
+
+				if tt.conflict {
+					claim.WillReturnResult(sqlmock.NewResult(0, 0))
+				} else {
+					claim.WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+			}
+
+			switch {
+			case tt.claimed == nil || tt.conflict:
+			case tt.providerErr != nil:
+				env.mock.ExpectExec(claimSQL).WithArgs(refunded, sqlmock.AnyArg(), "key-1", string(tt.status), tt.claimed).WillReturnResult(sqlmock.NewResult(0, 1))
+			case tt.ledgerErr:
+				// The refund was issued, it is returned even though it could not be posted
+				env.mock.ExpectBegin()
+				env.mock.ExpectQuery(`SELECT \* FROM "journal_entries"`).WillReturnError(errConnectionReset)
+				env.mock.ExpectRollback()
+				env.expectTransition(models.PaymentStatusSucceeded)
+			default:
+				expectJournalEntry(env.mock, 2)
+
+				// The last seats refunded, in one refund or after earlier ones, refund the booking
+
+				if !tt.wantPartial {
+					env.expectTransition(models.PaymentStatusSucceeded)
+				}
+			}
+
+			response, err := env.server.RefundPayment(context.Background(), &payment_service.RefundPaymentRequest{
+				IdempotentKey:  "key-1",
+				BookedSeatsIds: tt.seats,
+			})
+
+			assertCode(t, env, err, tt.code)
+
+			captured, fetchErr := env.gateway.GetPayment(context.Background(), payment.PaymentID)
+
+			if fetchErr != nil {
+				t.Fatalf("Failed to fetch payment: %v", fetchErr)
+			}
+
+			refunds := captured.Refunds[len(tt.refunded):]
+
+			if tt.code != codes.OK {
+				if len(refunds) != 0 {
+					t.Fatalf("Expected no refund, got %+v", refunds)
+				}
+				return
+			}
+
+			if len(refunds) != 1 || refunds[0].Amount.Amount != tt.wantAmount {
+				t.Fatalf("Expected one refund of %d, got %+v", tt.wantAmount, refunds)
+			}
+
+			if response.Amount.GetAmount() != tt.wantAmount || response.IsPartial != tt.wantPartial {
+				t.Errorf("Expected a refund of %d partial %v, got %d partial %v", tt.wantAmount, tt.wantPartial, response.Amount.GetAmount(), response.IsPartial)
+			}
+		})
+	}
+}
@@ -0,0 +1,324 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/resilience"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func TestBreaker(t *testing.T) {
+
+	t.Run("OpensAfterFailuresInARow", func(t *testing.T) {
+		b := resilience.NewBreaker("test-opens", 3, time.Minute)
+
+		for _, result := range []resilience.Result{resilience.Failed, resilience.Failed, resilience.Succeeded, resilience.Failed, resilience.Failed} {
+			done, err := b.Allow()
+
+			if err != nil {
+				t.Fatalf("Expected the call to be let through, got %v", err)
+			}
+
+			done(result)
+		}
+
+		if b.State() != resilience.StateClosed {
+			t.Fatalf("Expected a success to reset the failures, got %s", b.State())
+		}
+
+		done, _ := b.Allow()
+		done(resilience.Failed)
+
+		if _, err := b.Allow(); !errors.Is(err, resilience.ErrOpen) {
+			t.Errorf("Expected ErrOpen, got %v", err)
+		}
+
+		if got := testutil.ToFloat64(metrics.CircuitBreakerState.WithLabelValues("test-opens")); got != float64(resilience.StateOpen) {
+			t.Errorf("Expected the state metric to be open, got %v", got)
+		}
+	})
+
+	tests := []struct {
+		name   string
+		result resilience.Result
+		want   resilience.State
+	}{
+		{"ProbeSucceeds", resilience.Succeeded, resilience.StateClosed},
+		{"ProbeFails", resilience.Failed, resilience.StateOpen},
+		{"ProbeAbandoned", resilience.Abandoned, resilience.StateHalfOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := resilience.NewBreaker("test-"+tt.name, 1, 20*time.Millisecond)
+
+			done, _ := b.Allow()
+			done(resilience.Failed)
+
+			time.Sleep(30 * time.Millisecond)
+
+			probe, err := b.Allow()
+
+			if err != nil {
+				t.Fatalf("Expected a probe after the cooldown, got %v", err)
+			}
+
+			if _, err := b.Allow(); !errors.Is(err, resilience.ErrOpen) {
+				t.Errorf("Expected a single probe at a time, got %v", err)
+			}
+
+			probe(tt.result)
+
+			if b.State() != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, b.State())
+			}
+		})
+	}
+
+	t.Run("IgnoresResultsOfEarlierStates", func(t *testing.T) {
+		b := resilience.NewBreaker("test-stale", 1, time.Minute)
+
+		slow, _ := b.Allow()
+
+		done, _ := b.Allow()
+		done(resilience.Failed)
+
+		slow(resilience.Succeeded)
+
+		if b.State() != resilience.StateOpen {
+			t.Errorf("Expected a call started before opening not to close the breaker, got %s", b.State())
+		}
+	})
+}
+
+func TestBackoff(t *testing.T) {
+
+	b := resilience.Backoff{Initial: 100 * time.Millisecond, Max: time.Second}
+
+	for attempt, bound := range map[int]time.Duration{1: 100 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for range 100 {
+			if d := b.Delay(attempt); d <= 0 || d > bound {
+				t.Fatalf("Expected the delay after attempt %d within (0, %s], got %s", attempt, bound, d)
+			}
+		}
+	}
+}
+
+// scriptedConn answers the calls made on it with errs in turn, then with success
+type scriptedConn struct {
+	grpc.ClientConnInterface
+	errs  []error
+	calls int
+}
+
+func (c *scriptedConn) Invoke(ctx context.Context, method string, args interface{}, reply interface{}, opts ...grpc.CallOption) error {
+
+	c.calls++
+
+	if c.calls <= len(c.errs) {
+		return c.errs[c.calls-1]
+	}
+
+	return nil
+}
+
+func TestResilientConn(t *testing.T) {
+
+	const (
+		idempotent = "/moviedb_service.MovieDBService/GetBookedSeats"
+		mutation   = "/moviedb_service.MovieDBService/BookSeats"
+	)
+
+	policies := map[string]resilience.Policy{
+		idempotent: {MaxAttempts: 3, Backoff: resilience.Backoff{Initial: time.Millisecond, Max: 5 * time.Millisecond}},
+	}
+
+	unavailable := status.Error(codes.Unavailable, "connection refused")
+
+	tests := []struct {
+		name      string
+		method    string
+		policy    *resilience.Policy
+		errs      []error
+		wantCalls int
+		wantCode  codes.Code
+	}{
+		{name: "RetriedUntilSuccess", method: idempotent, errs: []error{unavailable, unavailable}, wantCalls: 3, wantCode: codes.OK},
+		{name: "GivesUpAfterMaxAttempts", method: idempotent, errs: []error{unavailable, unavailable, unavailable, unavailable}, wantCalls: 3, wantCode: codes.Unavailable},
+		{name: "RequestErrorNotRetried", method: idempotent, errs: []error{status.Error(codes.NotFound, "no slot")}, wantCalls: 1, wantCode: codes.NotFound},
+		{name: "MutationNotRetried", method: mutation, errs: []error{unavailable}, wantCalls: 1, wantCode: codes.Unavailable},
+		{
+			name:      "BudgetSpent",
+			method:    idempotent,
+			policy:    &resilience.Policy{MaxAttempts: 3, Budget: 50 * time.Millisecond, Backoff: resilience.Backoff{Initial: time.Hour}},
+			errs:      []error{unavailable},
+			wantCalls: 1,
+			wantCode:  codes.Unavailable,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			cc := &scriptedConn{errs: tt.errs}
+
+			conn := &resilience.Conn{ClientConnInterface: cc, Service: "test", Policies: policies}
+
+			if tt.policy != nil {
+				conn.Policies = map[string]resilience.Policy{tt.method: *tt.policy}
+			}
+
+			start := time.Now()
+
+			err := conn.Invoke(context.Background(), tt.method, nil, nil)
+
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Errorf("Expected the call to end within its budget, took %s", elapsed)
+			}
+
+			if cc.calls != tt.wantCalls {
+				t.Errorf("Expected %d calls, got %d", tt.wantCalls, cc.calls)
+			}
+
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("Expected %s, got %v", tt.wantCode, err)
+			}
+		})
+	}
+
+	t.Run("BreakerFailsFast", func(t *testing.T) {
+
+		cc := &scriptedConn{errs: []error{unavailable, unavailable, unavailable}}
+
+		conn := &resilience.Conn{ClientConnInterface: cc, Service: "test", Breaker: resilience.NewBreaker("test-conn", 2, time.Minute)}
+
+		for range 2 {
+			conn.Invoke(context.Background(), mutation, nil, nil)
+		}
+
+		err := conn.Invoke(context.Background(), mutation, nil, nil)
+
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Expected Unavailable, got %v", err)
+		}
+
+		if cc.calls != 2 {
+			t.Errorf("Expected no call while the breaker is open, got %d calls", cc.calls)
+		}
+	})
+}
+
+// flakyMovieDB fails every seat check with Unavailable
+type flakyMovieDB struct {
+	moviedb_service.UnimplementedMovieDBServiceServer
+	calls atomic.Int32
+}
+
+func (m *flakyMovieDB) IsValidToCommitSeatsForBooking(ctx context.Context, in *moviedb_service.IsValidToCommitSeatsForBooking_Request) (*moviedb_service.IsValidToCommitSeatsForBooking_Response, error) {
+
+	m.calls.Add(1)
+
+	return nil, status.Error(codes.Unavailable, "warming up")
+}
+
+func TestMovieDBResilience(t *testing.T) {
+
+	movieDB := &flakyMovieDB{}
+
+	lis := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer()
+	moviedb_service.RegisterMovieDBServiceServer(s, movieDB)
+
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///moviedb",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{DSN: "host=localhost dbname=unused"}), &gorm.Config{DisableAutomaticPing: true})
+
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+
+	cfg := config.Default()
+	cfg.MovieDBBreakerFailures = server.MovieDBPolicies(cfg)[moviedb_service.MovieDBService_IsValidToCommitSeatsForBooking_FullMethodName].MaxAttempts
+
+	ps, err := server.NewPaymentServer(cfg,
+		server.WithGateway(gatewaytest.NewFakeGateway(nil)),
+		server.WithDB(db),
+		server.WithMovieDBConn(conn),
+	)
+
+	if err != nil {
+		t.Fatalf("Failed to create payment server: %v", err)
+	}
+
+	request := &payment_service.Create_Order_Request{IdempotentKey: "key-1", MovieTimeSlotId: 1, SeatMatrixIDs: []int32{1}}
+
+	attempts := int32(cfg.MovieDBBreakerFailures)
+
+	// The first order retries the seat check until the breaker opens, the
+	// second fails without reaching the movie DB service
+
+	for i := range 2 {
+		_, err := ps.CreateOrder(context.Background(), request)
+
+		if status.Code(err) != codes.Unavailable {
+			t.Errorf("Expected Unavailable for order %d, got %v", i+1, err)
+		}
+
+		if got := movieDB.calls.Load(); got != attempts {
+			t.Errorf("Expected %d seat checks after order %d, got %d", attempts, i+1, got)
+		}
+	}
+}
+
+func TestMovieDBPolicies(t *testing.T) {
+
+	cfg := config.Default()
+	cfg.MovieDBRetryAttempts = 4
+	cfg.MovieDBRetryBudget = 7 * time.Second
+
+	policies := server.MovieDBPolicies(cfg)
+
+	for _, method := range []string{
+		moviedb_service.MovieDBService_IsValidToCommitSeatsForBooking_FullMethodName,
+		moviedb_service.MovieDBService_GetSeatMatrix_FullMethodName,
+	} {
+		if policy := policies[method]; policy.MaxAttempts != 4 || policy.Budget != 7*time.Second {
+			t.Errorf("Expected %s to be retried as configured, got %+v", method, policy)
+		}
+	}
+
+	if _, ok := policies[moviedb_service.MovieDBService_BookSeats_FullMethodName]; ok {
+		t.Error("Expected BookSeats to be left to its own retries")
+	}
+}
@@ -0,0 +1,149 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	moviedb_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcClient"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+)
+
+func TestSeatHolds(t *testing.T) {
+
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+	until := now.Add(server.SeatHoldTTL)
+
+	seats := []*moviedb_service.BookedSeats{
+		{Id: 11, SeatNumber: "A1", SeatMatrixID: 1},
+		{Id: 12, SeatNumber: "A2", SeatMatrixID: 2},
+	}
+
+	// The upsert only takes a seat that is free, held by the same session or whose hold lapsed
+	upsert := `INSERT INTO "booked_seats" .* ON CONFLICT \("movie_time_slot_id","seat_matrix_id"\) DO UPDATE SET .* WHERE NOT booked_seats.is_booked AND \(booked_seats.hold_key = \$19 OR booked_seats.locked_until IS NULL OR booked_seats.locked_until < \$20\)`
+
+	expectUpsert := func(mock sqlmock.Sqlmock, seat *moviedb_service.BookedSeats, key string, taken bool) {
+
+		rows := sqlmock.NewRows([]string{"id"})
+
+		if taken {
+			rows.AddRow(seat.Id)
+		}
+
+		mock.ExpectQuery(upsert).WithArgs(
+			sqlmock.AnyArg(), sqlmock.AnyArg(), nil, seat.SeatNumber, 7, seat.SeatMatrixID, seat.Id, false, nil, "", until, key,
+			seat.Id, nil, key, until, seat.SeatNumber, now,
+			key, now,
+		).WillReturnRows(rows)
+	}
+
+	t.Run("Hold", func(t *testing.T) {
+
+		env := newRPCEnv(t, &seatCheckMovieDB{})
+		env.server.Ps.Now = func() time.Time { return now }
+
+		// The session key is passed to the condition, seats the session holds already are extended
+
+		env.mock.ExpectBegin()
+		expectUpsert(env.mock, seats[0], "key-1", true)
+		expectUpsert(env.mock, seats[1], "key-1", true)
+		env.mock.ExpectCommit()
+
+		held, err := env.server.Ps.Hold_Seats(context.Background(), "key-1", 7, seats, server.SeatHoldTTL)
+
+		if err != nil {
+			t.Fatalf("Expected the seats to be held, got %v", err)
+		}
+
+		if !held.Equal(until) {
+			t.Errorf("Expected the seats to be held until %s, got %s", until, held)
+		}
+
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Unmet database expectations: %v", err)
+		}
+	})
+
+	t.Run("HeldByAnotherSession", func(t *testing.T) {
+
+		env := newRPCEnv(t, &seatCheckMovieDB{})
+		env.server.Ps.Now = func() time.Time { return now }
+
+		// The first seat is taken, the second one is not, nothing stays held
+
+		env.mock.ExpectBegin()
+		expectUpsert(env.mock, seats[0], "key-2", true)
+		expectUpsert(env.mock, seats[1], "key-2", false)
+		env.mock.ExpectRollback()
+
+		_, err := env.server.Ps.Hold_Seats(context.Background(), "key-2", 7, seats, server.SeatHoldTTL)
+
+		if !errors.Is(err, server.ErrSeatHeld) {
+			t.Fatalf("Expected %v, got %v", server.ErrSeatHeld, err)
+		}
+
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Unmet database expectations: %v", err)
+		}
+	})
+
+	t.Run("Extend", func(t *testing.T) {
+
+		for _, tt := range []struct {
+			name    string
+			rows    int64
+			wantErr error
+		}{
+			{name: "AllSeats", rows: 2},
+			{name: "SeatTakenMeanwhile", rows: 1, wantErr: server.ErrSeatHeld},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+
+				env := newRPCEnv(t, &seatCheckMovieDB{})
+				env.server.Ps.Now = func() time.Time { return now }
+
+				env.mock.ExpectBegin()
+				env.mock.ExpectExec(`UPDATE "booked_seats" SET "hold_key"=\$1,"locked_until"=\$2,"updated_at"=\$3 WHERE \(movie_time_slot_id = \$4 AND booked_seat_id IN \(\$5,\$6\)\) AND \(NOT booked_seats.is_booked AND \(booked_seats.hold_key = \$7`).
+					WithArgs("key-1", until, sqlmock.AnyArg(), 7, 11, 12, "key-1", now).
+					WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+				if tt.wantErr != nil {
+					env.mock.ExpectRollback()
+				} else {
+					env.mock.ExpectCommit()
+				}
+
+				_, err := env.server.Ps.Extend_Seat_Holds(context.Background(), "key-1", 7, []int32{11, 12}, server.SeatHoldTTL)
+
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Expected %v, got %v", tt.wantErr, err)
+				}
+
+				if err := env.mock.ExpectationsWereMet(); err != nil {
+					t.Fatalf("Unmet database expectations: %v", err)
+				}
+			})
+		}
+	})
+
+	t.Run("Release", func(t *testing.T) {
+
+		env := newRPCEnv(t, &seatCheckMovieDB{})
+
+		// Booked seats stay with the session, only holds are given back
+
+		env.mock.ExpectExec(`UPDATE "booked_seats" SET "hold_key"=\$1,"locked_until"=\$2,"updated_at"=\$3 WHERE \(hold_key = \$4 AND NOT is_booked\)`).
+			WithArgs("", nil, sqlmock.AnyArg(), "key-1").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		if err := env.server.Ps.Release_Seat_Holds(context.Background(), "key-1"); err != nil {
+			t.Fatalf("Expected the holds to be released, got %v", err)
+		}
+
+		if err := env.mock.ExpectationsWereMet(); err != nil {
+			t.Fatalf("Unmet database expectations: %v", err)
+		}
+	})
+}
@@ -0,0 +1,337 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/auth"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tlsconfig"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for localhost, serial tells certificates apart
+func (ca *testCA) issue(t *testing.T, serial int64, name string) ([]byte, []byte) {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		URIs:         []*url.URL{{Scheme: "spiffe", Host: "booking", Path: "/" + name}},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func writeFile(t *testing.T, path string, data []byte) {
+
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeKeyPair(t *testing.T, dir string, ca *testCA, serial int64, name string) (string, string) {
+
+	certPEM, keyPEM := ca.issue(t, serial, name)
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+".key")
+
+	writeFile(t, certFile, certPEM)
+	writeFile(t, keyFile, keyPEM)
+
+	return certFile, keyFile
+}
+
+func leafSerial(t *testing.T, r *tlsconfig.Reloader) int64 {
+
+	cert := r.Certificate()
+
+	if cert == nil {
+		t.Fatal("Expected a certificate")
+	}
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf.SerialNumber.Int64()
+}
+
+func TestTLSReloader(t *testing.T) {
+
+	ca := newTestCA(t)
+
+	t.Run("PicksUpRotatedCertificate", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeKeyPair(t, dir, ca, 10, "server")
+
+		r, err := tlsconfig.NewReloader(certFile, keyFile, "", time.Nanosecond)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if serial := leafSerial(t, r); serial != 10 {
+			t.Fatalf("Expected serial 10, got %d", serial)
+		}
+
+		writeKeyPair(t, dir, ca, 11, "server")
+
+		if serial := leafSerial(t, r); serial != 11 {
+			t.Errorf("Expected the rotated certificate, got serial %d", serial)
+		}
+	})
+
+	t.Run("KeepsCertificateWhenReloadFails", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeKeyPair(t, dir, ca, 20, "server")
+
+		r, err := tlsconfig.NewReloader(certFile, keyFile, "", time.Nanosecond)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		// The certificate is rotated but the matching key is not written yet
+		certPEM, _ := ca.issue(t, 21, "server")
+		writeFile(t, certFile, certPEM)
+
+		if serial := leafSerial(t, r); serial != 20 {
+			t.Errorf("Expected the previous certificate, got serial %d", serial)
+		}
+	})
+
+	t.Run("WaitsForInterval", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeKeyPair(t, dir, ca, 30, "server")
+
+		r, err := tlsconfig.NewReloader(certFile, keyFile, "", time.Hour)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		writeKeyPair(t, dir, ca, 31, "server")
+
+		if serial := leafSerial(t, r); serial != 30 {
+			t.Errorf("Expected no reload before the interval, got serial %d", serial)
+		}
+	})
+
+	t.Run("InvalidFiles", func(t *testing.T) {
+		dir := t.TempDir()
+		certFile, keyFile := writeKeyPair(t, dir, ca, 40, "server")
+
+		caFile := filepath.Join(dir, "ca.pem")
+		writeFile(t, caFile, []byte("not a certificate"))
+
+		cases := []struct {
+			name     string
+			certFile string
+			keyFile  string
+			caFile   string
+		}{
+			{"CertificateWithoutKey", certFile, "", ""},
+			{"MissingCertificate", filepath.Join(dir, "missing.pem"), keyFile, ""},
+			{"EmptyCABundle", certFile, keyFile, caFile},
+		}
+
+		for _, tc := range cases {
+			t.Run(tc.name, func(t *testing.T) {
+				if _, err := tlsconfig.NewReloader(tc.certFile, tc.keyFile, tc.caFile, 0); err == nil {
+					t.Error("Expected an error")
+				}
+			})
+		}
+	})
+}
+
+func TestTLSConnection(t *testing.T) {
+
+	ca := newTestCA(t)
+	dir := t.TempDir()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writeFile(t, caFile, ca.pem)
+
+	serverCert, serverKey := writeKeyPair(t, dir, ca, 100, "server")
+	clientCert, clientKey := writeKeyPair(t, dir, ca, 101, auth.BookingGateway)
+
+	serverFiles, err := tlsconfig.NewReloader(serverCert, serverKey, caFile, 0)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	authenticator := &auth.Authenticator{AllowMTLS: true, Policy: auth.Policy{}}
+
+	var caller auth.Identity
+
+	grpcServer := grpc.NewServer(
+		grpc.Creds(credentials.NewTLS(tlsconfig.ServerConfig(serverFiles, tls.RequireAndVerifyClientCert))),
+		grpc.ChainUnaryInterceptor(
+			authenticator.UnaryServerInterceptor(),
+			func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+				caller, _ = auth.FromContext(ctx)
+				return handler(ctx, req)
+			},
+		),
+	)
+
+	healthpb.RegisterHealthServer(grpcServer, health.NewServer())
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go grpcServer.Serve(lis)
+	t.Cleanup(grpcServer.Stop)
+
+	check := func(t *testing.T, certFile string, keyFile string) error {
+
+		clientFiles, err := tlsconfig.NewReloader(certFile, keyFile, caFile, 0)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(tlsconfig.NewClientCredentials(clientFiles, "localhost")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		_, err = healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+
+		return err
+	}
+
+	t.Run("ClientCertificateIsIdentity", func(t *testing.T) {
+		if err := check(t, clientCert, clientKey); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if caller.Method != auth.MethodMTLS || caller.Subject != "spiffe://booking/"+auth.BookingGateway {
+			t.Errorf("Unexpected caller %v", caller)
+		}
+	})
+
+	t.Run("ClientCertificateRequired", func(t *testing.T) {
+		if err := check(t, "", ""); err == nil {
+			t.Error("Expected the handshake to fail without a client certificate")
+		}
+	})
+
+	t.Run("UntrustedServer", func(t *testing.T) {
+		otherCAFile := filepath.Join(dir, "other-ca.pem")
+		writeFile(t, otherCAFile, newTestCA(t).pem)
+
+		clientFiles, err := tlsconfig.NewReloader(clientCert, clientKey, otherCAFile, 0)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(tlsconfig.NewClientCredentials(clientFiles, "localhost")))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		defer conn.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err == nil {
+			t.Error("Expected the server certificate to be rejected")
+		}
+	})
+}
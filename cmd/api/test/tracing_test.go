@@ -0,0 +1,304 @@
+package test
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// recordSpans installs a tracer provider that keeps every span in memory as the
+// global one for the duration of the test
+func recordSpans(t *testing.T) (*tracetest.SpanRecorder, trace.Tracer) {
+
+	if _, err := tracing.Setup(context.Background(), config.Default()); err != nil {
+		t.Fatalf("Failed to set up tracing: %v", err)
+	}
+
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	return recorder, provider.Tracer("test")
+}
+
+func spanNamed(spans []sdktrace.ReadOnlySpan, name string) sdktrace.ReadOnlySpan {
+
+	for _, span := range spans {
+		if span.Name() == name {
+			return span
+		}
+	}
+
+	return nil
+}
+
+func spanAttribute(span sdktrace.ReadOnlySpan, key attribute.Key) (attribute.Value, bool) {
+
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value, true
+		}
+	}
+
+	return attribute.Value{}, false
+}
+
+type idempotentKeyServer struct {
+	payment_service.UnimplementedPaymentServiceServer
+}
+
+func (idempotentKeyServer) IsValidIdempotentKey(ctx context.Context, in *payment_service.IsValidIdempotentKeyRequest) (*payment_service.IsValidIdempotentKeyResponse, error) {
+	return &payment_service.IsValidIdempotentKeyResponse{IsValid: true}, nil
+}
+
+func TestGRPCTracing(t *testing.T) {
+
+	recorder, tracer := recordSpans(t)
+
+	lis := bufconn.Listen(1 << 20)
+
+	s := grpc.NewServer(
+		grpc.StatsHandler(tracing.ServerHandler()),
+		grpc.ChainUnaryInterceptor(tracing.UnaryServerInterceptor()),
+	)
+
+	payment_service.RegisterPaymentServiceServer(s, idempotentKeyServer{})
+	healthpb.RegisterHealthServer(s, health.NewServer())
+
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///payments",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(tracing.ClientHandler()),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { conn.Close() })
+
+	ctx, parent := tracer.Start(context.Background(), "booking")
+
+	_, err = payment_service.NewPaymentServiceClient(conn).IsValidIdempotentKey(ctx, &payment_service.IsValidIdempotentKeyRequest{IdempotentKey: "key-1"})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Unexpected health check error: %v", err)
+	}
+
+	parent.End()
+
+	spans := recorder.Ended()
+
+	method := strings.TrimPrefix(payment_service.PaymentService_IsValidIdempotentKey_FullMethodName, "/")
+
+	var client, server sdktrace.ReadOnlySpan
+
+	for _, span := range spans {
+		if span.Name() != method {
+			continue
+		}
+
+		switch span.SpanKind() {
+		case trace.SpanKindClient:
+			client = span
+		case trace.SpanKindServer:
+			server = span
+		}
+	}
+
+	if client == nil || server == nil {
+		t.Fatalf("Expected a client and a server span for %s, got %d spans", method, len(spans))
+	}
+
+	if client.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the client span to be a child of the caller's span")
+	}
+
+	if server.Parent().SpanID() != client.SpanContext().SpanID() || server.SpanContext().TraceID() != parent.SpanContext().TraceID() {
+		t.Error("Expected the server span to continue the caller's trace")
+	}
+
+	if key, ok := spanAttribute(server, tracing.IdempotentKey); !ok || key.AsString() != "key-1" {
+		t.Errorf("Expected the idempotent key on the server span, got %q", key.AsString())
+	}
+
+	for _, span := range spans {
+		if strings.Contains(span.Name(), "grpc.health") {
+			t.Errorf("Expected health checks to be left out, got span %s", span.Name())
+		}
+	}
+}
+
+func TestGormTracing(t *testing.T) {
+
+	recorder, tracer := recordSpans(t)
+
+	sqlDB, mock, err := sqlmock.New()
+
+	if err != nil {
+		t.Fatalf("Failed to create database mock: %v", err)
+	}
+
+	t.Cleanup(func() { sqlDB.Close() })
+
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true, Logger: logger.Discard})
+
+	if err != nil {
+		t.Fatalf("Failed to open database handle: %v", err)
+	}
+
+	if err := db.Use(&tracing.GormPlugin{}); err != nil {
+		t.Fatalf("Failed to install the plugin: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		traced  bool
+		rows    *sqlmock.Rows
+		err     error
+		wantErr bool
+	}{
+		{name: "Found", traced: true, rows: sqlmock.NewRows([]string{"id"}).AddRow(1)},
+		{name: "NotFoundIsNotAnError", traced: true, rows: sqlmock.NewRows([]string{"id"})},
+		{name: "Failed", traced: true, err: errConnectionReset, wantErr: true},
+		{name: "NoParentSpan", rows: sqlmock.NewRows([]string{"id"}).AddRow(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			recorder.Reset()
+
+			query := mock.ExpectQuery(`SELECT \* FROM "idempotents"`)
+
+			if tt.err != nil {
+				query.WillReturnError(tt.err)
+			} else {
+				query.WillReturnRows(tt.rows)
+			}
+
+			ctx := context.Background()
+
+			var parent trace.Span
+
+			if tt.traced {
+				ctx, parent = tracer.Start(ctx, "booking")
+			}
+
+			db.WithContext(ctx).Where("idempotent_key = ?", "key-1").First(&models.Idempotent{})
+
+			if parent != nil {
+				parent.End()
+			}
+
+			span := spanNamed(recorder.Ended(), "postgres query idempotents")
+
+			if !tt.traced {
+				if span != nil {
+					t.Error("Expected no span without a parent span")
+				}
+				return
+			}
+
+			if span == nil {
+				t.Fatalf("Expected a query span, got %d spans", len(recorder.Ended()))
+			}
+
+			if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+				t.Error("Expected the query span to be a child of the caller's span")
+			}
+
+			if sql, _ := spanAttribute(span, "db.query.text"); !strings.Contains(sql.AsString(), "idempotent_key = $1") {
+				t.Errorf("Expected the SQL with placeholders, got %q", sql.AsString())
+			}
+
+			if (span.Status().Code == codes.Error) != tt.wantErr {
+				t.Errorf("Expected error status %t, got %v", tt.wantErr, span.Status())
+			}
+		})
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Unmet database expectations: %v", err)
+	}
+}
+
+func TestHTTPTracing(t *testing.T) {
+
+	recorder, tracer := recordSpans(t)
+
+	var traceparent string
+
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+
+	t.Cleanup(provider.Close)
+
+	client := &http.Client{Transport: tracing.Transport("dodo", nil)}
+
+	ctx, parent := tracer.Start(context.Background(), "booking")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, provider.URL+"/customers", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Do(req)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	resp.Body.Close()
+	parent.End()
+
+	span := spanNamed(recorder.Ended(), "dodo POST")
+
+	if span == nil {
+		t.Fatal("Expected a span for the provider call")
+	}
+
+	if span.Parent().SpanID() != parent.SpanContext().SpanID() {
+		t.Error("Expected the provider call span to be a child of the caller's span")
+	}
+
+	if !strings.Contains(traceparent, parent.SpanContext().TraceID().String()) {
+		t.Errorf("Expected the trace context to be sent to the provider, got %q", traceparent)
+	}
+}
@@ -0,0 +1,404 @@
+package test
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway"
+	"github.com/kartik7120/booking_payment_service/cmd/api/gateway/gatewaytest"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/models"
+	"github.com/kartik7120/booking_payment_service/cmd/api/money"
+	"github.com/kartik7120/booking_payment_service/cmd/api/server"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func signWebhook(secret []byte, id string, timestamp time.Time, body string) http.Header {
+
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(id + "." + ts + "." + body))
+
+	header := http.Header{}
+	header.Set(server.WebhookIDHeader, id)
+	header.Set(server.WebhookTimestampHeader, ts)
+	header.Set(server.WebhookSignatureHeader, "v1,"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+
+	return header
+}
+
+func TestVerifyWebhookSignature(t *testing.T) {
+
+	secret, err := server.DecodeWebhookSecret("whsec_" + base64.StdEncoding.EncodeToString([]byte("test-secret")))
+
+	if err != nil {
+		t.Fatalf("Failed to decode secret: %v", err)
+	}
+
+	now := time.Now()
+	body := `{"type":"payment.succeeded","data":{}}`
+
+	t.Run("ValidSignature", func(t *testing.T) {
+		header := signWebhook(secret, "msg_1", now, body)
+
+		if err := server.VerifyWebhookSignature(secret, header, []byte(body), now, server.DefaultWebhookTolerance); err != nil {
+			t.Fatalf("Expected signature to be valid, got %v", err)
+		}
+	})
+
+	t.Run("RotatedSecretSignatures", func(t *testing.T) {
+		header := signWebhook(secret, "msg_1", now, body)
+		header.Set(server.WebhookSignatureHeader, "v1,b2xkc2lnbmF0dXJl "+header.Get(server.WebhookSignatureHeader))
+
+		if err := server.VerifyWebhookSignature(secret, header, []byte(body), now, server.DefaultWebhookTolerance); err != nil {
+			t.Fatalf("Expected one of the signatures to match, got %v", err)
+		}
+	})
+
+	t.Run("TamperedBody", func(t *testing.T) {
+		header := signWebhook(secret, "msg_1", now, body)
+
+		err := server.VerifyWebhookSignature(secret, header, []byte(strings.Replace(body, "succeeded", "failed", 1)), now, server.DefaultWebhookTolerance)
+
+		if !errors.Is(err, server.ErrWebhookInvalidSignature) {
+			t.Fatalf("Expected ErrWebhookInvalidSignature, got %v", err)
+		}
+	})
+
+	t.Run("ReplayOutsideTolerance", func(t *testing.T) {
+		header := signWebhook(secret, "msg_1", now.Add(-10*time.Minute), body)
+
+		err := server.VerifyWebhookSignature(secret, header, []byte(body), now, server.DefaultWebhookTolerance)
+
+		if !errors.Is(err, server.ErrWebhookTimestampExpired) {
+			t.Fatalf("Expected ErrWebhookTimestampExpired, got %v", err)
+		}
+	})
+
+	t.Run("MissingHeaders", func(t *testing.T) {
+		err := server.VerifyWebhookSignature(secret, http.Header{}, []byte(body), now, server.DefaultWebhookTolerance)
+
+		if !errors.Is(err, server.ErrWebhookMissingHeaders) {
+			t.Fatalf("Expected ErrWebhookMissingHeaders, got %v", err)
+		}
+	})
+
+	t.Run("RejectedByHandler", func(t *testing.T) {
+		w := &server.Webhook_Server{
+			Secret:    secret,
+			Tolerance: server.DefaultWebhookTolerance,
+			Now:       func() time.Time { return now },
+		}
+
+		req := httptest.NewRequest(http.MethodPost, "/webhooks/dodopayments", strings.NewReader(body))
+		req.Header = signWebhook([]byte("wrong-secret"), "msg_1", now, body)
+
+		rec := httptest.NewRecorder()
+		w.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected status %d, got %d", http.StatusUnauthorized, rec.Code)
+		}
+	})
+}
+
+// fakePayment creates a payment for the session key-1 at the fake gateway
+func fakePayment(t *testing.T, fake *gatewaytest.FakeGateway) *gateway.Payment {
+
+	ctx := context.Background()
+
+	customer, err := fake.CreateCustomer(ctx, gateway.CustomerParams{Email: "asha@example.com", Name: "Asha", PhoneNumber: "+919876543210"})
+
+	if err != nil {
+		t.Fatalf("Failed to create customer: %v", err)
+	}
+
+	product, err := fake.CreateProduct(ctx, gateway.ProductParams{Name: "Dune - VIP", Price: money.New(25000, money.INR)})
+
+	if err != nil {
+		t.Fatalf("Failed to create product: %v", err)
+	}
+
+	payment, err := fake.CreatePayment(ctx, gateway.PaymentParams{
+		CustomerID:  customer.CustomerID,
+		ProductCart: []gateway.CartItem{{ProductID: product.ProductID, Quantity: 1}},
+		Currency:    money.INR,
+		Metadata:    map[string]string{"idempotent_key": "key-1"},
+	})
+
+	if err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+
+	return payment
+}
+
+func TestStaleFailure(t *testing.T) {
+
+	env := newRPCEnv(t, &seatCheckMovieDB{})
+
+	env.gateway.Secret = []byte("test-secret")
+	env.gateway.Webhooks = &server.Webhook_Server{
+		Ps:        env.server.Ps,
+		Secret:    env.gateway.Secret,
+		Tolerance: server.DefaultWebhookTolerance,
+		Now:       time.Now,
+	}
+
+	payment := fakePayment(t, env.gateway)
+
+	// The session is on a newer link, the failure of the earlier payment neither
+	// fails the session nor releases the seats held for the newer link
+
+	env.mock.ExpectQuery(`SELECT \* FROM "idempotents" WHERE idempotent_key = \$1 ORDER BY`).WillReturnRows(sessionRows(map[string]interface{}{
+		"id":             1,
+		"idempotent_key": "key-1",
+		"customer_id":    payment.Customer.CustomerID,
+		"payment_status": string(models.PaymentStatusLinkIssued),
+		"payment_id":     "pay_newer",
+		"deleted_at":     nil,
+	}))
+
+	if err := env.gateway.FailPayment(payment.PaymentID); err != nil {
+		t.Fatalf("Expected the failure to be acknowledged, got %v", err)
+	}
+
+	if err := env.mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("Database calls did not match: %v", err)
+	}
+}
+
+func TestReversalEvents(t *testing.T) {
+
+	tests := []struct {
+		name       string
+		event      string
+		data       func(payment *gateway.Payment, refund *gateway.Refund) map[string]interface{}
+		partial    bool
+		posted     bool
+		transition models.PaymentStatus // state the session moves out of, empty when it stays
+	}{
+		{
+			name:  "RefundIssuedAtProvider",
+			event: "refund.succeeded",
+			data: func(p *gateway.Payment, r *gateway.Refund) map[string]interface{} {
+				return map[string]interface{}{"refund_id": r.RefundID, "payment_id": p.PaymentID, "amount": r.Amount.Amount, "is_partial": false, "status": "succeeded"}
+			},
+			posted:     true,
+			transition: models.PaymentStatusSucceeded,
+		},
+		{
+			name:    "PartialRefundIssuedAtProvider",
+			event:   "refund.succeeded",
+			partial: true,
+			data: func(p *gateway.Payment, r *gateway.Refund) map[string]interface{} {
+				return map[string]interface{}{"refund_id": r.RefundID, "payment_id": p.PaymentID, "amount": r.Amount.Amount, "is_partial": true, "status": "succeeded"}
+			},
+			posted: true,
+		},
+		{
+			name:  "DisputeOpened",
+			event: "dispute.opened",
+			data: func(p *gateway.Payment, r *gateway.Refund) map[string]interface{} {
+				return map[string]interface{}{"dispute_id": "dsp_1", "payment_id": p.PaymentID, "amount": "25000", "currency": money.INR, "dispute_status": "dispute_opened"}
+			},
+			transition: models.PaymentStatusSucceeded,
+		},
+		{
+			name:  "DisputeLost",
+			event: "dispute.lost",
+			data: func(p *gateway.Payment, r *gateway.Refund) map[string]interface{} {
+				return map[string]interface{}{"dispute_id": "dsp_1", "payment_id": p.PaymentID, "amount": "25000", "currency": money.INR, "dispute_status": "dispute_lost"}
+			},
+			posted:     true,
+			transition: models.PaymentStatusDisputed,
+		},
+		{
+			name:  "DisputeWon",
+			event: "dispute.won",
+			data: func(p *gateway.Payment, r *gateway.Refund) map[string]interface{} {
+				return map[string]interface{}{"dispute_id": "dsp_1", "payment_id": p.PaymentID, "amount": "25000", "currency": money.INR, "dispute_status": "dispute_won"}
+			},
+			transition: models.PaymentStatusDisputed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			payment, product := paidBooking(t, env.gateway)
+
+			var refund *gateway.Refund
+
+			if strings.HasPrefix(tt.event, "refund.") {
+				params := gateway.RefundParams{PaymentID: payment.PaymentID}
+
+				if tt.partial {
+					params.Items = []gateway.RefundItem{{ItemID: product.ProductID, Amount: money.New(25000, money.INR)}}
+				}
+
+				var err error
+
+				if refund, err = env.gateway.CreateRefund(context.Background(), params); err != nil {
+					t.Fatalf("Failed to refund at the provider: %v", err)
+				}
+			}
+
+			env.mock.ExpectQuery(`SELECT "idempotent_key","customer_id","venue_id" FROM "idempotents"`).WillReturnRows(
+				sqlmock.NewRows([]string{"idempotent_key", "customer_id", "venue_id"}).AddRow("key-1", payment.Customer.CustomerID, 3),
+			)
+
+			if tt.posted {
+				expectJournalEntry(env.mock, 2)
+			}
+
+			if tt.transition != "" {
+				env.expectTransition(tt.transition)
+			}
+
+			succeeded := metrics.PaymentsSucceeded.WithLabelValues(string(money.INR), metrics.Venue(0))
+			before := testutil.ToFloat64(succeeded)
+
+			data, err := json.Marshal(tt.data(payment, refund))
+
+			if err != nil {
+				t.Fatalf("Failed to encode event data: %v", err)
+			}
+
+			if err := env.server.Ps.Handle_Webhook_Event(context.Background(), server.WebhookEvent{Type: tt.event, Data: data}); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Database calls did not match: %v", err)
+			}
+
+			if got := testutil.ToFloat64(succeeded) - before; got != 0 {
+				t.Errorf("Expected the payment not to be counted as succeeded again, got %v", got)
+			}
+		})
+	}
+}
+
+func TestLateCapture(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		status    models.PaymentStatus
+		deleted   bool
+		otherLink bool
+		refunded  bool
+	}{
+		{name: "ExpiredSession", status: models.PaymentStatusExpired, deleted: true, refunded: true},
+		{name: "PaidWithAnotherPayment", status: models.PaymentStatusSucceeded, otherLink: true, refunded: true},
+		{name: "RedeliveredAfterRefund", status: models.PaymentStatusRefunded},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			env := newRPCEnv(t, &seatCheckMovieDB{})
+
+			env.gateway.Secret = []byte("test-secret")
+			env.gateway.Webhooks = &server.Webhook_Server{
+				Ps:        env.server.Ps,
+				Secret:    env.gateway.Secret,
+				Tolerance: server.DefaultWebhookTolerance,
+				Now:       time.Now,
+			}
+
+			payment := fakePayment(t, env.gateway)
+
+			session := map[string]interface{}{
+				"id":             1,
+				"idempotent_key": "key-1",
+				"customer_id":    payment.Customer.CustomerID,
+				"payment_status": string(tt.status),
+				"payment_id":     payment.PaymentID,
+				"deleted_at":     nil,
+			}
+
+			if tt.deleted {
+				session["deleted_at"] = time.Now().Add(-time.Hour)
+			}
+
+			if tt.otherLink {
+				session["payment_id"] = "pay_other"
+			}
+
+			env.mock.ExpectQuery(`SELECT \* FROM "idempotents" WHERE idempotent_key = \$1 ORDER BY`).WillReturnRows(sessionRows(session))
+
+			if tt.refunded {
+				expectJournalEntry(env.mock, 2)
+
+				// The refund.succeeded event of the refund cannot move the session on, it is acknowledged
+
+				if tt.otherLink {
+					env.mock.ExpectQuery(`SELECT "idempotent_key","customer_id","venue_id" FROM "idempotents"`).WillReturnRows(sqlmock.NewRows([]string{"idempotent_key"}))
+					expectJournalEntry(env.mock, 2)
+				} else {
+					// The event posts the refund, the automatic refund then finds it posted
+					env.mock.ExpectQuery(`SELECT "idempotent_key","customer_id","venue_id" FROM "idempotents"`).WillReturnRows(
+						sqlmock.NewRows([]string{"idempotent_key", "customer_id", "venue_id"}).AddRow("key-1", payment.Customer.CustomerID, 0),
+					)
+					expectJournalEntry(env.mock, 2)
+					env.mock.ExpectBegin()
+					env.mock.ExpectQuery(`SELECT "id","payment_status","currency","venue_id" FROM "idempotents"`).WillReturnRows(
+						sqlmock.NewRows([]string{"id", "payment_status", "currency", "venue_id"}).AddRow(1, string(tt.status), money.INR, 0),
+					)
+					env.mock.ExpectRollback()
+					expectJournalEntryPosted(env.mock)
+				}
+			}
+
+			refunds := metrics.Refunds.WithLabelValues(string(money.INR), metrics.Venue(0), "false")
+			before := testutil.ToFloat64(refunds)
+
+			if err := env.gateway.SucceedPayment(payment.PaymentID); err != nil {
+				t.Fatalf("Expected the capture to be acknowledged, got %v", err)
+			}
+
+			var want float64
+
+			if tt.refunded {
+				want = 1
+			}
+
+			if got := testutil.ToFloat64(refunds) - before; got != want {
+				t.Errorf("Expected %v refunds counted, got %v", want, got)
+			}
+
+			captured, err := env.gateway.GetPayment(context.Background(), payment.PaymentID)
+
+			if err != nil {
+				t.Fatalf("Failed to fetch payment: %v", err)
+			}
+
+			if tt.refunded && (len(captured.Refunds) != 1 || captured.Refunds[0].Amount != captured.TotalAmount) {
+				t.Errorf("Expected the capture to be refunded in full, got refunds %v", captured.Refunds)
+			}
+
+			if !tt.refunded && len(captured.Refunds) != 0 {
+				t.Errorf("Expected no refund, got %v", captured.Refunds)
+			}
+
+			if err := env.mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("Database calls did not match: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Package tlsconfig builds the TLS settings of the gRPC server and of the
+// movie DB client. Certificates, keys and CA bundles are read from files and
+// reloaded when the files change, so rotated certificates are picked up
+// without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// DefaultReloadInterval is how often the files are checked for changes when no interval is given
+const DefaultReloadInterval = 30 * time.Second
+
+// Reloader holds a certificate with its key and a CA bundle read from files.
+// The files are checked for changes at most once per interval, when a TLS
+// handshake needs them, and reloaded when they changed. A reload that fails,
+// e.g. because the certificate was written but the key not yet, keeps the
+// previous files in use.
+type Reloader struct {
+	certFile string
+	keyFile  string
+	caFile   string
+	interval time.Duration
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	stamps  []fileStamp
+	checked time.Time
+}
+
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader reads the files, certFile and keyFile are either both set or both
+// empty and caFile may be empty
+func NewReloader(certFile string, keyFile string, caFile string, interval time.Duration) (*Reloader, error) {
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("certificate and key files must be given together")
+	}
+
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: interval,
+	}
+
+	stamps, err := r.stat()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.load(stamps); err != nil {
+		return nil, err
+	}
+
+	r.checked = time.Now()
+
+	return r, nil
+}
+
+// Certificate returns the current certificate, nil when the reloader has none
+func (r *Reloader) Certificate() *tls.Certificate {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+
+	return r.cert
+}
+
+// CAPool returns the current CA bundle, nil when the reloader has none
+func (r *Reloader) CAPool() *x509.CertPool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.refresh()
+
+	return r.pool
+}
+
+// refresh reloads the files if the interval passed and they changed, r.mu is held
+func (r *Reloader) refresh() {
+
+	now := time.Now()
+
+	if now.Sub(r.checked) < r.interval {
+		return
+	}
+
+	r.checked = now
+
+	stamps, err := r.stat()
+
+	if err != nil {
+		log.Error("Failed to check TLS files for changes, keeping the loaded ones: ", err)
+		return
+	}
+
+	if sameStamps(stamps, r.stamps) {
+		return
+	}
+
+	if err := r.load(stamps); err != nil {
+		log.Error("Failed to reload TLS files, keeping the loaded ones: ", err)
+		return
+	}
+
+	log.Infof("Reloaded TLS files %v", r.files())
+}
+
+func (r *Reloader) load(stamps []fileStamp) error {
+
+	var cert *tls.Certificate
+
+	if r.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+
+		if err != nil {
+			return fmt.Errorf("failed to load certificate %s: %w", r.certFile, err)
+		}
+
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+
+	if r.caFile != "" {
+		data, err := os.ReadFile(r.caFile)
+
+		if err != nil {
+			return fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool = x509.NewCertPool()
+
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("CA bundle %s has no PEM certificates", r.caFile)
+		}
+	}
+
+	r.cert = cert
+	r.pool = pool
+	r.stamps = stamps
+
+	return nil
+}
+
+func (r *Reloader) files() []string {
+
+	var files []string
+
+	for _, f := range []string{r.certFile, r.keyFile, r.caFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	return files
+}
+
+// stat follows symlinks, so certificates mounted from a Kubernetes secret are
+// seen as changed when the secret is updated
+func (r *Reloader) stat() ([]fileStamp, error) {
+
+	var stamps []fileStamp
+
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stamps = append(stamps, fileStamp{modTime: info.ModTime(), size: info.Size()})
+	}
+
+	return stamps, nil
+}
+
+func sameStamps(a []fileStamp, b []fileStamp) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,143 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// ServerConfig serves the certificate of r and, unless clientAuth is
+// tls.NoClientCert, verifies client certificates against the CA bundle of r.
+// Both are looked up per handshake, so rotated files apply to new connections.
+func ServerConfig(r *Reloader, clientAuth tls.ClientAuthType) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+
+			cert := r.Certificate()
+
+			if cert == nil {
+				return nil, errors.New("no server certificate loaded")
+			}
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				ClientCAs:    r.CAPool(),
+				ClientAuth:   clientAuth,
+				NextProtos:   []string{"h2"},
+			}, nil
+		},
+	}
+}
+
+// ClientConfig presents the certificate of r, if any, when the server asks for
+// one, and verifies the server certificate against the CA bundle of r, or the
+// system roots when it has none. serverName overrides the name the certificate
+// is checked for, the host of the dialled address by default.
+func ClientConfig(r *Reloader, serverName string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+		RootCAs:    r.CAPool(),
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+
+			if cert := r.Certificate(); cert != nil {
+				return cert, nil
+			}
+
+			return &tls.Certificate{}, nil
+		},
+	}
+}
+
+// clientCredentials builds the client TLS settings per connection, the CA
+// bundle is read once per tls.Config and would not be reloaded otherwise
+type clientCredentials struct {
+	credentials.TransportCredentials
+	reloader   *Reloader
+	serverName string
+}
+
+// NewClientCredentials returns gRPC client credentials using ClientConfig
+func NewClientCredentials(r *Reloader, serverName string) credentials.TransportCredentials {
+	return &clientCredentials{
+		TransportCredentials: credentials.NewTLS(ClientConfig(r, serverName)),
+		reloader:             r,
+		serverName:           serverName,
+	}
+}
+
+func (c *clientCredentials) ClientHandshake(ctx context.Context, authority string, conn net.Conn) (net.Conn, credentials.AuthInfo, error) {
+	return credentials.NewTLS(ClientConfig(c.reloader, c.serverName)).ClientHandshake(ctx, authority, conn)
+}
+
+func (c *clientCredentials) Clone() credentials.TransportCredentials {
+	return NewClientCredentials(c.reloader, c.serverName)
+}
+
+func (c *clientCredentials) OverrideServerName(serverName string) error {
+	c.serverName = serverName
+	return c.TransportCredentials.OverrideServerName(serverName)
+}
+
+// ClientAuth returns the client certificate verification of a tls_client_auth setting
+func ClientAuth(mode string) (tls.ClientAuthType, error) {
+
+	switch mode {
+	case "", config.ClientAuthNone:
+		return tls.NoClientCert, nil
+	case config.ClientAuthOptional:
+		return tls.VerifyClientCertIfGiven, nil
+	case config.ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unknown client auth mode %q", mode)
+	}
+}
+
+// ServerCredentials returns the transport credentials of the gRPC server, nil
+// when no server certificate is configured and the server runs in plaintext
+func ServerCredentials(cfg *config.Config) (credentials.TransportCredentials, error) {
+
+	if cfg.TLSCertFile == "" {
+		return nil, nil
+	}
+
+	clientAuth, err := ClientAuth(cfg.TLSClientAuth)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReloader(cfg.TLSCertFile, cfg.TLSKeyFile, cfg.TLSClientCAFile, cfg.TLSReloadInterval)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server TLS files: %w", err)
+	}
+
+	return credentials.NewTLS(ServerConfig(r, clientAuth)), nil
+}
+
+// MovieDBCredentials returns the transport credentials of the movie DB
+// connection, plaintext unless moviedb_tls is set
+func MovieDBCredentials(cfg *config.Config) (credentials.TransportCredentials, error) {
+
+	if !cfg.MovieDBTLS {
+		return insecure.NewCredentials(), nil
+	}
+
+	r, err := NewReloader(cfg.MovieDBCertFile, cfg.MovieDBKeyFile, cfg.MovieDBCAFile, cfg.TLSReloadInterval)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to load movie DB TLS files: %w", err)
+	}
+
+	return NewClientCredentials(r, cfg.MovieDBServerName), nil
+}
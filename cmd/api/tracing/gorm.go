@@ -0,0 +1,122 @@
+package tracing
+
+import (
+	"errors"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+const gormSpanKey = "tracing:span"
+
+// GormPlugin starts a span for every query made through a gorm.DB. Queries are
+// only recorded when their context carries a span, e.g. that of a gRPC call
+// passed on with WithContext, so background queries do not start traces of
+// their own. The span has the SQL with placeholders, never the values.
+type GormPlugin struct {
+	// TracerProvider defaults to the global one
+	TracerProvider trace.TracerProvider
+}
+
+func (p *GormPlugin) Name() string {
+	return "tracing"
+}
+
+func (p *GormPlugin) Initialize(db *gorm.DB) error {
+
+	provider := p.TracerProvider
+
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+
+	tracer := provider.Tracer(InstrumentationName)
+
+	cb := db.Callback()
+
+	return errors.Join(
+		cb.Create().Before("gorm:create").Register("tracing:before_create", startSpan(tracer, "create")),
+		cb.Create().After("gorm:create").Register("tracing:after_create", endSpan),
+		cb.Query().Before("gorm:query").Register("tracing:before_query", startSpan(tracer, "query")),
+		cb.Query().After("gorm:query").Register("tracing:after_query", endSpan),
+		cb.Update().Before("gorm:update").Register("tracing:before_update", startSpan(tracer, "update")),
+		cb.Update().After("gorm:update").Register("tracing:after_update", endSpan),
+		cb.Delete().Before("gorm:delete").Register("tracing:before_delete", startSpan(tracer, "delete")),
+		cb.Delete().After("gorm:delete").Register("tracing:after_delete", endSpan),
+		cb.Row().Before("gorm:row").Register("tracing:before_row", startSpan(tracer, "row")),
+		cb.Row().After("gorm:row").Register("tracing:after_row", endSpan),
+		cb.Raw().Before("gorm:raw").Register("tracing:before_raw", startSpan(tracer, "raw")),
+		cb.Raw().After("gorm:raw").Register("tracing:after_raw", endSpan),
+	)
+}
+
+func startSpan(tracer trace.Tracer, operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+
+		ctx := db.Statement.Context
+
+		if ctx == nil || !trace.SpanContextFromContext(ctx).IsValid() {
+			return
+		}
+
+		name := "postgres " + operation
+
+		if db.Statement.Table != "" {
+			name += " " + db.Statement.Table
+		}
+
+		ctx, span := tracer.Start(ctx, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(semconv.DBSystemNamePostgreSQL),
+		)
+
+		db.Statement.Context = ctx
+		db.InstanceSet(gormSpanKey, span)
+	}
+}
+
+func endSpan(db *gorm.DB) {
+
+	value, ok := db.InstanceGet(gormSpanKey)
+
+	if !ok {
+		return
+	}
+
+	span, ok := value.(trace.Span)
+
+	if !ok {
+		return
+	}
+
+	defer span.End()
+
+	sql := db.Statement.SQL.String()
+
+	attrs := []attribute.KeyValue{
+		semconv.DBQueryText(sql),
+		attribute.Int64("db.rows_affected", db.Statement.RowsAffected),
+	}
+
+	if op, _, _ := strings.Cut(strings.TrimSpace(sql), " "); op != "" {
+		attrs = append(attrs, semconv.DBOperationName(strings.ToUpper(op)))
+	}
+
+	if db.Statement.Table != "" {
+		attrs = append(attrs, semconv.DBCollectionName(db.Statement.Table))
+	}
+
+	span.SetAttributes(attrs...)
+
+	// A missing row is an answer, not a failure
+
+	if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(db.Error)
+		span.SetStatus(codes.Error, db.Error.Error())
+	}
+}
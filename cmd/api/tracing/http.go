@@ -0,0 +1,29 @@
+package tracing
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+)
+
+// Transport starts a client span for every request sent through base and
+// passes the trace context on in the request headers. service names the
+// remote end in the span name, e.g. "dodo POST".
+func Transport(service string, base http.RoundTripper) http.RoundTripper {
+
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return otelhttp.NewTransport(base,
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return service + " " + r.Method
+		}),
+	)
+}
+
+// Handler continues the trace of every incoming request that carries one and
+// starts a server span named operation
+func Handler(h http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(h, operation)
+}
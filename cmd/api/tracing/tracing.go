@@ -0,0 +1,138 @@
+// Package tracing sets up OpenTelemetry tracing of the payment service. Spans
+// are started for incoming gRPC calls, calls to the movie DB service, database
+// queries and calls to the payment provider, and are exported over OTLP or to
+// stdout. The W3C trace context is propagated to and from other services.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc/filters"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.30.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+)
+
+// ServiceName names the service in exported spans, OTEL_SERVICE_NAME overrides it
+const ServiceName = "payment_service"
+
+// InstrumentationName names the tracer of the spans started by this package
+const InstrumentationName = "github.com/kartik7120/booking_payment_service/cmd/api/tracing"
+
+// IdempotentKey is the span attribute holding the idempotent key of a booking,
+// it ties together every call made for one booking
+var IdempotentKey = attribute.Key("booking.idempotent_key")
+
+// Setup installs the global propagator and, unless tracing is disabled, a
+// tracer provider exporting as configured. The returned function flushes the
+// spans still buffered and must be called on shutdown.
+func Setup(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+
+	// The trace context is passed on even when this service records nothing,
+	// so traces started upstream continue in the movie DB service
+
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var exporter sdktrace.SpanExporter
+
+	switch cfg.TracingExporter {
+	case config.TracingOTLP:
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.OTLPEndpoint)}
+
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+
+		otlp, err := otlptracegrpc.New(ctx, opts...)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+		}
+
+		exporter = otlp
+	case config.TracingStdout:
+		stdout, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout exporter: %w", err)
+		}
+
+		exporter = stdout
+	default:
+		return func(context.Context) error { return nil }, nil
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(
+			semconv.ServiceName(ServiceName),
+			semconv.DeploymentEnvironmentName(cfg.Env),
+		),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+	)
+
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("failed to describe the service for tracing: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.TraceSampleRatio))),
+	)
+
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// SetIdempotentKey records key on the span of ctx
+func SetIdempotentKey(ctx context.Context, key string) {
+
+	if key == "" {
+		return
+	}
+
+	trace.SpanFromContext(ctx).SetAttributes(IdempotentKey.String(key))
+}
+
+// UnaryServerInterceptor records the idempotent key of every request that has
+// one on the span of the call. The span is started by the otelgrpc stats
+// handler, so the interceptor may go anywhere in the chain.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+
+		if r, ok := req.(interface{ GetIdempotentKey() string }); ok {
+			SetIdempotentKey(ctx, r.GetIdempotentKey())
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// ServerHandler starts a server span for every incoming RPC, continuing the
+// trace of the caller. Health checks are left out, load balancers call them
+// every few seconds.
+func ServerHandler() stats.Handler {
+	return otelgrpc.NewServerHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))
+}
+
+// ClientHandler starts a client span for every outgoing RPC and passes the
+// trace context on to the called service, health checks are left out
+func ClientHandler() stats.Handler {
+	return otelgrpc.NewClientHandler(otelgrpc.WithFilter(filters.Not(filters.HealthCheck())))
+}
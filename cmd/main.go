@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 
 	"github.com/joho/godotenv"
+	"github.com/kartik7120/booking_payment_service/cmd/api/auth"
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/logging"
+	"github.com/kartik7120/booking_payment_service/cmd/api/metrics"
+	"github.com/kartik7120/booking_payment_service/cmd/api/migrations"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tlsconfig"
+	"github.com/kartik7120/booking_payment_service/cmd/api/tracing"
 	log "github.com/sirupsen/logrus"
 	"google.golang.org/grpc"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 
 	payment_service "github.com/kartik7120/booking_payment_service/cmd/api/grpcServer"
 	"github.com/kartik7120/booking_payment_service/cmd/api/server"
@@ -16,6 +30,14 @@ import (
 
 func main() {
 
+	// JSON with personal data masked until the configuration says otherwise
+
+	if err := logging.Setup(log.StandardLogger(), config.LogFormatJSON, "info"); err != nil {
+		log.Fatal("Failed to set up logging: ", err)
+	}
+
+	log.SetReportCaller(true)
+
 	err := godotenv.Load()
 
 	if err != nil {
@@ -23,54 +45,295 @@ func main() {
 		// panic(err)
 	}
 
-	log.SetOutput(os.Stdout)
-	// log.SetFormatter(&log.JSONFormatter{})
-	log.SetReportCaller(true)
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:]); err != nil {
+			log.Error("Migration failed: ", err)
+			os.Exit(1)
+		}
+		return
+	}
 
-	lis, err := net.Listen("tcp", ":1104")
+	if err := run(os.Args[1:]); err != nil {
+		log.Error("Payment Service failed: ", err)
+		os.Exit(1)
+	}
+
+	log.Info("Payment Service has stopped")
+}
+
+// run starts the servers and blocks until a shutdown signal arrives or a server fails
+func run(args []string) error {
+
+	cfg, err := config.Load(args)
 
 	if err != nil {
-		log.Error("Error starting the server")
-		panic(err)
+		return fmt.Errorf("invalid configuration: %w", err)
 	}
 
-	signalChan := make(chan os.Signal, 1)
+	if err := logging.Setup(log.StandardLogger(), cfg.LogFormat, cfg.LogLevel); err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
 
-	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+	log.Info("Loaded configuration: ", cfg)
+
+	// Tracing comes first so the clients built below pick up the tracer provider
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to set up tracing: %w", err)
+	}
+
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if err := shutdownTracing(ctx); err != nil {
+			log.Error("Failed to flush spans: ", err)
+		}
+	}()
+
+	if cfg.TracingExporter != config.TracingNone {
+		log.Infof("Tracing is enabled, spans are exported to %s", cfg.TracingExporter)
+	}
+
+	paymentServer, err := server.NewPaymentServer(cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to create payment server: %w", err)
+	}
+
+	// Refuse to run against a schema the code does not match
+
+	sqlDB, err := paymentServer.Ps.DB.DB()
+
+	if err != nil {
+		return fmt.Errorf("failed to get database handle: %w", err)
+	}
+
+	schema, err := migrations.Check(sqlDB)
+
+	if err != nil {
+		return err
+	}
+
+	log.Info("Database schema is at ", schema)
+
+	// Dodo Payments webhooks are received over plain HTTP next to the gRPC server
+
+	webhookServer, err := server.NewWebhookServer(paymentServer.Ps, cfg.DodoWebhookSecret.Reveal())
+
+	if err != nil {
+		return fmt.Errorf("failed to create webhook server: %w", err)
+	}
+
+	sweeper, err := server.NewExpirySweeper(paymentServer.Ps, cfg.SessionSweepInterval, cfg.SessionSweepBatchSize)
+
+	if err != nil {
+		return fmt.Errorf("failed to create session expiry sweeper: %w", err)
+	}
+
+	// Load balancers route calls only while the database, the movie DB service
+	// and the payment gateway are ready
+
+	healthChecker, err := server.NewHealthChecker(paymentServer.Ps, paymentServer.ReadinessChecks(), cfg.HealthCheckInterval)
+
+	if err != nil {
+		return fmt.Errorf("failed to create health checker: %w", err)
+	}
+
+	// Metrics are served on their own address, the webhook receiver is public
+
+	var metricsServer *http.Server
+
+	if cfg.MetricsAddr != "" {
+		if err := metrics.Register(server.NewStateCollector(paymentServer.Ps)); err != nil {
+			return fmt.Errorf("failed to register metrics: %w", err)
+		}
+
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", metrics.Handler())
+
+		metricsServer = &http.Server{
+			Addr:              cfg.MetricsAddr,
+			Handler:           metricsMux,
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+
+		log.Infof("Metrics are served on %s/metrics", cfg.MetricsAddr)
+	}
+
+	// The gRPC server runs over TLS when a certificate is configured
 
 	var opts []grpc.ServerOption
 
+	creds, err := tlsconfig.ServerCredentials(cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to set up TLS: %w", err)
+	}
+
+	if creds != nil {
+		opts = append(opts, grpc.Creds(creds))
+		log.Infof("gRPC server uses TLS, client certificates: %s", cfg.TLSClientAuth)
+	} else {
+		log.Warn("TLS is disabled, the gRPC server runs in plaintext")
+	}
+
+	// Every RPC is counted, traced and logged, calls rejected by authentication included
+
+	opts = append(opts,
+		grpc.StatsHandler(tracing.ServerHandler()),
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			tracing.UnaryServerInterceptor(),
+			logging.UnaryServerInterceptor(log.StandardLogger()),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			logging.StreamServerInterceptor(log.StandardLogger()),
+		),
+	)
+
+	// Calling services authenticate with a bearer token or a client certificate
+
+	authenticator, err := auth.NewAuthenticator(cfg)
+
+	if err != nil {
+		return fmt.Errorf("failed to set up authentication: %w", err)
+	}
+
+	if authenticator != nil {
+		opts = append(opts,
+			grpc.ChainUnaryInterceptor(authenticator.UnaryServerInterceptor()),
+			grpc.ChainStreamInterceptor(authenticator.StreamServerInterceptor()),
+		)
+	} else {
+		log.Warn("Authentication is disabled, any caller may use the PaymentService API")
+	}
+
+	lis, err := net.Listen("tcp", cfg.GRPCAddr)
+
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", cfg.GRPCAddr, err)
+	}
+
+	signalChan := make(chan os.Signal, 1)
+
+	signal.Notify(signalChan, os.Interrupt, syscall.SIGTERM, syscall.SIGINT)
+
 	grpcServer := grpc.NewServer(opts...)
 
 	// Register the service here
 
-	paymentServer := server.NewPaymentServer()
-
 	payment_service.RegisterPaymentServiceServer(grpcServer, paymentServer)
+	healthpb.RegisterHealthServer(grpcServer, healthChecker.Health)
+
+	if cfg.GRPCReflection {
+		reflection.Register(grpcServer)
+		log.Info("gRPC server reflection is enabled")
+	}
 
-	log.Info("Payment Service is running on port 1104")
+	log.Infof("Payment Service is running on %s", cfg.GRPCAddr)
+
+	// Unpaid sessions are expired in the background until shutdown
+
+	sweeperCtx, stopSweeper := context.WithCancel(context.Background())
+	sweeperDone := make(chan struct{})
+
+	go func() {
+		defer close(sweeperDone)
+		sweeper.Run(sweeperCtx)
+	}()
+
+	healthCtx, stopHealthChecker := context.WithCancel(context.Background())
+	defer stopHealthChecker()
+
+	go healthChecker.Run(healthCtx)
+
+	mux := http.NewServeMux()
+	mux.Handle("/webhooks/dodopayments", tracing.Handler(logging.Handler(log.StandardLogger(), webhookServer), "webhook dodopayments"))
+	mux.Handle(server.PaymentReturnPath, tracing.Handler(logging.Handler(log.StandardLogger(), &server.ReturnHandler{Ps: paymentServer.Ps}), "payment return"))
+
+	httpServer := &http.Server{
+		Addr:              cfg.HTTPAddr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Infof("Webhook receiver and payment return handler are running on %s", cfg.HTTPAddr)
+
+	serveErr := make(chan error, 3)
 
 	go func() {
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Error("Failed to start gRPC server: ", err)
-			os.Exit(1)
+			serveErr <- fmt.Errorf("gRPC server failed: %w", err)
+		}
+	}()
+
+	go func() {
+		if err := httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serveErr <- fmt.Errorf("webhook server failed: %w", err)
 		}
 	}()
 
-	<-signalChan
+	if metricsServer != nil {
+		go func() {
+			if err := metricsServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				serveErr <- fmt.Errorf("metrics server failed: %w", err)
+			}
+		}()
+	}
+
+	var failure error
+
+	select {
+	case <-signalChan:
+		log.Info("Received shutdown signal, stopping server...")
+	case failure = <-serveErr:
+		log.Error("Stopping server: ", failure)
+	}
+
+	// Report NOT_SERVING first and keep serving for a while, so load balancers
+	// stop routing before the server stops accepting calls. A second signal
+	// skips the wait.
+
+	healthChecker.Drain()
+	stopHealthChecker()
+
+	if failure == nil && cfg.DrainDelay > 0 {
+		log.Infof("Waiting %s for load balancers to stop routing", cfg.DrainDelay)
+
+		select {
+		case <-time.After(cfg.DrainDelay):
+		case <-signalChan:
+			log.Info("Received second shutdown signal, stopping now")
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-	log.Info("Received shutdown signal, stopping server...")
+	if err := httpServer.Shutdown(ctx); err != nil {
+		log.Error("Failed to stop webhook server: ", err)
+	}
 
 	grpcServer.GracefulStop()
 
+	if metricsServer != nil {
+		if err := metricsServer.Shutdown(ctx); err != nil {
+			log.Error("Failed to stop metrics server: ", err)
+		}
+	}
+
+	stopSweeper()
+	<-sweeperDone
+
 	log.Info("Server stopped gracefully")
 
-	if err := lis.Close(); err != nil {
+	if err := lis.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
 		log.Error("Failed to close listener: ", err)
-	} else {
-		log.Info("Listener closed successfully")
 	}
 
-	log.Info("Payment Service has stopped")
-
+	return failure
 }
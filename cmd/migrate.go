@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kartik7120/booking_payment_service/cmd/api/config"
+	"github.com/kartik7120/booking_payment_service/cmd/api/migrations"
+	_ "github.com/lib/pq"
+	log "github.com/sirupsen/logrus"
+)
+
+const migrateUsage = "usage: migrate up|down [steps]|status [config flags]"
+
+// runMigrate applies, rolls back or reports the embedded schema migrations.
+// down rolls back a single migration unless a number of steps is given.
+func runMigrate(args []string) error {
+
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	action, rest := args[0], args[1:]
+
+	steps := 1
+
+	if action == "down" && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		n, err := strconv.Atoi(rest[0])
+
+		if err != nil {
+			return fmt.Errorf("invalid number of steps %q: %s", rest[0], migrateUsage)
+		}
+
+		steps, rest = n, rest[1:]
+	}
+
+	switch action {
+	case "up", "down", "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q: %s", action, migrateUsage)
+	}
+
+	cfg, err := config.Load(rest)
+
+	if err != nil {
+		return fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	db, err := sql.Open("postgres", cfg.DatabaseURL.Reveal())
+
+	if err != nil {
+		return fmt.Errorf("failed to open the database: %w", err)
+	}
+
+	migrator, err := migrations.New(db)
+
+	if err != nil {
+		db.Close()
+		return err
+	}
+
+	defer func() {
+		if err := migrator.Close(); err != nil {
+			log.Error("Failed to close migrator: ", err)
+		}
+	}()
+
+	switch action {
+	case "up":
+		err = migrator.Up()
+	case "down":
+		err = migrator.Down(steps)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	status, err := migrator.Status()
+
+	if err != nil {
+		return err
+	}
+
+	log.Info("Database schema is at ", status)
+
+	if len(status.Pending) > 0 {
+		log.Infof("Pending migrations: %v", status.Pending)
+	}
+
+	return nil
+}